@@ -1,7 +1,12 @@
 package main
 
 import (
+	"context"
 	"log"
+	"net"
+	"net/http"
+	"os"
+	"time"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
@@ -11,46 +16,129 @@ import (
 	"github.com/stewicca/angagrar-backend/internal/middleware"
 	"github.com/stewicca/angagrar-backend/internal/repositories"
 	"github.com/stewicca/angagrar-backend/internal/services"
+	"github.com/stewicca/angagrar-backend/pkg/utils"
 )
 
 func main() {
 	cfg := config.LoadConfig()
 
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err := runMigrate(cfg, os.Args[2:]); err != nil {
+			log.Fatalf("migrate: %v", err)
+		}
+		return
+	}
+
+	if err := cfg.Validate(); err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
+
+	keyring, err := utils.LoadKeyring(cfg.JWTSigningKeyID, cfg.JWTKeys, cfg.JWTSecret)
+	if err != nil {
+		log.Fatalf("Failed to load JWT keys: %v", err)
+	}
+
 	if err := database.Connect(cfg); err != nil {
 		log.Fatalf("Failed to connect to database: %v", err)
 	}
 
-	if err := database.AutoMigrate(); err != nil {
-		log.Fatalf("Failed to run migrations: %v", err)
+	if err := database.PrepareSchema(cfg.DBMigrate); err != nil {
+		log.Fatalf("Failed to prepare database schema: %v", err)
 	}
 
 	db := database.GetDB()
 
 	// Initialize repositories
 	userRepo := repositories.NewUserRepository(db)
+	refreshTokenRepo := repositories.NewRefreshTokenRepository(db)
+	revokedTokenRepo := repositories.NewRevokedTokenRepository(db)
 	transactionRepo := repositories.NewTransactionRepository(db)
 	budgetRepo := repositories.NewBudgetRepository(db)
 	conversationRepo := repositories.NewConversationRepository(db)
+	profileRepo := repositories.NewFinancialProfileRepository(db)
 	messageRepo := repositories.NewMessageRepository(db)
+	cityCostRepo := repositories.NewCityCostRepository(db)
+	llmUsageRepo := repositories.NewLLMUsageRepository(db)
+	unitOfWork := repositories.NewUnitOfWork(db)
+
+	location, err := time.LoadLocation(cfg.DBTimeZone)
+	if err != nil {
+		log.Fatalf("Invalid DB_TIMEZONE: %v", err)
+	}
+	budgetCalendar, err := services.NewBudgetCalendar(location, cfg.PublicHolidays)
+	if err != nil {
+		log.Fatalf("Invalid PUBLIC_HOLIDAYS: %v", err)
+	}
 
 	// Initialize services
-	authService := services.NewAuthService(userRepo, cfg.JWTSecret)
-	userService := services.NewUserService(userRepo)
-	transactionService := services.NewTransactionService(transactionRepo)
-	openAIService := services.NewOpenAIService(cfg)
+	authService := services.NewAuthService(
+		userRepo,
+		refreshTokenRepo,
+		revokedTokenRepo,
+		keyring,
+		cfg.AccessTokenTTL,
+		cfg.RefreshTokenTTL,
+	)
+	costOfLivingService := services.NewCostOfLivingService(cityCostRepo)
+	cityCostSeed, err := services.LoadCityCostSeed(cfg.CityCostSeedFile)
+	if err != nil {
+		log.Fatalf("Failed to load cost-of-living seed: %v", err)
+	}
+	synced, err := costOfLivingService.SyncSeed(context.Background(), cityCostSeed)
+	if err != nil {
+		log.Fatalf("Failed to seed cost of living: %v", err)
+	}
+	log.Printf("Cost-of-living seed v%d applied, %d rows updated", cityCostSeed.Version, synced)
+
+	userService := services.NewUserService(userRepo, profileRepo, budgetCalendar)
+	transactionService := services.NewTransactionService(transactionRepo, budgetRepo, cfg.BudgetCategoryAliases)
+	budgetService := services.NewBudgetService(budgetRepo, transactionRepo, userRepo, profileRepo, budgetCalendar, costOfLivingService)
+	llmService, err := services.NewLLMService(cfg)
+	if err != nil {
+		log.Fatalf("Failed to set up LLM provider: %v", err)
+	}
+	llmQuotas, err := services.ParseUsageQuotas(cfg.LLMQuotas)
+	if err != nil {
+		log.Fatalf("Invalid LLM_QUOTAS: %v", err)
+	}
+	llmPrices, err := services.ParseLLMPrices(cfg.LLMPrices)
+	if err != nil {
+		log.Fatalf("Invalid LLM_PRICES: %v", err)
+	}
+	usageService := services.NewUsageService(llmUsageRepo, userRepo, llmQuotas, llmPrices, services.LLMModel(cfg))
 	conversationService := services.NewConversationService(
 		conversationRepo,
 		messageRepo,
 		budgetRepo,
-		openAIService,
+		userRepo,
+		profileRepo,
+		unitOfWork,
+		budgetCalendar,
+		costOfLivingService,
+		services.NewContextWindow(services.NewTokenCounter(services.LLMModel(cfg)), cfg.LLMContextTokens, cfg.LLMContextRecentMessages),
+		usageService,
+		llmService,
 	)
 
+	revokedTokenCleanup := services.NewRevokedTokenCleanup(authService)
+	revokedTokenCleanup.Start()
+
+	var renewalScheduler *services.BudgetRenewalScheduler
+	if cfg.BudgetRenewalEnabled {
+		renewalScheduler = services.NewBudgetRenewalScheduler(budgetService, location)
+		renewalScheduler.Start()
+	}
+
 	// Initialize handlers
 	authHandler := handlers.NewAuthHandler(authService)
 	userHandler := handlers.NewUserHandler(userService)
 	transactionHandler := handlers.NewTransactionHandler(transactionService)
-	budgetHandler := handlers.NewBudgetHandler(budgetRepo)
-	conversationHandler := handlers.NewConversationHandler(conversationService)
+	budgetHandler := handlers.NewBudgetHandler(budgetService)
+	conversationHandler := handlers.NewConversationHandler(conversationService, cfg.HTTPStreamTimeout)
+	costOfLivingHandler := handlers.NewCostOfLivingHandler(costOfLivingService)
+	usageHandler := handlers.NewUsageHandler(usageService)
+
+	authMiddleware := middleware.AuthMiddleware(keyring, authService)
 
 	r := gin.Default()
 
@@ -61,7 +149,7 @@ func main() {
 	r.Use(cors.New(cors.Config{
 		AllowOrigins:     []string{"*"},
 		AllowMethods:     []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
-		AllowHeaders:     []string{"Origin", "Content-Type", "Authorization"},
+		AllowHeaders:     []string{"Origin", "Content-Type", "Authorization", "X-Admin-Key"},
 		ExposeHeaders:    []string{"Content-Length"},
 		AllowCredentials: true,
 	}))
@@ -73,45 +161,104 @@ func main() {
 		})
 	})
 
+	r.GET("/.well-known/jwks.json", authHandler.JWKS)
+
 	api := r.Group("/api/v1")
 	{
 		auth := api.Group("/auth")
 		{
 			auth.POST("/guest", authHandler.CreateGuest)
+			auth.POST("/login", authHandler.Login)
+			auth.POST("/refresh", authHandler.Refresh)
+			auth.POST("/register", authMiddleware, authHandler.Register)
+			auth.POST("/logout", authMiddleware, authHandler.Logout)
 		}
 
 		users := api.Group("/users")
-		users.Use(middleware.AuthMiddleware(cfg.JWTSecret))
+		users.Use(authMiddleware)
 		{
 			users.GET("/profile", userHandler.GetProfile)
+			users.GET("/profile/pay-cycle", userHandler.GetPayCycle)
+			users.PATCH("/profile/pay-cycle", userHandler.UpdatePayCycle)
+			users.GET("/profile/financial", userHandler.GetFinancialProfile)
+			users.PATCH("/profile/financial", userHandler.UpdateFinancialProfile)
 		}
 
 		transactions := api.Group("/transactions")
-		transactions.Use(middleware.AuthMiddleware(cfg.JWTSecret))
+		transactions.Use(authMiddleware)
 		{
 			transactions.POST("", transactionHandler.CreateTransaction)
 			transactions.GET("", transactionHandler.GetTransactions)
+			transactions.GET("/:id", transactionHandler.GetTransaction)
+			transactions.PUT("/:id", transactionHandler.ReplaceTransaction)
+			transactions.PATCH("/:id", transactionHandler.UpdateTransaction)
+			transactions.DELETE("/:id", transactionHandler.DeleteTransaction)
 		}
 
 		conversations := api.Group("/conversations")
-		conversations.Use(middleware.AuthMiddleware(cfg.JWTSecret))
+		conversations.Use(authMiddleware)
 		{
+			conversations.GET("", conversationHandler.ListConversations)
 			conversations.POST("/start", conversationHandler.StartConversation)
 			conversations.POST("/:sessionId/messages", conversationHandler.SendMessage)
+			conversations.POST("/:sessionId/messages/stream", conversationHandler.StreamMessage)
 			conversations.GET("/:sessionId/history", conversationHandler.GetConversationHistory)
 			conversations.POST("/:sessionId/reset", conversationHandler.ResetConversation)
+			conversations.POST("/:sessionId/archive", conversationHandler.ArchiveConversation)
+			conversations.POST("/:sessionId/unarchive", conversationHandler.UnarchiveConversation)
 		}
 
 		budgets := api.Group("/budgets")
-		budgets.Use(middleware.AuthMiddleware(cfg.JWTSecret))
+		budgets.Use(authMiddleware)
 		{
 			budgets.GET("", budgetHandler.GetUserBudgets)
+			budgets.POST("", budgetHandler.CreateBudget)
+			budgets.POST("/generate", budgetHandler.GenerateBudget)
+			budgets.GET("/progress", budgetHandler.GetBudgetProgress)
 			budgets.PATCH("/:id", budgetHandler.UpdateBudget)
 		}
+
+		if cfg.AdminAPIKey != "" {
+			admin := api.Group("/admin")
+			admin.Use(middleware.AdminMiddleware(cfg.AdminAPIKey))
+			{
+				admin.GET("/city-costs", costOfLivingHandler.ListCityCosts)
+				admin.PUT("/city-costs/:city/:lifestyle", costOfLivingHandler.SetCityCost)
+				admin.DELETE("/city-costs/:city/:lifestyle", costOfLivingHandler.DeleteCityCost)
+				admin.GET("/llm-usage", usageHandler.GetDailySpend)
+				admin.PUT("/users/:id/tier", usageHandler.SetUserTier)
+			}
+		}
 	}
 
-	log.Printf("Server starting on port %s", cfg.AppPort)
-	if err := r.Run(":" + cfg.AppPort); err != nil {
+	srv := &http.Server{
+		Addr:              ":" + cfg.AppPort,
+		Handler:           r,
+		ReadTimeout:       cfg.HTTPReadTimeout,
+		ReadHeaderTimeout: cfg.HTTPReadHeaderTimeout,
+		WriteTimeout:      cfg.HTTPWriteTimeout,
+		IdleTimeout:       cfg.HTTPIdleTimeout,
+		MaxHeaderBytes:    cfg.HTTPMaxHeaderBytes,
+	}
+
+	ln, err := net.Listen("tcp", srv.Addr)
+	if err != nil {
 		log.Fatalf("Failed to start server: %v", err)
 	}
+
+	log.Printf("Server starting on port %s", cfg.AppPort)
+	if err := serve(srv, ln, cfg.ShutdownTimeout); err != nil {
+		log.Fatalf("Server failed: %v", err)
+	}
+
+	// Background workers and the pool go last, after the requests using them
+	revokedTokenCleanup.Stop()
+	if renewalScheduler != nil {
+		renewalScheduler.Stop()
+	}
+	if err := database.Close(); err != nil {
+		log.Printf("Failed to close database: %v", err)
+	}
+
+	log.Println("Server stopped")
 }
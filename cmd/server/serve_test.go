@@ -0,0 +1,131 @@
+package main
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// startServe runs serve with handler on a free port and returns its address
+// and the error serve returns
+func startServe(t *testing.T, handler http.Handler, timeout time.Duration) (string, <-chan error) {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+
+	served := make(chan error, 1)
+	go func() {
+		served <- serve(&http.Server{Handler: handler}, ln, timeout)
+	}()
+
+	return ln.Addr().String(), served
+}
+
+func sigterm(t *testing.T) {
+	t.Helper()
+
+	if err := syscall.Kill(syscall.Getpid(), syscall.SIGTERM); err != nil {
+		t.Fatalf("SIGTERM: %v", err)
+	}
+}
+
+func waitServe(t *testing.T, served <-chan error) {
+	t.Helper()
+
+	select {
+	case err := <-served:
+		if err != nil {
+			t.Fatalf("serve: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("serve did not return after SIGTERM")
+	}
+}
+
+func TestServeDrainsInFlightRequestsOnSIGTERM(t *testing.T) {
+	entered := make(chan struct{})
+	release := make(chan struct{})
+	addr, served := startServe(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(entered)
+		<-release
+		io.WriteString(w, "done")
+	}), 5*time.Second)
+
+	type result struct {
+		body string
+		err  error
+	}
+	replied := make(chan result, 1)
+	go func() {
+		resp, err := http.Get("http://" + addr)
+		if err != nil {
+			replied <- result{err: err}
+			return
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		replied <- result{string(body), err}
+	}()
+
+	<-entered
+	sigterm(t)
+
+	// New connections are refused while the request is still running
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		conn, err := net.Dial("tcp", addr)
+		if err != nil {
+			break
+		}
+		conn.Close()
+		if time.Now().After(deadline) {
+			t.Fatal("server kept accepting connections after SIGTERM")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	close(release)
+	got := <-replied
+	if got.err != nil || got.body != "done" {
+		t.Fatalf("expected the in-flight request to finish, got %q, %v", got.body, got.err)
+	}
+	waitServe(t, served)
+}
+
+func TestServeClosesRequestsAfterShutdownTimeout(t *testing.T) {
+	entered := make(chan struct{})
+	canceled := make(chan struct{})
+	addr, served := startServe(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(entered)
+		<-r.Context().Done()
+		close(canceled)
+	}), 100*time.Millisecond)
+
+	failed := make(chan error, 1)
+	go func() {
+		resp, err := http.Get("http://" + addr)
+		if err == nil {
+			resp.Body.Close()
+		}
+		failed <- err
+	}()
+
+	<-entered
+	sigterm(t)
+	waitServe(t, served)
+
+	select {
+	case <-canceled:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the request context was not canceled after the shutdown timeout")
+	}
+	if err := <-failed; err == nil {
+		t.Error("expected the cut off request to fail")
+	}
+}
@@ -1,32 +1,100 @@
 package config
 
 import (
+	"errors"
 	"fmt"
 	"log"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
+	"github.com/stewicca/angagrar-backend/pkg/utils"
 )
 
+// defaultBudgetCategoryAliases maps common transaction categories onto the
+// six budget categories Aira generates
+const defaultBudgetCategoryAliases = "food:Makan,jajan:Makan,kopi:Makan,groceries:Makan,belanja dapur:Makan," +
+	"ojek:Transport,ojol:Transport,bensin:Transport,parkir:Transport,transportasi:Transport," +
+	"sewa:Kewajiban,kos:Kewajiban,kost:Kewajiban,listrik:Kewajiban,internet:Kewajiban,cicilan:Kewajiban,tagihan:Kewajiban," +
+	"hiburan:Healing,nonton:Healing,liburan:Healing,hobi:Healing," +
+	"nabung:Tabungan,investasi:Tabungan,savings:Tabungan," +
+	"lainnya:Lain-lain,lain:Lain-lain,other:Lain-lain"
+
+// defaultLLMQuotas are "daily/monthly" token limits per user tier, 0 for no
+// limit
+const defaultLLMQuotas = "guest:30000/300000,registered:150000/2000000,premium:0/0"
+
+// defaultLLMPrices are "input/output" USD per million tokens by model name
+// prefix, the longest matching prefix wins
+const defaultLLMPrices = "gpt-4o-mini:0.15/0.6,gpt-4o:2.5/10,gpt-4.1-nano:0.1/0.4,gpt-4.1-mini:0.4/1.6,gpt-4.1:2/8," +
+	"claude-3-haiku:0.25/1.25,claude-3-5-haiku:0.8/4,claude-3-5-sonnet:3/15,claude-3-7-sonnet:3/15,claude-sonnet-4:3/15"
+
 type Config struct {
 	// Database
+	DBDriver   string // postgres or sqlite
 	DBHost     string
 	DBPort     string
 	DBUser     string
 	DBPassword string
 	DBName     string
+	DBSSLMode  string
+	DBTimeZone string // session time zone on Postgres, budget periods follow it too
+	DBPath     string // SQLite file, or :memory: for a throwaway database
+	DBMigrate  string // check refuses to start with pending migrations, auto applies them
 
 	// Application
 	AppPort string
 
+	// HTTP server
+	HTTPReadTimeout       time.Duration
+	HTTPReadHeaderTimeout time.Duration
+	HTTPWriteTimeout      time.Duration // covers a whole reply, keep it above the LLM timeouts
+	HTTPStreamTimeout     time.Duration // replaces HTTPWriteTimeout for streamed replies, 0 for no limit
+	HTTPIdleTimeout       time.Duration
+	HTTPMaxHeaderBytes    int
+	ShutdownTimeout       time.Duration // how long in-flight requests get to finish on SIGTERM
+
 	// JWT
-	JWTSecret string
+	JWTSecret       string   // HS256 key, also verifies tokens issued without a kid
+	JWTSigningKeyID string   // kid new tokens are signed with
+	JWTKeys         []string // "kid:alg:path" entries, alg is HS256, RS256 or EdDSA
+	AccessTokenTTL  time.Duration
+	RefreshTokenTTL time.Duration
+
+	// Budgets
+	BudgetCategoryAliases map[string]string // lowercase transaction category -> budget category
+	BudgetRenewalEnabled  bool
+	PublicHolidays        []string // YYYY-MM-DD, paydays are moved off these days
+	CityCostSeedFile      string   // cost-of-living seed, built-in seed when empty
+
+	// Admin API, disabled when the key is empty
+	AdminAPIKey string
 
-	// OpenAI
-	OpenAIAPIKey    string
-	OpenAIModel     string
-	OpenAIMaxTokens int
-	OpenAITemp      float32
+	// LLM
+	LLMProvider    string // openai, openai_compatible, anthropic or scripted
+	LLMMaxTokens   int
+	LLMTemperature float32
+	LLMScriptFile  string // replies for the scripted provider, built-in script when empty
+
+	// Conversation history sent to the LLM per request
+	LLMContextTokens         int // prompt token budget, 0 for no limit
+	LLMContextRecentMessages int // latest messages never summarized
+
+	// LLM usage metering
+	LLMQuotas map[string]string // tier -> "daily/monthly" tokens
+	LLMPrices map[string]string // model prefix -> "input/output" USD per 1M tokens
+
+	// OpenAI, also used for OpenAI-compatible servers such as Ollama or llama.cpp
+	OpenAIAPIKey  string
+	OpenAIModel   string
+	OpenAIBaseURL string
+
+	// Anthropic
+	AnthropicAPIKey  string
+	AnthropicModel   string
+	AnthropicBaseURL string
 }
 
 func LoadConfig() *Config {
@@ -36,24 +104,81 @@ func LoadConfig() *Config {
 
 	return &Config{
 		// Database
+		DBDriver:   getEnv("DB_DRIVER", "postgres"),
 		DBHost:     getEnv("DB_HOST", "localhost"),
 		DBPort:     getEnv("DB_PORT", "5432"),
 		DBUser:     getEnv("DB_USER", "postgres"),
 		DBPassword: getEnv("DB_PASSWORD", "password"),
 		DBName:     getEnv("DB_NAME", "angagrar_db"),
+		DBSSLMode:  getEnv("DB_SSLMODE", "disable"),
+		DBTimeZone: getEnv("DB_TIMEZONE", "Asia/Jakarta"),
+		DBPath:     getEnv("DB_PATH", "angagrar.db"),
+		DBMigrate:  getEnv("DB_MIGRATE", "check"),
 
 		// Application
 		AppPort: getEnv("APP_PORT", "8080"),
 
+		// HTTP server
+		HTTPReadTimeout:       getEnvDuration("HTTP_READ_TIMEOUT", 15*time.Second),
+		HTTPReadHeaderTimeout: getEnvDuration("HTTP_READ_HEADER_TIMEOUT", 5*time.Second),
+		HTTPWriteTimeout:      getEnvDuration("HTTP_WRITE_TIMEOUT", 3*time.Minute),
+		HTTPStreamTimeout:     getEnvDuration("HTTP_STREAM_TIMEOUT", 10*time.Minute),
+		HTTPIdleTimeout:       getEnvDuration("HTTP_IDLE_TIMEOUT", 60*time.Second),
+		HTTPMaxHeaderBytes:    getEnvInt("HTTP_MAX_HEADER_BYTES", 1<<20),
+		ShutdownTimeout:       getEnvDuration("SHUTDOWN_TIMEOUT", 30*time.Second),
+
 		// JWT
-		JWTSecret: getEnv("JWT_SECRET", "3RBN1skwbkcF3jp31mVJOuQ0AW38Ut"),
+		JWTSecret:       getEnv("JWT_SECRET", ""),
+		JWTSigningKeyID: getEnv("JWT_SIGNING_KID", ""),
+		JWTKeys:         getEnvList("JWT_KEYS"),
+		AccessTokenTTL:  getEnvDuration("JWT_ACCESS_TTL", 15*time.Minute),
+		RefreshTokenTTL: getEnvDuration("JWT_REFRESH_TTL", 30*24*time.Hour),
+
+		// Budgets
+		BudgetCategoryAliases: getEnvMap("BUDGET_CATEGORY_ALIASES", defaultBudgetCategoryAliases),
+		BudgetRenewalEnabled:  getEnvBool("BUDGET_RENEWAL_ENABLED", true),
+		PublicHolidays:        getEnvList("PUBLIC_HOLIDAYS"),
+		CityCostSeedFile:      getEnv("CITY_COSTS_SEED_FILE", ""),
+
+		// Admin
+		AdminAPIKey: getEnv("ADMIN_API_KEY", ""),
+
+		// LLM (OPENAI_MAX_TOKENS and OPENAI_TEMPERATURE are the old names)
+		LLMProvider:    getEnv("LLM_PROVIDER", "openai"),
+		LLMMaxTokens:   getEnvInt("LLM_MAX_TOKENS", getEnvInt("OPENAI_MAX_TOKENS", 500)),
+		LLMTemperature: getEnvFloat("LLM_TEMPERATURE", getEnvFloat("OPENAI_TEMPERATURE", 0.7)),
+		LLMScriptFile:  getEnv("LLM_SCRIPT_FILE", ""),
+
+		LLMContextTokens:         getEnvInt("LLM_CONTEXT_TOKENS", 6000),
+		LLMContextRecentMessages: getEnvInt("LLM_CONTEXT_RECENT_MESSAGES", 8),
+
+		LLMQuotas: getEnvMap("LLM_QUOTAS", defaultLLMQuotas),
+		LLMPrices: getEnvMap("LLM_PRICES", defaultLLMPrices),
 
 		// OpenAI
-		OpenAIAPIKey:    getEnv("OPENAI_API_KEY", ""),
-		OpenAIModel:     getEnv("OPENAI_MODEL", "gpt-4o-mini"),
-		OpenAIMaxTokens: getEnvInt("OPENAI_MAX_TOKENS", 500),
-		OpenAITemp:      getEnvFloat("OPENAI_TEMPERATURE", 0.7),
+		OpenAIAPIKey:  getEnv("OPENAI_API_KEY", ""),
+		OpenAIModel:   getEnv("OPENAI_MODEL", "gpt-4o-mini"),
+		OpenAIBaseURL: getEnv("OPENAI_BASE_URL", ""),
+
+		// Anthropic
+		AnthropicAPIKey:  getEnv("ANTHROPIC_API_KEY", ""),
+		AnthropicModel:   getEnv("ANTHROPIC_MODEL", "claude-3-5-haiku-latest"),
+		AnthropicBaseURL: getEnv("ANTHROPIC_BASE_URL", "https://api.anthropic.com"),
+	}
+}
+
+// Validate rejects configurations the server must not start with
+func (c *Config) Validate() error {
+	if c.JWTSecret == "" && len(c.JWTKeys) == 0 {
+		return errors.New("JWT_SECRET or JWT_KEYS must be set")
+	}
+
+	// HS256 keys in JWT_KEYS are files, LoadKeyring checks those
+	if utils.IsInsecureHMACSecret([]byte(c.JWTSecret)) {
+		return errors.New("JWT_SECRET is the public built-in default, generate a new secret")
 	}
+
+	return nil
 }
 
 func getEnv(key, defaultValue string) string {
@@ -64,6 +189,34 @@ func getEnv(key, defaultValue string) string {
 	return defaultValue
 }
 
+func getEnvList(key string) []string {
+	var values []string
+	for _, value := range strings.Split(os.Getenv(key), ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+
+	return values
+}
+
+// getEnvMap parses "key:value" pairs separated by commas. Keys are lowercased.
+func getEnvMap(key, defaultValue string) map[string]string {
+	value := getEnv(key, defaultValue)
+
+	values := make(map[string]string)
+	for _, pair := range strings.Split(value, ",") {
+		k, v, ok := strings.Cut(pair, ":")
+		k, v = strings.ToLower(strings.TrimSpace(k)), strings.TrimSpace(v)
+		if !ok || k == "" || v == "" {
+			continue
+		}
+		values[k] = v
+	}
+
+	return values
+}
+
 func getEnvInt(key string, defaultValue int) int {
 	if value := os.Getenv(key); value != "" {
 		var intValue int
@@ -75,6 +228,16 @@ func getEnvInt(key string, defaultValue int) int {
 	return defaultValue
 }
 
+func getEnvBool(key string, defaultValue bool) bool {
+	if value := os.Getenv(key); value != "" {
+		if boolValue, err := strconv.ParseBool(value); err == nil {
+			return boolValue
+		}
+	}
+
+	return defaultValue
+}
+
 func getEnvFloat(key string, defaultValue float32) float32 {
 	if value := os.Getenv(key); value != "" {
 		var floatValue float32
@@ -85,3 +248,13 @@ func getEnvFloat(key string, defaultValue float32) float32 {
 
 	return defaultValue
 }
+
+func getEnvDuration(key string, defaultValue time.Duration) time.Duration {
+	if value := os.Getenv(key); value != "" {
+		if duration, err := time.ParseDuration(value); err == nil {
+			return duration
+		}
+	}
+
+	return defaultValue
+}
@@ -33,6 +33,10 @@ go mod tidy
 echo "Building images..."
 docker compose build --no-cache
 
+# The server refuses to start on an outdated schema
+echo "Running database migrations..."
+docker compose run --rm angagrar-backend ./main migrate up
+
 echo "Starting containers..."
 docker compose up -d
 
@@ -4,60 +4,109 @@ import (
 	"fmt"
 	"log"
 
+	"github.com/glebarez/sqlite"
 	"github.com/stewicca/angagrar-backend/config"
-	"github.com/stewicca/angagrar-backend/internal/models"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 	"gorm.io/gorm/logger"
 )
 
+// Storage drivers DB_DRIVER accepts
+const (
+	DriverPostgres = "postgres"
+	DriverSQLite   = "sqlite" // local development and tests
+)
+
+// SQLiteMemory is the DB_PATH of a throwaway in-memory SQLite database
+const SQLiteMemory = ":memory:"
+
+// Drivers lists every storage driver, each with its own migrations
+var Drivers = []string{DriverPostgres, DriverSQLite}
+
 var DB *gorm.DB
 
 func Connect(cfg *config.Config) error {
-	dsn := fmt.Sprintf(
-		"host=%s user=%s password=%s dbname=%s port=%s sslmode=disable TimeZone=Asia/Jakarta",
-		cfg.DBHost,
-		cfg.DBUser,
-		cfg.DBPassword,
-		cfg.DBName,
-		cfg.DBPort,
-	)
-
-	var err error
-
-	DB, err = gorm.Open(postgres.Open(dsn), &gorm.Config{
-		Logger: logger.Default.LogMode(logger.Info),
-	})
-
+	db, err := Open(cfg)
 	if err != nil {
-		return fmt.Errorf("failed to connect to database: %w", err)
+		return err
 	}
+	DB = db
 
-	log.Println("Database connection established")
+	log.Printf("Database connection established (%s)", cfg.DBDriver)
 
 	return nil
 }
 
-func AutoMigrate() error {
-	log.Println("Running database migrations...")
+// Open connects to the database cfg.DBDriver selects
+func Open(cfg *config.Config) (*gorm.DB, error) {
+	var dialector gorm.Dialector
+	switch cfg.DBDriver {
+	case DriverPostgres:
+		dialector = postgres.Open(fmt.Sprintf(
+			"host=%s user=%s password=%s dbname=%s port=%s sslmode=%s TimeZone=%s",
+			cfg.DBHost,
+			cfg.DBUser,
+			cfg.DBPassword,
+			cfg.DBName,
+			cfg.DBPort,
+			cfg.DBSSLMode,
+			cfg.DBTimeZone,
+		))
 
-	err := DB.AutoMigrate(
-		&models.User{},
-		&models.Budget{},
-		&models.Transaction{},
-		&models.Conversation{},
-		&models.Message{},
-	)
+	case DriverSQLite:
+		// Foreign keys are off in SQLite unless asked for, and a writer waits
+		// for the lock instead of failing right away. File databases use WAL
+		// so reads never wait for a writer, and transactions take the write
+		// lock when they begin: a deferred one upgrading later fails with
+		// SQLITE_BUSY without waiting for busy_timeout.
+		dsn := cfg.DBPath + "?_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)"
+		if cfg.DBPath != SQLiteMemory {
+			dsn += "&_pragma=journal_mode(WAL)&_txlock=immediate"
+		}
+		dialector = sqlite.Open(dsn)
 
+	default:
+		return nil, fmt.Errorf("unknown DB_DRIVER %q, use %s or %s", cfg.DBDriver, DriverPostgres, DriverSQLite)
+	}
+
+	db, err := gorm.Open(dialector, &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Info),
+		// Report unique violations as gorm.ErrDuplicatedKey on every driver
+		TranslateError: true,
+	})
 	if err != nil {
-		return fmt.Errorf("failed to run migrations: %w", err)
+		return nil, fmt.Errorf("failed to connect to database: %w", err)
 	}
 
-	log.Println("Database migrations completed")
+	// Every new connection to :memory: would open another empty database, so
+	// the pool keeps one connection open for good. A repository call on db
+	// inside UnitOfWork.Do then waits for that connection forever.
+	if cfg.DBDriver == DriverSQLite && cfg.DBPath == SQLiteMemory {
+		sqlDB, err := db.DB()
+		if err != nil {
+			return nil, err
+		}
+		sqlDB.SetMaxOpenConns(1)
+	}
 
-	return nil
+	return db, nil
 }
 
 func GetDB() *gorm.DB {
 	return DB
 }
+
+// Close closes the connection pool. Queries already running are allowed to
+// finish, new ones fail.
+func Close() error {
+	if DB == nil {
+		return nil
+	}
+
+	sqlDB, err := DB.DB()
+	if err != nil {
+		return err
+	}
+
+	return sqlDB.Close()
+}
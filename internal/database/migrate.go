@@ -0,0 +1,413 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// How the server treats pending migrations on startup
+const (
+	MigrateModeCheck = "check" // refuse to start, run `migrate up` first
+	MigrateModeAuto  = "auto"  // apply them
+)
+
+// MigrationsDir is where `migrate create` writes new migrations, relative to
+// the repository root. Every driver has its own subdirectory with the same
+// versions.
+const MigrationsDir = "internal/database/migrations"
+
+// migrationLockKey is the Postgres advisory lock held while migrating, so
+// replicas starting together migrate one after the other
+const migrationLockKey int64 = 0x616e676167726172 // "angagrar"
+
+//go:embed migrations/*/*.sql
+var migrationFiles embed.FS
+
+var (
+	migrationFileName  = regexp.MustCompile(`^(\d+)_([a-z0-9_]+)\.(up|down)\.sql$`)
+	migrationNameChars = regexp.MustCompile(`[^a-z0-9]+`)
+)
+
+// ErrSchemaOutdated is returned on startup when migrations are pending
+var ErrSchemaOutdated = errors.New("database schema is out of date")
+
+// Migration is a pair of up and down SQL scripts
+type Migration struct {
+	Version int64
+	Name    string
+	Up      string
+	Down    string
+}
+
+// MigrationStatus tells whether a migration was applied. Unknown marks
+// versions applied to the database that this binary does not have, e.g.
+// after a newer release migrated it.
+type MigrationStatus struct {
+	Version   int64
+	Name      string
+	AppliedAt *time.Time
+	Unknown   bool
+}
+
+// Migrator applies the migrations compiled into the binary and records them
+// in the schema_migrations table. Every migration runs in its own
+// transaction.
+type Migrator struct {
+	db         *sql.DB
+	driver     string
+	migrations []Migration
+}
+
+func NewMigrator(db *gorm.DB) (*Migrator, error) {
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, err
+	}
+
+	driver := db.Dialector.Name()
+	migrations, err := loadMigrations(migrationFiles, "migrations/"+driver)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Migrator{db: sqlDB, driver: driver, migrations: migrations}, nil
+}
+
+// loadMigrations reads NNNNNN_name.up.sql and NNNNNN_name.down.sql files,
+// ordered by version. Every version needs both files.
+func loadMigrations(fsys fs.FS, dir string) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read migrations: %w", err)
+	}
+
+	byVersion := make(map[int64]*Migration)
+	for _, entry := range entries {
+		match := migrationFileName.FindStringSubmatch(entry.Name())
+		if match == nil {
+			return nil, fmt.Errorf("invalid migration file name %s, want NNNNNN_name.up.sql or .down.sql", entry.Name())
+		}
+
+		version, _ := strconv.ParseInt(match[1], 10, 64)
+		raw, err := fs.ReadFile(fsys, dir+"/"+entry.Name())
+		if err != nil {
+			return nil, fmt.Errorf("failed to read migration %s: %w", entry.Name(), err)
+		}
+
+		migration, ok := byVersion[version]
+		if !ok {
+			migration = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = migration
+		}
+		if migration.Name != match[2] {
+			return nil, fmt.Errorf("migration %d has two names: %s and %s", version, migration.Name, match[2])
+		}
+
+		if match[3] == "up" {
+			migration.Up = string(raw)
+		} else {
+			migration.Down = string(raw)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, migration := range byVersion {
+		if migration.Up == "" || migration.Down == "" {
+			return nil, fmt.Errorf("migration %d_%s needs both an up and a down file", migration.Version, migration.Name)
+		}
+		migrations = append(migrations, *migration)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+
+	return migrations, nil
+}
+
+// Up applies all pending migrations and returns them
+func (m *Migrator) Up(ctx context.Context) ([]Migration, error) {
+	var applied []Migration
+	err := m.withLock(ctx, func(conn *sql.Conn) error {
+		done, err := appliedVersions(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for _, migration := range m.migrations {
+			if _, ok := done[migration.Version]; ok {
+				continue
+			}
+			err := inTransaction(ctx, conn, migration.Up,
+				"INSERT INTO schema_migrations (version, name, applied_at) VALUES ($1, $2, $3)",
+				migration.Version, migration.Name, time.Now())
+			if err != nil {
+				return fmt.Errorf("migration %d_%s failed: %w", migration.Version, migration.Name, err)
+			}
+			applied = append(applied, migration)
+		}
+		return nil
+	})
+	return applied, err
+}
+
+// Down reverts the latest steps migrations and returns them
+func (m *Migrator) Down(ctx context.Context, steps int) ([]Migration, error) {
+	known := make(map[int64]Migration, len(m.migrations))
+	for _, migration := range m.migrations {
+		known[migration.Version] = migration
+	}
+
+	var reverted []Migration
+	err := m.withLock(ctx, func(conn *sql.Conn) error {
+		done, err := appliedVersions(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		versions := make([]int64, 0, len(done))
+		for version := range done {
+			versions = append(versions, version)
+		}
+		sort.Slice(versions, func(i, j int) bool { return versions[i] > versions[j] })
+
+		for _, version := range versions[:min(steps, len(versions))] {
+			migration, ok := known[version]
+			if !ok {
+				return fmt.Errorf("migration %d is not in this binary, revert it with the release that added it", version)
+			}
+			err := inTransaction(ctx, conn, migration.Down,
+				"DELETE FROM schema_migrations WHERE version = $1", migration.Version)
+			if err != nil {
+				return fmt.Errorf("reverting migration %d_%s failed: %w", migration.Version, migration.Name, err)
+			}
+			reverted = append(reverted, migration)
+		}
+		return nil
+	})
+	return reverted, err
+}
+
+// Status lists every known migration and every applied one, by version
+func (m *Migrator) Status(ctx context.Context) ([]MigrationStatus, error) {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	if err := m.createMigrationsTable(ctx, conn); err != nil {
+		return nil, err
+	}
+	done, err := appliedVersions(ctx, conn)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]MigrationStatus, 0, len(m.migrations))
+	for _, migration := range m.migrations {
+		status := MigrationStatus{Version: migration.Version, Name: migration.Name}
+		if row, ok := done[migration.Version]; ok {
+			status.AppliedAt = &row.appliedAt
+			delete(done, migration.Version)
+		}
+		statuses = append(statuses, status)
+	}
+	for version, row := range done {
+		appliedAt := row.appliedAt
+		statuses = append(statuses, MigrationStatus{Version: version, Name: row.name, AppliedAt: &appliedAt, Unknown: true})
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Version < statuses[j].Version })
+
+	return statuses, nil
+}
+
+// Check returns ErrSchemaOutdated when migrations are pending. Migrations
+// unknown to this binary are fine, so an older release keeps running during
+// a rolling deploy.
+func (m *Migrator) Check(ctx context.Context) error {
+	statuses, err := m.Status(ctx)
+	if err != nil {
+		return err
+	}
+
+	var pending []string
+	for _, status := range statuses {
+		if status.AppliedAt == nil {
+			pending = append(pending, fmt.Sprintf("%d_%s", status.Version, status.Name))
+		}
+	}
+	if len(pending) > 0 {
+		return fmt.Errorf("%w, pending migrations: %s", ErrSchemaOutdated, strings.Join(pending, ", "))
+	}
+
+	return nil
+}
+
+// withLock runs fn on a single connection holding the migration lock. The
+// advisory lock belongs to the session, so it is taken and released on that
+// connection. SQLite databases belong to one process and need no lock.
+func (m *Migrator) withLock(ctx context.Context, fn func(conn *sql.Conn) error) error {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if m.driver == DriverPostgres {
+		if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", migrationLockKey); err != nil {
+			return fmt.Errorf("failed to take the migration lock: %w", err)
+		}
+		defer func() {
+			if _, err := conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock($1)", migrationLockKey); err != nil {
+				log.Printf("Failed to release the migration lock: %v", err)
+			}
+		}()
+	}
+
+	if err := m.createMigrationsTable(ctx, conn); err != nil {
+		return err
+	}
+
+	return fn(conn)
+}
+
+func (m *Migrator) createMigrationsTable(ctx context.Context, conn *sql.Conn) error {
+	// The SQLite driver only reads datetime columns back as time.Time
+	timestampType := "timestamptz"
+	if m.driver == DriverSQLite {
+		timestampType = "datetime"
+	}
+
+	_, err := conn.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+    version bigint PRIMARY KEY,
+    name text NOT NULL,
+    applied_at `+timestampType+` NOT NULL
+)`)
+	if err != nil {
+		return fmt.Errorf("failed to create schema_migrations: %w", err)
+	}
+	return nil
+}
+
+type appliedMigration struct {
+	name      string
+	appliedAt time.Time
+}
+
+func appliedVersions(ctx context.Context, conn *sql.Conn) (map[int64]appliedMigration, error) {
+	rows, err := conn.QueryContext(ctx, "SELECT version, name, applied_at FROM schema_migrations")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read schema_migrations: %w", err)
+	}
+	defer rows.Close()
+
+	applied := make(map[int64]appliedMigration)
+	for rows.Next() {
+		var version int64
+		var row appliedMigration
+		if err := rows.Scan(&version, &row.name, &row.appliedAt); err != nil {
+			return nil, fmt.Errorf("failed to read schema_migrations: %w", err)
+		}
+		applied[version] = row
+	}
+	return applied, rows.Err()
+}
+
+// inTransaction runs a migration script and the schema_migrations update
+// that records it, committing both or neither
+func inTransaction(ctx context.Context, conn *sql.Conn, script, record string, args ...any) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, script); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, record, args...); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// CreateMigration writes empty up and down files for the next version into
+// the subdirectory of dir of every driver and returns their paths
+func CreateMigration(dir, name string) ([]string, error) {
+	name = strings.Trim(migrationNameChars.ReplaceAllString(strings.ToLower(name), "_"), "_")
+	if name == "" {
+		return nil, errors.New("migration name is required")
+	}
+
+	var latest int64
+	for _, driver := range Drivers {
+		entries, err := os.ReadDir(filepath.Join(dir, driver))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read migrations of %s: %w", driver, err)
+		}
+		for _, entry := range entries {
+			if match := migrationFileName.FindStringSubmatch(entry.Name()); match != nil {
+				version, _ := strconv.ParseInt(match[1], 10, 64)
+				latest = max(latest, version)
+			}
+		}
+	}
+
+	base := fmt.Sprintf("%06d_%s", latest+1, name)
+	var paths []string
+	for _, driver := range Drivers {
+		up := filepath.Join(dir, driver, base+".up.sql")
+		if err := os.WriteFile(up, []byte("-- "+name+"\n"), 0o644); err != nil {
+			return nil, fmt.Errorf("failed to write %s: %w", up, err)
+		}
+		down := filepath.Join(dir, driver, base+".down.sql")
+		if err := os.WriteFile(down, []byte("-- Revert "+name+"\n"), 0o644); err != nil {
+			return nil, fmt.Errorf("failed to write %s: %w", down, err)
+		}
+		paths = append(paths, up, down)
+	}
+
+	return paths, nil
+}
+
+// PrepareSchema makes sure the schema is current before the server starts:
+// it applies pending migrations in auto mode and refuses to start with
+// pending migrations in check mode
+func PrepareSchema(mode string) error {
+	migrator, err := NewMigrator(DB)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	switch mode {
+	case MigrateModeAuto:
+		applied, err := migrator.Up(ctx)
+		if err != nil {
+			return err
+		}
+		for _, migration := range applied {
+			log.Printf("Applied migration %d_%s", migration.Version, migration.Name)
+		}
+		return nil
+
+	case MigrateModeCheck:
+		return migrator.Check(ctx)
+
+	default:
+		return fmt.Errorf("unknown DB_MIGRATE mode %q, use %s or %s", mode, MigrateModeCheck, MigrateModeAuto)
+	}
+}
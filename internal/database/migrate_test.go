@@ -0,0 +1,193 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stewicca/angagrar-backend/internal/models"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// The models as they were when AutoMigrate still built the schema, which is
+// what production databases started from
+
+type baselineUser struct {
+	ID        uint   `gorm:"primaryKey"`
+	GuestID   string `gorm:"uniqueIndex;not null"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	DeletedAt gorm.DeletedAt   `gorm:"index"`
+	Budgets   []baselineBudget `gorm:"foreignKey:UserID"`
+}
+
+func (baselineUser) TableName() string { return "users" }
+
+type baselineBudget struct {
+	ID           uint      `gorm:"primaryKey"`
+	UserID       uint      `gorm:"not null;index"`
+	Category     string    `gorm:"not null"`
+	Amount       float64   `gorm:"not null"`
+	Period       string    `gorm:"not null"`
+	StartDate    time.Time `gorm:"not null"`
+	EndDate      time.Time `gorm:"not null"`
+	Description  string
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+	DeletedAt    gorm.DeletedAt        `gorm:"index"`
+	Transactions []baselineTransaction `gorm:"foreignKey:BudgetID"`
+}
+
+func (baselineBudget) TableName() string { return "budgets" }
+
+type baselineTransaction struct {
+	ID          uint    `gorm:"primaryKey"`
+	UserID      uint    `gorm:"not null;index"`
+	BudgetID    *uint   `gorm:"index"`
+	Type        string  `gorm:"not null"`
+	Category    string  `gorm:"not null"`
+	Amount      float64 `gorm:"not null"`
+	Description string
+	Date        time.Time `gorm:"not null;index"`
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+	DeletedAt   gorm.DeletedAt `gorm:"index"`
+}
+
+func (baselineTransaction) TableName() string { return "transactions" }
+
+type baselineConversation struct {
+	ID              uint   `gorm:"primaryKey"`
+	UserID          uint   `gorm:"not null;index"`
+	SessionID       string `gorm:"uniqueIndex;not null"`
+	BudgetGenerated bool   `gorm:"default:false"`
+	CompletedAt     *time.Time
+	CreatedAt       time.Time
+	UpdatedAt       time.Time
+	DeletedAt       gorm.DeletedAt    `gorm:"index"`
+	User            baselineUser      `gorm:"foreignKey:UserID"`
+	Messages        []baselineMessage `gorm:"foreignKey:ConversationID"`
+}
+
+func (baselineConversation) TableName() string { return "conversations" }
+
+type baselineMessage struct {
+	ID             uint   `gorm:"primaryKey"`
+	ConversationID uint   `gorm:"not null;index"`
+	Role           string `gorm:"not null"`
+	Content        string `gorm:"type:text;not null"`
+	CreatedAt      time.Time
+	DeletedAt      gorm.DeletedAt `gorm:"index"`
+}
+
+func (baselineMessage) TableName() string { return "messages" }
+
+// openPostgresSchema opens TEST_POSTGRES_DSN in a fresh schema that is
+// dropped after the test
+func openPostgresSchema(t *testing.T) *gorm.DB {
+	t.Helper()
+
+	dsn := os.Getenv("TEST_POSTGRES_DSN")
+	if dsn == "" {
+		t.Skip("TEST_POSTGRES_DSN is not set, e.g. host=localhost user=postgres password=password dbname=angagrar_test sslmode=disable")
+	}
+
+	config := &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)}
+	admin, err := gorm.Open(postgres.Open(dsn), config)
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+
+	schema := fmt.Sprintf("migrate_test_%d", time.Now().UnixNano())
+	if err := admin.Exec("CREATE SCHEMA " + schema).Error; err != nil {
+		t.Fatalf("create schema: %v", err)
+	}
+
+	db, err := gorm.Open(postgres.Open(dsn+" search_path="+schema), config)
+	if err != nil {
+		t.Fatalf("connect to schema: %v", err)
+	}
+
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+		admin.Exec("DROP SCHEMA " + schema + " CASCADE")
+		if sqlDB, err := admin.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+
+	return db
+}
+
+func TestUpAdoptsAutoMigrateSchema(t *testing.T) {
+	ctx := context.Background()
+	db := openPostgresSchema(t)
+
+	if err := db.AutoMigrate(&baselineUser{}, &baselineBudget{}, &baselineTransaction{}, &baselineConversation{}, &baselineMessage{}); err != nil {
+		t.Fatalf("baseline AutoMigrate: %v", err)
+	}
+	existing := baselineUser{GuestID: "existing-guest"}
+	if err := db.Create(&existing).Error; err != nil {
+		t.Fatalf("create baseline user: %v", err)
+	}
+	existingConversation := baselineConversation{UserID: existing.ID, SessionID: "existing-session"}
+	if err := db.Omit("User").Create(&existingConversation).Error; err != nil {
+		t.Fatalf("create baseline conversation: %v", err)
+	}
+
+	migrator, err := NewMigrator(db)
+	if err != nil {
+		t.Fatalf("NewMigrator: %v", err)
+	}
+	if _, err := migrator.Up(ctx); err != nil {
+		t.Fatalf("migrate up: %v", err)
+	}
+	if err := migrator.Check(ctx); err != nil {
+		t.Fatalf("expected no pending migrations, got %v", err)
+	}
+
+	// Rows from before the migration get the column defaults
+	var user models.User
+	if err := db.First(&user, existing.ID).Error; err != nil {
+		t.Fatalf("load existing user: %v", err)
+	}
+	if user.PayDay != 1 || user.PayDayAdjust != models.PayDayAdjustNone {
+		t.Errorf("expected the default pay cycle, got %d/%s", user.PayDay, user.PayDayAdjust)
+	}
+	var conversation models.Conversation
+	if err := db.First(&conversation, existingConversation.ID).Error; err != nil {
+		t.Fatalf("load existing conversation: %v", err)
+	}
+	if conversation.Topic != models.ConversationTopicBudget {
+		t.Errorf("expected the budget topic, got %q", conversation.Topic)
+	}
+
+	// The columns added since are usable
+	email := "guest@example.com"
+	user.Email = &email
+	user.Tier = "premium"
+	if err := db.Save(&user).Error; err != nil {
+		t.Fatalf("save registered user: %v", err)
+	}
+	previous := models.Budget{UserID: user.ID, Category: "Makan", Amount: 100, Period: "monthly", StartDate: time.Now(), EndDate: time.Now().AddDate(0, 1, 0)}
+	if err := db.Create(&previous).Error; err != nil {
+		t.Fatalf("create budget: %v", err)
+	}
+	renewed := models.Budget{UserID: user.ID, Category: "Makan", Amount: 120, Period: "monthly", StartDate: previous.EndDate, EndDate: previous.EndDate.AddDate(0, 1, 0),
+		Rollover: true, RolloverAmount: 20, PreviousBudgetID: &previous.ID}
+	if err := db.Create(&renewed).Error; err != nil {
+		t.Fatalf("create renewed budget: %v", err)
+	}
+
+	// The unique index on email exists
+	other := models.User{GuestID: "other-guest", Email: &email}
+	if err := db.Create(&other).Error; err == nil {
+		t.Error("expected a second user with the same email to be rejected")
+	}
+}
@@ -0,0 +1,11 @@
+DROP TABLE IF EXISTS llm_usages;
+DROP TABLE IF EXISTS city_costs;
+DROP TABLE IF EXISTS financial_profiles;
+DROP TABLE IF EXISTS messages;
+DROP TABLE IF EXISTS conversations;
+DROP TABLE IF EXISTS transactions;
+DROP TABLE IF EXISTS budget_adjustments;
+DROP TABLE IF EXISTS budgets;
+DROP TABLE IF EXISTS revoked_tokens;
+DROP TABLE IF EXISTS refresh_tokens;
+DROP TABLE IF EXISTS users;
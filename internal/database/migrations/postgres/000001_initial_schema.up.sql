@@ -0,0 +1,194 @@
+-- Schema as built by GORM AutoMigrate before versioned migrations. Every
+-- statement is idempotent so databases created by AutoMigrate adopt it as is.
+-- CREATE TABLE IF NOT EXISTS skips tables an older AutoMigrate created, so
+-- columns added to them since are added separately before their indexes.
+
+CREATE TABLE IF NOT EXISTS users (
+    id bigserial PRIMARY KEY,
+    guest_id text NOT NULL,
+    email text,
+    password_hash text,
+    registered_at timestamptz,
+    pay_day bigint NOT NULL DEFAULT 1,
+    pay_day_adjust text NOT NULL DEFAULT 'none',
+    tier text,
+    created_at timestamptz,
+    updated_at timestamptz,
+    deleted_at timestamptz
+);
+ALTER TABLE users
+    ADD COLUMN IF NOT EXISTS email text,
+    ADD COLUMN IF NOT EXISTS password_hash text,
+    ADD COLUMN IF NOT EXISTS registered_at timestamptz,
+    ADD COLUMN IF NOT EXISTS pay_day bigint NOT NULL DEFAULT 1,
+    ADD COLUMN IF NOT EXISTS pay_day_adjust text NOT NULL DEFAULT 'none',
+    ADD COLUMN IF NOT EXISTS tier text;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_guest_id ON users (guest_id);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_email ON users (email);
+CREATE INDEX IF NOT EXISTS idx_users_deleted_at ON users (deleted_at);
+
+CREATE TABLE IF NOT EXISTS refresh_tokens (
+    id bigserial PRIMARY KEY,
+    user_id bigint NOT NULL,
+    family_id text NOT NULL,
+    token_hash text NOT NULL,
+    access_token_id text,
+    expires_at timestamptz NOT NULL,
+    used_at timestamptz,
+    revoked_at timestamptz,
+    created_at timestamptz
+);
+CREATE INDEX IF NOT EXISTS idx_refresh_tokens_user_id ON refresh_tokens (user_id);
+CREATE INDEX IF NOT EXISTS idx_refresh_tokens_family_id ON refresh_tokens (family_id);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_refresh_tokens_token_hash ON refresh_tokens (token_hash);
+CREATE INDEX IF NOT EXISTS idx_refresh_tokens_access_token_id ON refresh_tokens (access_token_id);
+
+CREATE TABLE IF NOT EXISTS revoked_tokens (
+    id bigserial PRIMARY KEY,
+    jti text NOT NULL,
+    user_id bigint NOT NULL,
+    expires_at timestamptz NOT NULL,
+    created_at timestamptz
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_revoked_tokens_jti ON revoked_tokens (jti);
+CREATE INDEX IF NOT EXISTS idx_revoked_tokens_user_id ON revoked_tokens (user_id);
+CREATE INDEX IF NOT EXISTS idx_revoked_tokens_expires_at ON revoked_tokens (expires_at);
+
+CREATE TABLE IF NOT EXISTS budgets (
+    id bigserial PRIMARY KEY,
+    user_id bigint NOT NULL,
+    category text NOT NULL,
+    amount decimal NOT NULL,
+    period text NOT NULL,
+    start_date timestamptz NOT NULL,
+    end_date timestamptz NOT NULL,
+    description text,
+    rollover boolean DEFAULT false,
+    rollover_amount decimal DEFAULT 0,
+    previous_budget_id bigint,
+    created_at timestamptz,
+    updated_at timestamptz,
+    deleted_at timestamptz,
+    CONSTRAINT fk_users_budgets FOREIGN KEY (user_id) REFERENCES users (id)
+);
+ALTER TABLE budgets
+    ADD COLUMN IF NOT EXISTS rollover boolean DEFAULT false,
+    ADD COLUMN IF NOT EXISTS rollover_amount decimal DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS previous_budget_id bigint;
+CREATE INDEX IF NOT EXISTS idx_budgets_user_id ON budgets (user_id);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_budgets_previous_budget_id ON budgets (previous_budget_id);
+CREATE INDEX IF NOT EXISTS idx_budgets_deleted_at ON budgets (deleted_at);
+
+CREATE TABLE IF NOT EXISTS budget_adjustments (
+    id bigserial PRIMARY KEY,
+    user_id bigint NOT NULL,
+    conversation_id bigint NOT NULL,
+    request text,
+    status text NOT NULL,
+    changes text,
+    applied_at timestamptz,
+    created_at timestamptz,
+    updated_at timestamptz
+);
+CREATE INDEX IF NOT EXISTS idx_budget_adjustments_user_id ON budget_adjustments (user_id);
+CREATE INDEX IF NOT EXISTS idx_budget_adjustments_conversation_id ON budget_adjustments (conversation_id);
+
+CREATE TABLE IF NOT EXISTS transactions (
+    id bigserial PRIMARY KEY,
+    user_id bigint NOT NULL,
+    budget_id bigint,
+    type text NOT NULL,
+    category text NOT NULL,
+    amount decimal NOT NULL,
+    description text,
+    date timestamptz NOT NULL,
+    created_at timestamptz,
+    updated_at timestamptz,
+    deleted_at timestamptz,
+    CONSTRAINT fk_budgets_transactions FOREIGN KEY (budget_id) REFERENCES budgets (id)
+);
+CREATE INDEX IF NOT EXISTS idx_transactions_user_id ON transactions (user_id);
+CREATE INDEX IF NOT EXISTS idx_transactions_user_date ON transactions (user_id, date);
+CREATE INDEX IF NOT EXISTS idx_transactions_budget_id ON transactions (budget_id);
+CREATE INDEX IF NOT EXISTS idx_transactions_date ON transactions (date);
+CREATE INDEX IF NOT EXISTS idx_transactions_deleted_at ON transactions (deleted_at);
+
+CREATE TABLE IF NOT EXISTS conversations (
+    id bigserial PRIMARY KEY,
+    user_id bigint NOT NULL,
+    session_id text NOT NULL,
+    topic text NOT NULL DEFAULT 'budget',
+    budget_generated boolean DEFAULT false,
+    completed_at timestamptz,
+    archived_at timestamptz,
+    summary text,
+    summarized_message_id bigint DEFAULT 0,
+    created_at timestamptz,
+    updated_at timestamptz,
+    deleted_at timestamptz,
+    CONSTRAINT fk_conversations_user FOREIGN KEY (user_id) REFERENCES users (id)
+);
+ALTER TABLE conversations
+    ADD COLUMN IF NOT EXISTS topic text NOT NULL DEFAULT 'budget',
+    ADD COLUMN IF NOT EXISTS archived_at timestamptz,
+    ADD COLUMN IF NOT EXISTS summary text,
+    ADD COLUMN IF NOT EXISTS summarized_message_id bigint DEFAULT 0;
+CREATE INDEX IF NOT EXISTS idx_conversations_user_id ON conversations (user_id);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_conversations_session_id ON conversations (session_id);
+CREATE INDEX IF NOT EXISTS idx_conversations_deleted_at ON conversations (deleted_at);
+
+CREATE TABLE IF NOT EXISTS messages (
+    id bigserial PRIMARY KEY,
+    conversation_id bigint NOT NULL,
+    role text NOT NULL,
+    content text NOT NULL,
+    created_at timestamptz,
+    deleted_at timestamptz,
+    CONSTRAINT fk_conversations_messages FOREIGN KEY (conversation_id) REFERENCES conversations (id)
+);
+CREATE INDEX IF NOT EXISTS idx_messages_conversation_id ON messages (conversation_id);
+CREATE INDEX IF NOT EXISTS idx_messages_deleted_at ON messages (deleted_at);
+
+CREATE TABLE IF NOT EXISTS financial_profiles (
+    id bigserial PRIMARY KEY,
+    user_id bigint NOT NULL,
+    salary decimal DEFAULT 0,
+    city text,
+    lifestyle text,
+    recurring_expenses text,
+    goals text,
+    created_at timestamptz,
+    updated_at timestamptz
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_financial_profiles_user_id ON financial_profiles (user_id);
+
+CREATE TABLE IF NOT EXISTS city_costs (
+    id bigserial PRIMARY KEY,
+    city text NOT NULL,
+    lifestyle text NOT NULL,
+    rent decimal NOT NULL,
+    food decimal NOT NULL,
+    transport decimal NOT NULL,
+    source text NOT NULL DEFAULT 'seed',
+    seed_version bigint NOT NULL DEFAULT 0,
+    created_at timestamptz,
+    updated_at timestamptz
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_city_costs_city_lifestyle ON city_costs (city, lifestyle);
+
+CREATE TABLE IF NOT EXISTS llm_usages (
+    id bigserial PRIMARY KEY,
+    user_id bigint NOT NULL,
+    conversation_id bigint,
+    purpose text NOT NULL,
+    model text NOT NULL,
+    prompt_tokens bigint NOT NULL,
+    completion_tokens bigint NOT NULL,
+    estimated boolean NOT NULL DEFAULT false,
+    latency_ms bigint NOT NULL,
+    cost_usd decimal NOT NULL,
+    created_at timestamptz
+);
+CREATE INDEX IF NOT EXISTS idx_llm_usages_user_created ON llm_usages (user_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_llm_usages_conversation_id ON llm_usages (conversation_id);
+CREATE INDEX IF NOT EXISTS idx_llm_usages_created_at ON llm_usages (created_at);
@@ -0,0 +1,7 @@
+ALTER TABLE llm_usages DROP CONSTRAINT IF EXISTS chk_llm_usages_tokens;
+ALTER TABLE city_costs DROP CONSTRAINT IF EXISTS chk_city_costs_amounts;
+ALTER TABLE conversations DROP CONSTRAINT IF EXISTS chk_conversations_topic;
+ALTER TABLE transactions DROP CONSTRAINT IF EXISTS chk_transactions_amount, DROP CONSTRAINT IF EXISTS chk_transactions_type;
+ALTER TABLE budget_adjustments DROP CONSTRAINT IF EXISTS chk_budget_adjustments_status;
+ALTER TABLE budgets DROP CONSTRAINT IF EXISTS chk_budgets_period;
+ALTER TABLE users DROP CONSTRAINT IF EXISTS chk_users_pay_day_adjust, DROP CONSTRAINT IF EXISTS chk_users_pay_day;
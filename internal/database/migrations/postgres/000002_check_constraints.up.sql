@@ -0,0 +1,25 @@
+-- The services validate these values already. NOT VALID skips rows written
+-- before the constraints existed; new and updated rows are checked.
+
+ALTER TABLE users
+    ADD CONSTRAINT chk_users_pay_day CHECK (pay_day BETWEEN 1 AND 31) NOT VALID,
+    ADD CONSTRAINT chk_users_pay_day_adjust CHECK (pay_day_adjust IN ('none', 'previous_business_day', 'next_business_day')) NOT VALID;
+
+ALTER TABLE budgets
+    ADD CONSTRAINT chk_budgets_period CHECK (period IN ('monthly', 'yearly')) NOT VALID;
+
+ALTER TABLE budget_adjustments
+    ADD CONSTRAINT chk_budget_adjustments_status CHECK (status IN ('pending', 'applied', 'rejected')) NOT VALID;
+
+ALTER TABLE transactions
+    ADD CONSTRAINT chk_transactions_type CHECK (type IN ('income', 'expense')) NOT VALID,
+    ADD CONSTRAINT chk_transactions_amount CHECK (amount > 0) NOT VALID;
+
+ALTER TABLE conversations
+    ADD CONSTRAINT chk_conversations_topic CHECK (topic IN ('budget', 'general')) NOT VALID;
+
+ALTER TABLE city_costs
+    ADD CONSTRAINT chk_city_costs_amounts CHECK (rent >= 0 AND food >= 0 AND transport >= 0) NOT VALID;
+
+ALTER TABLE llm_usages
+    ADD CONSTRAINT chk_llm_usages_tokens CHECK (prompt_tokens >= 0 AND completion_tokens >= 0) NOT VALID;
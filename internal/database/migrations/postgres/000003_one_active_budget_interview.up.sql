@@ -0,0 +1,17 @@
+-- A user has at most one budget interview that is neither completed,
+-- archived nor deleted. Older duplicates left by concurrent starts are
+-- archived first, keeping the newest one active.
+
+UPDATE conversations
+SET archived_at = CURRENT_TIMESTAMP
+WHERE id IN (
+    SELECT id FROM (
+        SELECT id, ROW_NUMBER() OVER (PARTITION BY user_id ORDER BY created_at DESC, id DESC) AS position
+        FROM conversations
+        WHERE topic = 'budget' AND completed_at IS NULL AND archived_at IS NULL AND deleted_at IS NULL
+    ) AS active
+    WHERE position > 1
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_conversations_active_budget_interview ON conversations (user_id)
+    WHERE topic = 'budget' AND completed_at IS NULL AND archived_at IS NULL AND deleted_at IS NULL;
@@ -0,0 +1,186 @@
+-- SQLite version of the Postgres schema. The CHECK constraints Postgres gets
+-- in 000002 are declared with the tables here, since SQLite cannot add
+-- constraints to an existing table.
+
+CREATE TABLE IF NOT EXISTS users (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    guest_id text NOT NULL,
+    email text,
+    password_hash text,
+    registered_at datetime,
+    pay_day bigint NOT NULL DEFAULT 1,
+    pay_day_adjust text NOT NULL DEFAULT 'none',
+    tier text,
+    created_at datetime,
+    updated_at datetime,
+    deleted_at datetime,
+    CONSTRAINT chk_users_pay_day CHECK (pay_day BETWEEN 1 AND 31),
+    CONSTRAINT chk_users_pay_day_adjust CHECK (pay_day_adjust IN ('none', 'previous_business_day', 'next_business_day'))
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_guest_id ON users (guest_id);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_email ON users (email);
+CREATE INDEX IF NOT EXISTS idx_users_deleted_at ON users (deleted_at);
+
+CREATE TABLE IF NOT EXISTS refresh_tokens (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    user_id bigint NOT NULL,
+    family_id text NOT NULL,
+    token_hash text NOT NULL,
+    access_token_id text,
+    expires_at datetime NOT NULL,
+    used_at datetime,
+    revoked_at datetime,
+    created_at datetime
+);
+CREATE INDEX IF NOT EXISTS idx_refresh_tokens_user_id ON refresh_tokens (user_id);
+CREATE INDEX IF NOT EXISTS idx_refresh_tokens_family_id ON refresh_tokens (family_id);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_refresh_tokens_token_hash ON refresh_tokens (token_hash);
+CREATE INDEX IF NOT EXISTS idx_refresh_tokens_access_token_id ON refresh_tokens (access_token_id);
+
+CREATE TABLE IF NOT EXISTS revoked_tokens (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    jti text NOT NULL,
+    user_id bigint NOT NULL,
+    expires_at datetime NOT NULL,
+    created_at datetime
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_revoked_tokens_jti ON revoked_tokens (jti);
+CREATE INDEX IF NOT EXISTS idx_revoked_tokens_user_id ON revoked_tokens (user_id);
+CREATE INDEX IF NOT EXISTS idx_revoked_tokens_expires_at ON revoked_tokens (expires_at);
+
+CREATE TABLE IF NOT EXISTS budgets (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    user_id bigint NOT NULL,
+    category text NOT NULL,
+    amount real NOT NULL,
+    period text NOT NULL,
+    start_date datetime NOT NULL,
+    end_date datetime NOT NULL,
+    description text,
+    rollover boolean DEFAULT false,
+    rollover_amount real DEFAULT 0,
+    previous_budget_id bigint,
+    created_at datetime,
+    updated_at datetime,
+    deleted_at datetime,
+    CONSTRAINT fk_users_budgets FOREIGN KEY (user_id) REFERENCES users (id),
+    CONSTRAINT chk_budgets_period CHECK (period IN ('monthly', 'yearly'))
+);
+CREATE INDEX IF NOT EXISTS idx_budgets_user_id ON budgets (user_id);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_budgets_previous_budget_id ON budgets (previous_budget_id);
+CREATE INDEX IF NOT EXISTS idx_budgets_deleted_at ON budgets (deleted_at);
+
+CREATE TABLE IF NOT EXISTS budget_adjustments (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    user_id bigint NOT NULL,
+    conversation_id bigint NOT NULL,
+    request text,
+    status text NOT NULL,
+    changes text,
+    applied_at datetime,
+    created_at datetime,
+    updated_at datetime,
+    CONSTRAINT chk_budget_adjustments_status CHECK (status IN ('pending', 'applied', 'rejected'))
+);
+CREATE INDEX IF NOT EXISTS idx_budget_adjustments_user_id ON budget_adjustments (user_id);
+CREATE INDEX IF NOT EXISTS idx_budget_adjustments_conversation_id ON budget_adjustments (conversation_id);
+
+CREATE TABLE IF NOT EXISTS transactions (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    user_id bigint NOT NULL,
+    budget_id bigint,
+    type text NOT NULL,
+    category text NOT NULL,
+    amount real NOT NULL,
+    description text,
+    date datetime NOT NULL,
+    created_at datetime,
+    updated_at datetime,
+    deleted_at datetime,
+    CONSTRAINT fk_budgets_transactions FOREIGN KEY (budget_id) REFERENCES budgets (id),
+    CONSTRAINT chk_transactions_type CHECK (type IN ('income', 'expense')),
+    CONSTRAINT chk_transactions_amount CHECK (amount > 0)
+);
+CREATE INDEX IF NOT EXISTS idx_transactions_user_id ON transactions (user_id);
+CREATE INDEX IF NOT EXISTS idx_transactions_user_date ON transactions (user_id, date);
+CREATE INDEX IF NOT EXISTS idx_transactions_budget_id ON transactions (budget_id);
+CREATE INDEX IF NOT EXISTS idx_transactions_date ON transactions (date);
+CREATE INDEX IF NOT EXISTS idx_transactions_deleted_at ON transactions (deleted_at);
+
+CREATE TABLE IF NOT EXISTS conversations (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    user_id bigint NOT NULL,
+    session_id text NOT NULL,
+    topic text NOT NULL DEFAULT 'budget',
+    budget_generated boolean DEFAULT false,
+    completed_at datetime,
+    archived_at datetime,
+    summary text,
+    summarized_message_id bigint DEFAULT 0,
+    created_at datetime,
+    updated_at datetime,
+    deleted_at datetime,
+    CONSTRAINT fk_conversations_user FOREIGN KEY (user_id) REFERENCES users (id),
+    CONSTRAINT chk_conversations_topic CHECK (topic IN ('budget', 'general'))
+);
+CREATE INDEX IF NOT EXISTS idx_conversations_user_id ON conversations (user_id);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_conversations_session_id ON conversations (session_id);
+CREATE INDEX IF NOT EXISTS idx_conversations_deleted_at ON conversations (deleted_at);
+
+CREATE TABLE IF NOT EXISTS messages (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    conversation_id bigint NOT NULL,
+    role text NOT NULL,
+    content text NOT NULL,
+    created_at datetime,
+    deleted_at datetime,
+    CONSTRAINT fk_conversations_messages FOREIGN KEY (conversation_id) REFERENCES conversations (id)
+);
+CREATE INDEX IF NOT EXISTS idx_messages_conversation_id ON messages (conversation_id);
+CREATE INDEX IF NOT EXISTS idx_messages_deleted_at ON messages (deleted_at);
+
+CREATE TABLE IF NOT EXISTS financial_profiles (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    user_id bigint NOT NULL,
+    salary real DEFAULT 0,
+    city text,
+    lifestyle text,
+    recurring_expenses text,
+    goals text,
+    created_at datetime,
+    updated_at datetime
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_financial_profiles_user_id ON financial_profiles (user_id);
+
+CREATE TABLE IF NOT EXISTS city_costs (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    city text NOT NULL,
+    lifestyle text NOT NULL,
+    rent real NOT NULL,
+    food real NOT NULL,
+    transport real NOT NULL,
+    source text NOT NULL DEFAULT 'seed',
+    seed_version bigint NOT NULL DEFAULT 0,
+    created_at datetime,
+    updated_at datetime,
+    CONSTRAINT chk_city_costs_amounts CHECK (rent >= 0 AND food >= 0 AND transport >= 0)
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_city_costs_city_lifestyle ON city_costs (city, lifestyle);
+
+CREATE TABLE IF NOT EXISTS llm_usages (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    user_id bigint NOT NULL,
+    conversation_id bigint,
+    purpose text NOT NULL,
+    model text NOT NULL,
+    prompt_tokens bigint NOT NULL,
+    completion_tokens bigint NOT NULL,
+    estimated boolean NOT NULL DEFAULT false,
+    latency_ms bigint NOT NULL,
+    cost_usd real NOT NULL,
+    created_at datetime,
+    CONSTRAINT chk_llm_usages_tokens CHECK (prompt_tokens >= 0 AND completion_tokens >= 0)
+);
+CREATE INDEX IF NOT EXISTS idx_llm_usages_user_created ON llm_usages (user_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_llm_usages_conversation_id ON llm_usages (conversation_id);
+CREATE INDEX IF NOT EXISTS idx_llm_usages_created_at ON llm_usages (created_at);
@@ -0,0 +1 @@
+-- The CHECK constraints go with the tables in 000001 on SQLite
@@ -0,0 +1 @@
+-- The CHECK constraints are part of the tables in 000001 on SQLite
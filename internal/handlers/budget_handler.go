@@ -1,21 +1,25 @@
 package handlers
 
 import (
+	"errors"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
-	"github.com/stewicca/angagrar-backend/internal/repositories"
+	"github.com/stewicca/angagrar-backend/internal/models"
+	"github.com/stewicca/angagrar-backend/internal/services"
 	"github.com/stewicca/angagrar-backend/pkg/utils"
 )
 
 type BudgetHandler struct {
-	budgetRepo repositories.BudgetRepository
+	budgetService services.BudgetService
 }
 
-func NewBudgetHandler(budgetRepo repositories.BudgetRepository) *BudgetHandler {
+func NewBudgetHandler(budgetService services.BudgetService) *BudgetHandler {
 	return &BudgetHandler{
-		budgetRepo: budgetRepo,
+		budgetService: budgetService,
 	}
 }
 
@@ -27,7 +31,7 @@ func (h *BudgetHandler) GetUserBudgets(c *gin.Context) {
 		return
 	}
 
-	budgets, err := h.budgetRepo.FindByUserID(userID.(uint))
+	budgets, err := h.budgetService.GetUserBudgets(c.Request.Context(), userID.(uint))
 	if err != nil {
 		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to retrieve budgets", err)
 		return
@@ -38,52 +42,191 @@ func (h *BudgetHandler) GetUserBudgets(c *gin.Context) {
 	})
 }
 
-// UpdateBudget handles PATCH /api/v1/budgets/:id
-func (h *BudgetHandler) UpdateBudget(c *gin.Context) {
+// CreateBudget handles POST /api/v1/budgets
+func (h *BudgetHandler) CreateBudget(c *gin.Context) {
 	userID, exists := c.Get("userID")
 	if !exists {
 		utils.ErrorResponse(c, http.StatusUnauthorized, "Unauthorized", nil)
 		return
 	}
 
-	budgetID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	var req struct {
+		Category    string  `json:"category" binding:"required"`
+		Amount      float64 `json:"amount" binding:"required,gt=0"`
+		Period      string  `json:"period" binding:"omitempty,oneof=monthly yearly"`
+		Description string  `json:"description"`
+		Rollover    bool    `json:"rollover"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ValidationErrorResponse(c, "Category and a positive amount are required, period must be monthly or yearly")
+		return
+	}
+
+	if req.Period == "" {
+		req.Period = models.BudgetPeriodMonthly
+	}
+
+	budget, err := h.budgetService.CreateBudget(c.Request.Context(), userID.(uint), req.Category, req.Amount, req.Period, req.Description, req.Rollover)
 	if err != nil {
-		utils.ValidationErrorResponse(c, "Invalid budget ID")
+		switch {
+		case errors.Is(err, services.ErrBudgetExists):
+			utils.ErrorResponse(c, http.StatusConflict, "Budget already exists", err)
+		case errors.Is(err, services.ErrInvalidBudgetAmount), errors.Is(err, services.ErrInvalidBudgetPeriod):
+			utils.ValidationErrorResponse(c, err.Error())
+		default:
+			utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to create budget", err)
+		}
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusCreated, "Budget created", gin.H{
+		"budget": budget,
+	})
+}
+
+// GenerateBudget handles POST /api/v1/budgets/generate
+func (h *BudgetHandler) GenerateBudget(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		utils.ErrorResponse(c, http.StatusUnauthorized, "Unauthorized", nil)
 		return
 	}
 
 	var req struct {
-		Amount float64 `json:"amount" binding:"required"`
+		Salary    interface{} `json:"salary"` // a number or text like "8 juta"
+		City      string      `json:"city"`
+		Lifestyle string      `json:"lifestyle"`
+		Save      bool        `json:"save"`
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
-		utils.ValidationErrorResponse(c, "Amount is required")
+		utils.ValidationErrorResponse(c, "Invalid request body")
+		return
+	}
+
+	var salary float64
+	switch value := req.Salary.(type) {
+	case nil:
+	case float64:
+		salary = value
+	case string:
+		if strings.TrimSpace(value) != "" {
+			parsed, err := utils.ParseSalary(value)
+			if err != nil {
+				utils.ValidationErrorResponse(c, "salary must be a number or text like \"8 juta\"")
+				return
+			}
+			salary = parsed
+		}
+	default:
+		utils.ValidationErrorResponse(c, "salary must be a number or text like \"8 juta\"")
+		return
+	}
+
+	data, budgets, err := h.budgetService.GenerateBudget(c.Request.Context(), userID.(uint), services.BudgetGeneration{
+		Salary:    salary,
+		City:      req.City,
+		Lifestyle: req.Lifestyle,
+		Save:      req.Save,
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrSalaryRequired),
+			errors.Is(err, services.ErrInvalidSalary),
+			errors.Is(err, services.ErrUnknownLocation):
+			utils.ValidationErrorResponse(c, err.Error())
+		case errors.Is(err, services.ErrBudgetExists):
+			utils.ErrorResponse(c, http.StatusConflict, "Budget already exists", err)
+		default:
+			utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to generate budget", err)
+		}
+		return
+	}
+
+	if !req.Save {
+		utils.SuccessResponse(c, http.StatusOK, "Budget generated", gin.H{
+			"budget": data,
+		})
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusCreated, "Budget generated and saved", gin.H{
+		"budget":  data,
+		"budgets": budgets,
+	})
+}
+
+// GetBudgetProgress handles GET /api/v1/budgets/progress
+func (h *BudgetHandler) GetBudgetProgress(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		utils.ErrorResponse(c, http.StatusUnauthorized, "Unauthorized", nil)
 		return
 	}
 
-	// Find budget
-	budget, err := h.budgetRepo.FindByID(uint(budgetID))
+	at := time.Now()
+	if value := c.Query("date"); value != "" {
+		date, dateOnly, err := parseDateParam(value)
+		if err != nil {
+			utils.ValidationErrorResponse(c, "date must be YYYY-MM-DD or RFC3339")
+			return
+		}
+		// A plain date reports progress as of the end of that day
+		if dateOnly {
+			date = date.AddDate(0, 0, 1).Add(-time.Nanosecond)
+		}
+		at = date
+	}
+
+	report, err := h.budgetService.GetProgress(c.Request.Context(), userID.(uint), at)
 	if err != nil {
-		utils.ErrorResponse(c, http.StatusNotFound, "Budget not found", err)
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to calculate budget progress", err)
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Budget progress retrieved", report)
+}
+
+// UpdateBudget handles PATCH /api/v1/budgets/:id
+func (h *BudgetHandler) UpdateBudget(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		utils.ErrorResponse(c, http.StatusUnauthorized, "Unauthorized", nil)
 		return
 	}
 
-	// Verify ownership
-	if budget.UserID != userID.(uint) {
-		utils.ErrorResponse(c, http.StatusForbidden, "You don't have permission to update this budget", nil)
+	budgetID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		utils.ValidationErrorResponse(c, "Invalid budget ID")
 		return
 	}
 
-	// Validate amount
-	if req.Amount <= 0 {
-		utils.ValidationErrorResponse(c, "Amount must be greater than 0")
+	var req struct {
+		Amount   *float64 `json:"amount"`
+		Rollover *bool    `json:"rollover"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil || (req.Amount == nil && req.Rollover == nil) {
+		utils.ValidationErrorResponse(c, "Amount or rollover is required")
 		return
 	}
 
-	// Update amount
-	budget.Amount = req.Amount
-	if err := h.budgetRepo.Update(budget); err != nil {
-		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to update budget", err)
+	budget, err := h.budgetService.UpdateBudget(c.Request.Context(), userID.(uint), uint(budgetID), services.BudgetUpdate{
+		Amount:   req.Amount,
+		Rollover: req.Rollover,
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrBudgetNotFound):
+			utils.ErrorResponse(c, http.StatusNotFound, "Budget not found", err)
+		case errors.Is(err, services.ErrBudgetNotOwned):
+			utils.ErrorResponse(c, http.StatusForbidden, "You don't have permission to update this budget", nil)
+		case errors.Is(err, services.ErrInvalidBudgetAmount):
+			utils.ValidationErrorResponse(c, "Amount must be greater than 0")
+		default:
+			utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to update budget", err)
+		}
 		return
 	}
 
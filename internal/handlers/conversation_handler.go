@@ -1,20 +1,26 @@
 package handlers
 
 import (
+	"errors"
+	"io"
 	"net/http"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/stewicca/angagrar-backend/internal/repositories"
 	"github.com/stewicca/angagrar-backend/internal/services"
 	"github.com/stewicca/angagrar-backend/pkg/utils"
 )
 
 type ConversationHandler struct {
 	conversationService services.ConversationService
+	streamTimeout       time.Duration // write deadline of a streamed reply, 0 for none
 }
 
-func NewConversationHandler(conversationService services.ConversationService) *ConversationHandler {
+func NewConversationHandler(conversationService services.ConversationService, streamTimeout time.Duration) *ConversationHandler {
 	return &ConversationHandler{
 		conversationService: conversationService,
+		streamTimeout:       streamTimeout,
 	}
 }
 
@@ -26,20 +32,80 @@ func (h *ConversationHandler) StartConversation(c *gin.Context) {
 		return
 	}
 
-	conversation, greetingMsg, err := h.conversationService.StartConversation(userID.(uint))
+	// The body is optional, no topic starts a budget interview
+	var req struct {
+		Topic string `json:"topic"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		utils.ValidationErrorResponse(c, "Invalid request body")
+		return
+	}
+
+	conversation, greetingMsg, err := h.conversationService.StartConversation(c.Request.Context(), userID.(uint), req.Topic)
 	if err != nil {
-		utils.ErrorResponse(c, http.StatusBadRequest, "Failed to start conversation", err)
+		switch {
+		case errors.Is(err, services.ErrBudgetInterviewActive):
+			utils.ErrorResponse(c, http.StatusConflict, "Budget interview already active", err)
+		default:
+			utils.ErrorResponse(c, http.StatusBadRequest, "Failed to start conversation", err)
+		}
 		return
 	}
 
 	utils.SuccessResponse(c, http.StatusOK, "Conversation started", gin.H{
 		"session_id": conversation.SessionID,
+		"topic":      conversation.Topic,
 		"message":    greetingMsg,
 	})
 }
 
+// ListConversations handles GET /api/v1/conversations
+func (h *ConversationHandler) ListConversations(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		utils.ErrorResponse(c, http.StatusUnauthorized, "Unauthorized", nil)
+		return
+	}
+
+	var req struct {
+		Status string `form:"status"`
+		Topic  string `form:"topic"`
+		Cursor string `form:"cursor"`
+		Limit  int    `form:"limit" binding:"omitempty,min=1"`
+	}
+	if err := c.ShouldBindQuery(&req); err != nil {
+		utils.ValidationErrorResponse(c, "limit must be a positive number")
+		return
+	}
+
+	page, err := h.conversationService.ListConversations(c.Request.Context(), userID.(uint), services.ConversationQuery{
+		Filter: repositories.ConversationFilter{
+			Status: req.Status,
+			Topic:  req.Topic,
+			Limit:  req.Limit,
+		},
+		Cursor: req.Cursor,
+	})
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidStatus) || errors.Is(err, services.ErrInvalidTopic) || errors.Is(err, services.ErrInvalidCursor) {
+			utils.ValidationErrorResponse(c, err.Error())
+			return
+		}
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to list conversations", err)
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Conversations retrieved", page)
+}
+
 // SendMessage handles POST /api/v1/conversations/:sessionId/messages
 func (h *ConversationHandler) SendMessage(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		utils.ErrorResponse(c, http.StatusUnauthorized, "Unauthorized", nil)
+		return
+	}
+
 	sessionID := c.Param("sessionId")
 
 	var req struct {
@@ -51,8 +117,20 @@ func (h *ConversationHandler) SendMessage(c *gin.Context) {
 		return
 	}
 
-	response, isCompleted, budgets, err := h.conversationService.ProcessMessage(sessionID, req.Message)
+	response, isCompleted, budgets, err := h.conversationService.ProcessMessage(c.Request.Context(), userID.(uint), sessionID, req.Message)
 	if err != nil {
+		if errors.Is(err, services.ErrConversationNotFound) {
+			utils.ErrorResponse(c, http.StatusNotFound, "Conversation not found", err)
+			return
+		}
+		if errors.Is(err, services.ErrConversationArchived) {
+			utils.ErrorResponse(c, http.StatusConflict, "Conversation is archived", err)
+			return
+		}
+		if errors.Is(err, services.ErrBudgetAlreadyCreated) {
+			utils.ErrorResponse(c, http.StatusConflict, "Budget was already generated", err)
+			return
+		}
 		utils.ErrorResponse(c, http.StatusBadRequest, "Failed to process message", err)
 		return
 	}
@@ -71,13 +149,120 @@ func (h *ConversationHandler) SendMessage(c *gin.Context) {
 	utils.SuccessResponse(c, http.StatusOK, "Message processed", responseData)
 }
 
+// StreamMessage handles POST /api/v1/conversations/:sessionId/messages/stream
+//
+// The reply is sent as Server-Sent Events: a "delta" event per token chunk and
+// a final "done" event with the same fields SendMessage returns. Errors before
+// the first event are answered with a normal JSON error response.
+func (h *ConversationHandler) StreamMessage(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		utils.ErrorResponse(c, http.StatusUnauthorized, "Unauthorized", nil)
+		return
+	}
+
+	sessionID := c.Param("sessionId")
+
+	var req struct {
+		Message string `json:"message" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ValidationErrorResponse(c, "Message is required")
+		return
+	}
+
+	// One turn can make several LLM calls before and while streaming, which
+	// would outlast the server's WriteTimeout and cut the stream off with no
+	// "done" or "error" event
+	deadline := time.Time{}
+	if h.streamTimeout > 0 {
+		deadline = time.Now().Add(h.streamTimeout)
+	}
+	http.NewResponseController(c.Writer).SetWriteDeadline(deadline)
+
+	ctx := c.Request.Context()
+	streaming := false
+	startStream := func() {
+		if streaming {
+			return
+		}
+		streaming = true
+		c.Header("Content-Type", "text/event-stream")
+		c.Header("Cache-Control", "no-cache")
+		c.Header("Connection", "keep-alive")
+		c.Header("X-Accel-Buffering", "no")
+		c.Status(http.StatusOK)
+	}
+
+	response, isCompleted, budgets, err := h.conversationService.StreamMessage(ctx, userID.(uint), sessionID, req.Message, func(delta string) error {
+		startStream()
+		c.SSEvent("delta", gin.H{"content": delta})
+		c.Writer.Flush()
+		return ctx.Err()
+	})
+	if err != nil {
+		if !streaming {
+			if errors.Is(err, services.ErrConversationNotFound) {
+				utils.ErrorResponse(c, http.StatusNotFound, "Conversation not found", err)
+				return
+			}
+			if errors.Is(err, services.ErrConversationArchived) {
+				utils.ErrorResponse(c, http.StatusConflict, "Conversation is archived", err)
+				return
+			}
+			if errors.Is(err, services.ErrBudgetAlreadyCreated) {
+				utils.ErrorResponse(c, http.StatusConflict, "Budget was already generated", err)
+				return
+			}
+			utils.ErrorResponse(c, http.StatusBadRequest, "Failed to process message", err)
+			return
+		}
+
+		// Nobody is listening any more
+		if ctx.Err() != nil {
+			return
+		}
+
+		c.SSEvent("error", gin.H{"message": "Failed to process message"})
+		c.Writer.Flush()
+		return
+	}
+
+	startStream()
+
+	responseData := gin.H{
+		"assistant_message": response,
+		"completed":         isCompleted,
+	}
+
+	// Include budgets if generated
+	if len(budgets) > 0 {
+		responseData["budgets"] = budgets
+		responseData["budget_generated"] = true
+	}
+
+	c.SSEvent("done", responseData)
+	c.Writer.Flush()
+}
+
 // GetConversationHistory handles GET /api/v1/conversations/:sessionId/history
 func (h *ConversationHandler) GetConversationHistory(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		utils.ErrorResponse(c, http.StatusUnauthorized, "Unauthorized", nil)
+		return
+	}
+
 	sessionID := c.Param("sessionId")
 
-	messages, err := h.conversationService.GetConversationHistory(sessionID)
+	messages, err := h.conversationService.GetConversationHistory(c.Request.Context(), userID.(uint), sessionID)
 	if err != nil {
-		utils.ErrorResponse(c, http.StatusNotFound, "Conversation not found", err)
+		if errors.Is(err, services.ErrConversationNotFound) {
+			utils.ErrorResponse(c, http.StatusNotFound, "Conversation not found", err)
+			return
+		}
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to retrieve history", err)
 		return
 	}
 
@@ -88,11 +273,24 @@ func (h *ConversationHandler) GetConversationHistory(c *gin.Context) {
 
 // ResetConversation handles POST /api/v1/conversations/:sessionId/reset
 func (h *ConversationHandler) ResetConversation(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		utils.ErrorResponse(c, http.StatusUnauthorized, "Unauthorized", nil)
+		return
+	}
+
 	sessionID := c.Param("sessionId")
 
-	conversation, greetingMsg, err := h.conversationService.ResetConversation(sessionID)
+	conversation, greetingMsg, err := h.conversationService.ResetConversation(c.Request.Context(), userID.(uint), sessionID)
 	if err != nil {
-		utils.ErrorResponse(c, http.StatusBadRequest, "Failed to reset conversation", err)
+		switch {
+		case errors.Is(err, services.ErrConversationNotFound):
+			utils.ErrorResponse(c, http.StatusNotFound, "Conversation not found", err)
+		case errors.Is(err, services.ErrBudgetInterviewActive):
+			utils.ErrorResponse(c, http.StatusConflict, "Budget interview already active", err)
+		default:
+			utils.ErrorResponse(c, http.StatusBadRequest, "Failed to reset conversation", err)
+		}
 		return
 	}
 
@@ -102,3 +300,52 @@ func (h *ConversationHandler) ResetConversation(c *gin.Context) {
 		"greeting":       greetingMsg,
 	})
 }
+
+// ArchiveConversation handles POST /api/v1/conversations/:sessionId/archive
+func (h *ConversationHandler) ArchiveConversation(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		utils.ErrorResponse(c, http.StatusUnauthorized, "Unauthorized", nil)
+		return
+	}
+
+	conversation, err := h.conversationService.ArchiveConversation(c.Request.Context(), userID.(uint), c.Param("sessionId"))
+	if err != nil {
+		if errors.Is(err, services.ErrConversationNotFound) {
+			utils.ErrorResponse(c, http.StatusNotFound, "Conversation not found", err)
+			return
+		}
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to archive conversation", err)
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Conversation archived", gin.H{
+		"conversation": conversation,
+	})
+}
+
+// UnarchiveConversation handles POST /api/v1/conversations/:sessionId/unarchive
+func (h *ConversationHandler) UnarchiveConversation(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		utils.ErrorResponse(c, http.StatusUnauthorized, "Unauthorized", nil)
+		return
+	}
+
+	conversation, err := h.conversationService.UnarchiveConversation(c.Request.Context(), userID.(uint), c.Param("sessionId"))
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrConversationNotFound):
+			utils.ErrorResponse(c, http.StatusNotFound, "Conversation not found", err)
+		case errors.Is(err, services.ErrBudgetInterviewActive):
+			utils.ErrorResponse(c, http.StatusConflict, "Budget interview already active", err)
+		default:
+			utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to unarchive conversation", err)
+		}
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Conversation unarchived", gin.H{
+		"conversation": conversation,
+	})
+}
@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stewicca/angagrar-backend/internal/services"
+	"github.com/stewicca/angagrar-backend/pkg/utils"
+)
+
+type CostOfLivingHandler struct {
+	costOfLivingService services.CostOfLivingService
+}
+
+func NewCostOfLivingHandler(costOfLivingService services.CostOfLivingService) *CostOfLivingHandler {
+	return &CostOfLivingHandler{
+		costOfLivingService: costOfLivingService,
+	}
+}
+
+// ListCityCosts handles GET /api/v1/admin/city-costs
+func (h *CostOfLivingHandler) ListCityCosts(c *gin.Context) {
+	costs, err := h.costOfLivingService.ListCosts(c.Request.Context(), c.Query("city"))
+	if err != nil {
+		if errors.Is(err, services.ErrUnknownLocation) {
+			utils.ValidationErrorResponse(c, err.Error())
+			return
+		}
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to retrieve city costs", err)
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "City costs retrieved", gin.H{
+		"city_costs": costs,
+	})
+}
+
+// SetCityCost handles PUT /api/v1/admin/city-costs/:city/:lifestyle
+func (h *CostOfLivingHandler) SetCityCost(c *gin.Context) {
+	var req struct {
+		Rent      *float64 `json:"rent" binding:"required"`
+		Food      *float64 `json:"food" binding:"required"`
+		Transport *float64 `json:"transport" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ValidationErrorResponse(c, "Rent, food and transport are required")
+		return
+	}
+
+	cost, err := h.costOfLivingService.SetCost(c.Request.Context(), c.Param("city"), c.Param("lifestyle"), services.CityCostAmounts{
+		Rent:      *req.Rent,
+		Food:      *req.Food,
+		Transport: *req.Transport,
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrUnknownLocation),
+			errors.Is(err, services.ErrInvalidLifestyle),
+			errors.Is(err, services.ErrInvalidCityCost):
+			utils.ValidationErrorResponse(c, err.Error())
+		default:
+			utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to save city cost", err)
+		}
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "City cost saved", gin.H{
+		"city_cost": cost,
+	})
+}
+
+// DeleteCityCost handles DELETE /api/v1/admin/city-costs/:city/:lifestyle
+func (h *CostOfLivingHandler) DeleteCityCost(c *gin.Context) {
+	err := h.costOfLivingService.DeleteCost(c.Request.Context(), c.Param("city"), c.Param("lifestyle"))
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrCityCostNotFound):
+			utils.ErrorResponse(c, http.StatusNotFound, "City cost not found", err)
+		case errors.Is(err, services.ErrUnknownLocation), errors.Is(err, services.ErrInvalidLifestyle):
+			utils.ValidationErrorResponse(c, err.Error())
+		default:
+			utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to delete city cost", err)
+		}
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "City cost deleted", nil)
+}
@@ -0,0 +1,325 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stewicca/angagrar-backend/config"
+	"github.com/stewicca/angagrar-backend/internal/database"
+	"github.com/stewicca/angagrar-backend/internal/middleware"
+	"github.com/stewicca/angagrar-backend/internal/repositories"
+	"github.com/stewicca/angagrar-backend/internal/services"
+	"github.com/stewicca/angagrar-backend/pkg/utils"
+)
+
+// newTestRouter serves the API on a fresh in-memory SQLite database with the
+// scripted LLM, wired like cmd/server
+func newTestRouter(t *testing.T) *gin.Engine {
+	t.Helper()
+	ctx := context.Background()
+
+	db, err := database.Open(&config.Config{DBDriver: database.DriverSQLite, DBPath: database.SQLiteMemory})
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+	migrator, err := database.NewMigrator(db)
+	if err != nil {
+		t.Fatalf("NewMigrator: %v", err)
+	}
+	if _, err := migrator.Up(ctx); err != nil {
+		t.Fatalf("migrate up: %v", err)
+	}
+
+	userRepo := repositories.NewUserRepository(db)
+	transactionRepo := repositories.NewTransactionRepository(db)
+	budgetRepo := repositories.NewBudgetRepository(db)
+	profileRepo := repositories.NewFinancialProfileRepository(db)
+
+	keyring, err := utils.NewKeyring("test", utils.NewHMACKey("test", []byte("test-secret")))
+	if err != nil {
+		t.Fatalf("NewKeyring: %v", err)
+	}
+	calendar, err := services.NewBudgetCalendar(time.UTC, nil)
+	if err != nil {
+		t.Fatalf("NewBudgetCalendar: %v", err)
+	}
+	costOfLiving := services.NewCostOfLivingService(repositories.NewCityCostRepository(db))
+	seed, err := services.LoadCityCostSeed("")
+	if err != nil {
+		t.Fatalf("LoadCityCostSeed: %v", err)
+	}
+	if _, err := costOfLiving.SyncSeed(ctx, seed); err != nil {
+		t.Fatalf("SyncSeed: %v", err)
+	}
+
+	authService := services.NewAuthService(userRepo, repositories.NewRefreshTokenRepository(db), repositories.NewRevokedTokenRepository(db), keyring, 15*time.Minute, time.Hour)
+	transactionService := services.NewTransactionService(transactionRepo, budgetRepo, nil)
+	budgetService := services.NewBudgetService(budgetRepo, transactionRepo, userRepo, profileRepo, calendar, costOfLiving)
+	usage := services.NewUsageService(repositories.NewLLMUsageRepository(db), userRepo, nil, nil, services.LLMProviderScripted)
+	conversationService := services.NewConversationService(repositories.NewConversationRepository(db), repositories.NewMessageRepository(db), budgetRepo, userRepo, profileRepo,
+		repositories.NewUnitOfWork(db), calendar, costOfLiving, services.NewContextWindow(services.NewTokenCounter(services.LLMProviderScripted), 0, 8), usage, services.NewScriptedLLMService(nil))
+
+	authHandler := NewAuthHandler(authService)
+	transactionHandler := NewTransactionHandler(transactionService)
+	budgetHandler := NewBudgetHandler(budgetService)
+	conversationHandler := NewConversationHandler(conversationService, time.Minute)
+	authMiddleware := middleware.AuthMiddleware(keyring, authService)
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	api := r.Group("/api/v1")
+	api.POST("/auth/guest", authHandler.CreateGuest)
+	api.POST("/auth/logout", authMiddleware, authHandler.Logout)
+
+	transactions := api.Group("/transactions", authMiddleware)
+	transactions.POST("", transactionHandler.CreateTransaction)
+	transactions.GET("", transactionHandler.GetTransactions)
+	transactions.GET("/:id", transactionHandler.GetTransaction)
+	transactions.PUT("/:id", transactionHandler.ReplaceTransaction)
+	transactions.PATCH("/:id", transactionHandler.UpdateTransaction)
+	transactions.DELETE("/:id", transactionHandler.DeleteTransaction)
+
+	conversations := api.Group("/conversations", authMiddleware)
+	conversations.POST("/start", conversationHandler.StartConversation)
+	conversations.POST("/:sessionId/messages", conversationHandler.SendMessage)
+	conversations.GET("/:sessionId/history", conversationHandler.GetConversationHistory)
+	conversations.POST("/:sessionId/reset", conversationHandler.ResetConversation)
+
+	budgets := api.Group("/budgets", authMiddleware)
+	budgets.GET("", budgetHandler.GetUserBudgets)
+	budgets.POST("", budgetHandler.CreateBudget)
+
+	return r
+}
+
+// call sends a JSON request and decodes the JSON response into out
+func call(t *testing.T, r http.Handler, method, path, token string, body any, out any) int {
+	t.Helper()
+
+	var reader bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&reader).Encode(body); err != nil {
+			t.Fatalf("encode body: %v", err)
+		}
+	}
+	req := httptest.NewRequest(method, path, &reader)
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	if out != nil && w.Body.Len() > 0 {
+		if err := json.Unmarshal(w.Body.Bytes(), out); err != nil {
+			t.Fatalf("%s %s: decode %q: %v", method, path, w.Body.String(), err)
+		}
+	}
+	return w.Code
+}
+
+// guestToken creates a guest and returns its access token
+func guestToken(t *testing.T, r http.Handler) string {
+	t.Helper()
+
+	var resp struct {
+		Token string `json:"token"`
+	}
+	if code := call(t, r, http.MethodPost, "/api/v1/auth/guest", "", nil, &resp); code != http.StatusCreated {
+		t.Fatalf("create guest: status %d", code)
+	}
+	return resp.Token
+}
+
+func TestProtectedRoutesNeedALiveToken(t *testing.T) {
+	r := newTestRouter(t)
+	token := guestToken(t, r)
+
+	if code := call(t, r, http.MethodGet, "/api/v1/transactions", "", nil, nil); code != http.StatusUnauthorized {
+		t.Errorf("expected 401 without a token, got %d", code)
+	}
+	if code := call(t, r, http.MethodGet, "/api/v1/transactions", token, nil, nil); code != http.StatusOK {
+		t.Errorf("expected 200 with the token, got %d", code)
+	}
+
+	if code := call(t, r, http.MethodPost, "/api/v1/auth/logout", token, nil, nil); code != http.StatusOK {
+		t.Fatalf("logout: status %d", code)
+	}
+	if code := call(t, r, http.MethodGet, "/api/v1/transactions", token, nil, nil); code != http.StatusUnauthorized {
+		t.Errorf("expected 401 after logout, got %d", code)
+	}
+}
+
+func TestTransactionsAreScopedToTheirOwner(t *testing.T) {
+	r := newTestRouter(t)
+	owner, intruder := guestToken(t, r), guestToken(t, r)
+
+	var created struct {
+		Transaction struct {
+			ID uint `json:"id"`
+		} `json:"transaction"`
+	}
+	code := call(t, r, http.MethodPost, "/api/v1/transactions", owner, gin.H{
+		"type": "expense", "category": "Makan", "amount": 25000, "date": time.Now().Format(time.RFC3339),
+	}, &created)
+	if code != http.StatusCreated {
+		t.Fatalf("create transaction: status %d", code)
+	}
+	path := fmt.Sprintf("/api/v1/transactions/%d", created.Transaction.ID)
+
+	if code := call(t, r, http.MethodGet, path, owner, nil, nil); code != http.StatusOK {
+		t.Errorf("expected the owner to get the transaction, got %d", code)
+	}
+	if code := call(t, r, http.MethodGet, path, intruder, nil, nil); code != http.StatusNotFound {
+		t.Errorf("expected 404 for another user, got %d", code)
+	}
+	if code := call(t, r, http.MethodDelete, path, intruder, nil, nil); code != http.StatusNotFound {
+		t.Errorf("expected 404 deleting for another user, got %d", code)
+	}
+
+	var page struct {
+		Transactions []json.RawMessage `json:"transactions"`
+	}
+	if code := call(t, r, http.MethodGet, "/api/v1/transactions", intruder, nil, &page); code != http.StatusOK || len(page.Transactions) != 0 {
+		t.Errorf("expected an empty list for another user, got %d with %d transactions", code, len(page.Transactions))
+	}
+	if code := call(t, r, http.MethodGet, "/api/v1/transactions", owner, nil, &page); code != http.StatusOK || len(page.Transactions) != 1 {
+		t.Errorf("expected the owner's transaction, got %d with %d transactions", code, len(page.Transactions))
+	}
+}
+
+func TestConversationGeneratesBudgets(t *testing.T) {
+	r := newTestRouter(t)
+	owner, intruder := guestToken(t, r), guestToken(t, r)
+
+	var started struct {
+		Data struct {
+			SessionID string `json:"session_id"`
+		} `json:"data"`
+	}
+	if code := call(t, r, http.MethodPost, "/api/v1/conversations/start", owner, nil, &started); code != http.StatusOK {
+		t.Fatalf("start conversation: status %d", code)
+	}
+	session := "/api/v1/conversations/" + started.Data.SessionID
+
+	if code := call(t, r, http.MethodPost, "/api/v1/conversations/start", owner, nil, nil); code != http.StatusConflict {
+		t.Errorf("expected 409 for a second budget interview, got %d", code)
+	}
+	for _, path := range []string{session + "/messages", session + "/reset"} {
+		if code := call(t, r, http.MethodPost, path, intruder, gin.H{"message": "buatin budget"}, nil); code != http.StatusNotFound {
+			t.Errorf("POST %s: expected 404 for another user, got %d", path, code)
+		}
+	}
+
+	var reply struct {
+		Data struct {
+			Completed bool              `json:"completed"`
+			Budgets   []json.RawMessage `json:"budgets"`
+		} `json:"data"`
+	}
+	if code := call(t, r, http.MethodPost, session+"/messages", owner, gin.H{"message": "buatin budget"}, &reply); code != http.StatusOK {
+		t.Fatalf("send message: status %d", code)
+	}
+	if !reply.Data.Completed || len(reply.Data.Budgets) == 0 {
+		t.Fatalf("expected the budget to be generated, got %+v", reply.Data)
+	}
+
+	var history struct {
+		Data struct {
+			Messages []json.RawMessage `json:"messages"`
+		} `json:"data"`
+	}
+	if code := call(t, r, http.MethodGet, session+"/history", owner, nil, &history); code != http.StatusOK || len(history.Data.Messages) != 3 {
+		t.Errorf("expected 3 messages in the history, got %d with %d", code, len(history.Data.Messages))
+	}
+	if code := call(t, r, http.MethodGet, session+"/history", intruder, nil, nil); code != http.StatusNotFound {
+		t.Errorf("expected 404 reading another user's history, got %d", code)
+	}
+
+	var budgets struct {
+		Data struct {
+			Budgets []json.RawMessage `json:"budgets"`
+		} `json:"data"`
+	}
+	if code := call(t, r, http.MethodGet, "/api/v1/budgets", owner, nil, &budgets); code != http.StatusOK || len(budgets.Data.Budgets) != len(reply.Data.Budgets) {
+		t.Errorf("expected %d budgets, got %d with %d", len(reply.Data.Budgets), code, len(budgets.Data.Budgets))
+	}
+	if code := call(t, r, http.MethodGet, "/api/v1/budgets", intruder, nil, &budgets); code != http.StatusOK || len(budgets.Data.Budgets) != 0 {
+		t.Errorf("expected no budgets for another user, got %d with %d", code, len(budgets.Data.Budgets))
+	}
+}
+
+func TestUpdateTransactionBudgetLink(t *testing.T) {
+	r := newTestRouter(t)
+	token := guestToken(t, r)
+
+	var budget struct {
+		Data struct {
+			Budget struct {
+				ID uint `json:"id"`
+			} `json:"budget"`
+		} `json:"data"`
+	}
+	if code := call(t, r, http.MethodPost, "/api/v1/budgets", token, gin.H{"category": "Makan", "amount": 1000000}, &budget); code != http.StatusCreated {
+		t.Fatalf("create budget: status %d", code)
+	}
+	budgetID := budget.Data.Budget.ID
+
+	type transactionResponse struct {
+		Transaction struct {
+			ID       uint  `json:"id"`
+			BudgetID *uint `json:"budget_id"`
+		} `json:"transaction"`
+	}
+	body := gin.H{"type": "expense", "category": "Makan", "amount": 25000, "date": time.Now().Format(time.RFC3339)}
+	var created transactionResponse
+	if code := call(t, r, http.MethodPost, "/api/v1/transactions", token, body, &created); code != http.StatusCreated {
+		t.Fatalf("create transaction: status %d", code)
+	}
+	if created.Transaction.BudgetID == nil || *created.Transaction.BudgetID != budgetID {
+		t.Fatalf("expected the expense to be linked to budget %d, got %v", budgetID, created.Transaction.BudgetID)
+	}
+	path := fmt.Sprintf("/api/v1/transactions/%d", created.Transaction.ID)
+
+	tests := []struct {
+		name   string
+		method string
+		body   gin.H
+		want   *uint
+	}{
+		{"PATCH without budget_id keeps the link", http.MethodPatch, gin.H{"amount": 30000}, &budgetID},
+		{"PUT without budget_id unlinks", http.MethodPut, body, nil},
+		{"PUT with budget_id links", http.MethodPut, gin.H{"budget_id": budgetID, "type": "expense", "category": "Makan", "amount": 25000, "date": body["date"]}, &budgetID},
+		{"PATCH with a null budget_id unlinks", http.MethodPatch, gin.H{"budget_id": nil}, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var updated transactionResponse
+			if code := call(t, r, tt.method, path, token, tt.body, &updated); code != http.StatusOK {
+				t.Fatalf("status %d", code)
+			}
+
+			got := updated.Transaction.BudgetID
+			switch {
+			case tt.want == nil && got != nil:
+				t.Errorf("expected no budget, got %d", *got)
+			case tt.want != nil && (got == nil || *got != *tt.want):
+				t.Errorf("expected budget %d, got %v", *tt.want, got)
+			}
+		})
+	}
+}
@@ -1,10 +1,15 @@
 package handlers
 
 import (
+	"encoding/json"
+	"errors"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/stewicca/angagrar-backend/internal/repositories"
 	"github.com/stewicca/angagrar-backend/internal/services"
 )
 
@@ -25,6 +30,32 @@ type CreateTransactionRequest struct {
 	Date        time.Time `json:"date" binding:"required"`
 }
 
+// PatchTransactionRequest only changes the fields present in the body.
+// Sending "budget_id": null unlinks the transaction from its budget.
+type PatchTransactionRequest struct {
+	BudgetID    *uint      `json:"budget_id"`
+	Type        *string    `json:"type" binding:"omitempty,oneof=income expense"`
+	Category    *string    `json:"category" binding:"omitempty,min=1"`
+	Amount      *float64   `json:"amount" binding:"omitempty,gt=0"`
+	Description *string    `json:"description"`
+	Date        *time.Time `json:"date"`
+}
+
+type ListTransactionsRequest struct {
+	StartDate string   `form:"start_date"`
+	EndDate   string   `form:"end_date"`
+	Type      string   `form:"type" binding:"omitempty,oneof=income expense"`
+	Category  string   `form:"category"`
+	BudgetID  *uint    `form:"budget_id"`
+	MinAmount *float64 `form:"min_amount" binding:"omitempty,gte=0"`
+	MaxAmount *float64 `form:"max_amount" binding:"omitempty,gte=0"`
+	Query     string   `form:"q"`
+	Sort      string   `form:"sort" binding:"omitempty,oneof=date amount created_at"`
+	Order     string   `form:"order" binding:"omitempty,oneof=asc desc"`
+	Cursor    string   `form:"cursor"`
+	Limit     int      `form:"limit" binding:"omitempty,min=1"`
+}
+
 func (h *TransactionHandler) CreateTransaction(c *gin.Context) {
 	userID, exists := c.Get("userID")
 	if !exists {
@@ -39,6 +70,7 @@ func (h *TransactionHandler) CreateTransaction(c *gin.Context) {
 	}
 
 	transaction, err := h.transactionService.CreateTransaction(
+		c.Request.Context(),
 		userID.(uint),
 		req.BudgetID,
 		req.Type,
@@ -48,7 +80,7 @@ func (h *TransactionHandler) CreateTransaction(c *gin.Context) {
 		req.Date,
 	)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		respondTransactionError(c, err, "Failed to create transaction")
 		return
 	}
 
@@ -58,6 +90,7 @@ func (h *TransactionHandler) CreateTransaction(c *gin.Context) {
 	})
 }
 
+// GetTransactions handles GET /api/v1/transactions
 func (h *TransactionHandler) GetTransactions(c *gin.Context) {
 	userID, exists := c.Get("userID")
 	if !exists {
@@ -65,13 +98,219 @@ func (h *TransactionHandler) GetTransactions(c *gin.Context) {
 		return
 	}
 
-	transactions, err := h.transactionService.GetUserTransactions(userID.(uint))
+	var req ListTransactionsRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	filter := repositories.TransactionFilter{
+		Type:      req.Type,
+		Category:  req.Category,
+		BudgetID:  req.BudgetID,
+		MinAmount: req.MinAmount,
+		MaxAmount: req.MaxAmount,
+		Search:    req.Query,
+		SortBy:    req.Sort,
+		Ascending: req.Order == "asc",
+		Limit:     req.Limit,
+	}
+
+	if req.StartDate != "" {
+		start, _, err := parseDateParam(req.StartDate)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "start_date must be YYYY-MM-DD or RFC3339"})
+			return
+		}
+		filter.DateFrom = &start
+	}
+
+	if req.EndDate != "" {
+		end, dateOnly, err := parseDateParam(req.EndDate)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "end_date must be YYYY-MM-DD or RFC3339"})
+			return
+		}
+		// A plain date includes the whole day
+		if dateOnly {
+			end = end.AddDate(0, 0, 1).Add(-time.Nanosecond)
+		}
+		filter.DateTo = &end
+	}
+
+	page, err := h.transactionService.ListTransactions(c.Request.Context(), userID.(uint), services.TransactionQuery{
+		Filter: filter,
+		Cursor: req.Cursor,
+	})
 	if err != nil {
+		if errors.Is(err, services.ErrInvalidCursor) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch transactions"})
 		return
 	}
 
+	c.JSON(http.StatusOK, page)
+}
+
+// GetTransaction handles GET /api/v1/transactions/:id
+func (h *TransactionHandler) GetTransaction(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	transactionID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid transaction ID"})
+		return
+	}
+
+	transaction, err := h.transactionService.GetTransaction(c.Request.Context(), userID.(uint), uint(transactionID))
+	if err != nil {
+		respondTransactionError(c, err, "Failed to fetch transaction")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"transaction": transaction,
+	})
+}
+
+// ReplaceTransaction handles PUT /api/v1/transactions/:id
+func (h *TransactionHandler) ReplaceTransaction(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	transactionID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid transaction ID"})
+		return
+	}
+
+	var req CreateTransactionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	transaction, err := h.transactionService.UpdateTransaction(c.Request.Context(), userID.(uint), uint(transactionID), services.TransactionUpdate{
+		BudgetID:    req.BudgetID,
+		ClearBudget: req.BudgetID == nil,
+		Type:        &req.Type,
+		Category:    &req.Category,
+		Amount:      &req.Amount,
+		Description: &req.Description,
+		Date:        &req.Date,
+	})
+	if err != nil {
+		respondTransactionError(c, err, "Failed to update transaction")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":     "Transaction updated successfully",
+		"transaction": transaction,
+	})
+}
+
+// UpdateTransaction handles PATCH /api/v1/transactions/:id
+func (h *TransactionHandler) UpdateTransaction(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	transactionID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid transaction ID"})
+		return
+	}
+
+	var req PatchTransactionRequest
+	if err := c.ShouldBindBodyWith(&req, binding.JSON); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// A null budget_id and a missing one both decode to nil, so look at the raw keys
+	var fields map[string]json.RawMessage
+	if err := c.ShouldBindBodyWith(&fields, binding.JSON); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	_, hasBudgetID := fields["budget_id"]
+
+	transaction, err := h.transactionService.UpdateTransaction(c.Request.Context(), userID.(uint), uint(transactionID), services.TransactionUpdate{
+		BudgetID:    req.BudgetID,
+		ClearBudget: hasBudgetID && req.BudgetID == nil,
+		Type:        req.Type,
+		Category:    req.Category,
+		Amount:      req.Amount,
+		Description: req.Description,
+		Date:        req.Date,
+	})
+	if err != nil {
+		respondTransactionError(c, err, "Failed to update transaction")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":     "Transaction updated successfully",
+		"transaction": transaction,
+	})
+}
+
+// DeleteTransaction handles DELETE /api/v1/transactions/:id
+func (h *TransactionHandler) DeleteTransaction(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	transactionID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid transaction ID"})
+		return
+	}
+
+	if err := h.transactionService.DeleteTransaction(c.Request.Context(), userID.(uint), uint(transactionID)); err != nil {
+		respondTransactionError(c, err, "Failed to delete transaction")
+		return
+	}
+
 	c.JSON(http.StatusOK, gin.H{
-		"transactions": transactions,
+		"message": "Transaction deleted successfully",
 	})
 }
+
+func respondTransactionError(c *gin.Context, err error, message string) {
+	switch {
+	case errors.Is(err, services.ErrTransactionNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrInvalidTransactionAmount),
+		errors.Is(err, services.ErrInvalidTransactionType),
+		errors.Is(err, services.ErrBudgetNotFound):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": message})
+	}
+}
+
+// parseDateParam accepts a plain date or an RFC3339 timestamp and reports
+// which one it got
+func parseDateParam(value string) (time.Time, bool, error) {
+	if date, err := time.Parse("2006-01-02", value); err == nil {
+		return date, true, nil
+	}
+
+	timestamp, err := time.Parse(time.RFC3339, value)
+	return timestamp, false, err
+}
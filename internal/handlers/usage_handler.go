@@ -0,0 +1,101 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stewicca/angagrar-backend/internal/services"
+	"github.com/stewicca/angagrar-backend/pkg/utils"
+)
+
+// defaultSpendReportDays is the range of a spend report without dates
+const defaultSpendReportDays = 30
+
+type UsageHandler struct {
+	usageService services.UsageService
+}
+
+func NewUsageHandler(usageService services.UsageService) *UsageHandler {
+	return &UsageHandler{
+		usageService: usageService,
+	}
+}
+
+// GetDailySpend handles GET /api/v1/admin/llm-usage. from and to are
+// YYYY-MM-DD and both included; the default is the last 30 days.
+func (h *UsageHandler) GetDailySpend(c *gin.Context) {
+	now := time.Now()
+	to := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.Local)
+	if value := c.Query("to"); value != "" {
+		parsed, err := time.ParseInLocation("2006-01-02", value, time.Local)
+		if err != nil {
+			utils.ValidationErrorResponse(c, "to must be a date in YYYY-MM-DD format")
+			return
+		}
+		to = parsed
+	}
+
+	from := to.AddDate(0, 0, 1-defaultSpendReportDays)
+	if value := c.Query("from"); value != "" {
+		parsed, err := time.ParseInLocation("2006-01-02", value, time.Local)
+		if err != nil {
+			utils.ValidationErrorResponse(c, "from must be a date in YYYY-MM-DD format")
+			return
+		}
+		from = parsed
+	}
+
+	report, err := h.usageService.DailySpend(c.Request.Context(), from, to.AddDate(0, 0, 1))
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidDateRange) {
+			utils.ValidationErrorResponse(c, err.Error())
+			return
+		}
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to retrieve LLM usage", err)
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "LLM usage retrieved", gin.H{
+		"from":   from.Format("2006-01-02"),
+		"to":     to.Format("2006-01-02"),
+		"report": report,
+	})
+}
+
+// SetUserTier handles PUT /api/v1/admin/users/:id/tier
+func (h *UsageHandler) SetUserTier(c *gin.Context) {
+	userID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		utils.ValidationErrorResponse(c, "Invalid user ID")
+		return
+	}
+
+	var req struct {
+		Tier *string `json:"tier" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ValidationErrorResponse(c, "Tier is required, send an empty tier for the default")
+		return
+	}
+
+	user, err := h.usageService.SetTier(c.Request.Context(), uint(userID), *req.Tier)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrUserNotFound):
+			utils.ErrorResponse(c, http.StatusNotFound, "User not found", err)
+		case errors.Is(err, services.ErrInvalidTier):
+			utils.ValidationErrorResponse(c, err.Error())
+		default:
+			utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to update tier", err)
+		}
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Tier updated", gin.H{
+		"user_id": user.ID,
+		"tier":    user.UsageTier(),
+	})
+}
@@ -1,9 +1,11 @@
 package handlers
 
 import (
+	"errors"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
+	"github.com/stewicca/angagrar-backend/internal/models"
 	"github.com/stewicca/angagrar-backend/internal/services"
 )
 
@@ -15,6 +17,19 @@ func NewUserHandler(userService services.UserService) *UserHandler {
 	return &UserHandler{userService: userService}
 }
 
+type UpdateFinancialProfileRequest struct {
+	Salary            *float64                   `json:"salary"`
+	City              *string                    `json:"city"`
+	Lifestyle         *string                    `json:"lifestyle"`
+	RecurringExpenses *[]models.RecurringExpense `json:"recurring_expenses"`
+	Goals             *[]string                  `json:"goals"`
+}
+
+type UpdatePayCycleRequest struct {
+	PayDay           *int    `json:"pay_day" binding:"omitempty,min=1,max=31"`
+	PayDayAdjustment *string `json:"pay_day_adjustment" binding:"omitempty,oneof=none previous_business_day next_business_day"`
+}
+
 func (h *UserHandler) GetProfile(c *gin.Context) {
 	userID, exists := c.Get("userID")
 	if !exists {
@@ -22,7 +37,7 @@ func (h *UserHandler) GetProfile(c *gin.Context) {
 		return
 	}
 
-	user, err := h.userService.GetProfile(userID.(uint))
+	user, err := h.userService.GetProfile(c.Request.Context(), userID.(uint))
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
 		return
@@ -32,3 +47,107 @@ func (h *UserHandler) GetProfile(c *gin.Context) {
 		"user": user,
 	})
 }
+
+// GetPayCycle handles GET /api/v1/users/profile/pay-cycle
+func (h *UserHandler) GetPayCycle(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	payCycle, err := h.userService.GetPayCycle(c.Request.Context(), userID.(uint))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"pay_cycle": payCycle,
+	})
+}
+
+// UpdatePayCycle handles PATCH /api/v1/users/profile/pay-cycle
+func (h *UserHandler) UpdatePayCycle(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	var req UpdatePayCycleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	payCycle, err := h.userService.UpdatePayCycle(c.Request.Context(), userID.(uint), req.PayDay, req.PayDayAdjustment)
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidPayDay) || errors.Is(err, services.ErrInvalidPayDayAdjust) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update pay cycle"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"pay_cycle": payCycle,
+	})
+}
+
+// GetFinancialProfile handles GET /api/v1/users/profile/financial
+func (h *UserHandler) GetFinancialProfile(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	profile, err := h.userService.GetFinancialProfile(c.Request.Context(), userID.(uint))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch financial profile"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"financial_profile": profile,
+	})
+}
+
+// UpdateFinancialProfile handles PATCH /api/v1/users/profile/financial
+func (h *UserHandler) UpdateFinancialProfile(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	var req UpdateFinancialProfileRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	profile, err := h.userService.UpdateFinancialProfile(c.Request.Context(), userID.(uint), services.FinancialProfileUpdate{
+		Salary:            req.Salary,
+		City:              req.City,
+		Lifestyle:         req.Lifestyle,
+		RecurringExpenses: req.RecurringExpenses,
+		Goals:             req.Goals,
+	})
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidSalary) ||
+			errors.Is(err, services.ErrInvalidLifestyle) ||
+			errors.Is(err, services.ErrInvalidExpense) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update financial profile"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"financial_profile": profile,
+	})
+}
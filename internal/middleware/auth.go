@@ -1,6 +1,7 @@
 package middleware
 
 import (
+	"context"
 	"net/http"
 	"strings"
 
@@ -8,7 +9,12 @@ import (
 	"github.com/stewicca/angagrar-backend/pkg/utils"
 )
 
-func AuthMiddleware(jwtSecret string) gin.HandlerFunc {
+// TokenRevocationChecker reports whether an access token jti has been revoked
+type TokenRevocationChecker interface {
+	IsTokenRevoked(ctx context.Context, jti string) (bool, error)
+}
+
+func AuthMiddleware(keyring *utils.Keyring, revocations TokenRevocationChecker) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		authHeader := c.GetHeader("Authorization")
 		if authHeader == "" {
@@ -25,15 +31,34 @@ func AuthMiddleware(jwtSecret string) gin.HandlerFunc {
 		}
 
 		token := tokenParts[1]
-		claims, err := utils.ValidateToken(token, jwtSecret)
+		claims, err := utils.ValidateToken(token, keyring)
 		if err != nil {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired token"})
 			c.Abort()
 			return
 		}
 
+		// Tokens issued before jti was introduced cannot be revoked and simply expire
+		if claims.ID != "" {
+			revoked, err := revocations.IsTokenRevoked(c.Request.Context(), claims.ID)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify token"})
+				c.Abort()
+				return
+			}
+			if revoked {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "Token has been revoked"})
+				c.Abort()
+				return
+			}
+		}
+
 		c.Set("userID", claims.UserID)
 		c.Set("guestID", claims.GuestID)
+		c.Set("tokenID", claims.ID)
+		if claims.ExpiresAt != nil {
+			c.Set("tokenExpiresAt", claims.ExpiresAt.Time)
+		}
 		c.Next()
 	}
 }
@@ -6,17 +6,26 @@ import (
 	"gorm.io/gorm"
 )
 
+// Budget periods
+const (
+	BudgetPeriodMonthly = "monthly"
+	BudgetPeriodYearly  = "yearly"
+)
+
 type Budget struct {
-	ID           uint           `gorm:"primaryKey" json:"id"`
-	UserID       uint           `gorm:"not null;index" json:"user_id"`
-	Category     string         `gorm:"not null" json:"category"`
-	Amount       float64        `gorm:"not null" json:"amount"`
-	Period       string         `gorm:"not null" json:"period"` // monthly, yearly
-	StartDate    time.Time      `gorm:"not null" json:"start_date"`
-	EndDate      time.Time      `gorm:"not null" json:"end_date"`
-	Description  string         `json:"description"`
-	CreatedAt    time.Time      `json:"created_at"`
-	UpdatedAt    time.Time      `json:"updated_at"`
-	DeletedAt    gorm.DeletedAt `gorm:"index" json:"-"`
-	Transactions []Transaction  `gorm:"foreignKey:BudgetID" json:"transactions,omitempty"`
+	ID               uint           `gorm:"primaryKey" json:"id"`
+	UserID           uint           `gorm:"not null;index" json:"user_id"`
+	Category         string         `gorm:"not null" json:"category"`
+	Amount           float64        `gorm:"not null" json:"amount"` // Includes RolloverAmount
+	Period           string         `gorm:"not null" json:"period"` // monthly, yearly
+	StartDate        time.Time      `gorm:"not null" json:"start_date"`
+	EndDate          time.Time      `gorm:"not null" json:"end_date"`
+	Description      string         `json:"description"`
+	Rollover         bool           `gorm:"default:false" json:"rollover"`                   // Carry unspent or overspent amount into the next period
+	RolloverAmount   float64        `gorm:"default:0" json:"rollover_amount"`                // Carried in from PreviousBudgetID, negative if overspent
+	PreviousBudgetID *uint          `gorm:"uniqueIndex" json:"previous_budget_id,omitempty"` // Budget this one was renewed from
+	CreatedAt        time.Time      `json:"created_at"`
+	UpdatedAt        time.Time      `json:"updated_at"`
+	DeletedAt        gorm.DeletedAt `gorm:"index" json:"-"`
+	Transactions     []Transaction  `gorm:"foreignKey:BudgetID" json:"transactions,omitempty"`
 }
@@ -0,0 +1,35 @@
+package models
+
+import (
+	"time"
+)
+
+// Budget adjustment statuses
+const (
+	BudgetAdjustmentPending  = "pending"
+	BudgetAdjustmentApplied  = "applied"
+	BudgetAdjustmentRejected = "rejected"
+)
+
+// BudgetAdjustment is a change to the user's budgets proposed by Aira after
+// the budget was generated. It is applied once the user confirms it and kept
+// afterwards as a record of the change.
+type BudgetAdjustment struct {
+	ID             uint                     `gorm:"primaryKey" json:"id"`
+	UserID         uint                     `gorm:"not null;index" json:"user_id"`
+	ConversationID uint                     `gorm:"not null;index" json:"conversation_id"`
+	Request        string                   `json:"request"`                // What the user asked for
+	Status         string                   `gorm:"not null" json:"status"` // pending, applied, rejected
+	Changes        []BudgetAdjustmentChange `gorm:"serializer:json" json:"changes"`
+	AppliedAt      *time.Time               `json:"applied_at,omitempty"`
+	CreatedAt      time.Time                `json:"created_at"`
+	UpdatedAt      time.Time                `json:"updated_at"`
+}
+
+// BudgetAdjustmentChange is the new amount of one budget
+type BudgetAdjustmentChange struct {
+	BudgetID uint    `json:"budget_id"`
+	Category string  `json:"category"`
+	Before   float64 `json:"before"`
+	After    float64 `json:"after"`
+}
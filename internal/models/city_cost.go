@@ -0,0 +1,30 @@
+package models
+
+import (
+	"time"
+)
+
+// Where a cost-of-living row comes from
+const (
+	CityCostSourceSeed  = "seed"
+	CityCostSourceAdmin = "admin"
+)
+
+// CityCostNational is the City of the national average, used for places
+// without numbers of their own
+const CityCostNational = "Indonesia"
+
+// CityCost is the typical monthly cost of living of one person with a given
+// lifestyle in a city, a province or the whole country
+type CityCost struct {
+	ID          uint      `gorm:"primaryKey" json:"id"`
+	City        string    `gorm:"uniqueIndex:idx_city_costs_city_lifestyle;not null" json:"city"`      // Normalized location
+	Lifestyle   string    `gorm:"uniqueIndex:idx_city_costs_city_lifestyle;not null" json:"lifestyle"` // Minimalis, Moderate or Santai
+	Rent        float64   `gorm:"not null" json:"rent"`                                                // Rent and utilities
+	Food        float64   `gorm:"not null" json:"food"`
+	Transport   float64   `gorm:"not null" json:"transport"`
+	Source      string    `gorm:"not null;default:seed" json:"source"` // Seeded rows are updated by newer seeds, admin rows are not
+	SeedVersion int       `gorm:"not null;default:0" json:"seed_version"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
@@ -6,17 +6,46 @@ import (
 	"gorm.io/gorm"
 )
 
+// Conversation topics
+const (
+	ConversationTopicBudget  = "budget"  // Budget interview, ends with a generated budget
+	ConversationTopicGeneral = "general" // Free money questions, never generates a budget
+)
+
+// Conversation statuses, derived from CompletedAt and ArchivedAt
+const (
+	ConversationStatusActive    = "active"
+	ConversationStatusCompleted = "completed"
+	ConversationStatusArchived  = "archived"
+)
+
 type Conversation struct {
-	ID              uint           `gorm:"primaryKey" json:"id"`
-	UserID          uint           `gorm:"not null;index" json:"user_id"`
-	SessionID       string         `gorm:"uniqueIndex;not null" json:"session_id"` // UUID for frontend reference
-	BudgetGenerated bool           `gorm:"default:false" json:"budget_generated"`  // Flag if budget has been generated
-	CompletedAt     *time.Time     `json:"completed_at,omitempty"`                 // Null if not completed
-	CreatedAt       time.Time      `json:"created_at"`
-	UpdatedAt       time.Time      `json:"updated_at"`
-	DeletedAt       gorm.DeletedAt `gorm:"index" json:"-"`
+	ID                  uint           `gorm:"primaryKey" json:"id"`
+	UserID              uint           `gorm:"not null;index" json:"user_id"`
+	SessionID           string         `gorm:"uniqueIndex;not null" json:"session_id"` // UUID for frontend reference
+	Topic               string         `gorm:"not null;default:budget" json:"topic"`   // budget, general
+	BudgetGenerated     bool           `gorm:"default:false" json:"budget_generated"`  // Flag if budget has been generated
+	CompletedAt         *time.Time     `json:"completed_at,omitempty"`                 // Null if not completed
+	ArchivedAt          *time.Time     `json:"archived_at,omitempty"`                  // Hidden from the user and closed for messages
+	Summary             string         `gorm:"type:text" json:"-"`                     // Rolling summary of messages too old for the LLM context
+	SummarizedMessageID uint           `gorm:"default:0" json:"-"`                     // Last message folded into Summary
+	CreatedAt           time.Time      `json:"created_at"`
+	UpdatedAt           time.Time      `json:"updated_at"`
+	DeletedAt           gorm.DeletedAt `gorm:"index" json:"-"`
 
 	// Relationships
 	User     User      `gorm:"foreignKey:UserID" json:"user,omitempty"`
 	Messages []Message `gorm:"foreignKey:ConversationID" json:"messages,omitempty"`
 }
+
+// Status is archived, completed or active, in that order of precedence
+func (c *Conversation) Status() string {
+	switch {
+	case c.ArchivedAt != nil:
+		return ConversationStatusArchived
+	case c.CompletedAt != nil:
+		return ConversationStatusCompleted
+	default:
+		return ConversationStatusActive
+	}
+}
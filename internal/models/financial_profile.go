@@ -0,0 +1,25 @@
+package models
+
+import (
+	"time"
+)
+
+// FinancialProfile is what Aira has learned about a user's finances. It is
+// filled during the interview and can be edited by the user.
+type FinancialProfile struct {
+	ID                uint               `gorm:"primaryKey" json:"id"`
+	UserID            uint               `gorm:"uniqueIndex;not null" json:"user_id"`
+	Salary            float64            `gorm:"default:0" json:"salary"` // Monthly income, 0 if unknown
+	City              string             `json:"city"`
+	Lifestyle         string             `json:"lifestyle"` // Minimalis, Moderate or Santai
+	RecurringExpenses []RecurringExpense `gorm:"serializer:json" json:"recurring_expenses"`
+	Goals             []string           `gorm:"serializer:json" json:"goals"`
+	CreatedAt         time.Time          `json:"created_at"`
+	UpdatedAt         time.Time          `json:"updated_at"`
+}
+
+// RecurringExpense is a fixed monthly cost such as rent or an installment
+type RecurringExpense struct {
+	Name   string  `json:"name"`
+	Amount float64 `json:"amount"` // 0 if the user did not say
+}
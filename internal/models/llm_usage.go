@@ -0,0 +1,32 @@
+package models
+
+import (
+	"time"
+)
+
+// What an LLM call was made for
+const (
+	LLMPurposeGreeting   = "greeting"
+	LLMPurposeChat       = "chat"
+	LLMPurposeClassify   = "classify"
+	LLMPurposeBudget     = "budget"
+	LLMPurposeAdjustment = "adjustment"
+	LLMPurposeSummary    = "summary"
+)
+
+// LLMUsage records one LLM call: the tokens it used, how long it took and
+// what it cost. Estimated is set when the provider reported no token counts
+// and they were estimated from the text.
+type LLMUsage struct {
+	ID               uint      `gorm:"primaryKey" json:"id"`
+	UserID           uint      `gorm:"not null;index:idx_llm_usages_user_created,priority:1" json:"user_id"`
+	ConversationID   *uint     `gorm:"index" json:"conversation_id,omitempty"`
+	Purpose          string    `gorm:"not null" json:"purpose"`
+	Model            string    `gorm:"not null" json:"model"`
+	PromptTokens     int       `gorm:"not null" json:"prompt_tokens"`
+	CompletionTokens int       `gorm:"not null" json:"completion_tokens"`
+	Estimated        bool      `gorm:"not null;default:false" json:"estimated"`
+	LatencyMs        int64     `gorm:"not null" json:"latency_ms"`
+	CostUSD          float64   `gorm:"not null" json:"cost_usd"`
+	CreatedAt        time.Time `gorm:"index:idx_llm_usages_user_created,priority:2;index" json:"created_at"`
+}
@@ -0,0 +1,26 @@
+package models
+
+import "time"
+
+// RefreshToken is a single-use refresh token. Rotated tokens share a FamilyID
+// so reuse of an already rotated token can revoke the whole chain.
+type RefreshToken struct {
+	ID            uint       `gorm:"primaryKey" json:"id"`
+	UserID        uint       `gorm:"not null;index" json:"user_id"`
+	FamilyID      string     `gorm:"not null;index" json:"family_id"`
+	TokenHash     string     `gorm:"uniqueIndex;not null" json:"-"`
+	AccessTokenID string     `gorm:"index" json:"-"` // jti of the access token issued alongside
+	ExpiresAt     time.Time  `gorm:"not null" json:"expires_at"`
+	UsedAt        *time.Time `json:"used_at,omitempty"`    // Set once rotated
+	RevokedAt     *time.Time `json:"revoked_at,omitempty"` // Set on logout or reuse detection
+	CreatedAt     time.Time  `json:"created_at"`
+}
+
+// RevokedToken denylists an access token by jti until it expires
+type RevokedToken struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	JTI       string    `gorm:"column:jti;uniqueIndex;not null" json:"jti"`
+	UserID    uint      `gorm:"not null;index" json:"user_id"`
+	ExpiresAt time.Time `gorm:"not null;index" json:"expires_at"`
+	CreatedAt time.Time `json:"created_at"`
+}
@@ -6,12 +6,47 @@ import (
 	"gorm.io/gorm"
 )
 
-// User represents a guest user
+// How a payday that falls on a weekend or holiday is moved
+const (
+	PayDayAdjustNone        = "none"
+	PayDayAdjustPreviousDay = "previous_business_day"
+	PayDayAdjustNextDay     = "next_business_day"
+)
+
+// User represents a guest user, optionally upgraded to a registered account
 type User struct {
-	ID        uint           `gorm:"primaryKey" json:"id"`
-	GuestID   string         `gorm:"uniqueIndex;not null" json:"guest_id"`
-	CreatedAt time.Time      `json:"created_at"`
-	UpdatedAt time.Time      `json:"updated_at"`
-	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
-	Budgets   []Budget       `gorm:"foreignKey:UserID" json:"budgets,omitempty"`
+	ID           uint           `gorm:"primaryKey" json:"id"`
+	GuestID      string         `gorm:"uniqueIndex;not null" json:"guest_id"`
+	Email        *string        `gorm:"uniqueIndex" json:"email,omitempty"` // Null while still a guest
+	PasswordHash string         `json:"-"`
+	RegisteredAt *time.Time     `json:"registered_at,omitempty"`
+	PayDay       int            `gorm:"not null;default:1" json:"pay_day"`               // Day of month budget periods start, 1 = calendar months
+	PayDayAdjust string         `gorm:"not null;default:none" json:"pay_day_adjustment"` // See PayDayAdjust* constants
+	Tier         string         `json:"tier,omitempty"`                                  // LLM quota tier, empty for the guest or registered default
+	CreatedAt    time.Time      `json:"created_at"`
+	UpdatedAt    time.Time      `json:"updated_at"`
+	DeletedAt    gorm.DeletedAt `gorm:"index" json:"-"`
+	Budgets      []Budget       `gorm:"foreignKey:UserID" json:"budgets,omitempty"`
+}
+
+// Default LLM quota tiers of users without an assigned tier
+const (
+	TierGuest      = "guest"
+	TierRegistered = "registered"
+)
+
+// IsGuest reports whether the user has not registered an email yet
+func (u *User) IsGuest() bool {
+	return u.Email == nil
+}
+
+// UsageTier returns the LLM quota tier of the user
+func (u *User) UsageTier() string {
+	if u.Tier != "" {
+		return u.Tier
+	}
+	if u.IsGuest() {
+		return TierGuest
+	}
+	return TierRegistered
 }
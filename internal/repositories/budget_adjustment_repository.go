@@ -0,0 +1,84 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/stewicca/angagrar-backend/internal/models"
+	"gorm.io/gorm"
+)
+
+// errBudgetChanged rolls back an adjustment whose budgets no longer hold the
+// amounts it was proposed for
+var errBudgetChanged = errors.New("budget changed since the adjustment was proposed")
+
+type BudgetAdjustmentRepository interface {
+	Create(ctx context.Context, adjustment *models.BudgetAdjustment) error
+	FindPendingByConversationID(ctx context.Context, conversationID uint) (*models.BudgetAdjustment, error)
+	Update(ctx context.Context, adjustment *models.BudgetAdjustment) error
+	Apply(ctx context.Context, adjustment *models.BudgetAdjustment, at time.Time) (bool, error)
+}
+
+type budgetAdjustmentRepository struct {
+	db *gorm.DB
+}
+
+func NewBudgetAdjustmentRepository(db *gorm.DB) BudgetAdjustmentRepository {
+	return &budgetAdjustmentRepository{db: db}
+}
+
+func (r *budgetAdjustmentRepository) Create(ctx context.Context, adjustment *models.BudgetAdjustment) error {
+	return r.db.WithContext(ctx).Create(adjustment).Error
+}
+
+// FindPendingByConversationID returns the latest adjustment still waiting for
+// the user's confirmation
+func (r *budgetAdjustmentRepository) FindPendingByConversationID(ctx context.Context, conversationID uint) (*models.BudgetAdjustment, error) {
+	var adjustment models.BudgetAdjustment
+	err := r.db.WithContext(ctx).Where("conversation_id = ? AND status = ?", conversationID, models.BudgetAdjustmentPending).
+		Order("id DESC").
+		First(&adjustment).Error
+	if err != nil {
+		return nil, err
+	}
+	return &adjustment, nil
+}
+
+func (r *budgetAdjustmentRepository) Update(ctx context.Context, adjustment *models.BudgetAdjustment) error {
+	return r.db.WithContext(ctx).Save(adjustment).Error
+}
+
+// Apply sets the new budget amounts and marks the adjustment applied in one
+// transaction. It returns false without changing anything when one of the
+// budgets was changed or deleted after the adjustment was proposed.
+func (r *budgetAdjustmentRepository) Apply(ctx context.Context, adjustment *models.BudgetAdjustment, at time.Time) (bool, error) {
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		for _, change := range adjustment.Changes {
+			result := tx.Model(&models.Budget{}).
+				Where("id = ? AND user_id = ? AND amount = ?", change.BudgetID, adjustment.UserID, change.Before).
+				Update("amount", change.After)
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected != 1 {
+				return errBudgetChanged
+			}
+		}
+
+		return tx.Model(adjustment).Updates(map[string]interface{}{
+			"status":     models.BudgetAdjustmentApplied,
+			"applied_at": at,
+		}).Error
+	})
+	if errors.Is(err, errBudgetChanged) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	adjustment.Status = models.BudgetAdjustmentApplied
+	adjustment.AppliedAt = &at
+	return true, nil
+}
@@ -1,17 +1,24 @@
 package repositories
 
 import (
+	"context"
+	"time"
+
 	"github.com/stewicca/angagrar-backend/internal/models"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type BudgetRepository interface {
-	Create(budget *models.Budget) error
-	CreateBatch(budgets []models.Budget) error
-	FindByID(id uint) (*models.Budget, error)
-	FindByUserID(userID uint) ([]models.Budget, error)
-	Update(budget *models.Budget) error
-	Delete(id uint) error
+	Create(ctx context.Context, budget *models.Budget) error
+	CreateBatch(ctx context.Context, budgets []models.Budget) error
+	FindByID(ctx context.Context, id uint) (*models.Budget, error)
+	FindByUserID(ctx context.Context, userID uint) ([]models.Budget, error)
+	FindActiveByUserID(ctx context.Context, userID uint, at time.Time) ([]models.Budget, error)
+	FindRenewable(ctx context.Context, period string, endedFrom, endedBefore time.Time) ([]models.Budget, error)
+	CreateRenewal(ctx context.Context, budget *models.Budget) (bool, error)
+	Update(ctx context.Context, budget *models.Budget) error
+	Delete(ctx context.Context, id uint) error
 }
 
 type budgetRepository struct {
@@ -22,26 +29,26 @@ func NewBudgetRepository(db *gorm.DB) BudgetRepository {
 	return &budgetRepository{db: db}
 }
 
-func (r *budgetRepository) Create(budget *models.Budget) error {
-	return r.db.Create(budget).Error
+func (r *budgetRepository) Create(ctx context.Context, budget *models.Budget) error {
+	return r.db.WithContext(ctx).Create(budget).Error
 }
 
-func (r *budgetRepository) CreateBatch(budgets []models.Budget) error {
-	return r.db.Create(&budgets).Error
+func (r *budgetRepository) CreateBatch(ctx context.Context, budgets []models.Budget) error {
+	return r.db.WithContext(ctx).Create(&budgets).Error
 }
 
-func (r *budgetRepository) FindByID(id uint) (*models.Budget, error) {
+func (r *budgetRepository) FindByID(ctx context.Context, id uint) (*models.Budget, error) {
 	var budget models.Budget
-	err := r.db.First(&budget, id).Error
+	err := r.db.WithContext(ctx).First(&budget, id).Error
 	if err != nil {
 		return nil, err
 	}
 	return &budget, nil
 }
 
-func (r *budgetRepository) FindByUserID(userID uint) ([]models.Budget, error) {
+func (r *budgetRepository) FindByUserID(ctx context.Context, userID uint) ([]models.Budget, error) {
 	var budgets []models.Budget
-	err := r.db.Where("user_id = ?", userID).
+	err := r.db.WithContext(ctx).Where("user_id = ?", userID).
 		Order("created_at DESC").
 		Find(&budgets).Error
 	if err != nil {
@@ -50,10 +57,50 @@ func (r *budgetRepository) FindByUserID(userID uint) ([]models.Budget, error) {
 	return budgets, nil
 }
 
-func (r *budgetRepository) Update(budget *models.Budget) error {
-	return r.db.Save(budget).Error
+// FindActiveByUserID returns the budgets whose period contains at
+func (r *budgetRepository) FindActiveByUserID(ctx context.Context, userID uint, at time.Time) ([]models.Budget, error) {
+	var budgets []models.Budget
+	err := r.db.WithContext(ctx).Where("user_id = ? AND start_date <= ? AND end_date >= ?", userID, at, at).
+		Order("id ASC").
+		Find(&budgets).Error
+	if err != nil {
+		return nil, err
+	}
+	return budgets, nil
+}
+
+// FindRenewable returns budgets of the given period that ended in
+// [endedFrom, endedBefore) and were never renewed. Soft deleted renewals
+// still count, so a renewal the user deleted is not recreated.
+func (r *budgetRepository) FindRenewable(ctx context.Context, period string, endedFrom, endedBefore time.Time) ([]models.Budget, error) {
+	var budgets []models.Budget
+	err := r.db.WithContext(ctx).Where("period = ? AND end_date >= ? AND end_date < ?", period, endedFrom, endedBefore).
+		Where("NOT EXISTS (SELECT 1 FROM budgets renewed WHERE renewed.previous_budget_id = budgets.id)").
+		Order("user_id ASC, id ASC").
+		Find(&budgets).Error
+	if err != nil {
+		return nil, err
+	}
+	return budgets, nil
+}
+
+// CreateRenewal inserts a renewed budget. It returns false when another
+// process already renewed the same previous budget.
+func (r *budgetRepository) CreateRenewal(ctx context.Context, budget *models.Budget) (bool, error) {
+	result := r.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "previous_budget_id"}},
+		DoNothing: true,
+	}).Create(budget)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
+
+func (r *budgetRepository) Update(ctx context.Context, budget *models.Budget) error {
+	return r.db.WithContext(ctx).Save(budget).Error
 }
 
-func (r *budgetRepository) Delete(id uint) error {
-	return r.db.Delete(&models.Budget{}, id).Error
+func (r *budgetRepository) Delete(ctx context.Context, id uint) error {
+	return r.db.WithContext(ctx).Delete(&models.Budget{}, id).Error
 }
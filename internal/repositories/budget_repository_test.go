@@ -0,0 +1,52 @@
+package repositories
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stewicca/angagrar-backend/internal/models"
+)
+
+func TestCreateRenewalIsIdempotent(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDB(t)
+	repo := NewBudgetRepository(db)
+	user := createTestUser(t, db, "guest")
+
+	start := time.Date(2025, 3, 25, 0, 0, 0, 0, time.UTC)
+	previous := &models.Budget{UserID: user.ID, Category: "Makan", Amount: 1000000, Period: models.BudgetPeriodMonthly,
+		StartDate: start, EndDate: start.AddDate(0, 1, 0).Add(-time.Second)}
+	if err := repo.Create(ctx, previous); err != nil {
+		t.Fatalf("create budget: %v", err)
+	}
+
+	renewal := func() *models.Budget {
+		return &models.Budget{UserID: user.ID, Category: "Makan", Amount: 1000000, Period: models.BudgetPeriodMonthly,
+			StartDate: previous.EndDate.Add(time.Second), EndDate: previous.EndDate.AddDate(0, 1, 0), PreviousBudgetID: &previous.ID}
+	}
+
+	renewedAt := previous.EndDate.Add(time.Hour)
+	if renewable, err := repo.FindRenewable(ctx, models.BudgetPeriodMonthly, start, renewedAt); err != nil || len(renewable) != 1 {
+		t.Fatalf("expected the ended budget to be renewable, got %d, %v", len(renewable), err)
+	}
+
+	first := renewal()
+	if created, err := repo.CreateRenewal(ctx, first); err != nil || !created {
+		t.Fatalf("expected the first renewal to be created, got %v, %v", created, err)
+	}
+	if created, err := repo.CreateRenewal(ctx, renewal()); err != nil || created {
+		t.Errorf("expected the second renewal to be skipped, got %v, %v", created, err)
+	}
+
+	// A renewal the user deleted still counts as renewed
+	if err := repo.Delete(ctx, first.ID); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if renewable, err := repo.FindRenewable(ctx, models.BudgetPeriodMonthly, start, renewedAt); err != nil || len(renewable) != 0 {
+		t.Errorf("expected no renewable budgets, got %d, %v", len(renewable), err)
+	}
+	if created, err := repo.CreateRenewal(ctx, renewal()); err != nil || created {
+		t.Errorf("expected the deleted renewal not to be recreated, got %v, %v", created, err)
+	}
+}
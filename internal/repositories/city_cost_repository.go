@@ -0,0 +1,52 @@
+package repositories
+
+import (
+	"context"
+	"github.com/stewicca/angagrar-backend/internal/models"
+	"gorm.io/gorm"
+)
+
+type CityCostRepository interface {
+	FindAll(ctx context.Context, city string) ([]models.CityCost, error)
+	Find(ctx context.Context, city, lifestyle string) (*models.CityCost, error)
+	Save(ctx context.Context, cost *models.CityCost) error
+	Delete(ctx context.Context, id uint) error
+}
+
+type cityCostRepository struct {
+	db *gorm.DB
+}
+
+func NewCityCostRepository(db *gorm.DB) CityCostRepository {
+	return &cityCostRepository{db: db}
+}
+
+// FindAll lists every row, or only those of city when it is not empty
+func (r *cityCostRepository) FindAll(ctx context.Context, city string) ([]models.CityCost, error) {
+	query := r.db.WithContext(ctx).Order("city ASC, lifestyle ASC")
+	if city != "" {
+		query = query.Where("city = ?", city)
+	}
+
+	var costs []models.CityCost
+	err := query.Find(&costs).Error
+	return costs, err
+}
+
+func (r *cityCostRepository) Find(ctx context.Context, city, lifestyle string) (*models.CityCost, error) {
+	var cost models.CityCost
+	err := r.db.WithContext(ctx).Where("city = ? AND lifestyle = ?", city, lifestyle).First(&cost).Error
+	if err != nil {
+		return nil, err
+	}
+	return &cost, nil
+}
+
+// Save creates the row on first use and updates it afterwards
+func (r *cityCostRepository) Save(ctx context.Context, cost *models.CityCost) error {
+	return r.db.WithContext(ctx).Save(cost).Error
+}
+
+func (r *cityCostRepository) Delete(ctx context.Context, id uint) error {
+	return r.db.WithContext(ctx).Delete(&models.CityCost{}, id).Error
+}
@@ -1,18 +1,39 @@
 package repositories
 
 import (
+	"context"
+	"time"
+
 	"github.com/stewicca/angagrar-backend/internal/models"
 	"gorm.io/gorm"
 )
 
+// ConversationCursor is the position of the last row of the previous page
+type ConversationCursor struct {
+	CreatedAt time.Time `json:"created_at"`
+	ID        uint      `json:"id"`
+}
+
+// ConversationFilter narrows a conversation listing, newest first. Zero
+// values mean "no filter".
+type ConversationFilter struct {
+	Status string // See models.ConversationStatus*
+	Topic  string
+	Cursor *ConversationCursor
+	Limit  int
+}
+
 type ConversationRepository interface {
-	Create(conversation *models.Conversation) error
-	FindByID(id uint) (*models.Conversation, error)
-	FindBySessionID(sessionID string) (*models.Conversation, error)
-	FindByUserID(userID uint) ([]models.Conversation, error)
-	FindActiveByUserID(userID uint) (*models.Conversation, error)
-	Update(conversation *models.Conversation) error
-	Delete(id uint) error
+	Create(ctx context.Context, conversation *models.Conversation) error
+	FindByID(ctx context.Context, id uint) (*models.Conversation, error)
+	FindByUserAndSessionID(ctx context.Context, userID uint, sessionID string) (*models.Conversation, error)
+	FindByUserID(ctx context.Context, userID uint) ([]models.Conversation, error)
+	FindActiveByUserID(ctx context.Context, userID uint, topic string) (*models.Conversation, error)
+	List(ctx context.Context, userID uint, filter ConversationFilter) ([]models.Conversation, error)
+	SetArchivedAt(ctx context.Context, id uint, archivedAt *time.Time) error
+	SaveSummary(ctx context.Context, id uint, summary string, summarizedMessageID uint) error
+	MarkBudgetGenerated(ctx context.Context, id uint, at time.Time) (bool, error)
+	Delete(ctx context.Context, id uint) error
 }
 
 type conversationRepository struct {
@@ -23,40 +44,44 @@ func NewConversationRepository(db *gorm.DB) ConversationRepository {
 	return &conversationRepository{db: db}
 }
 
-func (r *conversationRepository) Create(conversation *models.Conversation) error {
-	return r.db.Create(conversation).Error
+func (r *conversationRepository) Create(ctx context.Context, conversation *models.Conversation) error {
+	return r.db.WithContext(ctx).Create(conversation).Error
 }
 
-func (r *conversationRepository) FindByID(id uint) (*models.Conversation, error) {
+func (r *conversationRepository) FindByID(ctx context.Context, id uint) (*models.Conversation, error) {
 	var conversation models.Conversation
-	err := r.db.Preload("Messages").First(&conversation, id).Error
+	err := r.db.WithContext(ctx).Preload("Messages").First(&conversation, id).Error
 	if err != nil {
 		return nil, err
 	}
 	return &conversation, nil
 }
 
-func (r *conversationRepository) FindBySessionID(sessionID string) (*models.Conversation, error) {
+// FindByUserAndSessionID only matches conversations owned by userID, so a
+// leaked session UUID cannot be used by another user
+func (r *conversationRepository) FindByUserAndSessionID(ctx context.Context, userID uint, sessionID string) (*models.Conversation, error) {
 	var conversation models.Conversation
-	err := r.db.Where("session_id = ?", sessionID).Preload("Messages").First(&conversation).Error
+	err := r.db.WithContext(ctx).Where("session_id = ? AND user_id = ?", sessionID, userID).Preload("Messages").First(&conversation).Error
 	if err != nil {
 		return nil, err
 	}
 	return &conversation, nil
 }
 
-func (r *conversationRepository) FindByUserID(userID uint) ([]models.Conversation, error) {
+func (r *conversationRepository) FindByUserID(ctx context.Context, userID uint) ([]models.Conversation, error) {
 	var conversations []models.Conversation
-	err := r.db.Where("user_id = ?", userID).Order("created_at DESC").Find(&conversations).Error
+	err := r.db.WithContext(ctx).Where("user_id = ?", userID).Order("created_at DESC").Find(&conversations).Error
 	if err != nil {
 		return nil, err
 	}
 	return conversations, nil
 }
 
-func (r *conversationRepository) FindActiveByUserID(userID uint) (*models.Conversation, error) {
+// FindActiveByUserID returns the newest conversation of topic that is
+// neither completed nor archived
+func (r *conversationRepository) FindActiveByUserID(ctx context.Context, userID uint, topic string) (*models.Conversation, error) {
 	var conversation models.Conversation
-	err := r.db.Where("user_id = ? AND completed_at IS NULL", userID).
+	err := r.db.WithContext(ctx).Where("user_id = ? AND topic = ? AND completed_at IS NULL AND archived_at IS NULL", userID, topic).
 		Order("created_at DESC").
 		First(&conversation).Error
 	if err != nil {
@@ -65,10 +90,62 @@ func (r *conversationRepository) FindActiveByUserID(userID uint) (*models.Conver
 	return &conversation, nil
 }
 
-func (r *conversationRepository) Update(conversation *models.Conversation) error {
-	return r.db.Save(conversation).Error
+// List returns up to filter.Limit conversations after filter.Cursor using
+// keyset pagination on (created_at, id)
+func (r *conversationRepository) List(ctx context.Context, userID uint, filter ConversationFilter) ([]models.Conversation, error) {
+	query := r.db.WithContext(ctx).Where("user_id = ?", userID)
+
+	switch filter.Status {
+	case models.ConversationStatusActive:
+		query = query.Where("completed_at IS NULL AND archived_at IS NULL")
+	case models.ConversationStatusCompleted:
+		query = query.Where("completed_at IS NOT NULL AND archived_at IS NULL")
+	case models.ConversationStatusArchived:
+		query = query.Where("archived_at IS NOT NULL")
+	}
+	if filter.Topic != "" {
+		query = query.Where("topic = ?", filter.Topic)
+	}
+
+	if filter.Cursor != nil {
+		query = query.Where("(created_at < ? OR (created_at = ? AND id < ?))",
+			filter.Cursor.CreatedAt, filter.Cursor.CreatedAt, filter.Cursor.ID)
+	}
+
+	var conversations []models.Conversation
+	err := query.
+		Order("created_at DESC, id DESC").
+		Limit(filter.Limit).
+		Find(&conversations).Error
+	return conversations, err
+}
+
+// SetArchivedAt archives the conversation, or unarchives it when archivedAt is
+// nil. Only that column is written, so it cannot undo a concurrent update.
+func (r *conversationRepository) SetArchivedAt(ctx context.Context, id uint, archivedAt *time.Time) error {
+	return r.db.WithContext(ctx).Model(&models.Conversation{}).
+		Where("id = ?", id).
+		Update("archived_at", archivedAt).Error
+}
+
+// SaveSummary stores a rolling summary. A summary covering fewer messages
+// than the stored one, e.g. from a slower concurrent turn, is dropped.
+func (r *conversationRepository) SaveSummary(ctx context.Context, id uint, summary string, summarizedMessageID uint) error {
+	return r.db.WithContext(ctx).Model(&models.Conversation{}).
+		Where("id = ? AND summarized_message_id < ?", id, summarizedMessageID).
+		Updates(map[string]interface{}{"summary": summary, "summarized_message_id": summarizedMessageID}).Error
+}
+
+// MarkBudgetGenerated completes an open conversation with its budget. It
+// reports false when the conversation was completed or archived meanwhile,
+// e.g. by a concurrent request for the same budget.
+func (r *conversationRepository) MarkBudgetGenerated(ctx context.Context, id uint, at time.Time) (bool, error) {
+	result := r.db.WithContext(ctx).Model(&models.Conversation{}).
+		Where("id = ? AND completed_at IS NULL AND archived_at IS NULL", id).
+		Updates(map[string]interface{}{"budget_generated": true, "completed_at": at})
+	return result.RowsAffected == 1, result.Error
 }
 
-func (r *conversationRepository) Delete(id uint) error {
-	return r.db.Delete(&models.Conversation{}, id).Error
+func (r *conversationRepository) Delete(ctx context.Context, id uint) error {
+	return r.db.WithContext(ctx).Delete(&models.Conversation{}, id).Error
 }
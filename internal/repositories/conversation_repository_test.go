@@ -0,0 +1,171 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stewicca/angagrar-backend/internal/database"
+	"github.com/stewicca/angagrar-backend/internal/models"
+	"gorm.io/gorm"
+)
+
+func TestSetArchivedAtKeepsConcurrentUpdates(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDB(t)
+	repo := NewConversationRepository(db)
+	user := createTestUser(t, db, "guest")
+
+	conversation := &models.Conversation{UserID: user.ID, SessionID: "session", Topic: models.ConversationTopicBudget}
+	if err := repo.Create(ctx, conversation); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	// Another request completes the conversation and summarizes it after
+	// this copy was loaded
+	now := time.Now()
+	if ok, err := repo.MarkBudgetGenerated(ctx, conversation.ID, now); err != nil || !ok {
+		t.Fatalf("MarkBudgetGenerated: %v, %v", ok, err)
+	}
+	if err := repo.SaveSummary(ctx, conversation.ID, "ringkasan", 10); err != nil {
+		t.Fatalf("SaveSummary: %v", err)
+	}
+
+	if err := repo.SetArchivedAt(ctx, conversation.ID, &now); err != nil {
+		t.Fatalf("SetArchivedAt: %v", err)
+	}
+
+	stored, err := repo.FindByID(ctx, conversation.ID)
+	if err != nil {
+		t.Fatalf("FindByID: %v", err)
+	}
+	if stored.ArchivedAt == nil {
+		t.Error("expected the conversation to be archived")
+	}
+	if !stored.BudgetGenerated || stored.CompletedAt == nil {
+		t.Error("expected archiving to keep the generated budget")
+	}
+	if stored.Summary != "ringkasan" || stored.SummarizedMessageID != 10 {
+		t.Errorf("expected archiving to keep the summary, got %q up to %d", stored.Summary, stored.SummarizedMessageID)
+	}
+
+	if err := repo.SetArchivedAt(ctx, conversation.ID, nil); err != nil {
+		t.Fatalf("SetArchivedAt: %v", err)
+	}
+	if stored, _ = repo.FindByID(ctx, conversation.ID); stored.ArchivedAt != nil {
+		t.Error("expected the conversation to be unarchived")
+	}
+}
+
+func TestSaveSummaryNeverGoesBack(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDB(t)
+	repo := NewConversationRepository(db)
+	user := createTestUser(t, db, "guest")
+
+	conversation := &models.Conversation{UserID: user.ID, SessionID: "session", Topic: models.ConversationTopicGeneral}
+	if err := repo.Create(ctx, conversation); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	if err := repo.SaveSummary(ctx, conversation.ID, "sampai pesan 20", 20); err != nil {
+		t.Fatalf("SaveSummary: %v", err)
+	}
+	// A slower turn that summarized fewer messages finishes last
+	if err := repo.SaveSummary(ctx, conversation.ID, "sampai pesan 12", 12); err != nil {
+		t.Fatalf("SaveSummary: %v", err)
+	}
+
+	stored, err := repo.FindByID(ctx, conversation.ID)
+	if err != nil {
+		t.Fatalf("FindByID: %v", err)
+	}
+	if stored.Summary != "sampai pesan 20" || stored.SummarizedMessageID != 20 {
+		t.Errorf("expected the newest summary to stay, got %q up to %d", stored.Summary, stored.SummarizedMessageID)
+	}
+}
+
+func TestOneActiveBudgetInterviewPerUser(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDB(t)
+	repo := NewConversationRepository(db)
+	user := createTestUser(t, db, "guest")
+	other := createTestUser(t, db, "other")
+
+	create := func(userID uint, sessionID, topic string) error {
+		return repo.Create(ctx, &models.Conversation{UserID: userID, SessionID: sessionID, Topic: topic})
+	}
+
+	first := &models.Conversation{UserID: user.ID, SessionID: "first", Topic: models.ConversationTopicBudget}
+	if err := repo.Create(ctx, first); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if err := create(user.ID, "second", models.ConversationTopicBudget); !errors.Is(err, gorm.ErrDuplicatedKey) {
+		t.Fatalf("expected a second active budget interview to be rejected, got %v", err)
+	}
+	if err := create(user.ID, "general", models.ConversationTopicGeneral); err != nil {
+		t.Errorf("expected general conversations to be allowed, got %v", err)
+	}
+	if err := create(other.ID, "other", models.ConversationTopicBudget); err != nil {
+		t.Errorf("expected another user's budget interview to be allowed, got %v", err)
+	}
+
+	now := time.Now()
+	if err := repo.SetArchivedAt(ctx, first.ID, &now); err != nil {
+		t.Fatalf("SetArchivedAt: %v", err)
+	}
+	replacement := &models.Conversation{UserID: user.ID, SessionID: "replacement", Topic: models.ConversationTopicBudget}
+	if err := repo.Create(ctx, replacement); err != nil {
+		t.Fatalf("expected a new interview once the first is archived, got %v", err)
+	}
+	if err := repo.SetArchivedAt(ctx, first.ID, nil); !errors.Is(err, gorm.ErrDuplicatedKey) {
+		t.Errorf("expected unarchiving a second active interview to be rejected, got %v", err)
+	}
+
+	if err := repo.Delete(ctx, replacement.ID); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if err := create(user.ID, "after-delete", models.ConversationTopicBudget); err != nil {
+		t.Errorf("expected deleted interviews not to count, got %v", err)
+	}
+}
+
+func TestActiveBudgetInterviewMigrationArchivesDuplicates(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDB(t)
+	repo := NewConversationRepository(db)
+	user := createTestUser(t, db, "guest")
+
+	migrator, err := database.NewMigrator(db)
+	if err != nil {
+		t.Fatalf("NewMigrator: %v", err)
+	}
+	if _, err := migrator.Down(ctx, 1); err != nil {
+		t.Fatalf("migrate down: %v", err)
+	}
+
+	// Left behind by concurrent starts before the index existed
+	older := &models.Conversation{UserID: user.ID, SessionID: "older", Topic: models.ConversationTopicBudget, CreatedAt: time.Now().Add(-time.Minute)}
+	newer := &models.Conversation{UserID: user.ID, SessionID: "newer", Topic: models.ConversationTopicBudget}
+	for _, conversation := range []*models.Conversation{older, newer} {
+		if err := repo.Create(ctx, conversation); err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+	}
+
+	if _, err := migrator.Up(ctx); err != nil {
+		t.Fatalf("migrate up: %v", err)
+	}
+
+	active, err := repo.FindActiveByUserID(ctx, user.ID, models.ConversationTopicBudget)
+	if err != nil {
+		t.Fatalf("FindActiveByUserID: %v", err)
+	}
+	if active.ID != newer.ID {
+		t.Errorf("expected the newest interview to stay active, got %q", active.SessionID)
+	}
+	if stored, _ := repo.FindByID(ctx, older.ID); stored == nil || stored.ArchivedAt == nil {
+		t.Error("expected the older interview to be archived")
+	}
+}
@@ -0,0 +1,34 @@
+package repositories
+
+import (
+	"context"
+	"github.com/stewicca/angagrar-backend/internal/models"
+	"gorm.io/gorm"
+)
+
+type FinancialProfileRepository interface {
+	FindByUserID(ctx context.Context, userID uint) (*models.FinancialProfile, error)
+	Save(ctx context.Context, profile *models.FinancialProfile) error
+}
+
+type financialProfileRepository struct {
+	db *gorm.DB
+}
+
+func NewFinancialProfileRepository(db *gorm.DB) FinancialProfileRepository {
+	return &financialProfileRepository{db: db}
+}
+
+func (r *financialProfileRepository) FindByUserID(ctx context.Context, userID uint) (*models.FinancialProfile, error) {
+	var profile models.FinancialProfile
+	err := r.db.WithContext(ctx).Where("user_id = ?", userID).First(&profile).Error
+	if err != nil {
+		return nil, err
+	}
+	return &profile, nil
+}
+
+// Save creates the profile on first use and updates it afterwards
+func (r *financialProfileRepository) Save(ctx context.Context, profile *models.FinancialProfile) error {
+	return r.db.WithContext(ctx).Save(profile).Error
+}
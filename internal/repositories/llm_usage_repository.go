@@ -0,0 +1,89 @@
+package repositories
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/stewicca/angagrar-backend/internal/models"
+	"gorm.io/gorm"
+)
+
+// DailySpend is the LLM usage of all users on one day
+type DailySpend struct {
+	Day              time.Time `json:"day"`
+	Calls            int       `json:"calls"`
+	Users            int       `json:"users"`
+	PromptTokens     int       `json:"prompt_tokens"`
+	CompletionTokens int       `json:"completion_tokens"`
+	CostUSD          float64   `json:"cost_usd"`
+}
+
+type LLMUsageRepository interface {
+	Create(ctx context.Context, usage *models.LLMUsage) error
+	SumTokensSince(ctx context.Context, userID uint, since time.Time) (int, error)
+	DailySpend(ctx context.Context, from, to time.Time) ([]DailySpend, error)
+}
+
+type llmUsageRepository struct {
+	db *gorm.DB
+}
+
+func NewLLMUsageRepository(db *gorm.DB) LLMUsageRepository {
+	return &llmUsageRepository{db: db}
+}
+
+func (r *llmUsageRepository) Create(ctx context.Context, usage *models.LLMUsage) error {
+	return r.db.WithContext(ctx).Create(usage).Error
+}
+
+// SumTokensSince totals the prompt and completion tokens the user used since
+// the given time
+func (r *llmUsageRepository) SumTokensSince(ctx context.Context, userID uint, since time.Time) (int, error) {
+	var total int
+	err := r.db.WithContext(ctx).Model(&models.LLMUsage{}).
+		Select("COALESCE(SUM(prompt_tokens + completion_tokens), 0)").
+		Where("user_id = ? AND created_at >= ?", userID, since).
+		Scan(&total).Error
+	return total, err
+}
+
+// DailySpend groups the usage in [from, to) by day, oldest first. Days
+// without calls are missing from the result.
+func (r *llmUsageRepository) DailySpend(ctx context.Context, from, to time.Time) ([]DailySpend, error) {
+	day := dayOf(r.db, "created_at")
+
+	var rows []struct {
+		DailySpend
+		Date string
+	}
+	err := r.db.WithContext(ctx).Model(&models.LLMUsage{}).
+		Select(day+" AS date, COUNT(*) AS calls, COUNT(DISTINCT user_id) AS users, "+
+			"SUM(prompt_tokens) AS prompt_tokens, SUM(completion_tokens) AS completion_tokens, SUM(cost_usd) AS cost_usd").
+		Where("created_at >= ? AND created_at < ?", from, to).
+		Group(day).
+		Order("date").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	days := make([]DailySpend, len(rows))
+	for i, row := range rows {
+		days[i] = row.DailySpend
+		if days[i].Day, err = time.Parse(time.DateOnly, row.Date); err != nil {
+			return nil, fmt.Errorf("invalid day %q: %w", row.Date, err)
+		}
+	}
+	return days, nil
+}
+
+// dayOf returns the SQL for the calendar day of a timestamp column as
+// YYYY-MM-DD text. SQLite stores timestamps as text in the writer's time
+// zone, so the day is the date part of the text.
+func dayOf(db *gorm.DB, column string) string {
+	if db.Dialector.Name() == "sqlite" {
+		return "substr(" + column + ", 1, 10)"
+	}
+	return "CAST(DATE(" + column + ") AS text)"
+}
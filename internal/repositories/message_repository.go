@@ -1,15 +1,16 @@
 package repositories
 
 import (
+	"context"
 	"github.com/stewicca/angagrar-backend/internal/models"
 	"gorm.io/gorm"
 )
 
 type MessageRepository interface {
-	Create(message *models.Message) error
-	FindByID(id uint) (*models.Message, error)
-	FindByConversationID(conversationID uint) ([]models.Message, error)
-	Delete(id uint) error
+	Create(ctx context.Context, message *models.Message) error
+	FindByID(ctx context.Context, id uint) (*models.Message, error)
+	FindByConversationID(ctx context.Context, conversationID uint) ([]models.Message, error)
+	Delete(ctx context.Context, id uint) error
 }
 
 type messageRepository struct {
@@ -20,22 +21,22 @@ func NewMessageRepository(db *gorm.DB) MessageRepository {
 	return &messageRepository{db: db}
 }
 
-func (r *messageRepository) Create(message *models.Message) error {
-	return r.db.Create(message).Error
+func (r *messageRepository) Create(ctx context.Context, message *models.Message) error {
+	return r.db.WithContext(ctx).Create(message).Error
 }
 
-func (r *messageRepository) FindByID(id uint) (*models.Message, error) {
+func (r *messageRepository) FindByID(ctx context.Context, id uint) (*models.Message, error) {
 	var message models.Message
-	err := r.db.First(&message, id).Error
+	err := r.db.WithContext(ctx).First(&message, id).Error
 	if err != nil {
 		return nil, err
 	}
 	return &message, nil
 }
 
-func (r *messageRepository) FindByConversationID(conversationID uint) ([]models.Message, error) {
+func (r *messageRepository) FindByConversationID(ctx context.Context, conversationID uint) ([]models.Message, error) {
 	var messages []models.Message
-	err := r.db.Where("conversation_id = ?", conversationID).
+	err := r.db.WithContext(ctx).Where("conversation_id = ?", conversationID).
 		Order("created_at ASC").
 		Find(&messages).Error
 	if err != nil {
@@ -44,6 +45,6 @@ func (r *messageRepository) FindByConversationID(conversationID uint) ([]models.
 	return messages, nil
 }
 
-func (r *messageRepository) Delete(id uint) error {
-	return r.db.Delete(&models.Message{}, id).Error
+func (r *messageRepository) Delete(ctx context.Context, id uint) error {
+	return r.db.WithContext(ctx).Delete(&models.Message{}, id).Error
 }
@@ -0,0 +1,53 @@
+package repositories
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stewicca/angagrar-backend/config"
+	"github.com/stewicca/angagrar-backend/internal/database"
+	"github.com/stewicca/angagrar-backend/internal/models"
+	"gorm.io/gorm"
+)
+
+// newTestDB migrates a fresh in-memory SQLite database
+func newTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+
+	return openTestDB(t, database.SQLiteMemory)
+}
+
+// openTestDB migrates the SQLite database at path
+func openTestDB(t *testing.T, path string) *gorm.DB {
+	t.Helper()
+
+	db, err := database.Open(&config.Config{DBDriver: database.DriverSQLite, DBPath: path})
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+
+	migrator, err := database.NewMigrator(db)
+	if err != nil {
+		t.Fatalf("NewMigrator: %v", err)
+	}
+	if _, err := migrator.Up(context.Background()); err != nil {
+		t.Fatalf("migrate up: %v", err)
+	}
+
+	return db
+}
+
+func createTestUser(t *testing.T, db *gorm.DB, guestID string) *models.User {
+	t.Helper()
+
+	user := &models.User{GuestID: guestID}
+	if err := NewUserRepository(db).Create(context.Background(), user); err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	return user
+}
@@ -1,13 +1,55 @@
 package repositories
 
 import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
 	"github.com/stewicca/angagrar-backend/internal/models"
 	"gorm.io/gorm"
 )
 
+// Columns transactions can be sorted by
+const (
+	TransactionSortDate      = "date"
+	TransactionSortAmount    = "amount"
+	TransactionSortCreatedAt = "created_at"
+)
+
+// TransactionCursor is the position of the last row of the previous page.
+// Only the field of the active sort column and ID are compared.
+type TransactionCursor struct {
+	Date      time.Time `json:"date"`
+	Amount    float64   `json:"amount"`
+	CreatedAt time.Time `json:"created_at"`
+	ID        uint      `json:"id"`
+}
+
+// TransactionFilter narrows and orders a transaction listing. Zero values
+// mean "no filter"; DateFrom and DateTo are both inclusive.
+type TransactionFilter struct {
+	DateFrom  *time.Time
+	DateTo    *time.Time
+	Type      string
+	Category  string
+	BudgetID  *uint
+	MinAmount *float64
+	MaxAmount *float64
+	Search    string
+	SortBy    string
+	Ascending bool
+	Cursor    *TransactionCursor
+	Limit     int
+}
+
 type TransactionRepository interface {
-	Create(transaction *models.Transaction) error
-	FindByUserID(userID uint) ([]models.Transaction, error)
+	Create(ctx context.Context, transaction *models.Transaction) error
+	FindByUserAndID(ctx context.Context, userID, id uint) (*models.Transaction, error)
+	List(ctx context.Context, userID uint, filter TransactionFilter) ([]models.Transaction, error)
+	SumExpensesByBudget(ctx context.Context, budgetIDs []uint) (map[uint]float64, error)
+	Update(ctx context.Context, transaction *models.Transaction) error
+	Delete(ctx context.Context, id uint) error
 }
 
 type transactionRepository struct {
@@ -18,12 +60,123 @@ func NewTransactionRepository(db *gorm.DB) TransactionRepository {
 	return &transactionRepository{db: db}
 }
 
-func (r *transactionRepository) Create(transaction *models.Transaction) error {
-	return r.db.Create(transaction).Error
+func (r *transactionRepository) Create(ctx context.Context, transaction *models.Transaction) error {
+	return r.db.WithContext(ctx).Create(transaction).Error
+}
+
+func (r *transactionRepository) FindByUserAndID(ctx context.Context, userID, id uint) (*models.Transaction, error) {
+	var transaction models.Transaction
+	err := r.db.WithContext(ctx).Where("user_id = ?", userID).First(&transaction, id).Error
+	if err != nil {
+		return nil, err
+	}
+	return &transaction, nil
 }
 
-func (r *transactionRepository) FindByUserID(userID uint) ([]models.Transaction, error) {
+// List returns up to filter.Limit transactions after filter.Cursor using
+// keyset pagination on (sort column, id)
+func (r *transactionRepository) List(ctx context.Context, userID uint, filter TransactionFilter) ([]models.Transaction, error) {
+	query := r.db.WithContext(ctx).Where("user_id = ?", userID)
+
+	if filter.DateFrom != nil {
+		query = query.Where("date >= ?", *filter.DateFrom)
+	}
+	if filter.DateTo != nil {
+		query = query.Where("date <= ?", *filter.DateTo)
+	}
+	if filter.Type != "" {
+		query = query.Where("type = ?", filter.Type)
+	}
+	if filter.Category != "" {
+		query = query.Where("LOWER(category) = ?", strings.ToLower(filter.Category))
+	}
+	if filter.BudgetID != nil {
+		query = query.Where("budget_id = ?", *filter.BudgetID)
+	}
+	if filter.MinAmount != nil {
+		query = query.Where("amount >= ?", *filter.MinAmount)
+	}
+	if filter.MaxAmount != nil {
+		query = query.Where("amount <= ?", *filter.MaxAmount)
+	}
+	if filter.Search != "" {
+		query = query.Where(`LOWER(description) LIKE ? ESCAPE '\'`, "%"+escapeLike(strings.ToLower(filter.Search))+"%")
+	}
+
+	column := TransactionSortDate
+	switch filter.SortBy {
+	case TransactionSortAmount, TransactionSortCreatedAt:
+		column = filter.SortBy
+	}
+
+	direction, operator := "DESC", "<"
+	if filter.Ascending {
+		direction, operator = "ASC", ">"
+	}
+
+	if filter.Cursor != nil {
+		var value any
+		switch column {
+		case TransactionSortAmount:
+			value = filter.Cursor.Amount
+		case TransactionSortCreatedAt:
+			value = filter.Cursor.CreatedAt
+		default:
+			value = filter.Cursor.Date
+		}
+		query = query.Where(
+			fmt.Sprintf("(%[1]s %[2]s ? OR (%[1]s = ? AND id %[2]s ?))", column, operator),
+			value, value, filter.Cursor.ID,
+		)
+	}
+
 	var transactions []models.Transaction
-	err := r.db.Where("user_id = ?", userID).Order("date DESC").Find(&transactions).Error
+	err := query.
+		Order(fmt.Sprintf("%s %s, id %s", column, direction, direction)).
+		Limit(filter.Limit).
+		Find(&transactions).Error
 	return transactions, err
 }
+
+// SumExpensesByBudget totals the expense transactions linked to each budget
+// and dated within its period. Budgets without expenses are missing from the
+// result.
+func (r *transactionRepository) SumExpensesByBudget(ctx context.Context, budgetIDs []uint) (map[uint]float64, error) {
+	totals := make(map[uint]float64, len(budgetIDs))
+	if len(budgetIDs) == 0 {
+		return totals, nil
+	}
+
+	var rows []struct {
+		BudgetID uint
+		Total    float64
+	}
+	err := r.db.WithContext(ctx).Model(&models.Transaction{}).
+		Select("transactions.budget_id, SUM(transactions.amount) AS total").
+		Joins("JOIN budgets ON budgets.id = transactions.budget_id").
+		Where("transactions.budget_id IN ? AND transactions.type = ?", budgetIDs, "expense").
+		Where("transactions.date >= budgets.start_date AND transactions.date <= budgets.end_date").
+		Group("transactions.budget_id").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	for _, row := range rows {
+		totals[row.BudgetID] = row.Total
+	}
+	return totals, nil
+}
+
+func (r *transactionRepository) Update(ctx context.Context, transaction *models.Transaction) error {
+	return r.db.WithContext(ctx).Save(transaction).Error
+}
+
+// Delete soft deletes the transaction through its DeletedAt column
+func (r *transactionRepository) Delete(ctx context.Context, id uint) error {
+	return r.db.WithContext(ctx).Delete(&models.Transaction{}, id).Error
+}
+
+func escapeLike(value string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(value)
+}
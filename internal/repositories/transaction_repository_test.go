@@ -0,0 +1,45 @@
+package repositories
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stewicca/angagrar-backend/internal/models"
+)
+
+func TestSumExpensesByBudgetOnlyCountsThePeriod(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDB(t)
+	user := createTestUser(t, db, "guest")
+
+	start := time.Date(2025, 3, 25, 0, 0, 0, 0, time.UTC)
+	budget := &models.Budget{UserID: user.ID, Category: "Makan", Amount: 1000000, Period: "monthly",
+		StartDate: start, EndDate: start.AddDate(0, 1, 0).Add(-time.Second)}
+	if err := NewBudgetRepository(db).Create(ctx, budget); err != nil {
+		t.Fatalf("create budget: %v", err)
+	}
+
+	transactions := NewTransactionRepository(db)
+	for _, transaction := range []models.Transaction{
+		{Type: "expense", Amount: 50000, Date: start.AddDate(0, 0, 3)},        // within the period
+		{Type: "expense", Amount: 70000, Date: start.Add(-time.Hour)},         // before it started
+		{Type: "expense", Amount: 90000, Date: budget.EndDate.Add(time.Hour)}, // after it ended
+		{Type: "income", Amount: 30000, Date: start.AddDate(0, 0, 3)},
+	} {
+		transaction.UserID = user.ID
+		transaction.BudgetID = &budget.ID
+		transaction.Category = "Makan"
+		if err := transactions.Create(ctx, &transaction); err != nil {
+			t.Fatalf("create transaction: %v", err)
+		}
+	}
+
+	totals, err := transactions.SumExpensesByBudget(ctx, []uint{budget.ID})
+	if err != nil {
+		t.Fatalf("SumExpensesByBudget: %v", err)
+	}
+	if totals[budget.ID] != 50000 {
+		t.Errorf("expected only the expense within the period, got %v", totals[budget.ID])
+	}
+}
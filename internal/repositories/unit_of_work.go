@@ -0,0 +1,64 @@
+package repositories
+
+import (
+	"context"
+
+	"gorm.io/gorm"
+)
+
+// Repositories are the repositories bound to one database handle, either the
+// shared pool or a transaction
+type Repositories struct {
+	Users             UserRepository
+	RefreshTokens     RefreshTokenRepository
+	RevokedTokens     RevokedTokenRepository
+	Transactions      TransactionRepository
+	Budgets           BudgetRepository
+	BudgetAdjustments BudgetAdjustmentRepository
+	Conversations     ConversationRepository
+	Messages          MessageRepository
+	Profiles          FinancialProfileRepository
+	CityCosts         CityCostRepository
+	LLMUsage          LLMUsageRepository
+}
+
+func newRepositories(db *gorm.DB) Repositories {
+	return Repositories{
+		Users:             NewUserRepository(db),
+		RefreshTokens:     NewRefreshTokenRepository(db),
+		RevokedTokens:     NewRevokedTokenRepository(db),
+		Transactions:      NewTransactionRepository(db),
+		Budgets:           NewBudgetRepository(db),
+		BudgetAdjustments: NewBudgetAdjustmentRepository(db),
+		Conversations:     NewConversationRepository(db),
+		Messages:          NewMessageRepository(db),
+		Profiles:          NewFinancialProfileRepository(db),
+		CityCosts:         NewCityCostRepository(db),
+		LLMUsage:          NewLLMUsageRepository(db),
+	}
+}
+
+// UnitOfWork groups writes to several repositories into one transaction
+type UnitOfWork interface {
+	// Do runs fn with repositories bound to a new transaction on ctx. The writes
+	// commit when fn returns nil and roll back when it returns an error or
+	// panics. Keep slow work such as LLM calls out of fn, and only use the
+	// repositories in tx inside it: on in-memory SQLite the transaction holds
+	// the only connection, so any other repository call blocks until ctx ends,
+	// and a write outside tx is not rolled back with it anyway.
+	Do(ctx context.Context, fn func(tx Repositories) error) error
+}
+
+type unitOfWork struct {
+	db *gorm.DB
+}
+
+func NewUnitOfWork(db *gorm.DB) UnitOfWork {
+	return &unitOfWork{db: db}
+}
+
+func (u *unitOfWork) Do(ctx context.Context, fn func(tx Repositories) error) error {
+	return u.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		return fn(newRepositories(tx))
+	})
+}
@@ -0,0 +1,100 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stewicca/angagrar-backend/internal/models"
+)
+
+func TestUnitOfWorkOnFileDatabase(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	db := openTestDB(t, filepath.Join(t.TempDir(), "angagrar.db"))
+	uow := NewUnitOfWork(db)
+	existing := createTestUser(t, db, "existing")
+
+	// Reads through the pool do not wait for the open transaction
+	err := uow.Do(ctx, func(tx Repositories) error {
+		if err := tx.Users.Create(ctx, &models.User{GuestID: "in-tx"}); err != nil {
+			return err
+		}
+		_, err := NewUserRepository(db).FindByID(ctx, existing.ID)
+		return err
+	})
+	if err != nil {
+		t.Fatalf("Do: %v", err)
+	}
+
+	// Concurrent transactions wait for the write lock instead of failing
+	var wg sync.WaitGroup
+	errs := make(chan error, 8)
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs <- uow.Do(ctx, func(tx Repositories) error {
+				if _, err := tx.Users.FindByID(ctx, existing.ID); err != nil {
+					return err
+				}
+				return tx.Users.Create(ctx, &models.User{GuestID: fmt.Sprintf("concurrent-%d", i)})
+			})
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Errorf("concurrent Do: %v", err)
+		}
+	}
+
+	// A failed transaction leaves nothing behind
+	failed := errors.New("failed")
+	err = uow.Do(ctx, func(tx Repositories) error {
+		if err := tx.Users.Create(ctx, &models.User{GuestID: "rolled-back"}); err != nil {
+			return err
+		}
+		return failed
+	})
+	if !errors.Is(err, failed) {
+		t.Fatalf("expected the error of fn, got %v", err)
+	}
+
+	var count int64
+	if err := db.Model(&models.User{}).Count(&count).Error; err != nil {
+		t.Fatalf("count users: %v", err)
+	}
+	if count != 10 {
+		t.Errorf("expected 10 users, got %d", count)
+	}
+}
+
+// On in-memory SQLite the transaction holds the only connection, so a
+// repository call outside tx waits until its context ends
+func TestUnitOfWorkOnMemoryDatabaseBlocksCallsOutsideTx(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDB(t)
+	existing := createTestUser(t, db, "existing")
+
+	err := NewUnitOfWork(db).Do(ctx, func(tx Repositories) error {
+		callCtx, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+		defer cancel()
+
+		_, err := NewUserRepository(db).FindByID(callCtx, existing.ID)
+		if !errors.Is(err, context.DeadlineExceeded) {
+			return fmt.Errorf("expected the call outside tx to time out, got %v", err)
+		}
+
+		_, err = tx.Users.FindByID(ctx, existing.ID)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
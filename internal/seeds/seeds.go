@@ -0,0 +1,12 @@
+// Package seeds holds the reference data loaded into the database on startup
+package seeds
+
+import (
+	_ "embed"
+)
+
+// CityCosts is the cost-of-living seed. Bump its version when changing the
+// numbers so existing databases pick them up.
+//
+//go:embed city_costs.json
+var CityCosts []byte
@@ -0,0 +1,339 @@
+package services
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/stewicca/angagrar-backend/internal/models"
+)
+
+const anthropicVersion = "2023-06-01"
+
+// anthropicStartMessage opens the conversation when it is empty or starts
+// with Aira's greeting, since the Messages API wants a user turn first
+const anthropicStartMessage = "Mulai."
+
+type anthropicService struct {
+	client      *http.Client
+	apiKey      string
+	baseURL     string
+	model       string
+	maxTokens   int
+	temperature float32
+	onUsage     func(TokenUsage)
+}
+
+type anthropicMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+type anthropicRequest struct {
+	Model       string             `json:"model"`
+	System      string             `json:"system,omitempty"`
+	Messages    []anthropicMessage `json:"messages"`
+	MaxTokens   int                `json:"max_tokens"`
+	Temperature float32            `json:"temperature"`
+	Stream      bool               `json:"stream,omitempty"`
+	Tools       []anthropicTool    `json:"tools,omitempty"`
+	ToolChoice  *anthropicChoice   `json:"tool_choice,omitempty"`
+}
+
+type anthropicTool struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description,omitempty"`
+	InputSchema json.RawMessage `json:"input_schema"`
+}
+
+type anthropicChoice struct {
+	Type string `json:"type"`
+	Name string `json:"name"`
+}
+
+type anthropicResponse struct {
+	Model   string `json:"model"`
+	Content []struct {
+		Type  string          `json:"type"`
+		Text  string          `json:"text"`
+		Input json.RawMessage `json:"input"`
+	} `json:"content"`
+	Usage anthropicUsage `json:"usage"`
+}
+
+type anthropicUsage struct {
+	InputTokens  int `json:"input_tokens"`
+	OutputTokens int `json:"output_tokens"`
+}
+
+// anthropicEvent covers the stream events we read: message_start and
+// message_delta for the usage, content_block_delta, message_stop and error
+type anthropicEvent struct {
+	Type    string `json:"type"`
+	Message struct {
+		Model string         `json:"model"`
+		Usage anthropicUsage `json:"usage"`
+	} `json:"message"`
+	Delta struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	} `json:"delta"`
+	Usage anthropicUsage  `json:"usage"`
+	Error *anthropicError `json:"error"`
+}
+
+type anthropicError struct {
+	Type    string `json:"type"`
+	Message string `json:"message"`
+}
+
+// NewAnthropicService talks to the Anthropic Messages API
+func NewAnthropicService(apiKey, baseURL, model string, maxTokens int, temperature float32) LLMService {
+	return &anthropicService{
+		client:      &http.Client{},
+		apiKey:      apiKey,
+		baseURL:     strings.TrimSuffix(baseURL, "/"),
+		model:       model,
+		maxTokens:   maxTokens,
+		temperature: temperature,
+	}
+}
+
+func (s *anthropicService) GenerateResponse(ctx context.Context, systemPrompt string, messages []models.Message) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	body, err := s.create(ctx, s.buildRequest(systemPrompt, messages, false))
+	if err != nil {
+		return "", err
+	}
+	s.reportUsage(body.Model, body.Usage)
+
+	var content strings.Builder
+	for _, block := range body.Content {
+		if block.Type == "text" {
+			content.WriteString(block.Text)
+		}
+	}
+
+	if content.Len() == 0 {
+		return "", fmt.Errorf("no response from Anthropic")
+	}
+
+	return content.String(), nil
+}
+
+// GenerateStructured forces a call to a single tool whose input schema is
+// schema and returns the tool input
+func (s *anthropicService) GenerateStructured(ctx context.Context, systemPrompt string, messages []models.Message, schema JSONSchema) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	req := s.buildRequest(systemPrompt, messages, false)
+	req.Tools = []anthropicTool{{
+		Name:        schema.Name,
+		Description: schema.Description,
+		InputSchema: schema.Schema,
+	}}
+	req.ToolChoice = &anthropicChoice{Type: "tool", Name: schema.Name}
+
+	body, err := s.create(ctx, req)
+	if err != nil {
+		return "", err
+	}
+	s.reportUsage(body.Model, body.Usage)
+
+	for _, block := range body.Content {
+		if block.Type == "tool_use" && len(block.Input) > 0 {
+			return string(block.Input), nil
+		}
+	}
+
+	return "", fmt.Errorf("no tool call in Anthropic response")
+}
+
+func (s *anthropicService) GenerateResponseWithRetry(ctx context.Context, systemPrompt string, messages []models.Message, maxRetries int) (string, error) {
+	return generateWithRetry(ctx, s, systemPrompt, messages, maxRetries)
+}
+
+// StreamResponse reads the server-sent events of a streamed message and
+// passes every text delta to onDelta. The text received so far is returned
+// even when the stream breaks off.
+func (s *anthropicService) StreamResponse(ctx context.Context, systemPrompt string, messages []models.Message, onDelta func(delta string) error) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, streamTimeout)
+	defer cancel()
+
+	resp, err := s.send(ctx, s.buildRequest(systemPrompt, messages, true))
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	// Input tokens come with message_start, output tokens with message_delta;
+	// whatever arrived is reported, also for a broken stream
+	var model string
+	var usage anthropicUsage
+	defer func() {
+		if usage.InputTokens+usage.OutputTokens > 0 {
+			s.reportUsage(model, usage)
+		}
+	}()
+
+	var content strings.Builder
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+
+	for scanner.Scan() {
+		data, ok := strings.CutPrefix(scanner.Text(), "data:")
+		if !ok {
+			continue
+		}
+
+		var event anthropicEvent
+		if err := json.Unmarshal([]byte(strings.TrimSpace(data)), &event); err != nil {
+			return content.String(), fmt.Errorf("Anthropic stream error: %w", err)
+		}
+
+		switch event.Type {
+		case "message_start":
+			model = event.Message.Model
+			usage = event.Message.Usage
+		case "message_delta":
+			if event.Usage.OutputTokens > 0 {
+				usage.OutputTokens = event.Usage.OutputTokens
+			}
+		case "content_block_delta":
+			if event.Delta.Type != "text_delta" || event.Delta.Text == "" {
+				continue
+			}
+			content.WriteString(event.Delta.Text)
+			if err := onDelta(event.Delta.Text); err != nil {
+				return content.String(), err
+			}
+		case "message_stop":
+			return content.String(), nil
+		case "error":
+			if event.Error != nil {
+				return content.String(), fmt.Errorf("Anthropic stream error: %s", event.Error.Message)
+			}
+			return content.String(), fmt.Errorf("Anthropic stream error")
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return content.String(), fmt.Errorf("Anthropic stream error: %w", err)
+	}
+
+	return content.String(), fmt.Errorf("Anthropic stream ended unexpectedly")
+}
+
+func (s *anthropicService) reportingUsage(onUsage func(TokenUsage)) LLMService {
+	reporting := *s
+	reporting.onUsage = onUsage
+	return &reporting
+}
+
+func (s *anthropicService) reportUsage(model string, usage anthropicUsage) {
+	if s.onUsage == nil {
+		return
+	}
+	s.onUsage(TokenUsage{
+		Model:            model,
+		PromptTokens:     usage.InputTokens,
+		CompletionTokens: usage.OutputTokens,
+	})
+}
+
+func (s *anthropicService) create(ctx context.Context, payload anthropicRequest) (*anthropicResponse, error) {
+	resp, err := s.send(ctx, payload)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var body anthropicResponse
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, fmt.Errorf("Anthropic API error: %w", err)
+	}
+
+	return &body, nil
+}
+
+func (s *anthropicService) send(ctx context.Context, payload anthropicRequest) (*http.Response, error) {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.baseURL+"/v1/messages", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Api-Key", s.apiKey)
+	req.Header.Set("Anthropic-Version", anthropicVersion)
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("Anthropic API error: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+
+		var failure struct {
+			Error anthropicError `json:"error"`
+		}
+		raw, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+		if json.Unmarshal(raw, &failure) == nil && failure.Error.Message != "" {
+			return nil, fmt.Errorf("Anthropic API error (%d): %s", resp.StatusCode, failure.Error.Message)
+		}
+		return nil, fmt.Errorf("Anthropic API error (%d)", resp.StatusCode)
+	}
+
+	return resp, nil
+}
+
+// buildRequest converts the conversation to a Messages API request. The API
+// wants alternating turns starting with the user, so consecutive messages of
+// the same role are merged.
+func (s *anthropicService) buildRequest(systemPrompt string, messages []models.Message, stream bool) anthropicRequest {
+	turns := []anthropicMessage{}
+
+	for _, msg := range messages {
+		role := "user"
+		if msg.Role == models.RoleAssistant {
+			role = "assistant"
+		}
+
+		if len(turns) == 0 && role == "assistant" {
+			turns = append(turns, anthropicMessage{Role: "user", Content: anthropicStartMessage})
+		}
+
+		if last := len(turns) - 1; last >= 0 && turns[last].Role == role {
+			turns[last].Content += "\n\n" + msg.Content
+			continue
+		}
+
+		turns = append(turns, anthropicMessage{Role: role, Content: msg.Content})
+	}
+
+	if len(turns) == 0 {
+		turns = append(turns, anthropicMessage{Role: "user", Content: anthropicStartMessage})
+	}
+
+	return anthropicRequest{
+		Model:       s.model,
+		System:      systemPrompt,
+		Messages:    turns,
+		MaxTokens:   s.maxTokens,
+		Temperature: s.temperature,
+		Stream:      stream,
+	}
+}
@@ -1,43 +1,321 @@
 package services
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
 	"github.com/google/uuid"
 	"github.com/stewicca/angagrar-backend/internal/models"
 	"github.com/stewicca/angagrar-backend/internal/repositories"
 	"github.com/stewicca/angagrar-backend/pkg/utils"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrEmailAlreadyUsed     = errors.New("email is already registered")
+	ErrAlreadyRegistered    = errors.New("account is already registered")
+	ErrInvalidCredentials   = errors.New("invalid email or password")
+	ErrInvalidRefreshToken  = errors.New("invalid or expired refresh token")
+	ErrRefreshTokenReused   = errors.New("refresh token reuse detected, please login again")
+	ErrRefreshTokenNotOwned = errors.New("refresh token does not belong to user")
 )
 
+// dummyPasswordHash is compared against when no user has the email, so a
+// failed login takes as long whether or not the email is registered
+const dummyPasswordHash = "$2a$10$Pi7XUew0SCLW/6ihO/p5v.DHUrHq0WwUcde0Yo6MqtA9PsWiZvXnS"
+
+// TokenPair is returned whenever a user signs in or refreshes
+type TokenPair struct {
+	AccessToken      string    `json:"token"`
+	AccessExpiresAt  time.Time `json:"expires_at"`
+	RefreshToken     string    `json:"refresh_token"`
+	RefreshExpiresAt time.Time `json:"refresh_expires_at"`
+}
+
 type AuthService interface {
-	CreateGuest() (*models.User, string, error)
+	CreateGuest(ctx context.Context) (*models.User, *TokenPair, error)
+	Register(ctx context.Context, userID uint, email, password string) (*models.User, *TokenPair, error)
+	Login(ctx context.Context, email, password string) (*models.User, *TokenPair, error)
+	Refresh(ctx context.Context, refreshToken string) (*TokenPair, error)
+	Logout(ctx context.Context, userID uint, jti string, accessExpiresAt time.Time, refreshToken string) error
+	IsTokenRevoked(ctx context.Context, jti string) (bool, error)
+	PurgeRevokedTokens(ctx context.Context, now time.Time) error
+	JWKS() utils.JWKSet
 }
 
 type authService struct {
-	userRepo  repositories.UserRepository
-	jwtSecret string
+	userRepo         repositories.UserRepository
+	refreshTokenRepo repositories.RefreshTokenRepository
+	revokedTokenRepo repositories.RevokedTokenRepository
+	keyring          *utils.Keyring
+	accessTokenTTL   time.Duration
+	refreshTokenTTL  time.Duration
 }
 
-func NewAuthService(userRepo repositories.UserRepository, jwtSecret string) AuthService {
+func NewAuthService(
+	userRepo repositories.UserRepository,
+	refreshTokenRepo repositories.RefreshTokenRepository,
+	revokedTokenRepo repositories.RevokedTokenRepository,
+	keyring *utils.Keyring,
+	accessTokenTTL time.Duration,
+	refreshTokenTTL time.Duration,
+) AuthService {
 	return &authService{
-		userRepo:  userRepo,
-		jwtSecret: jwtSecret,
+		userRepo:         userRepo,
+		refreshTokenRepo: refreshTokenRepo,
+		revokedTokenRepo: revokedTokenRepo,
+		keyring:          keyring,
+		accessTokenTTL:   accessTokenTTL,
+		refreshTokenTTL:  refreshTokenTTL,
 	}
 }
 
-func (s *authService) CreateGuest() (*models.User, string, error) {
+func (s *authService) CreateGuest(ctx context.Context) (*models.User, *TokenPair, error) {
 	guestID := uuid.New().String()
 
 	user := &models.User{
 		GuestID: guestID,
 	}
 
-	if err := s.userRepo.Create(user); err != nil {
-		return nil, "", err
+	if err := s.userRepo.Create(ctx, user); err != nil {
+		return nil, nil, err
+	}
+
+	tokens, err := s.issueTokens(ctx, user, uuid.New().String())
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return user, tokens, nil
+}
+
+// Register upgrades an existing guest user in place, so every budget,
+// transaction and conversation keeps pointing at the same user ID
+func (s *authService) Register(ctx context.Context, userID uint, email, password string) (*models.User, *TokenPair, error) {
+	email = normalizeEmail(email)
+
+	user, err := s.userRepo.FindByID(ctx, userID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("user not found: %w", err)
+	}
+
+	if !user.IsGuest() {
+		return nil, nil, ErrAlreadyRegistered
+	}
+
+	existing, err := s.userRepo.FindByEmail(ctx, email)
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil, err
+	}
+	if existing != nil {
+		return nil, nil, ErrEmailAlreadyUsed
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to hash password: %w", err)
+	}
+
+	now := time.Now()
+	user.Email = &email
+	user.PasswordHash = string(hash)
+	user.RegisteredAt = &now
+
+	if err := s.userRepo.Update(ctx, user); err != nil {
+		if errors.Is(err, gorm.ErrDuplicatedKey) {
+			// A concurrent sign-up took the email after the check above
+			return nil, nil, ErrEmailAlreadyUsed
+		}
+		return nil, nil, err
+	}
+
+	tokens, err := s.issueTokens(ctx, user, uuid.New().String())
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return user, tokens, nil
+}
+
+// Login authenticates a registered user by email and password
+func (s *authService) Login(ctx context.Context, email, password string) (*models.User, *TokenPair, error) {
+	user, err := s.userRepo.FindByEmail(ctx, normalizeEmail(email))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			_ = bcrypt.CompareHashAndPassword([]byte(dummyPasswordHash), []byte(password))
+			return nil, nil, ErrInvalidCredentials
+		}
+		return nil, nil, err
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)); err != nil {
+		return nil, nil, ErrInvalidCredentials
+	}
+
+	tokens, err := s.issueTokens(ctx, user, uuid.New().String())
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return user, tokens, nil
+}
+
+// Refresh rotates a refresh token. Presenting a token that was already
+// rotated revokes its whole family, since one of the copies must be stolen.
+func (s *authService) Refresh(ctx context.Context, refreshToken string) (*TokenPair, error) {
+	stored, err := s.refreshTokenRepo.FindByHash(ctx, utils.HashToken(refreshToken))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrInvalidRefreshToken
+		}
+		return nil, err
+	}
+
+	if stored.RevokedAt != nil {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	if stored.UsedAt != nil {
+		if err := s.revokeFamily(ctx, stored.FamilyID); err != nil {
+			return nil, err
+		}
+		return nil, ErrRefreshTokenReused
+	}
+
+	now := time.Now()
+	if now.After(stored.ExpiresAt) {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	marked, err := s.refreshTokenRepo.MarkUsed(ctx, stored.ID, now)
+	if err != nil {
+		return nil, err
+	}
+	if !marked {
+		// Lost a race against another refresh with the same token
+		if err := s.revokeFamily(ctx, stored.FamilyID); err != nil {
+			return nil, err
+		}
+		return nil, ErrRefreshTokenReused
+	}
+
+	user, err := s.userRepo.FindByID(ctx, stored.UserID)
+	if err != nil {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	return s.issueTokens(ctx, user, stored.FamilyID)
+}
+
+// Logout revokes the current access token and, if given, the refresh token family
+func (s *authService) Logout(ctx context.Context, userID uint, jti string, accessExpiresAt time.Time, refreshToken string) error {
+	if refreshToken != "" {
+		stored, err := s.refreshTokenRepo.FindByHash(ctx, utils.HashToken(refreshToken))
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+		if stored != nil {
+			if stored.UserID != userID {
+				return ErrRefreshTokenNotOwned
+			}
+			if err := s.revokeFamily(ctx, stored.FamilyID); err != nil {
+				return err
+			}
+		}
+	}
+
+	if jti == "" {
+		return nil
+	}
+
+	return s.revokedTokenRepo.Create(ctx, &models.RevokedToken{
+		JTI:       jti,
+		UserID:    userID,
+		ExpiresAt: accessExpiresAt,
+	})
+}
+
+func (s *authService) IsTokenRevoked(ctx context.Context, jti string) (bool, error) {
+	return s.revokedTokenRepo.IsRevoked(ctx, jti)
+}
+
+// PurgeRevokedTokens drops denylisted access tokens that expired before now;
+// they fail validation anyway
+func (s *authService) PurgeRevokedTokens(ctx context.Context, now time.Time) error {
+	return s.revokedTokenRepo.DeleteExpired(ctx, now)
+}
+
+// JWKS returns the public keys other services use to verify access tokens
+func (s *authService) JWKS() utils.JWKSet {
+	return s.keyring.JWKS()
+}
+
+// issueTokens signs a new access token and persists a refresh token in the given family
+func (s *authService) issueTokens(ctx context.Context, user *models.User, familyID string) (*TokenPair, error) {
+	accessToken, claims, err := utils.GenerateToken(user.ID, user.GuestID, s.keyring, s.accessTokenTTL)
+	if err != nil {
+		return nil, err
+	}
+
+	refreshToken, err := utils.GenerateRefreshToken()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate refresh token: %w", err)
+	}
+
+	refreshExpiresAt := time.Now().Add(s.refreshTokenTTL)
+	if err := s.refreshTokenRepo.Create(ctx, &models.RefreshToken{
+		UserID:        user.ID,
+		FamilyID:      familyID,
+		TokenHash:     utils.HashToken(refreshToken),
+		AccessTokenID: claims.ID,
+		ExpiresAt:     refreshExpiresAt,
+	}); err != nil {
+		return nil, fmt.Errorf("failed to save refresh token: %w", err)
 	}
 
-	token, err := utils.GenerateToken(user.ID, guestID, s.jwtSecret)
+	return &TokenPair{
+		AccessToken:      accessToken,
+		AccessExpiresAt:  claims.ExpiresAt.Time,
+		RefreshToken:     refreshToken,
+		RefreshExpiresAt: refreshExpiresAt,
+	}, nil
+}
+
+// revokeFamily revokes every refresh token in the family and denylists the
+// access tokens that were issued with them and may still be valid
+func (s *authService) revokeFamily(ctx context.Context, familyID string) error {
+	now := time.Now()
+
+	tokens, err := s.refreshTokenRepo.FindByFamilyID(ctx, familyID)
 	if err != nil {
-		return nil, "", err
+		return err
 	}
 
-	return user, token, nil
+	if err := s.refreshTokenRepo.RevokeFamily(ctx, familyID, now); err != nil {
+		return err
+	}
+
+	for _, t := range tokens {
+		accessExpiresAt := t.CreatedAt.Add(s.accessTokenTTL)
+		if t.AccessTokenID == "" || accessExpiresAt.Before(now) {
+			continue
+		}
+		if err := s.revokedTokenRepo.Create(ctx, &models.RevokedToken{
+			JTI:       t.AccessTokenID,
+			UserID:    t.UserID,
+			ExpiresAt: accessExpiresAt,
+		}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
 }
@@ -0,0 +1,174 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stewicca/angagrar-backend/internal/models"
+	"github.com/stewicca/angagrar-backend/internal/repositories"
+	"github.com/stewicca/angagrar-backend/pkg/utils"
+)
+
+// racingRefreshTokenRepo lets another request rotate the token between the
+// lookup and MarkUsed
+type racingRefreshTokenRepo struct {
+	repositories.RefreshTokenRepository
+}
+
+func (r *racingRefreshTokenRepo) MarkUsed(ctx context.Context, id uint, usedAt time.Time) (bool, error) {
+	if _, err := r.RefreshTokenRepository.MarkUsed(ctx, id, usedAt); err != nil {
+		return false, err
+	}
+	return r.RefreshTokenRepository.MarkUsed(ctx, id, usedAt)
+}
+
+func newTestAuthService(t *testing.T) (AuthService, repositories.Repositories, *utils.Keyring) {
+	t.Helper()
+
+	repos, _ := newSQLiteRepositories(t)
+	keyring, err := utils.NewKeyring("test", utils.NewHMACKey("test", []byte("test-secret")))
+	if err != nil {
+		t.Fatalf("NewKeyring: %v", err)
+	}
+
+	return NewAuthService(repos.Users, repos.RefreshTokens, repos.RevokedTokens, keyring, 15*time.Minute, time.Hour), repos, keyring
+}
+
+// accessTokenRevoked reports whether the access token of tokens is denylisted
+func accessTokenRevoked(t *testing.T, service AuthService, keyring *utils.Keyring, tokens *TokenPair) bool {
+	t.Helper()
+
+	claims, err := utils.ValidateToken(tokens.AccessToken, keyring)
+	if err != nil {
+		t.Fatalf("ValidateToken: %v", err)
+	}
+	revoked, err := service.IsTokenRevoked(context.Background(), claims.ID)
+	if err != nil {
+		t.Fatalf("IsTokenRevoked: %v", err)
+	}
+	return revoked
+}
+
+func TestRefreshRotatesTheToken(t *testing.T) {
+	ctx := context.Background()
+	service, _, keyring := newTestAuthService(t)
+
+	_, first, err := service.CreateGuest(ctx)
+	if err != nil {
+		t.Fatalf("CreateGuest: %v", err)
+	}
+
+	second, err := service.Refresh(ctx, first.RefreshToken)
+	if err != nil {
+		t.Fatalf("Refresh: %v", err)
+	}
+	if second.RefreshToken == first.RefreshToken || second.AccessToken == first.AccessToken {
+		t.Error("expected a new token pair")
+	}
+	if accessTokenRevoked(t, service, keyring, second) {
+		t.Error("expected the new access token to be valid")
+	}
+
+	if _, err := service.Refresh(ctx, second.RefreshToken); err != nil {
+		t.Errorf("expected the rotated token to refresh again, got %v", err)
+	}
+	if _, err := service.Refresh(ctx, "not-a-token"); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Errorf("expected ErrInvalidRefreshToken for an unknown token, got %v", err)
+	}
+}
+
+func TestRefreshReuseRevokesTheWholeFamily(t *testing.T) {
+	ctx := context.Background()
+	service, _, keyring := newTestAuthService(t)
+
+	_, stolen, err := service.CreateGuest(ctx)
+	if err != nil {
+		t.Fatalf("CreateGuest: %v", err)
+	}
+	rotated, err := service.Refresh(ctx, stolen.RefreshToken)
+	if err != nil {
+		t.Fatalf("Refresh: %v", err)
+	}
+
+	if _, err := service.Refresh(ctx, stolen.RefreshToken); !errors.Is(err, ErrRefreshTokenReused) {
+		t.Fatalf("expected ErrRefreshTokenReused, got %v", err)
+	}
+
+	if _, err := service.Refresh(ctx, rotated.RefreshToken); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Errorf("expected the latest token of the family to be revoked, got %v", err)
+	}
+	for name, tokens := range map[string]*TokenPair{"first": stolen, "rotated": rotated} {
+		if !accessTokenRevoked(t, service, keyring, tokens) {
+			t.Errorf("expected the %s access token to be revoked", name)
+		}
+	}
+}
+
+func TestRefreshLosingTheRaceRevokesTheFamily(t *testing.T) {
+	ctx := context.Background()
+	_, repos, keyring := newTestAuthService(t)
+	service := NewAuthService(repos.Users, &racingRefreshTokenRepo{repos.RefreshTokens}, repos.RevokedTokens, keyring, 15*time.Minute, time.Hour)
+
+	_, tokens, err := service.CreateGuest(ctx)
+	if err != nil {
+		t.Fatalf("CreateGuest: %v", err)
+	}
+
+	if _, err := service.Refresh(ctx, tokens.RefreshToken); !errors.Is(err, ErrRefreshTokenReused) {
+		t.Fatalf("expected ErrRefreshTokenReused, got %v", err)
+	}
+	if !accessTokenRevoked(t, service, keyring, tokens) {
+		t.Error("expected the access token of the family to be revoked")
+	}
+}
+
+func TestLogoutRejectsAnotherUsersRefreshToken(t *testing.T) {
+	ctx := context.Background()
+	service, _, _ := newTestAuthService(t)
+
+	_, victim, err := service.CreateGuest(ctx)
+	if err != nil {
+		t.Fatalf("CreateGuest: %v", err)
+	}
+	attacker, _, err := service.CreateGuest(ctx)
+	if err != nil {
+		t.Fatalf("CreateGuest: %v", err)
+	}
+
+	err = service.Logout(ctx, attacker.ID, "attacker-jti", time.Now().Add(time.Minute), victim.RefreshToken)
+	if !errors.Is(err, ErrRefreshTokenNotOwned) {
+		t.Fatalf("expected ErrRefreshTokenNotOwned, got %v", err)
+	}
+
+	if _, err := service.Refresh(ctx, victim.RefreshToken); err != nil {
+		t.Errorf("expected the victim's refresh token to stay valid, got %v", err)
+	}
+}
+
+func TestPurgeRevokedTokensKeepsUnexpiredTokens(t *testing.T) {
+	ctx := context.Background()
+	service, repos, _ := newTestAuthService(t)
+
+	now := time.Now()
+	for jti, expiresAt := range map[string]time.Time{"expired": now.Add(-time.Minute), "valid": now.Add(time.Minute)} {
+		if err := repos.RevokedTokens.Create(ctx, &models.RevokedToken{JTI: jti, UserID: 1, ExpiresAt: expiresAt}); err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+	}
+
+	if err := service.PurgeRevokedTokens(ctx, now); err != nil {
+		t.Fatalf("PurgeRevokedTokens: %v", err)
+	}
+
+	for jti, want := range map[string]bool{"expired": false, "valid": true} {
+		revoked, err := service.IsTokenRevoked(ctx, jti)
+		if err != nil {
+			t.Fatalf("IsTokenRevoked: %v", err)
+		}
+		if revoked != want {
+			t.Errorf("expected %s to be revoked=%v, got %v", jti, want, revoked)
+		}
+	}
+}
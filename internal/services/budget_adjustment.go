@@ -0,0 +1,379 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"regexp"
+	"slices"
+	"strings"
+	"unicode"
+
+	"github.com/stewicca/angagrar-backend/internal/models"
+	"github.com/stewicca/angagrar-backend/pkg/utils"
+)
+
+// ErrAdjustmentExceedsIncome is returned when the requested amounts leave
+// nothing for the other categories to give up
+var ErrAdjustmentExceedsIncome = errors.New("requested budget changes add up to more than the income")
+
+// Actions of a requested budget change
+const (
+	AdjustSet      = "set"
+	AdjustIncrease = "increase"
+	AdjustDecrease = "decrease"
+)
+
+// adjustmentStep is how far a change without an amount, like "kurangin
+// healing", moves a category, as a share of its current amount
+const adjustmentStep = 0.2
+
+// BudgetChangeRequest is one change the user asked for after the budget was
+// generated. Amount is nil when the user did not say how much.
+type BudgetChangeRequest struct {
+	Category string   `json:"category"`
+	Action   string   `json:"action"`
+	Amount   *float64 `json:"amount"`
+}
+
+var budgetAdjustmentSchema = JSONSchema{
+	Name:        "budget_adjustment",
+	Description: "Changes to the budget the user asked for in their latest message",
+	Schema: json.RawMessage(`{
+  "type": "object",
+  "properties": {
+    "changes": {
+      "type": "array",
+      "items": {
+        "type": "object",
+        "properties": {
+          "category": {"type": "string", "enum": ["Kewajiban", "Makan", "Transport", "Healing", "Tabungan", "Lain-lain"]},
+          "action": {"type": "string", "enum": ["set", "increase", "decrease"]},
+          "amount": {"type": ["number", "null"], "description": "rupiah; the new amount for set, the difference for increase and decrease, null if not mentioned"}
+        },
+        "required": ["category", "action", "amount"],
+        "additionalProperties": false
+      }
+    }
+  },
+  "required": ["changes"],
+  "additionalProperties": false
+}`),
+}
+
+// adjustmentCategoryKeywords map words in a chat message to budget
+// categories when the LLM is unavailable
+var adjustmentCategoryKeywords = map[string]string{
+	"kewajiban": "Kewajiban", "sewa": "Kewajiban", "kos": "Kewajiban", "kost": "Kewajiban", "cicilan": "Kewajiban", "tagihan": "Kewajiban",
+	"makan": "Makan", "makanan": "Makan", "jajan": "Makan",
+	"transport": "Transport", "transportasi": "Transport", "bensin": "Transport", "ojol": "Transport",
+	"healing": "Healing", "hiburan": "Healing", "nongkrong": "Healing",
+	"tabungan": "Tabungan", "nabung": "Tabungan", "saving": "Tabungan", "investasi": "Tabungan",
+	"lain": "Lain-lain", "lainnya": "Lain-lain",
+}
+
+var (
+	increaseKeywords = []string{"naikin", "naikkan", "naik", "tambah", "tambahin", "gedein", "besarin"}
+	decreaseKeywords = []string{"kurangin", "kurangi", "turunin", "turunkan", "potong", "kecilin", "pangkas"}
+
+	adjustmentClauseSeparator = regexp.MustCompile(`[,;&]|\s(?:dan|terus|trus)\s`)
+	adjustmentAmountPattern   = regexp.MustCompile(`(?:rp\.?\s*)?\d+(?:[.,]\d+)*\s*(?:juta|jt|ribu|rb)?`)
+)
+
+// parseBudgetChanges asks the LLM which budget changes the latest user message
+// asks for. If that fails it falls back to keyword matching. No changes means
+// the message is not an adjustment request, e.g. a confirmation.
+func (s *conversationService) parseBudgetChanges(ctx context.Context, conversation *models.Conversation, budgets []models.Budget, messages []models.Message) []BudgetChangeRequest {
+	if len(messages) > classifierHistory {
+		messages = messages[len(messages)-classifierHistory:]
+	}
+
+	raw, err := s.llm(conversation, models.LLMPurposeAdjustment).GenerateStructured(ctx, getBudgetAdjustmentPrompt(budgets), messages, budgetAdjustmentSchema)
+	if err == nil {
+		var parsed struct {
+			Changes []BudgetChangeRequest `json:"changes"`
+		}
+		if err = json.Unmarshal([]byte(extractJSONObject(raw)), &parsed); err == nil {
+			if err = validateBudgetChanges(parsed.Changes); err == nil {
+				return parsed.Changes
+			}
+		}
+	}
+
+	log.Printf("Budget adjustment parsing failed, falling back to keywords: %v", err)
+
+	return parseBudgetChangesFromText(messages[len(messages)-1].Content)
+}
+
+func validateBudgetChanges(changes []BudgetChangeRequest) error {
+	for _, change := range changes {
+		if !isBudgetCategory(change.Category) {
+			return fmt.Errorf("unknown category %q", change.Category)
+		}
+		switch change.Action {
+		case AdjustSet, AdjustIncrease, AdjustDecrease:
+		default:
+			return fmt.Errorf("unknown action %q", change.Action)
+		}
+		if change.Amount != nil && *change.Amount < 0 {
+			return fmt.Errorf("amount for %s must not be negative", change.Category)
+		}
+		if change.Action == AdjustSet && change.Amount == nil {
+			return fmt.Errorf("set %s without an amount", change.Category)
+		}
+	}
+	return nil
+}
+
+// parseBudgetChangesFromText reads requests like "naikin makan jadi 2 juta,
+// kurangin healing" clause by clause
+func parseBudgetChangesFromText(message string) []BudgetChangeRequest {
+	var changes []BudgetChangeRequest
+
+	for _, clause := range adjustmentClauseSeparator.Split(strings.ToLower(message), -1) {
+		change := BudgetChangeRequest{}
+		for _, word := range messageWords(clause) {
+			if category, ok := adjustmentCategoryKeywords[word]; ok && change.Category == "" {
+				change.Category = category
+			}
+			if slices.Contains(increaseKeywords, word) {
+				change.Action = AdjustIncrease
+			}
+			if slices.Contains(decreaseKeywords, word) {
+				change.Action = AdjustDecrease
+			}
+		}
+		if change.Category == "" {
+			continue
+		}
+
+		if match := adjustmentAmountPattern.FindString(clause); match != "" {
+			if amount, err := utils.ParseSalary(match); err == nil {
+				change.Amount = &amount
+				// "jadi 2 juta" is the new amount, "naikin 500rb" the difference
+				if change.Action == "" || slices.Contains(messageWords(clause), "jadi") {
+					change.Action = AdjustSet
+				}
+			}
+		}
+		if change.Action == "" {
+			continue
+		}
+
+		changes = append(changes, change)
+	}
+
+	return changes
+}
+
+// planBudgetAdjustment turns the requested changes into new budget amounts
+// that still add up to income. Categories asked to go down without an amount
+// pay for the rest first, then categories the user did not mention. Money
+// freed up goes to categories asked to go up without an amount, otherwise to
+// Tabungan. Rollover amounts are left as they are.
+func planBudgetAdjustment(budgets []models.Budget, income float64, requests []BudgetChangeRequest) ([]models.BudgetAdjustmentChange, error) {
+	round := func(amount float64) float64 {
+		return utils.RoundToNearest(amount, budgetRoundingInterval)
+	}
+
+	current := make(map[string]float64)
+	for _, budget := range budgets {
+		current[budget.Category] = budget.Amount - budget.RolloverAmount
+	}
+
+	target := make(map[string]float64)
+	for category, amount := range current {
+		target[category] = amount
+	}
+
+	fixed := make(map[string]bool)
+	var sources, sinks []string
+	for _, request := range requests {
+		amount, ok := current[request.Category]
+		if !ok {
+			continue
+		}
+
+		if request.Amount == nil {
+			if request.Action == AdjustDecrease {
+				sources = append(sources, request.Category)
+			} else {
+				sinks = append(sinks, request.Category)
+			}
+			continue
+		}
+
+		switch request.Action {
+		case AdjustSet:
+			target[request.Category] = round(*request.Amount)
+		case AdjustIncrease:
+			target[request.Category] = round(amount + *request.Amount)
+		case AdjustDecrease:
+			target[request.Category] = math.Max(round(amount-*request.Amount), 0)
+		}
+		fixed[request.Category] = true
+	}
+
+	// Without any amount, move one step out of the categories to cut, or
+	// into the ones to raise when nothing is cut
+	if len(fixed) == 0 {
+		moved := sources
+		sign := -1.0
+		if len(moved) == 0 {
+			moved, sign = sinks, 1
+		}
+		for _, category := range moved {
+			step := math.Max(round(current[category]*adjustmentStep), budgetRoundingInterval)
+			target[category] = math.Max(current[category]+sign*step, 0)
+			fixed[category] = true
+		}
+	}
+
+	sources, sinks = unfixed(sources, fixed), unfixed(sinks, fixed)
+	mentioned := make(map[string]bool)
+	for _, category := range append(sources, sinks...) {
+		mentioned[category] = true
+	}
+
+	var unmentioned []string
+	for _, budget := range budgets {
+		if !fixed[budget.Category] && !mentioned[budget.Category] {
+			unmentioned = append(unmentioned, budget.Category)
+		}
+	}
+
+	total := 0.0
+	for _, amount := range target {
+		total += amount
+	}
+	diff := round(income) - total
+
+	switch {
+	case diff < 0:
+		pool := sources
+		if len(pool) == 0 {
+			pool = unmentioned
+		}
+		if err := spreadBudgetDifference(target, pool, diff); err != nil {
+			return nil, err
+		}
+	case diff > 0:
+		pool := sinks
+		if len(pool) == 0 && slices.Contains(unmentioned, "Tabungan") {
+			pool = []string{"Tabungan"}
+		}
+		if len(pool) == 0 {
+			pool = unmentioned
+		}
+		if err := spreadBudgetDifference(target, pool, diff); err != nil {
+			return nil, err
+		}
+	}
+
+	var changes []models.BudgetAdjustmentChange
+	for _, budget := range budgets {
+		if target[budget.Category] == current[budget.Category] {
+			continue
+		}
+		changes = append(changes, models.BudgetAdjustmentChange{
+			BudgetID: budget.ID,
+			Category: budget.Category,
+			Before:   budget.Amount,
+			After:    target[budget.Category] + budget.RolloverAmount,
+		})
+	}
+
+	return changes, nil
+}
+
+// spreadBudgetDifference adds diff to the pool's categories in proportion to
+// their amounts, rounded, with the remainder on the largest one
+func spreadBudgetDifference(target map[string]float64, pool []string, diff float64) error {
+	available := 0.0
+	for _, category := range pool {
+		available += target[category]
+	}
+	if len(pool) == 0 || available+diff < 0 {
+		return ErrAdjustmentExceedsIncome
+	}
+
+	allocated := 0.0
+	largest := pool[0]
+	for _, category := range pool {
+		share := diff / float64(len(pool))
+		if available > 0 {
+			share = diff * target[category] / available
+		}
+		share = utils.RoundToNearest(share, budgetRoundingInterval)
+
+		target[category] = math.Max(target[category]+share, 0)
+		allocated += share
+		if target[category] > target[largest] {
+			largest = category
+		}
+	}
+	target[largest] += diff - allocated
+
+	return nil
+}
+
+func unfixed(categories []string, fixed map[string]bool) []string {
+	var result []string
+	for _, category := range categories {
+		if !fixed[category] && !slices.Contains(result, category) {
+			result = append(result, category)
+		}
+	}
+	return result
+}
+
+// messageWords splits a chat message into lower case words
+func messageWords(message string) []string {
+	return strings.FieldsFunc(strings.ToLower(message), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+func getBudgetAdjustmentPrompt(budgets []models.Budget) string {
+	lines := make([]string, 0, len(budgets))
+	for _, budget := range budgets {
+		lines = append(lines, fmt.Sprintf("- %s: Rp %.0f", budget.Category, budget.Amount))
+	}
+
+	return fmt.Sprintf(`Kamu adalah budget adjustment parser untuk Aira, asisten budget. User sudah punya budget dan mungkin minta mengubahnya di pesan TERAKHIR.
+
+BUDGET USER SAAT INI:
+%s
+
+Untuk tiap kategori yang user minta ubah, isi:
+- category: salah satu kategori di atas
+- action: "set" kalau user sebut angka baru ("makan jadi 2 juta"), "increase" kalau dinaikkan, "decrease" kalau dikurangi
+- amount: rupiah penuh ("2 juta" = 2000000); untuk increase/decrease ini selisihnya; null kalau user tidak sebut angka
+
+Kalau pesan terakhir bukan permintaan ubah budget (misal cuma "iya", "oke", "nggak jadi", atau pertanyaan), kembalikan changes kosong.
+
+Return ONLY valid JSON: {"changes": [...]}`, strings.Join(lines, "\n"))
+}
+
+// formatAdjustmentProposal shows the changes and asks the user to confirm
+func formatAdjustmentProposal(changes []models.BudgetAdjustmentChange) string {
+	response := "oke, jadi budget kamu berubah gini ya:\n\n"
+	for _, change := range changes {
+		response += fmt.Sprintf("%s %s: Rp %.0f → Rp %.0f\n", getCategoryEmoji(change.Category), change.Category, change.Before, change.After)
+	}
+	response += "\ntotalnya tetap sama dengan gaji kamu. bales \"ya\" buat apply atau \"nggak\" buat batal 🙌"
+	return response
+}
+
+// formatAdjustedBudgets shows the budgets after an adjustment was applied
+func formatAdjustedBudgets(budgets []models.Budget) string {
+	response := "done! ✨ budget kamu udah gue update:\n\n"
+	for _, budget := range budgets {
+		response += fmt.Sprintf("%s %s: Rp %.0f\n", getCategoryEmoji(budget.Category), budget.Category, budget.Amount)
+	}
+	response += "\nkalau masih ada yang mau diubah, bilang aja!"
+	return response
+}
@@ -0,0 +1,116 @@
+package services
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stewicca/angagrar-backend/internal/models"
+)
+
+func testAdjustableBudgets() []models.Budget {
+	amounts := []float64{2000000, 1500000, 500000, 1000000, 1500000, 500000}
+	budgets := make([]models.Budget, len(budgetCategories))
+	for i, category := range budgetCategories {
+		budgets[i] = models.Budget{ID: uint(i + 1), Category: category, Amount: amounts[i], Period: models.BudgetPeriodMonthly}
+	}
+	return budgets
+}
+
+func adjustedAmounts(budgets []models.Budget, changes []models.BudgetAdjustmentChange) map[string]float64 {
+	amounts := make(map[string]float64)
+	for _, budget := range budgets {
+		amounts[budget.Category] = budget.Amount
+	}
+	for _, change := range changes {
+		amounts[change.Category] = change.After
+	}
+	return amounts
+}
+
+func TestParseBudgetChangesFromText(t *testing.T) {
+	changes := parseBudgetChangesFromText("naikin makan jadi 2 juta, kurangin healing dan tambah tabungan 500rb")
+	if len(changes) != 3 {
+		t.Fatalf("expected 3 changes, got %+v", changes)
+	}
+
+	expected := []struct {
+		category, action string
+		amount           float64
+	}{
+		{"Makan", AdjustSet, 2000000},
+		{"Healing", AdjustDecrease, 0},
+		{"Tabungan", AdjustIncrease, 500000},
+	}
+	for i, want := range expected {
+		got := changes[i]
+		amount := 0.0
+		if got.Amount != nil {
+			amount = *got.Amount
+		}
+		if got.Category != want.category || got.Action != want.action || amount != want.amount {
+			t.Errorf("change %d: expected %s %s %.0f, got %s %s %.0f", i, want.category, want.action, want.amount, got.Category, got.Action, amount)
+		}
+	}
+
+	if changes := parseBudgetChangesFromText("iya boleh"); len(changes) != 0 {
+		t.Errorf("expected no changes for a confirmation, got %+v", changes)
+	}
+}
+
+func TestPlanBudgetAdjustmentKeepsTotal(t *testing.T) {
+	budgets := testAdjustableBudgets()
+	amount := 2000000.0
+
+	tests := []struct {
+		name     string
+		requests []BudgetChangeRequest
+		expected map[string]float64
+	}{
+		{
+			name:     "cut category pays for raise",
+			requests: []BudgetChangeRequest{{Category: "Makan", Action: AdjustSet, Amount: &amount}, {Category: "Healing", Action: AdjustDecrease}},
+			expected: map[string]float64{"Makan": 2000000, "Healing": 500000, "Tabungan": 1500000},
+		},
+		{
+			name:     "freed money goes to savings",
+			requests: []BudgetChangeRequest{{Category: "Healing", Action: AdjustDecrease}},
+			expected: map[string]float64{"Healing": 800000, "Tabungan": 1700000},
+		},
+		{
+			name:     "raise without cut comes from the other categories",
+			requests: []BudgetChangeRequest{{Category: "Kewajiban", Action: AdjustIncrease, Amount: &amount}},
+			expected: map[string]float64{"Kewajiban": 4000000, "Makan": 900000, "Tabungan": 900000},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			changes, err := planBudgetAdjustment(budgets, 7000000, tt.requests)
+			if err != nil {
+				t.Fatalf("planBudgetAdjustment: %v", err)
+			}
+
+			amounts := adjustedAmounts(budgets, changes)
+			total := 0.0
+			for _, amount := range amounts {
+				total += amount
+			}
+			if total != 7000000 {
+				t.Errorf("expected total 7000000, got %.0f", total)
+			}
+			for category, want := range tt.expected {
+				if amounts[category] != want {
+					t.Errorf("expected %s %.0f, got %.0f", category, want, amounts[category])
+				}
+			}
+		})
+	}
+}
+
+func TestPlanBudgetAdjustmentRejectsMoreThanIncome(t *testing.T) {
+	amount := 8000000.0
+	_, err := planBudgetAdjustment(testAdjustableBudgets(), 7000000, []BudgetChangeRequest{{Category: "Makan", Action: AdjustSet, Amount: &amount}})
+	if !errors.Is(err, ErrAdjustmentExceedsIncome) {
+		t.Fatalf("expected ErrAdjustmentExceedsIncome, got %v", err)
+	}
+}
@@ -0,0 +1,102 @@
+package services
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/stewicca/angagrar-backend/internal/models"
+)
+
+// BudgetCalendar turns a user's pay cycle into budget periods. Monthly
+// periods start on the (adjusted) payday and end the second before the next
+// one; yearly periods stay calendar years. Days start at midnight in the
+// calendar's location, so a payday begins when it does for the user.
+type BudgetCalendar struct {
+	location *time.Location
+	holidays map[string]struct{}
+}
+
+// NewBudgetCalendar takes the time zone periods are computed in and the
+// public holidays paydays are moved away from, formatted as YYYY-MM-DD
+func NewBudgetCalendar(location *time.Location, holidays []string) (*BudgetCalendar, error) {
+	c := &BudgetCalendar{location: location, holidays: make(map[string]struct{}, len(holidays))}
+
+	for _, holiday := range holidays {
+		date, err := time.Parse("2006-01-02", holiday)
+		if err != nil {
+			return nil, fmt.Errorf("invalid holiday %q: %w", holiday, err)
+		}
+		c.holidays[date.Format("2006-01-02")] = struct{}{}
+	}
+
+	return c, nil
+}
+
+// PeriodBounds returns the first and last second of the period containing at
+func (c *BudgetCalendar) PeriodBounds(user *models.User, period string, at time.Time) (time.Time, time.Time) {
+	at = at.In(c.location)
+
+	if period == models.BudgetPeriodYearly {
+		start := time.Date(at.Year(), time.January, 1, 0, 0, 0, 0, c.location)
+		return start, start.AddDate(1, 0, 0).Add(-time.Second)
+	}
+
+	// An adjusted payday can move into the neighbouring month, so walk the
+	// nominal pay months instead of the month at falls in
+	year, month := at.Year(), at.Month()+1
+	start := c.Payday(user, year, month)
+	for start.After(at) {
+		month--
+		start = c.Payday(user, year, month)
+	}
+
+	next := c.Payday(user, year, month+1)
+	return start, next.Add(-time.Second)
+}
+
+// Payday returns the day the user is paid in the given month. Days past the
+// end of the month fall on its last day; weekends and holidays are then
+// moved according to the user's adjustment rule.
+func (c *BudgetCalendar) Payday(user *models.User, year int, month time.Month) time.Time {
+	first := time.Date(year, month, 1, 0, 0, 0, 0, c.location)
+	lastDay := first.AddDate(0, 1, -1).Day()
+
+	day := 1
+	adjust := models.PayDayAdjustNone
+	if user != nil {
+		if user.PayDay > 0 {
+			day = user.PayDay
+		}
+		adjust = user.PayDayAdjust
+	}
+	if day > lastDay {
+		day = lastDay
+	}
+
+	payday := time.Date(first.Year(), first.Month(), day, 0, 0, 0, 0, c.location)
+
+	step := 0
+	switch adjust {
+	case models.PayDayAdjustPreviousDay:
+		step = -1
+	case models.PayDayAdjustNextDay:
+		step = 1
+	}
+	if step == 0 {
+		return payday
+	}
+
+	for !c.isBusinessDay(payday) {
+		payday = payday.AddDate(0, 0, step)
+	}
+
+	return payday
+}
+
+func (c *BudgetCalendar) isBusinessDay(date time.Time) bool {
+	if date.Weekday() == time.Saturday || date.Weekday() == time.Sunday {
+		return false
+	}
+	_, holiday := c.holidays[date.Format("2006-01-02")]
+	return !holiday
+}
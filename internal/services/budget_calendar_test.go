@@ -0,0 +1,127 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stewicca/angagrar-backend/internal/models"
+)
+
+// wib is Asia/Jakarta without depending on the system's tzdata
+var wib = time.FixedZone("WIB", 7*60*60)
+
+func newTestBudgetCalendar(t *testing.T) *BudgetCalendar {
+	t.Helper()
+
+	calendar, err := NewBudgetCalendar(wib, []string{"2025-03-31", "2025-04-01", "2025-12-25"})
+	if err != nil {
+		t.Fatalf("NewBudgetCalendar: %v", err)
+	}
+	return calendar
+}
+
+func payCycle(day int, adjust string) *models.User {
+	return &models.User{PayDay: day, PayDayAdjust: adjust}
+}
+
+func TestPayday(t *testing.T) {
+	calendar := newTestBudgetCalendar(t)
+
+	tests := []struct {
+		name  string
+		user  *models.User
+		year  int
+		month time.Month
+		want  time.Time
+	}{
+		{"no pay cycle", nil, 2025, time.May, time.Date(2025, 5, 1, 0, 0, 0, 0, wib)},
+		{"sunday without adjustment", payCycle(25, models.PayDayAdjustNone), 2025, time.May, time.Date(2025, 5, 25, 0, 0, 0, 0, wib)},
+		{"sunday to friday", payCycle(25, models.PayDayAdjustPreviousDay), 2025, time.May, time.Date(2025, 5, 23, 0, 0, 0, 0, wib)},
+		{"sunday to monday", payCycle(25, models.PayDayAdjustNextDay), 2025, time.May, time.Date(2025, 5, 26, 0, 0, 0, 0, wib)},
+		{"holiday and weekend to friday", payCycle(31, models.PayDayAdjustPreviousDay), 2025, time.March, time.Date(2025, 3, 28, 0, 0, 0, 0, wib)},
+		{"holidays into next month", payCycle(31, models.PayDayAdjustNextDay), 2025, time.March, time.Date(2025, 4, 2, 0, 0, 0, 0, wib)},
+		{"christmas to boxing day", payCycle(25, models.PayDayAdjustNextDay), 2025, time.December, time.Date(2025, 12, 26, 0, 0, 0, 0, wib)},
+		{"day 29 in february", payCycle(29, models.PayDayAdjustNone), 2025, time.February, time.Date(2025, 2, 28, 0, 0, 0, 0, wib)},
+		{"day 30 in a leap february", payCycle(30, models.PayDayAdjustNone), 2024, time.February, time.Date(2024, 2, 29, 0, 0, 0, 0, wib)},
+		{"day 31 in february", payCycle(31, models.PayDayAdjustNone), 2025, time.February, time.Date(2025, 2, 28, 0, 0, 0, 0, wib)},
+		{"day 31 in april", payCycle(31, models.PayDayAdjustNone), 2025, time.April, time.Date(2025, 4, 30, 0, 0, 0, 0, wib)},
+		{"clamped to sunday then friday", payCycle(31, models.PayDayAdjustPreviousDay), 2025, time.November, time.Date(2025, 11, 28, 0, 0, 0, 0, wib)},
+		{"month 13 is january", payCycle(25, models.PayDayAdjustNone), 2025, 13, time.Date(2026, 1, 25, 0, 0, 0, 0, wib)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := calendar.Payday(tt.user, tt.year, tt.month); !got.Equal(tt.want) {
+				t.Errorf("expected %s, got %s", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestPeriodBounds(t *testing.T) {
+	calendar := newTestBudgetCalendar(t)
+	endOf := func(year int, month time.Month, day int) time.Time {
+		return time.Date(year, month, day, 23, 59, 59, 0, wib)
+	}
+
+	tests := []struct {
+		name      string
+		user      *models.User
+		period    string
+		at        time.Time
+		wantStart time.Time
+		wantEnd   time.Time
+	}{
+		{"mid period", payCycle(25, models.PayDayAdjustNone), models.BudgetPeriodMonthly,
+			time.Date(2025, 4, 10, 12, 0, 0, 0, wib), time.Date(2025, 3, 25, 0, 0, 0, 0, wib), endOf(2025, 4, 24)},
+		{"on payday", payCycle(25, models.PayDayAdjustNone), models.BudgetPeriodMonthly,
+			time.Date(2025, 3, 25, 0, 0, 0, 0, wib), time.Date(2025, 3, 25, 0, 0, 0, 0, wib), endOf(2025, 4, 24)},
+		{"last second before payday", payCycle(25, models.PayDayAdjustNone), models.BudgetPeriodMonthly,
+			endOf(2025, 3, 24), time.Date(2025, 2, 25, 0, 0, 0, 0, wib), endOf(2025, 3, 24)},
+		{"payday starts at local midnight", payCycle(25, models.PayDayAdjustNone), models.BudgetPeriodMonthly,
+			time.Date(2025, 3, 24, 17, 30, 0, 0, time.UTC), time.Date(2025, 3, 25, 0, 0, 0, 0, wib), endOf(2025, 4, 24)},
+		{"december into january", payCycle(25, models.PayDayAdjustNone), models.BudgetPeriodMonthly,
+			time.Date(2025, 12, 30, 9, 0, 0, 0, wib), time.Date(2025, 12, 25, 0, 0, 0, 0, wib), endOf(2026, 1, 24)},
+		{"january back to december", payCycle(25, models.PayDayAdjustNone), models.BudgetPeriodMonthly,
+			time.Date(2026, 1, 10, 9, 0, 0, 0, wib), time.Date(2025, 12, 25, 0, 0, 0, 0, wib), endOf(2026, 1, 24)},
+		{"christmas before the adjusted payday", payCycle(25, models.PayDayAdjustNextDay), models.BudgetPeriodMonthly,
+			time.Date(2025, 12, 25, 10, 0, 0, 0, wib), time.Date(2025, 11, 25, 0, 0, 0, 0, wib), endOf(2025, 12, 25)},
+		{"payday moved into the previous month", payCycle(1, models.PayDayAdjustPreviousDay), models.BudgetPeriodMonthly,
+			time.Date(2025, 10, 31, 9, 0, 0, 0, wib), time.Date(2025, 10, 31, 0, 0, 0, 0, wib), endOf(2025, 11, 30)},
+		{"day 31 ending in february", payCycle(31, models.PayDayAdjustNone), models.BudgetPeriodMonthly,
+			time.Date(2025, 2, 15, 9, 0, 0, 0, wib), time.Date(2025, 1, 31, 0, 0, 0, 0, wib), endOf(2025, 2, 27)},
+		{"day 31 starting in february", payCycle(31, models.PayDayAdjustNone), models.BudgetPeriodMonthly,
+			time.Date(2025, 3, 1, 9, 0, 0, 0, wib), time.Date(2025, 2, 28, 0, 0, 0, 0, wib), endOf(2025, 3, 30)},
+		{"yearly in local time", payCycle(25, models.PayDayAdjustNone), models.BudgetPeriodYearly,
+			time.Date(2025, 12, 31, 17, 30, 0, 0, time.UTC), time.Date(2026, 1, 1, 0, 0, 0, 0, wib), endOf(2026, 12, 31)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start, end := calendar.PeriodBounds(tt.user, tt.period, tt.at)
+			if !start.Equal(tt.wantStart) || !end.Equal(tt.wantEnd) {
+				t.Errorf("expected %s - %s, got %s - %s", tt.wantStart, tt.wantEnd, start, end)
+			}
+		})
+	}
+}
+
+func TestUntilNextRenewalWaitsForLocalMidnight(t *testing.T) {
+	tests := []struct {
+		name string
+		now  time.Time
+		want time.Duration
+	}{
+		{"half an hour before midnight in Jakarta", time.Date(2025, 3, 24, 16, 30, 0, 0, time.UTC), 30 * time.Minute},
+		{"seconds before midnight in Jakarta", time.Date(2025, 3, 24, 16, 59, 30, 0, time.UTC), 30 * time.Second},
+		{"UTC midnight is not a boundary", time.Date(2025, 3, 24, 23, 50, 0, 0, time.UTC), budgetRenewalMaxWait},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := untilNextRenewal(tt.now, wib); got != tt.want {
+				t.Errorf("expected %s, got %s", tt.want, got)
+			}
+		})
+	}
+}
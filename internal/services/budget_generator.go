@@ -0,0 +1,82 @@
+package services
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/stewicca/angagrar-backend/pkg/utils"
+)
+
+// lifestyleRatios split what is left of the salary after essentials between
+// savings, fun and the rest
+type lifestyleRatios struct {
+	savings float64
+	healing float64
+	other   float64
+}
+
+var lifestyleBudgetRatios = map[string]lifestyleRatios{
+	"Minimalis": {savings: 0.60, healing: 0.20, other: 0.20},
+	"Moderate":  {savings: 0.45, healing: 0.35, other: 0.20},
+	"Santai":    {savings: 0.30, healing: 0.50, other: 0.20},
+}
+
+// maxEssentialsShare keeps room for savings when the cost of living eats
+// most of a low salary
+const maxEssentialsShare = 0.8
+
+// GenerateRuleBasedBudget splits a salary into the six budget categories
+// without an LLM: Kewajiban, Makan and Transport follow the cost-of-living
+// baseline, the remainder goes to Tabungan, Healing and Lain-lain by
+// lifestyle ratios.
+func GenerateRuleBasedBudget(salary float64, baseline *CostBaseline) (*BudgetData, error) {
+	if err := utils.ValidateSalary(salary); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidSalary, err)
+	}
+
+	ratios, ok := lifestyleBudgetRatios[baseline.Lifestyle]
+	if !ok {
+		ratios = lifestyleBudgetRatios["Moderate"]
+	}
+
+	target := utils.RoundToNearest(salary, budgetRoundingInterval)
+
+	obligations, food, transport := baseline.Rent, baseline.Food, baseline.Transport
+
+	if essentials := obligations + food + transport; essentials > target*maxEssentialsShare {
+		scale := target * maxEssentialsShare / essentials
+		obligations *= scale
+		food *= scale
+		transport *= scale
+	}
+
+	round := func(amount float64) float64 {
+		return utils.RoundToNearest(amount, budgetRoundingInterval)
+	}
+
+	obligations, food, transport = round(obligations), round(food), round(transport)
+	rest := target - obligations - food - transport
+	healing := round(rest * ratios.healing)
+	other := round(rest * ratios.other)
+	// Savings take the rounding remainder so the total matches exactly
+	savings := math.Max(rest-healing-other, 0)
+
+	place := baseline.Source
+	if baseline.Location != "" && baseline.Location != baseline.Source {
+		place = fmt.Sprintf("%s (pakai angka %s)", baseline.Location, baseline.Source)
+	}
+
+	return &BudgetData{
+		Salary:   target,
+		Location: baseline.Location,
+		Analysis: fmt.Sprintf("budget ini dihitung dari estimasi biaya hidup di %s dengan lifestyle %s: kebutuhan pokok dulu, sisanya dibagi ke tabungan, healing, dan lain-lain.", place, baseline.Lifestyle),
+		Categories: []BudgetCategory{
+			{Name: "Kewajiban", Amount: obligations, Description: "sewa, utilities, cicilan"},
+			{Name: "Makan", Amount: food, Description: "makanan sehari-hari"},
+			{Name: "Transport", Amount: transport, Description: "transportasi"},
+			{Name: "Healing", Amount: healing, Description: "hiburan, self-care"},
+			{Name: "Tabungan", Amount: savings, Description: "tabungan & investasi"},
+			{Name: "Lain-lain", Amount: other, Description: "pengeluaran lain"},
+		},
+	}, nil
+}
@@ -0,0 +1,74 @@
+package services
+
+import (
+	"context"
+	"testing"
+)
+
+func TestGenerateRuleBasedBudgetAddsUpToSalary(t *testing.T) {
+	costs := newTestCostOfLiving(t)
+
+	for _, city := range []string{"jkt", "Bandung", "jogja", "kab. garut", "Atlantis", ""} {
+		for _, lifestyle := range []string{"hemat", "moderate", "santai"} {
+			baseline, err := costs.Baseline(context.Background(), city, lifestyle)
+			if err != nil {
+				t.Fatalf("Baseline(%q, %q): %v", city, lifestyle, err)
+			}
+
+			for _, salary := range []float64{1500000, 4750500, 8000000, 35000000} {
+				data, err := GenerateRuleBasedBudget(salary, baseline)
+				if err != nil {
+					t.Fatalf("GenerateRuleBasedBudget(%.0f, %q, %q): %v", salary, city, lifestyle, err)
+				}
+
+				if problems := validateBudgetData(data); len(problems) != 0 {
+					t.Errorf("GenerateRuleBasedBudget(%.0f, %q, %q) is invalid: %v", salary, city, lifestyle, problems)
+				}
+			}
+		}
+	}
+}
+
+func TestGenerateRuleBasedBudgetFollowsCityAndLifestyle(t *testing.T) {
+	costs := newTestCostOfLiving(t)
+
+	generate := func(city, lifestyle string) *BudgetData {
+		baseline, err := costs.Baseline(context.Background(), city, lifestyle)
+		if err != nil {
+			t.Fatalf("Baseline(%q, %q): %v", city, lifestyle, err)
+		}
+		data, err := GenerateRuleBasedBudget(10000000, baseline)
+		if err != nil {
+			t.Fatalf("GenerateRuleBasedBudget: %v", err)
+		}
+		return data
+	}
+
+	amount := func(data *BudgetData, category string) float64 {
+		for _, cat := range data.Categories {
+			if cat.Name == category {
+				return cat.Amount
+			}
+		}
+		return 0
+	}
+
+	if amount(generate("jakarta", "moderate"), "Kewajiban") <= amount(generate("jogja", "moderate"), "Kewajiban") {
+		t.Errorf("expected higher obligations in Jakarta than Yogyakarta")
+	}
+
+	frugal, relaxed := generate("bandung", "hemat"), generate("bandung", "santai")
+	if amount(frugal, "Tabungan") <= amount(relaxed, "Tabungan") {
+		t.Errorf("expected a frugal lifestyle to save more")
+	}
+	if amount(frugal, "Healing") >= amount(relaxed, "Healing") {
+		t.Errorf("expected a relaxed lifestyle to spend more on healing")
+	}
+}
+
+func TestGenerateRuleBasedBudgetRejectsInvalidSalary(t *testing.T) {
+	baseline := &CostBaseline{Lifestyle: "Moderate", Rent: 1000000, Food: 1000000, Transport: 300000}
+	if _, err := GenerateRuleBasedBudget(0, baseline); err == nil {
+		t.Errorf("expected an error for a zero salary")
+	}
+}
@@ -0,0 +1,74 @@
+package services
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// budgetRenewalMaxWait bounds the wait between runs so a missed boundary
+// (downtime, clock jump) is caught up soon after
+const budgetRenewalMaxWait = time.Hour
+
+// BudgetRenewalScheduler renews budgets when a new period starts. Paydays
+// differ per user, so after catching up on Start it runs at every midnight
+// in the budget calendar's location, and at least hourly.
+type BudgetRenewalScheduler struct {
+	budgetService BudgetService
+	location      *time.Location
+	now           func() time.Time
+	ctx           context.Context
+	cancel        context.CancelFunc
+	done          chan struct{}
+}
+
+func NewBudgetRenewalScheduler(budgetService BudgetService, location *time.Location) *BudgetRenewalScheduler {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &BudgetRenewalScheduler{
+		budgetService: budgetService,
+		location:      location,
+		now:           time.Now,
+		ctx:           ctx,
+		cancel:        cancel,
+		done:          make(chan struct{}),
+	}
+}
+
+func (s *BudgetRenewalScheduler) Start() {
+	go s.run()
+}
+
+// Stop cancels a running renewal and waits for it to return. Budgets it did
+// not get to are renewed on the next Start.
+func (s *BudgetRenewalScheduler) Stop() {
+	s.cancel()
+	<-s.done
+}
+
+func (s *BudgetRenewalScheduler) run() {
+	defer close(s.done)
+
+	for {
+		if _, err := s.budgetService.RenewBudgets(s.ctx, s.now()); err != nil && s.ctx.Err() == nil {
+			log.Printf("Budget renewal failed: %v", err)
+		}
+
+		timer := time.NewTimer(untilNextRenewal(s.now(), s.location))
+		select {
+		case <-s.ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+	}
+}
+
+func untilNextRenewal(now time.Time, location *time.Location) time.Duration {
+	now = now.In(location)
+	midnight := time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, location)
+	wait := midnight.Sub(now)
+	if wait > budgetRenewalMaxWait {
+		return budgetRenewalMaxWait
+	}
+	return wait
+}
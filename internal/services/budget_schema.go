@@ -0,0 +1,177 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/stewicca/angagrar-backend/pkg/utils"
+)
+
+// budgetCategories are the categories Aira allocates, in display order
+var budgetCategories = []string{"Kewajiban", "Makan", "Transport", "Healing", "Tabungan", "Lain-lain"}
+
+// budgetRoundingInterval is what every budget amount is rounded to
+const budgetRoundingInterval = 1000
+
+// budgetSchema is the JSON schema the budget analysis must follow. Bounds are
+// checked by validateBudgetData since strict structured output rejects most
+// numeric keywords.
+var budgetSchema = JSONSchema{
+	Name:        "budget_recommendation",
+	Description: "Monthly budget allocation of the user's salary",
+	Schema: json.RawMessage(`{
+  "type": "object",
+  "properties": {
+    "salary": {"type": "number", "description": "monthly income in rupiah"},
+    "location": {"type": "string"},
+    "analysis": {"type": "string", "description": "why this budget suits the user"},
+    "categories": {
+      "type": "array",
+      "items": {
+        "type": "object",
+        "properties": {
+          "name": {"type": "string", "enum": ["Kewajiban", "Makan", "Transport", "Healing", "Tabungan", "Lain-lain"]},
+          "amount": {"type": "number", "description": "rupiah, rounded to 1000"},
+          "description": {"type": "string"}
+        },
+        "required": ["name", "amount", "description"],
+        "additionalProperties": false
+      }
+    }
+  },
+  "required": ["salary", "location", "analysis", "categories"],
+  "additionalProperties": false
+}`),
+}
+
+// parseBudgetData decodes a budget analysis. Providers without structured
+// output may wrap the object in text, so everything around it is ignored.
+func parseBudgetData(raw string) (*BudgetData, error) {
+	start := strings.Index(raw, "{")
+	end := strings.LastIndex(raw, "}") + 1
+
+	if start == -1 || end <= start {
+		return nil, fmt.Errorf("no JSON found in response")
+	}
+
+	var budgetData BudgetData
+	if err := json.Unmarshal([]byte(raw[start:end]), &budgetData); err != nil {
+		return nil, fmt.Errorf("failed to parse JSON: %w", err)
+	}
+
+	return &budgetData, nil
+}
+
+// validateBudgetData lists everything wrong with a budget, in words the LLM
+// can act on when asked to fix it
+func validateBudgetData(data *BudgetData) []string {
+	var problems []string
+
+	if data.Salary <= 0 {
+		problems = append(problems, "salary must be greater than 0")
+	}
+
+	if len(data.Categories) == 0 {
+		problems = append(problems, "categories must not be empty")
+	}
+
+	seen := make(map[string]bool)
+	total := 0.0
+	for _, cat := range data.Categories {
+		if !isBudgetCategory(cat.Name) {
+			problems = append(problems, fmt.Sprintf("unknown category %q, use one of %s", cat.Name, strings.Join(budgetCategories, ", ")))
+		}
+		if seen[cat.Name] {
+			problems = append(problems, fmt.Sprintf("category %s appears more than once", cat.Name))
+		}
+		seen[cat.Name] = true
+
+		if cat.Amount < 0 {
+			problems = append(problems, fmt.Sprintf("amount for %s must not be negative", cat.Name))
+		}
+		if cat.Amount != utils.RoundToNearest(cat.Amount, budgetRoundingInterval) {
+			problems = append(problems, fmt.Sprintf("amount for %s must be rounded to %d", cat.Name, budgetRoundingInterval))
+		}
+		total += cat.Amount
+	}
+
+	if data.Salary > 0 {
+		expected := utils.RoundToNearest(data.Salary, budgetRoundingInterval)
+		if math.Abs(total-expected) >= 1 {
+			problems = append(problems, fmt.Sprintf("categories add up to %.0f but must add up to the salary %.0f", total, expected))
+		}
+	}
+
+	return problems
+}
+
+// rebalanceBudget makes a budget valid without asking the LLM again. Unknown
+// categories go to Lain-lain, duplicates are merged, negative amounts are
+// dropped, and the rest is scaled to the salary and rounded. The rounding
+// remainder goes to the largest category.
+func rebalanceBudget(data *BudgetData) error {
+	amounts := make(map[string]float64)
+	descriptions := make(map[string]string)
+
+	for _, cat := range data.Categories {
+		name := cat.Name
+		if !isBudgetCategory(name) {
+			name = "Lain-lain"
+		}
+		amounts[name] += math.Max(cat.Amount, 0)
+		if descriptions[name] == "" {
+			descriptions[name] = cat.Description
+		}
+	}
+
+	total := 0.0
+	for _, amount := range amounts {
+		total += amount
+	}
+	if total <= 0 {
+		return fmt.Errorf("budget has no positive amounts to rebalance")
+	}
+
+	if data.Salary <= 0 {
+		data.Salary = total
+	}
+	target := utils.RoundToNearest(data.Salary, budgetRoundingInterval)
+
+	rebalanced := data.Categories[:0]
+	allocated := 0.0
+	largest := -1
+	for _, name := range budgetCategories {
+		amount, ok := amounts[name]
+		if !ok {
+			continue
+		}
+
+		amount = utils.RoundToNearest(amount*target/total, budgetRoundingInterval)
+		allocated += amount
+		if largest == -1 || amount > rebalanced[largest].Amount {
+			largest = len(rebalanced)
+		}
+
+		rebalanced = append(rebalanced, BudgetCategory{
+			Name:        name,
+			Amount:      amount,
+			Description: descriptions[name],
+		})
+	}
+
+	rebalanced[largest].Amount += target - allocated
+	data.Categories = rebalanced
+
+	return nil
+}
+
+func isBudgetCategory(name string) bool {
+	for _, category := range budgetCategories {
+		if name == category {
+			return true
+		}
+	}
+	return false
+}
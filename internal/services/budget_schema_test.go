@@ -0,0 +1,74 @@
+package services
+
+import (
+	"testing"
+)
+
+func sumCategories(data *BudgetData) float64 {
+	total := 0.0
+	for _, cat := range data.Categories {
+		total += cat.Amount
+	}
+	return total
+}
+
+func TestDefaultScriptBudgetIsValid(t *testing.T) {
+	data, err := parseBudgetData(defaultScript[0].Reply)
+	if err != nil {
+		t.Fatalf("parseBudgetData: %v", err)
+	}
+
+	if problems := validateBudgetData(data); len(problems) != 0 {
+		t.Errorf("expected a valid budget, got %v", problems)
+	}
+}
+
+func TestValidateBudgetDataReportsProblems(t *testing.T) {
+	data := &BudgetData{
+		Salary: 5000000,
+		Categories: []BudgetCategory{
+			{Name: "Makan", Amount: 2000500},
+			{Name: "Kopi", Amount: 1000000},
+			{Name: "Tabungan", Amount: -500000},
+		},
+	}
+
+	problems := validateBudgetData(data)
+	if len(problems) != 4 {
+		t.Errorf("expected 4 problems (rounding, unknown category, negative amount, sum), got %d: %v", len(problems), problems)
+	}
+}
+
+func TestRebalanceBudgetMatchesSalary(t *testing.T) {
+	data := &BudgetData{
+		Salary: 7250400,
+		Categories: []BudgetCategory{
+			{Name: "Tabungan", Amount: 1000000},
+			{Name: "Makan", Amount: 2000500},
+			{Name: "Kopi", Amount: 333333},
+			{Name: "Makan", Amount: 500000},
+			{Name: "Healing", Amount: -100000},
+		},
+	}
+
+	if err := rebalanceBudget(data); err != nil {
+		t.Fatalf("rebalanceBudget: %v", err)
+	}
+
+	if problems := validateBudgetData(data); len(problems) != 0 {
+		t.Fatalf("rebalanced budget is invalid: %v", problems)
+	}
+	if total := sumCategories(data); total != 7250000 {
+		t.Errorf("expected total 7250000, got %.0f", total)
+	}
+
+	want := []string{"Makan", "Healing", "Tabungan", "Lain-lain"}
+	if len(data.Categories) != len(want) {
+		t.Fatalf("expected categories %v, got %+v", want, data.Categories)
+	}
+	for i, name := range want {
+		if data.Categories[i].Name != name {
+			t.Errorf("category %d: expected %s, got %s", i, name, data.Categories[i].Name)
+		}
+	}
+}
@@ -0,0 +1,451 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/stewicca/angagrar-backend/internal/models"
+	"github.com/stewicca/angagrar-backend/internal/repositories"
+	"github.com/stewicca/angagrar-backend/pkg/utils"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrBudgetNotFound      = errors.New("budget not found")
+	ErrBudgetNotOwned      = errors.New("you don't have permission to update this budget")
+	ErrInvalidBudgetAmount = errors.New("amount must be greater than 0")
+	ErrInvalidBudgetPeriod = errors.New("period must be 'monthly' or 'yearly'")
+	ErrBudgetExists        = errors.New("a budget for this category already exists in this period")
+	ErrSalaryRequired      = errors.New("salary is required, send it or fill in the financial profile")
+)
+
+// BudgetGeneration is the input of a rule-based budget; empty fields are
+// taken from the user's financial profile. Save stores the budget for the
+// current pay period instead of only returning it.
+type BudgetGeneration struct {
+	Salary    float64
+	City      string
+	Lifestyle string
+	Save      bool
+}
+
+// BudgetUpdate holds the fields to change; nil fields are left as is
+type BudgetUpdate struct {
+	Amount   *float64
+	Rollover *bool
+}
+
+// BudgetProgress is how much of one budget has been spent so far
+type BudgetProgress struct {
+	Budget         models.Budget `json:"budget"`
+	Spent          float64       `json:"spent"`
+	Remaining      float64       `json:"remaining"`
+	PercentageUsed float64       `json:"percentage_used"`
+	ProjectedSpend float64       `json:"projected_spend"` // Spent extrapolated to the end of the period
+	DaysElapsed    int           `json:"days_elapsed"`
+	DaysTotal      int           `json:"days_total"`
+}
+
+// BudgetProgressReport covers every budget active on a given date
+type BudgetProgressReport struct {
+	Date           time.Time        `json:"date"`
+	Budgets        []BudgetProgress `json:"budgets"`
+	TotalBudget    float64          `json:"total_budget"`
+	TotalSpent     float64          `json:"total_spent"`
+	TotalRemaining float64          `json:"total_remaining"`
+	PercentageUsed float64          `json:"percentage_used"`
+}
+
+type BudgetService interface {
+	GetUserBudgets(ctx context.Context, userID uint) ([]models.Budget, error)
+	CreateBudget(ctx context.Context, userID uint, category string, amount float64, period, description string, rollover bool) (*models.Budget, error)
+	UpdateBudget(ctx context.Context, userID, budgetID uint, update BudgetUpdate) (*models.Budget, error)
+	GetProgress(ctx context.Context, userID uint, at time.Time) (*BudgetProgressReport, error)
+	GenerateBudget(ctx context.Context, userID uint, input BudgetGeneration) (*BudgetData, []models.Budget, error)
+	RenewBudgets(ctx context.Context, now time.Time) (int, error)
+}
+
+type budgetService struct {
+	budgetRepo      repositories.BudgetRepository
+	transactionRepo repositories.TransactionRepository
+	userRepo        repositories.UserRepository
+	profileRepo     repositories.FinancialProfileRepository
+	calendar        *BudgetCalendar
+	costOfLiving    CostOfLivingService
+}
+
+func NewBudgetService(
+	budgetRepo repositories.BudgetRepository,
+	transactionRepo repositories.TransactionRepository,
+	userRepo repositories.UserRepository,
+	profileRepo repositories.FinancialProfileRepository,
+	calendar *BudgetCalendar,
+	costOfLiving CostOfLivingService,
+) BudgetService {
+	return &budgetService{
+		budgetRepo:      budgetRepo,
+		transactionRepo: transactionRepo,
+		userRepo:        userRepo,
+		profileRepo:     profileRepo,
+		calendar:        calendar,
+		costOfLiving:    costOfLiving,
+	}
+}
+
+func (s *budgetService) GetUserBudgets(ctx context.Context, userID uint) ([]models.Budget, error) {
+	return s.budgetRepo.FindByUserID(ctx, userID)
+}
+
+// CreateBudget adds a budget for the user's period that contains the current time
+func (s *budgetService) CreateBudget(ctx context.Context, userID uint, category string, amount float64, period, description string, rollover bool) (*models.Budget, error) {
+	if amount <= 0 {
+		return nil, ErrInvalidBudgetAmount
+	}
+
+	if period != models.BudgetPeriodMonthly && period != models.BudgetPeriodYearly {
+		return nil, ErrInvalidBudgetPeriod
+	}
+
+	user, err := s.userRepo.FindByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	startDate, endDate := s.calendar.PeriodBounds(user, period, time.Now())
+
+	active, err := s.budgetRepo.FindActiveByUserID(ctx, userID, startDate)
+	if err != nil {
+		return nil, err
+	}
+	if hasBudgetCategory(active, period, category) {
+		return nil, ErrBudgetExists
+	}
+
+	budget := &models.Budget{
+		UserID:      userID,
+		Category:    strings.TrimSpace(category),
+		Amount:      amount,
+		Period:      period,
+		StartDate:   startDate,
+		EndDate:     endDate,
+		Description: description,
+		Rollover:    rollover,
+	}
+
+	if err := s.budgetRepo.Create(ctx, budget); err != nil {
+		return nil, err
+	}
+
+	return budget, nil
+}
+
+func (s *budgetService) UpdateBudget(ctx context.Context, userID, budgetID uint, update BudgetUpdate) (*models.Budget, error) {
+	budget, err := s.budgetRepo.FindByID(ctx, budgetID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrBudgetNotFound
+		}
+		return nil, err
+	}
+
+	if budget.UserID != userID {
+		return nil, ErrBudgetNotOwned
+	}
+
+	if update.Amount != nil {
+		if *update.Amount <= 0 {
+			return nil, ErrInvalidBudgetAmount
+		}
+		budget.Amount = *update.Amount
+	}
+	if update.Rollover != nil {
+		budget.Rollover = *update.Rollover
+	}
+
+	if err := s.budgetRepo.Update(ctx, budget); err != nil {
+		return nil, err
+	}
+
+	return budget, nil
+}
+
+// GetProgress sums the expenses linked to every budget active at the given
+// time and projects the spend to the end of each budget's period
+func (s *budgetService) GetProgress(ctx context.Context, userID uint, at time.Time) (*BudgetProgressReport, error) {
+	budgets, err := s.budgetRepo.FindActiveByUserID(ctx, userID, at)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]uint, 0, len(budgets))
+	for _, budget := range budgets {
+		ids = append(ids, budget.ID)
+	}
+
+	spentByBudget, err := s.transactionRepo.SumExpensesByBudget(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &BudgetProgressReport{
+		Date:    at,
+		Budgets: make([]BudgetProgress, 0, len(budgets)),
+	}
+
+	for _, budget := range budgets {
+		progress := calculateBudgetProgress(budget, spentByBudget[budget.ID], at)
+		report.Budgets = append(report.Budgets, progress)
+		report.TotalBudget += budget.Amount
+		report.TotalSpent += progress.Spent
+	}
+
+	report.TotalRemaining = report.TotalBudget - report.TotalSpent
+	report.PercentageUsed = percentageOf(report.TotalSpent, report.TotalBudget)
+
+	return report, nil
+}
+
+// GenerateBudget builds a budget with the rule-based engine, without the LLM
+func (s *budgetService) GenerateBudget(ctx context.Context, userID uint, input BudgetGeneration) (*BudgetData, []models.Budget, error) {
+	if input.Salary == 0 || input.City == "" || input.Lifestyle == "" {
+		profile, err := s.profileRepo.FindByUserID(ctx, userID)
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil, err
+		}
+		if profile != nil {
+			if input.Salary == 0 {
+				input.Salary = profile.Salary
+			}
+			if input.City == "" {
+				input.City = profile.City
+			}
+			if input.Lifestyle == "" {
+				input.Lifestyle = profile.Lifestyle
+			}
+		}
+	}
+
+	if input.Salary == 0 {
+		return nil, nil, ErrSalaryRequired
+	}
+
+	if input.City != "" {
+		input.City = utils.NormalizeLocation(input.City)
+		if !utils.IsValidLocation(input.City) {
+			return nil, nil, ErrUnknownLocation
+		}
+	}
+
+	baseline, err := s.costOfLiving.Baseline(ctx, input.City, input.Lifestyle)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	data, err := GenerateRuleBasedBudget(input.Salary, baseline)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if !input.Save {
+		return data, nil, nil
+	}
+
+	user, err := s.userRepo.FindByID(ctx, userID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	budgets := monthlyBudgetRecords(s.calendar, user, data, time.Now())
+
+	active, err := s.budgetRepo.FindActiveByUserID(ctx, userID, budgets[0].StartDate)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, budget := range budgets {
+		if hasBudgetCategory(active, budget.Period, budget.Category) {
+			return nil, nil, fmt.Errorf("%w: %s", ErrBudgetExists, budget.Category)
+		}
+	}
+
+	if err := s.budgetRepo.CreateBatch(ctx, budgets); err != nil {
+		return nil, nil, err
+	}
+
+	return data, budgets, nil
+}
+
+// monthlyBudgetRecords turns a budget analysis into budgets for the user's
+// pay period containing at
+func monthlyBudgetRecords(calendar *BudgetCalendar, user *models.User, data *BudgetData, at time.Time) []models.Budget {
+	startDate, endDate := calendar.PeriodBounds(user, models.BudgetPeriodMonthly, at)
+
+	budgets := []models.Budget{}
+	for _, cat := range data.Categories {
+		budgets = append(budgets, models.Budget{
+			UserID:      user.ID,
+			Category:    cat.Name,
+			Amount:      cat.Amount,
+			Period:      models.BudgetPeriodMonthly,
+			StartDate:   startDate,
+			EndDate:     endDate,
+			Description: cat.Description,
+		})
+	}
+
+	return budgets
+}
+
+// RenewBudgets clones every budget that ended in the user's previous period
+// into the period containing now, carrying over the unspent (or overspent)
+// amount for budgets with Rollover. A user who already has a budget for the
+// category in the new period keeps it and the old one is not renewed.
+func (s *budgetService) RenewBudgets(ctx context.Context, now time.Time) (int, error) {
+	renewed := 0
+	users := make(map[uint]*models.User)
+
+	for _, period := range []string{models.BudgetPeriodMonthly, models.BudgetPeriodYearly} {
+		// Pay cycles differ per user, so fetch everything that ended recently
+		// and work out each user's periods below
+		lookback := now.AddDate(0, -2, 0)
+		if period == models.BudgetPeriodYearly {
+			lookback = now.AddDate(-2, 0, 0)
+		}
+
+		budgets, err := s.budgetRepo.FindRenewable(ctx, period, lookback, now)
+		if err != nil {
+			return renewed, err
+		}
+		if len(budgets) == 0 {
+			continue
+		}
+
+		ids := make([]uint, 0, len(budgets))
+		for _, budget := range budgets {
+			ids = append(ids, budget.ID)
+		}
+
+		spentByBudget, err := s.transactionRepo.SumExpensesByBudget(ctx, ids)
+		if err != nil {
+			return renewed, err
+		}
+
+		for _, budget := range budgets {
+			user, ok := users[budget.UserID]
+			if !ok {
+				user, err = s.userRepo.FindByID(ctx, budget.UserID)
+				if err != nil {
+					return renewed, err
+				}
+				users[budget.UserID] = user
+			}
+
+			currentStart, currentEnd := s.calendar.PeriodBounds(user, period, now)
+			previousStart, _ := s.calendar.PeriodBounds(user, period, currentStart.Add(-time.Second))
+			if budget.EndDate.Before(previousStart) {
+				continue
+			}
+
+			// The pay cycle changed while this budget ran, so the new period
+			// starts right after it instead of overlapping
+			startDate := currentStart
+			if !budget.EndDate.Before(startDate) {
+				startDate = budget.EndDate.Add(time.Second)
+			}
+
+			active, err := s.budgetRepo.FindActiveByUserID(ctx, budget.UserID, startDate)
+			if err != nil {
+				return renewed, err
+			}
+			if hasBudgetCategory(active, period, budget.Category) {
+				continue
+			}
+
+			next := renewBudget(budget, spentByBudget[budget.ID], startDate, currentEnd)
+			created, err := s.budgetRepo.CreateRenewal(ctx, &next)
+			if err != nil {
+				return renewed, err
+			}
+			if created {
+				renewed++
+			}
+		}
+	}
+
+	if renewed > 0 {
+		log.Printf("Renewed %d budgets", renewed)
+	}
+
+	return renewed, nil
+}
+
+// renewBudget copies a budget into a new period. The base amount excludes the
+// rollover the previous budget received, so carries do not compound.
+func renewBudget(previous models.Budget, spent float64, startDate, endDate time.Time) models.Budget {
+	baseAmount := previous.Amount - previous.RolloverAmount
+
+	rolloverAmount := 0.0
+	if previous.Rollover {
+		rolloverAmount = previous.Amount - spent
+	}
+
+	return models.Budget{
+		UserID:           previous.UserID,
+		Category:         previous.Category,
+		Amount:           math.Max(baseAmount+rolloverAmount, 0),
+		Period:           previous.Period,
+		StartDate:        startDate,
+		EndDate:          endDate,
+		Description:      previous.Description,
+		Rollover:         previous.Rollover,
+		RolloverAmount:   rolloverAmount,
+		PreviousBudgetID: &previous.ID,
+	}
+}
+
+func hasBudgetCategory(budgets []models.Budget, period, category string) bool {
+	for _, budget := range budgets {
+		if budget.Period == period && strings.EqualFold(budget.Category, strings.TrimSpace(category)) {
+			return true
+		}
+	}
+	return false
+}
+
+func calculateBudgetProgress(budget models.Budget, spent float64, at time.Time) BudgetProgress {
+	daysTotal := daysBetween(budget.StartDate, budget.EndDate)
+	daysElapsed := daysBetween(budget.StartDate, at)
+	if daysElapsed > daysTotal {
+		daysElapsed = daysTotal
+	}
+
+	return BudgetProgress{
+		Budget:         budget,
+		Spent:          spent,
+		Remaining:      budget.Amount - spent,
+		PercentageUsed: percentageOf(spent, budget.Amount),
+		ProjectedSpend: math.Round(spent / float64(daysElapsed) * float64(daysTotal)),
+		DaysElapsed:    daysElapsed,
+		DaysTotal:      daysTotal,
+	}
+}
+
+// daysBetween counts the calendar days from start to end, both included
+func daysBetween(start, end time.Time) int {
+	days := int(end.Sub(start).Hours()/24) + 1
+	if days < 1 {
+		return 1
+	}
+	return days
+}
+
+func percentageOf(part, total float64) float64 {
+	if total <= 0 {
+		return 0
+	}
+	return math.Round(part/total*10000) / 100
+}
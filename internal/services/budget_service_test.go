@@ -0,0 +1,306 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stewicca/angagrar-backend/internal/models"
+	"github.com/stewicca/angagrar-backend/internal/repositories"
+)
+
+// fakeExpenseRepo only answers the spending totals renewals need
+type fakeExpenseRepo struct {
+	repositories.TransactionRepository
+	spent map[uint]float64
+}
+
+func (r *fakeExpenseRepo) SumExpensesByBudget(ctx context.Context, budgetIDs []uint) (map[uint]float64, error) {
+	spent := make(map[uint]float64, len(budgetIDs))
+	for _, id := range budgetIDs {
+		spent[id] = r.spent[id]
+	}
+	return spent, nil
+}
+
+// payCycleUserRepo returns the users it was given, with their pay cycles
+type payCycleUserRepo struct {
+	fakeUserRepo
+	users map[uint]*models.User
+}
+
+func (r *payCycleUserRepo) FindByID(ctx context.Context, id uint) (*models.User, error) {
+	user := *r.users[id]
+	return &user, nil
+}
+
+// staleBudgetRepo answers reads from before another process renewed the
+// budgets, the way a concurrent run sees them
+type staleBudgetRepo struct {
+	*fakeBudgetRepo
+	snapshot []models.Budget
+}
+
+func (r *staleBudgetRepo) FindRenewable(ctx context.Context, period string, endedFrom, endedBefore time.Time) ([]models.Budget, error) {
+	stale := &fakeBudgetRepo{budgets: r.snapshot}
+	return stale.FindRenewable(ctx, period, endedFrom, endedBefore)
+}
+
+func (r *staleBudgetRepo) FindActiveByUserID(ctx context.Context, userID uint, at time.Time) ([]models.Budget, error) {
+	stale := &fakeBudgetRepo{budgets: r.snapshot}
+	return stale.FindActiveByUserID(ctx, userID, at)
+}
+
+func newTestBudgetService(t *testing.T, budgetRepo repositories.BudgetRepository, spent map[uint]float64, users ...*models.User) BudgetService {
+	t.Helper()
+
+	userRepo := &payCycleUserRepo{users: make(map[uint]*models.User)}
+	for _, user := range users {
+		userRepo.users[user.ID] = user
+	}
+	return NewBudgetService(budgetRepo, &fakeExpenseRepo{spent: spent}, userRepo, &fakeProfileRepo{}, newTestBudgetCalendar(t), nil)
+}
+
+func createBudget(t *testing.T, repo *fakeBudgetRepo, budget models.Budget) models.Budget {
+	t.Helper()
+
+	if err := repo.Create(context.Background(), &budget); err != nil {
+		t.Fatalf("create budget: %v", err)
+	}
+	return budget
+}
+
+// renewalOf returns the budget renewed from previous, if any
+func renewalOf(repo *fakeBudgetRepo, previous models.Budget) *models.Budget {
+	for _, budget := range repo.budgets {
+		if budget.PreviousBudgetID != nil && *budget.PreviousBudgetID == previous.ID {
+			return &budget
+		}
+	}
+	return nil
+}
+
+func TestRenewBudget(t *testing.T) {
+	tests := []struct {
+		name         string
+		previous     models.Budget
+		spent        float64
+		wantAmount   float64
+		wantRollover float64
+	}{
+		{"unspent rollover carried once", models.Budget{Amount: 1200000, RolloverAmount: 200000, Rollover: true}, 700000, 1500000, 500000},
+		{"overspending reduces the next amount", models.Budget{Amount: 1000000, Rollover: true}, 1300000, 700000, -300000},
+		{"overspending past the base amount", models.Budget{Amount: 1000000, Rollover: true}, 2500000, 0, -1500000},
+		{"earlier overspending is not charged twice", models.Budget{Amount: 700000, RolloverAmount: -300000, Rollover: true}, 0, 1700000, 700000},
+		{"rollover turned off drops the carry", models.Budget{Amount: 1200000, RolloverAmount: 200000}, 100000, 1000000, 0},
+	}
+
+	start := time.Date(2025, 4, 25, 0, 0, 0, 0, wib)
+	end := time.Date(2025, 5, 24, 23, 59, 59, 0, wib)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.previous.ID = 7
+			next := renewBudget(tt.previous, tt.spent, start, end)
+
+			if next.Amount != tt.wantAmount || next.RolloverAmount != tt.wantRollover {
+				t.Errorf("expected %.0f with rollover %.0f, got %.0f with rollover %.0f", tt.wantAmount, tt.wantRollover, next.Amount, next.RolloverAmount)
+			}
+			if next.PreviousBudgetID == nil || *next.PreviousBudgetID != 7 || next.Rollover != tt.previous.Rollover {
+				t.Errorf("expected a renewal of budget 7 keeping rollover=%v, got %+v", tt.previous.Rollover, next)
+			}
+			if !next.StartDate.Equal(start) || !next.EndDate.Equal(end) {
+				t.Errorf("expected %s - %s, got %s - %s", start, end, next.StartDate, next.EndDate)
+			}
+		})
+	}
+}
+
+func TestRenewBudgetsOnceAtPayday(t *testing.T) {
+	ctx := context.Background()
+	budgetRepo := &fakeBudgetRepo{}
+	user := &models.User{ID: ownerID, PayDay: 25, PayDayAdjust: models.PayDayAdjustNone}
+
+	start := time.Date(2025, 3, 25, 0, 0, 0, 0, wib)
+	end := time.Date(2025, 4, 24, 23, 59, 59, 0, wib)
+	food := createBudget(t, budgetRepo, models.Budget{UserID: ownerID, Category: "Makan", Amount: 1200000, RolloverAmount: 200000, Rollover: true,
+		Period: models.BudgetPeriodMonthly, StartDate: start, EndDate: end})
+	transport := createBudget(t, budgetRepo, models.Budget{UserID: ownerID, Category: "Transport", Amount: 500000,
+		Period: models.BudgetPeriodMonthly, StartDate: start, EndDate: end})
+
+	service := newTestBudgetService(t, budgetRepo, map[uint]float64{food.ID: 700000, transport.ID: 600000}, user)
+
+	// Still in the period, nothing to renew yet
+	if renewed, err := service.RenewBudgets(ctx, end); err != nil || renewed != 0 {
+		t.Fatalf("expected no renewal before payday, got %d, %v", renewed, err)
+	}
+
+	payday := time.Date(2025, 4, 25, 0, 0, 5, 0, wib)
+	renewed, err := service.RenewBudgets(ctx, payday)
+	if err != nil {
+		t.Fatalf("RenewBudgets: %v", err)
+	}
+	if renewed != 2 {
+		t.Fatalf("expected 2 renewals, got %d", renewed)
+	}
+
+	nextStart := time.Date(2025, 4, 25, 0, 0, 0, 0, wib)
+	nextEnd := time.Date(2025, 5, 24, 23, 59, 59, 0, wib)
+	for _, tt := range []struct {
+		previous     models.Budget
+		wantAmount   float64
+		wantRollover float64
+	}{
+		{food, 1500000, 500000},
+		{transport, 500000, 0},
+	} {
+		next := renewalOf(budgetRepo, tt.previous)
+		if next == nil {
+			t.Fatalf("%s was not renewed", tt.previous.Category)
+		}
+		if next.Amount != tt.wantAmount || next.RolloverAmount != tt.wantRollover {
+			t.Errorf("%s: expected %.0f with rollover %.0f, got %.0f with rollover %.0f", tt.previous.Category, tt.wantAmount, tt.wantRollover, next.Amount, next.RolloverAmount)
+		}
+		if !next.StartDate.Equal(nextStart) || !next.EndDate.Equal(nextEnd) {
+			t.Errorf("%s: expected %s - %s, got %s - %s", tt.previous.Category, nextStart, nextEnd, next.StartDate, next.EndDate)
+		}
+	}
+
+	// The scheduler runs again within the same period
+	if renewed, err := service.RenewBudgets(ctx, payday.Add(time.Hour)); err != nil || renewed != 0 {
+		t.Errorf("expected the second run to renew nothing, got %d, %v", renewed, err)
+	}
+	if len(budgetRepo.budgets) != 4 {
+		t.Errorf("expected 4 budgets, got %d", len(budgetRepo.budgets))
+	}
+}
+
+func TestRenewBudgetsLosingTheRaceCreatesNothing(t *testing.T) {
+	ctx := context.Background()
+	budgetRepo := &fakeBudgetRepo{}
+	user := &models.User{ID: ownerID, PayDay: 25, PayDayAdjust: models.PayDayAdjustNone}
+	createBudget(t, budgetRepo, models.Budget{UserID: ownerID, Category: "Makan", Amount: 1000000, Period: models.BudgetPeriodMonthly,
+		StartDate: time.Date(2025, 3, 25, 0, 0, 0, 0, wib), EndDate: time.Date(2025, 4, 24, 23, 59, 59, 0, wib)})
+	snapshot := append([]models.Budget(nil), budgetRepo.budgets...)
+
+	payday := time.Date(2025, 4, 25, 0, 0, 5, 0, wib)
+	if renewed, err := newTestBudgetService(t, budgetRepo, nil, user).RenewBudgets(ctx, payday); err != nil || renewed != 1 {
+		t.Fatalf("expected the first run to renew 1 budget, got %d, %v", renewed, err)
+	}
+
+	// A second replica read the budgets before the first one renewed them
+	stale := &staleBudgetRepo{fakeBudgetRepo: budgetRepo, snapshot: snapshot}
+	if renewed, err := newTestBudgetService(t, stale, nil, user).RenewBudgets(ctx, payday); err != nil || renewed != 0 {
+		t.Errorf("expected the second replica to renew nothing, got %d, %v", renewed, err)
+	}
+	if len(budgetRepo.budgets) != 2 {
+		t.Errorf("expected 2 budgets, got %d", len(budgetRepo.budgets))
+	}
+}
+
+func TestRenewBudgetsAfterPayCycleChange(t *testing.T) {
+	ctx := context.Background()
+	budgetRepo := &fakeBudgetRepo{}
+
+	// The budget ran on the old cycle, paid on the 1st
+	previous := createBudget(t, budgetRepo, models.Budget{UserID: ownerID, Category: "Makan", Amount: 1000000, Period: models.BudgetPeriodMonthly,
+		StartDate: time.Date(2025, 3, 1, 0, 0, 0, 0, wib), EndDate: time.Date(2025, 3, 31, 23, 59, 59, 0, wib)})
+	user := &models.User{ID: ownerID, PayDay: 25, PayDayAdjust: models.PayDayAdjustNone}
+
+	service := newTestBudgetService(t, budgetRepo, nil, user)
+	if renewed, err := service.RenewBudgets(ctx, time.Date(2025, 4, 1, 0, 0, 5, 0, wib)); err != nil || renewed != 1 {
+		t.Fatalf("expected 1 renewal, got %d, %v", renewed, err)
+	}
+
+	// The new period starts right after the old budget and ends before the
+	// next payday of the new cycle
+	next := renewalOf(budgetRepo, previous)
+	wantStart := time.Date(2025, 4, 1, 0, 0, 0, 0, wib)
+	wantEnd := time.Date(2025, 4, 24, 23, 59, 59, 0, wib)
+	if next == nil || !next.StartDate.Equal(wantStart) || !next.EndDate.Equal(wantEnd) {
+		t.Fatalf("expected a renewal for %s - %s, got %+v", wantStart, wantEnd, next)
+	}
+
+	// From the next payday on the budgets follow the new cycle
+	if renewed, err := service.RenewBudgets(ctx, time.Date(2025, 4, 25, 0, 0, 5, 0, wib)); err != nil || renewed != 1 {
+		t.Fatalf("expected 1 renewal, got %d, %v", renewed, err)
+	}
+	following := renewalOf(budgetRepo, *next)
+	wantStart = time.Date(2025, 4, 25, 0, 0, 0, 0, wib)
+	wantEnd = time.Date(2025, 5, 24, 23, 59, 59, 0, wib)
+	if following == nil || !following.StartDate.Equal(wantStart) || !following.EndDate.Equal(wantEnd) {
+		t.Errorf("expected a renewal for %s - %s, got %+v", wantStart, wantEnd, following)
+	}
+}
+
+// recordingBudgetService reports every RenewBudgets call, and blocks each
+// one until its context ends when block is set
+type recordingBudgetService struct {
+	BudgetService
+	calls chan time.Time
+	block bool
+}
+
+func (s *recordingBudgetService) RenewBudgets(ctx context.Context, now time.Time) (int, error) {
+	s.calls <- now
+	if s.block {
+		<-ctx.Done()
+		return 0, ctx.Err()
+	}
+	return 0, nil
+}
+
+func newTestScheduler(service BudgetService, now time.Time) *BudgetRenewalScheduler {
+	scheduler := NewBudgetRenewalScheduler(service, wib)
+	scheduler.now = func() time.Time { return now }
+	return scheduler
+}
+
+// stopWithin fails the test when Stop does not return in time
+func stopWithin(t *testing.T, scheduler *BudgetRenewalScheduler, timeout time.Duration) {
+	t.Helper()
+
+	stopped := make(chan struct{})
+	go func() {
+		scheduler.Stop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(timeout):
+		t.Fatal("Stop did not end the scheduler loop")
+	}
+}
+
+func TestBudgetRenewalSchedulerStopEndsTheLoop(t *testing.T) {
+	service := &recordingBudgetService{calls: make(chan time.Time, 1)}
+	// An hour before midnight, so the loop is waiting when Stop is called
+	now := time.Date(2025, 4, 24, 23, 0, 0, 0, wib)
+	scheduler := newTestScheduler(service, now)
+
+	scheduler.Start()
+	select {
+	case got := <-service.calls:
+		if !got.Equal(now) {
+			t.Errorf("expected the renewal to run at %s, got %s", now, got)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the scheduler did not catch up on Start")
+	}
+
+	stopWithin(t, scheduler, 5*time.Second)
+	select {
+	case <-service.calls:
+		t.Error("the scheduler ran again after Stop")
+	default:
+	}
+}
+
+func TestBudgetRenewalSchedulerStopCancelsARunningRenewal(t *testing.T) {
+	service := &recordingBudgetService{calls: make(chan time.Time, 1), block: true}
+	scheduler := newTestScheduler(service, time.Date(2025, 4, 25, 0, 0, 5, 0, wib))
+
+	scheduler.Start()
+	<-service.calls
+
+	stopWithin(t, scheduler, 5*time.Second)
+}
@@ -0,0 +1,149 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/stewicca/angagrar-backend/internal/models"
+)
+
+// ContextWindow limits how much conversation history goes into one LLM
+// request. History over the limit is folded into a rolling summary stored on
+// the conversation, and the oldest messages that still do not fit are left out.
+type ContextWindow struct {
+	counter        *TokenCounter
+	maxTokens      int // prompt budget per request, 0 for no limit
+	recentMessages int // latest messages always sent verbatim instead of summarized
+}
+
+func NewContextWindow(counter *TokenCounter, maxTokens, recentMessages int) *ContextWindow {
+	if recentMessages < 1 {
+		recentMessages = 1
+	}
+	return &ContextWindow{
+		counter:        counter,
+		maxTokens:      maxTokens,
+		recentMessages: recentMessages,
+	}
+}
+
+func (w *ContextWindow) fits(systemPrompt string, messages []models.Message) bool {
+	return w.maxTokens <= 0 || w.counter.CountPrompt(systemPrompt, messages) <= w.maxTokens
+}
+
+// conversationContext returns the conversation summary and the latest
+// messages that fit the token budget next to prompt. When the unsummarized
+// history is too long, all but the recent messages are folded into the
+// summary first; the longer summary is set on conversation and saved with the
+// turn.
+func (s *conversationService) conversationContext(ctx context.Context, conversation *models.Conversation, prompt string, messages []models.Message) (string, []models.Message) {
+	// Messages up to SummarizedMessageID are in the summary already. The
+	// user's new message is not saved yet, so it has no ID.
+	start := len(messages)
+	for i, msg := range messages {
+		if msg.ID == 0 || msg.ID > conversation.SummarizedMessageID {
+			start = i
+			break
+		}
+	}
+	recent := messages[start:]
+
+	summary := conversation.Summary
+	if s.window.fits(withSummary(prompt, summary), recent) {
+		return summary, recent
+	}
+
+	if keep := s.window.recentMessages; len(recent) > keep {
+		older := recent[:len(recent)-keep]
+		folded, err := s.summarize(ctx, conversation, summary, older)
+		if err != nil {
+			log.Printf("Conversation summary failed, dropping old messages instead: %v", err)
+		} else {
+			summary = folded
+			recent = recent[len(recent)-keep:]
+
+			conversation.Summary = summary
+			conversation.SummarizedMessageID = older[len(older)-1].ID
+		}
+	}
+
+	// Sliding window over what still does not fit
+	for len(recent) > 1 && !s.window.fits(withSummary(prompt, summary), recent) {
+		recent = recent[1:]
+	}
+
+	return summary, recent
+}
+
+// summarize folds messages into the previous summary, in chunks that fit the
+// token budget
+func (s *conversationService) summarize(ctx context.Context, conversation *models.Conversation, summary string, messages []models.Message) (string, error) {
+	for len(messages) > 0 {
+		prompt := getSummaryPrompt(summary)
+
+		n := 1
+		for n < len(messages) && s.window.fits(prompt, []models.Message{transcriptMessage(messages[:n+1])}) {
+			n++
+		}
+
+		folded, err := s.llm(conversation, models.LLMPurposeSummary).GenerateResponse(ctx, prompt, []models.Message{transcriptMessage(messages[:n])})
+		if err != nil {
+			return "", err
+		}
+		folded = strings.TrimSpace(folded)
+		if folded == "" {
+			return "", fmt.Errorf("empty summary")
+		}
+
+		summary = folded
+		messages = messages[n:]
+	}
+
+	return summary, nil
+}
+
+// withSummary adds the summary of earlier messages to a system prompt
+func withSummary(systemPrompt, summary string) string {
+	if summary == "" {
+		return systemPrompt
+	}
+	return systemPrompt + "\n\nRINGKASAN PERCAKAPAN SEBELUMNYA:\n" + summary
+}
+
+// transcriptMessage renders messages as one user message for the summarizer
+func transcriptMessage(messages []models.Message) models.Message {
+	return models.Message{Role: models.RoleUser, Content: formatTranscript(messages)}
+}
+
+func formatTranscript(messages []models.Message) string {
+	transcript := ""
+	for _, msg := range messages {
+		role := "User"
+		if msg.Role == models.RoleAssistant {
+			role = "Aira"
+		}
+		transcript += fmt.Sprintf("%s: %s\n", role, msg.Content)
+	}
+	return transcript
+}
+
+func getSummaryPrompt(summary string) string {
+	if summary == "" {
+		summary = "(belum ada)"
+	}
+
+	return fmt.Sprintf(`Kamu adalah conversation summarizer untuk Aira, asisten budget. Gabungkan ringkasan lama dengan lanjutan percakapan yang dikirim user jadi satu ringkasan baru.
+
+RINGKASAN LAMA:
+%s
+
+ATURAN:
+- Simpan semua fakta keuangan user: gaji, kota, lifestyle, pengeluaran rutin, utang, goals, kebiasaan spending
+- Simpan keputusan dan angka budget yang sudah disepakati
+- Info baru yang meralat info lama menggantikan info lama
+- Max 10 poin singkat, bahasa Indonesia, tanpa basa-basi
+
+Return ONLY ringkasannya.`, summary)
+}
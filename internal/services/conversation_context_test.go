@@ -0,0 +1,66 @@
+package services
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stewicca/angagrar-backend/internal/models"
+)
+
+func TestTokenCounterDependsOnModel(t *testing.T) {
+	text := strings.Repeat("gaji gue delapan juta ", 20)
+
+	gpt := NewTokenCounter("gpt-4o-mini").Count(text)
+	claude := NewTokenCounter("claude-3-5-haiku-latest").Count(text)
+	local := NewTokenCounter("llama3.1:8b").Count(text)
+	if !(gpt < claude && claude < local) {
+		t.Errorf("expected gpt-4o < claude < unknown model, got %d, %d, %d", gpt, claude, local)
+	}
+
+	if emoji := NewTokenCounter("gpt-4o").Count("✨💰"); emoji != 2 {
+		t.Errorf("expected one token per emoji, got %d", emoji)
+	}
+}
+
+func TestConversationContextSummarizesOldMessages(t *testing.T) {
+	llm := NewScriptedLLMService([]ScriptRule{
+		{Match: "conversation summarizer", Reply: "- gaji 8 juta, tinggal di bandung"},
+		{Reply: "oke!"},
+	})
+	service, conversationRepo, _, _, sessionID := newTestConversationService(t, llm)
+	conversation, _ := conversationRepo.FindByUserAndSessionID(context.Background(), ownerID, sessionID)
+
+	s := service.(*conversationService)
+	s.window = NewContextWindow(NewTokenCounter("gpt-4o"), 300, 2)
+
+	var messages []models.Message
+	for i := 1; i <= 12; i++ {
+		role := models.RoleUser
+		if i%2 == 0 {
+			role = models.RoleAssistant
+		}
+		messages = append(messages, models.Message{ID: uint(i), Role: role, Content: strings.Repeat("cerita soal duit ", 10)})
+	}
+
+	summary, history := s.conversationContext(context.Background(), conversation, "system", messages)
+	if summary == "" || conversation.Summary != summary {
+		t.Fatalf("expected a saved summary, got %q", conversation.Summary)
+	}
+	if conversation.SummarizedMessageID != 10 {
+		t.Errorf("expected messages up to 10 to be summarized, got %d", conversation.SummarizedMessageID)
+	}
+	if len(history) != 2 || history[0].ID != 11 {
+		t.Errorf("expected the 2 latest messages, got %d starting at %d", len(history), history[0].ID)
+	}
+	if !s.window.fits(withSummary("system", summary), history) {
+		t.Errorf("context does not fit the token budget")
+	}
+
+	// The next turn reuses the summary and only sends newer messages
+	messages = append(messages, models.Message{ID: 13, Role: models.RoleUser, Content: "lanjut"})
+	_, history = s.conversationContext(context.Background(), conversation, "system", messages)
+	if len(history) != 3 || history[0].ID != 11 {
+		t.Errorf("expected messages 11-13, got %d starting at %d", len(history), history[0].ID)
+	}
+}
@@ -1,72 +1,202 @@
 package services
 
 import (
+	"context"
+	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"log"
 	"strings"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/stewicca/angagrar-backend/internal/models"
 	"github.com/stewicca/angagrar-backend/internal/repositories"
+	"github.com/stewicca/angagrar-backend/pkg/utils"
+	"gorm.io/gorm"
 )
 
+// ErrConversationNotFound is returned for unknown sessions and for sessions
+// owned by another user, so callers cannot probe for foreign session IDs
+var ErrConversationNotFound = errors.New("conversation not found")
+
+var (
+	ErrBudgetInterviewActive = errors.New("user already has an active budget interview, continue or archive it first")
+	ErrConversationArchived  = errors.New("conversation is archived, unarchive it first")
+	ErrInvalidTopic          = errors.New("topic must be 'budget' or 'general'")
+	ErrInvalidStatus         = errors.New("status must be 'active', 'completed' or 'archived'")
+	ErrBudgetAlreadyCreated  = errors.New("the budget of this conversation was already generated")
+)
+
+const (
+	DefaultConversationPageSize = 20
+	MaxConversationPageSize     = 100
+)
+
+const (
+	conversationCompletedMessage = "Conversation sudah selesai. Silakan start conversation baru."
+	budgetErrorMessage           = "maaf, ada error saat generate budget 😅 coba lagi ya!"
+	assistantErrorMessage        = "hmm gue lagi error nih 😅 bisa coba lagi?"
+
+	adjustmentHelpMessage      = "budget kamu udah jadi ✨ kalau ada yang mau diubah bilang aja, misal \"naikin makan jadi 2 juta, kurangin healing\""
+	adjustmentErrorMessage     = "maaf, ada error saat ubah budget 😅 coba lagi ya!"
+	adjustmentNoBudgetMessage  = "hmm budget kamu buat periode ini nggak ketemu 🤔 start conversation baru aja buat bikin budget lagi ya"
+	adjustmentUnchangedMessage = "budget kamu udah segitu kok, nggak ada yang perlu diubah 👌"
+	adjustmentTooLargeMessage  = "hmm kalau segitu totalnya jadi lebih dari gaji kamu 😅 coba kurangin kategori lain juga ya"
+	adjustmentCancelledMessage = "oke, budget kamu nggak gue ubah 👌"
+	adjustmentStaleMessage     = "budget kamu udah berubah sejak usulan tadi, jadi nggak gue apply. bilang lagi aja mau diubah gimana ya"
+
+	dailyQuotaMessage   = "waduh, jatah ngobrol kamu sama gue hari ini udah habis 😅 lanjut besok ya! budget sama transaksi kamu tetap bisa dipakai kok"
+	monthlyQuotaMessage = "waduh, jatah ngobrol kamu sama gue bulan ini udah habis 😅 lanjut bulan depan ya! budget sama transaksi kamu tetap bisa dipakai kok"
+)
+
+// budgetAnalysisAttempts is how often the LLM gets to produce a valid budget
+// before it is rebalanced
+const budgetAnalysisAttempts = 3
+
+// ConversationQuery is a listing request. Cursor is the opaque NextCursor of
+// the previous page.
+type ConversationQuery struct {
+	Filter repositories.ConversationFilter
+	Cursor string
+}
+
+// ConversationSummary is a conversation without its messages
+type ConversationSummary struct {
+	SessionID       string     `json:"session_id"`
+	Topic           string     `json:"topic"`
+	Status          string     `json:"status"`
+	BudgetGenerated bool       `json:"budget_generated"`
+	CreatedAt       time.Time  `json:"created_at"`
+	CompletedAt     *time.Time `json:"completed_at,omitempty"`
+	ArchivedAt      *time.Time `json:"archived_at,omitempty"`
+}
+
+// ConversationPage is one page of a listing
+type ConversationPage struct {
+	Conversations []ConversationSummary `json:"conversations"`
+	NextCursor    string                `json:"next_cursor,omitempty"`
+	HasMore       bool                  `json:"has_more"`
+}
+
 type ConversationService interface {
-	StartConversation(userID uint) (*models.Conversation, string, error)
-	ProcessMessage(sessionID string, userMessage string) (string, bool, []models.Budget, error)
-	GetConversationHistory(sessionID string) ([]models.Message, error)
-	ResetConversation(sessionID string) (*models.Conversation, string, error)
+	StartConversation(ctx context.Context, userID uint, topic string) (*models.Conversation, string, error)
+	ListConversations(ctx context.Context, userID uint, query ConversationQuery) (*ConversationPage, error)
+	ProcessMessage(ctx context.Context, userID uint, sessionID string, userMessage string) (string, bool, []models.Budget, error)
+	StreamMessage(ctx context.Context, userID uint, sessionID string, userMessage string, onDelta func(delta string) error) (string, bool, []models.Budget, error)
+	GetConversationHistory(ctx context.Context, userID uint, sessionID string) ([]models.Message, error)
+	ResetConversation(ctx context.Context, userID uint, sessionID string) (*models.Conversation, string, error)
+	ArchiveConversation(ctx context.Context, userID uint, sessionID string) (*ConversationSummary, error)
+	UnarchiveConversation(ctx context.Context, userID uint, sessionID string) (*ConversationSummary, error)
 }
 
 type conversationService struct {
 	conversationRepo repositories.ConversationRepository
 	messageRepo      repositories.MessageRepository
 	budgetRepo       repositories.BudgetRepository
-	openAIService    OpenAIService
+	userRepo         repositories.UserRepository
+	profileRepo      repositories.FinancialProfileRepository
+	uow              repositories.UnitOfWork
+	calendar         *BudgetCalendar
+	costOfLiving     CostOfLivingService
+	window           *ContextWindow
+	usage            UsageService
+	llmService       LLMService
 }
 
 func NewConversationService(
 	conversationRepo repositories.ConversationRepository,
 	messageRepo repositories.MessageRepository,
 	budgetRepo repositories.BudgetRepository,
-	openAIService OpenAIService,
+	userRepo repositories.UserRepository,
+	profileRepo repositories.FinancialProfileRepository,
+	uow repositories.UnitOfWork,
+	calendar *BudgetCalendar,
+	costOfLiving CostOfLivingService,
+	window *ContextWindow,
+	usage UsageService,
+	llmService LLMService,
 ) ConversationService {
 	return &conversationService{
 		conversationRepo: conversationRepo,
 		messageRepo:      messageRepo,
 		budgetRepo:       budgetRepo,
-		openAIService:    openAIService,
+		userRepo:         userRepo,
+		profileRepo:      profileRepo,
+		uow:              uow,
+		calendar:         calendar,
+		costOfLiving:     costOfLiving,
+		window:           window,
+		usage:            usage,
+		llmService:       llmService,
 	}
 }
 
-// StartConversation creates a new conversation and returns greeting message
-func (s *conversationService) StartConversation(userID uint) (*models.Conversation, string, error) {
-	// Check if user already has an active conversation (for MVP: 1 conversation only)
-	existingConv, err := s.conversationRepo.FindActiveByUserID(userID)
-	if err == nil && existingConv != nil {
-		return nil, "", fmt.Errorf("user already has an active conversation, complete or reset it first")
+// StartConversation creates a new conversation about topic and returns the
+// greeting message. Users can have any number of open conversations, but only
+// one active budget interview since it generates the period's budgets.
+func (s *conversationService) StartConversation(ctx context.Context, userID uint, topic string) (*models.Conversation, string, error) {
+	conversation, quotaReply, err := s.newConversation(ctx, userID, topic, 0)
+	if err != nil {
+		return nil, "", err
 	}
 
-	// Create new conversation
-	sessionID := uuid.New().String()
-	conversation := &models.Conversation{
-		UserID:          userID,
-		SessionID:       sessionID,
-		BudgetGenerated: false,
+	if err := s.conversationRepo.Create(ctx, conversation); err != nil {
+		return nil, "", createConversationError(err)
 	}
 
-	if err := s.conversationRepo.Create(conversation); err != nil {
-		return nil, "", fmt.Errorf("failed to create conversation: %w", err)
+	return s.greet(ctx, conversation, quotaReply)
+}
+
+// newConversation checks that userID may start a conversation about topic,
+// ignoring the conversation with ID replacing, and returns it unsaved with
+// the reply to greet over quota users with
+func (s *conversationService) newConversation(ctx context.Context, userID uint, topic string, replacing uint) (*models.Conversation, string, error) {
+	if topic == "" {
+		topic = models.ConversationTopicBudget
+	}
+	if topic != models.ConversationTopicBudget && topic != models.ConversationTopicGeneral {
+		return nil, "", ErrInvalidTopic
 	}
 
+	if topic == models.ConversationTopicBudget {
+		if err := s.checkNoActiveInterview(ctx, userID, replacing); err != nil {
+			return nil, "", err
+		}
+	}
+
+	quotaReply, err := s.quotaReply(ctx, userID)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return &models.Conversation{
+		UserID:          userID,
+		SessionID:       uuid.New().String(),
+		Topic:           topic,
+		BudgetGenerated: false,
+	}, quotaReply, nil
+}
+
+// greet saves and returns the greeting of a new conversation
+func (s *conversationService) greet(ctx context.Context, conversation *models.Conversation, quotaReply string) (*models.Conversation, string, error) {
 	// Generate personalized greeting using LLM
 	systemPrompt := getAiraSystemPrompt()
+	fallbackGreeting := "hai! 👋 gue aira, siap bantu kamu atur budget yang pas buat lifestyle kamu. cerita aja dulu tentang keuangan kamu, gaji berapa, tinggal dimana, lifestyle gimana?"
+	if conversation.Topic == models.ConversationTopicGeneral {
+		systemPrompt = getAiraGeneralPrompt()
+		fallbackGreeting = "hai! 👋 gue aira. mau nanya apa soal duit? nabung, investasi, utang, atau cara ngatur pengeluaran, tanya aja!"
+	}
 	initialMessages := []models.Message{}
 
-	greetingMsg, err := s.openAIService.GenerateResponseWithRetry(systemPrompt, initialMessages, 3)
-	if err != nil {
-		// Fallback greeting
-		greetingMsg = "hai! 👋 gue aira, siap bantu kamu atur budget yang pas buat lifestyle kamu. cerita aja dulu tentang keuangan kamu, gaji berapa, tinggal dimana, lifestyle gimana?"
+	// Over quota users still get a conversation, greeted without the LLM
+	greetingMsg := fallbackGreeting
+	if quotaReply == "" {
+		generated, err := s.llm(conversation, models.LLMPurposeGreeting).GenerateResponseWithRetry(ctx, systemPrompt, initialMessages, 3)
+		if err == nil {
+			greetingMsg = generated
+		}
 	}
 
 	// Save assistant message
@@ -75,154 +205,709 @@ func (s *conversationService) StartConversation(userID uint) (*models.Conversati
 		Role:           models.RoleAssistant,
 		Content:        greetingMsg,
 	}
-	if err := s.messageRepo.Create(assistantMsg); err != nil {
+	if err := s.messageRepo.Create(ctx, assistantMsg); err != nil {
 		return nil, "", fmt.Errorf("failed to save message: %w", err)
 	}
 
 	return conversation, greetingMsg, nil
 }
 
-// ProcessMessage handles user input and generates AI response
-func (s *conversationService) ProcessMessage(sessionID string, userMessage string) (string, bool, []models.Budget, error) {
+// createConversationError maps the unique index on active budget interviews
+// to ErrBudgetInterviewActive. checkNoActiveInterview catches the usual case;
+// the index catches requests that passed the check at the same time.
+func createConversationError(err error) error {
+	if errors.Is(err, gorm.ErrDuplicatedKey) {
+		return ErrBudgetInterviewActive
+	}
+	return fmt.Errorf("failed to create conversation: %w", err)
+}
+
+// checkNoActiveInterview returns ErrBudgetInterviewActive when the user is
+// in the middle of a budget interview other than the one with ID except
+func (s *conversationService) checkNoActiveInterview(ctx context.Context, userID uint, except uint) error {
+	active, err := s.conversationRepo.FindActiveByUserID(ctx, userID, models.ConversationTopicBudget)
+	if err == nil {
+		if active.ID == except {
+			return nil
+		}
+		return ErrBudgetInterviewActive
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return fmt.Errorf("failed to find active conversation: %w", err)
+	}
+	return nil
+}
+
+// ListConversations returns one page of the user's conversations, newest
+// first. One extra row is fetched to know whether another page follows.
+func (s *conversationService) ListConversations(ctx context.Context, userID uint, query ConversationQuery) (*ConversationPage, error) {
+	filter := query.Filter
+
+	switch filter.Status {
+	case "", models.ConversationStatusActive, models.ConversationStatusCompleted, models.ConversationStatusArchived:
+	default:
+		return nil, ErrInvalidStatus
+	}
+	switch filter.Topic {
+	case "", models.ConversationTopicBudget, models.ConversationTopicGeneral:
+	default:
+		return nil, ErrInvalidTopic
+	}
+
+	if filter.Limit <= 0 {
+		filter.Limit = DefaultConversationPageSize
+	}
+	if filter.Limit > MaxConversationPageSize {
+		filter.Limit = MaxConversationPageSize
+	}
+	pageSize := filter.Limit
+	filter.Limit++
+
+	if query.Cursor != "" {
+		cursor, err := decodeConversationCursor(query.Cursor, filter)
+		if err != nil {
+			return nil, err
+		}
+		filter.Cursor = cursor
+	}
+
+	conversations, err := s.conversationRepo.List(ctx, userID, filter)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list conversations: %w", err)
+	}
+
+	page := &ConversationPage{Conversations: make([]ConversationSummary, 0, len(conversations))}
+	if len(conversations) > pageSize {
+		conversations = conversations[:pageSize]
+		page.HasMore = true
+		page.NextCursor = encodeConversationCursor(conversations[pageSize-1], filter)
+	}
+	for i := range conversations {
+		page.Conversations = append(page.Conversations, summarizeConversation(&conversations[i]))
+	}
+
+	return page, nil
+}
+
+// ArchiveConversation hides a conversation and closes it for new messages.
+// Archiving an archived conversation is a no-op.
+func (s *conversationService) ArchiveConversation(ctx context.Context, userID uint, sessionID string) (*ConversationSummary, error) {
+	conversation, err := s.findConversation(ctx, userID, sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	if conversation.ArchivedAt == nil {
+		now := time.Now()
+		if err := s.conversationRepo.SetArchivedAt(ctx, conversation.ID, &now); err != nil {
+			return nil, fmt.Errorf("failed to archive conversation: %w", err)
+		}
+		conversation.ArchivedAt = &now
+	}
+
+	summary := summarizeConversation(conversation)
+	return &summary, nil
+}
+
+// UnarchiveConversation reopens an archived conversation so it can be resumed
+func (s *conversationService) UnarchiveConversation(ctx context.Context, userID uint, sessionID string) (*ConversationSummary, error) {
+	conversation, err := s.findConversation(ctx, userID, sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	if conversation.ArchivedAt != nil {
+		if conversation.Topic == models.ConversationTopicBudget && conversation.CompletedAt == nil {
+			if err := s.checkNoActiveInterview(ctx, userID, conversation.ID); err != nil {
+				return nil, err
+			}
+		}
+
+		if err := s.conversationRepo.SetArchivedAt(ctx, conversation.ID, nil); err != nil {
+			if errors.Is(err, gorm.ErrDuplicatedKey) {
+				return nil, ErrBudgetInterviewActive
+			}
+			return nil, fmt.Errorf("failed to unarchive conversation: %w", err)
+		}
+		conversation.ArchivedAt = nil
+	}
+
+	summary := summarizeConversation(conversation)
+	return &summary, nil
+}
+
+// ProcessMessage handles user input and generates AI response. Once ctx is
+// done, e.g. when the client disconnected, pending LLM calls and retries stop
+// and the turn is not saved.
+func (s *conversationService) ProcessMessage(ctx context.Context, userID uint, sessionID string, userMessage string) (string, bool, []models.Budget, error) {
 	// Find conversation
-	conversation, err := s.conversationRepo.FindBySessionID(sessionID)
+	conversation, err := s.findConversation(ctx, userID, sessionID)
+	if err != nil {
+		return "", false, nil, err
+	}
+	if conversation.ArchivedAt != nil {
+		return "", false, nil, ErrConversationArchived
+	}
+
+	// Over quota, Aira answers without calling the LLM or saving the message
+	quotaReply, err := s.quotaReply(ctx, userID)
 	if err != nil {
-		return "", false, nil, fmt.Errorf("conversation not found: %w", err)
+		return "", false, nil, err
+	}
+	if quotaReply != "" {
+		return quotaReply, conversation.CompletedAt != nil, nil, nil
 	}
 
-	// Check if conversation is already completed
+	// Once the budget is generated the user can only adjust it
 	if conversation.CompletedAt != nil {
-		return "Conversation sudah selesai. Silakan start conversation baru.", true, nil, nil
+		if !conversation.BudgetGenerated {
+			return conversationCompletedMessage, true, nil, nil
+		}
+		aiResponse, budgets, err := s.adjustBudget(ctx, conversation, userMessage)
+		return aiResponse, true, budgets, err
 	}
 
-	// Save user message
-	userMsg := &models.Message{
-		ConversationID: conversation.ID,
-		Role:           models.RoleUser,
-		Content:        userMessage,
+	t, err := s.startTurn(ctx, conversation, userMessage)
+	if err != nil {
+		return "", false, nil, err
 	}
-	if err := s.messageRepo.Create(userMsg); err != nil {
-		return "", false, nil, fmt.Errorf("failed to save user message: %w", err)
+
+	// Check if user asks to generate budget and we know enough to do it
+	shouldGenerateBudget, systemPrompt, err := s.planTurn(ctx, t)
+	if err != nil {
+		return "", false, nil, err
 	}
 
-	// Get conversation history for context
-	messages, err := s.messageRepo.FindByConversationID(conversation.ID)
+	if shouldGenerateBudget {
+		budgets, aiResponse, err := s.completeWithBudget(ctx, t)
+		if err != nil {
+			return budgetErrorMessage, false, nil, err
+		}
+		return aiResponse, true, budgets, nil
+	}
+
+	// Continue conversation normally, with the history that fits
+	summary, history := s.conversationContext(ctx, conversation, systemPrompt, t.messages)
+	aiResponse, err := s.llm(conversation, models.LLMPurposeChat).GenerateResponseWithRetry(ctx, withSummary(systemPrompt, summary), history, 3)
+	if err != nil && ctx.Err() != nil {
+		return "", false, nil, ctx.Err()
+	}
 	if err != nil {
-		return "", false, nil, fmt.Errorf("failed to get conversation history: %w", err)
+		aiResponse = assistantErrorMessage
 	}
 
-	// Check if user asks to generate budget
-	shouldGenerateBudget := s.detectBudgetGenerationIntent(userMessage, messages)
+	if err := s.saveTurn(ctx, t, aiResponse); err != nil {
+		return "", false, nil, err
+	}
 
-	var budgets []models.Budget
-	var aiResponse string
+	return aiResponse, false, nil, nil
+}
 
-	if shouldGenerateBudget && !conversation.BudgetGenerated {
-		// Ask LLM to analyze conversation and generate budget
-		budgets, aiResponse, err = s.generateBudgetFromConversation(conversation, messages)
+// StreamMessage works like ProcessMessage but hands the reply to onDelta
+// piece by piece as the LLM produces it. Whatever was generated is saved with
+// the user's message once the stream ends, also when ctx is cancelled midway;
+// a turn cancelled before any reply saves nothing.
+func (s *conversationService) StreamMessage(ctx context.Context, userID uint, sessionID string, userMessage string, onDelta func(delta string) error) (string, bool, []models.Budget, error) {
+	conversation, err := s.findConversation(ctx, userID, sessionID)
+	if err != nil {
+		return "", false, nil, err
+	}
+	if conversation.ArchivedAt != nil {
+		return "", false, nil, ErrConversationArchived
+	}
+
+	quotaReply, err := s.quotaReply(ctx, userID)
+	if err != nil {
+		return "", false, nil, err
+	}
+	if quotaReply != "" {
+		return quotaReply, conversation.CompletedAt != nil, nil, onDelta(quotaReply)
+	}
+
+	if conversation.CompletedAt != nil {
+		if !conversation.BudgetGenerated {
+			return conversationCompletedMessage, true, nil, onDelta(conversationCompletedMessage)
+		}
+		aiResponse, budgets, err := s.adjustBudget(ctx, conversation, userMessage)
 		if err != nil {
-			return "maaf, ada error saat generate budget 😅 coba lagi ya!", false, nil, err
+			return aiResponse, true, nil, err
 		}
+		return aiResponse, true, budgets, onDelta(aiResponse)
+	}
 
-		// Mark budget as generated
-		conversation.BudgetGenerated = true
-		now := time.Now()
-		conversation.CompletedAt = &now
-		if err := s.conversationRepo.Update(conversation); err != nil {
-			return "", false, nil, fmt.Errorf("failed to update conversation: %w", err)
-		}
-	} else {
-		// Continue conversation normally
-		systemPrompt := getAiraSystemPrompt()
-		aiResponse, err = s.openAIService.GenerateResponseWithRetry(systemPrompt, messages, 3)
+	t, err := s.startTurn(ctx, conversation, userMessage)
+	if err != nil {
+		return "", false, nil, err
+	}
+
+	shouldGenerateBudget, systemPrompt, err := s.planTurn(ctx, t)
+	if err != nil {
+		return "", false, nil, err
+	}
+
+	if shouldGenerateBudget {
+		budgets, aiResponse, err := s.completeWithBudget(ctx, t)
 		if err != nil {
-			aiResponse = "hmm gue lagi error nih 😅 bisa coba lagi?"
+			return budgetErrorMessage, false, nil, err
 		}
+
+		// The budget reply is formatted locally, so it goes out in one piece
+		return aiResponse, true, budgets, onDelta(aiResponse)
 	}
 
-	// Save assistant response
-	assistantMsg := &models.Message{
+	summary, history := s.conversationContext(ctx, conversation, systemPrompt, t.messages)
+	aiResponse, streamErr := s.llm(conversation, models.LLMPurposeChat).StreamResponse(ctx, withSummary(systemPrompt, summary), history, onDelta)
+	if aiResponse == "" {
+		if ctx.Err() != nil {
+			return "", false, nil, ctx.Err()
+		}
+		if streamErr != nil {
+			aiResponse = assistantErrorMessage
+			streamErr = onDelta(aiResponse)
+		}
+	}
+
+	// A broken or cancelled stream keeps the part the user already saw
+	if err := s.saveTurn(context.WithoutCancel(ctx), t, aiResponse); err != nil {
+		return "", false, nil, err
+	}
+
+	return aiResponse, false, nil, streamErr
+}
+
+// quotaReply returns Aira's reply for users who used up their LLM quota, or
+// an empty string while they have quota left
+func (s *conversationService) quotaReply(ctx context.Context, userID uint) (string, error) {
+	err := s.usage.CheckQuota(ctx, userID)
+	switch {
+	case err == nil:
+		return "", nil
+	case errors.Is(err, ErrDailyQuota):
+		return dailyQuotaMessage, nil
+	case errors.Is(err, ErrMonthlyQuota):
+		return monthlyQuotaMessage, nil
+	default:
+		return "", err
+	}
+}
+
+// llm returns the LLM client that records its calls for the conversation
+func (s *conversationService) llm(conversation *models.Conversation, purpose string) LLMService {
+	return s.usage.Meter(s.llmService, conversation.UserID, conversation.ID, purpose)
+}
+
+// turn is one user message and Aira's reply. What the turn learns on the way,
+// profile changes and a longer conversation summary, is only saved with the
+// messages once the turn succeeds, so a failed turn leaves nothing behind.
+type turn struct {
+	conversation        *models.Conversation
+	messages            []models.Message // history followed by the user's new message
+	userMsg             *models.Message
+	profile             *models.FinancialProfile // loaded by planTurn
+	profileChanged      bool
+	summarizedMessageID uint // conversation.SummarizedMessageID when the turn started
+}
+
+// startTurn loads the conversation history and adds the user's new message
+func (s *conversationService) startTurn(ctx context.Context, conversation *models.Conversation, content string) (*turn, error) {
+	messages, err := s.messageRepo.FindByConversationID(ctx, conversation.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get conversation history: %w", err)
+	}
+
+	userMsg := &models.Message{
 		ConversationID: conversation.ID,
+		Role:           models.RoleUser,
+		Content:        content,
+	}
+	return &turn{
+		conversation:        conversation,
+		messages:            append(messages, *userMsg),
+		userMsg:             userMsg,
+		summarizedMessageID: conversation.SummarizedMessageID,
+	}, nil
+}
+
+// saveTurn stores the turn with Aira's reply in one transaction
+func (s *conversationService) saveTurn(ctx context.Context, t *turn, reply string) error {
+	return s.uow.Do(ctx, func(tx repositories.Repositories) error {
+		return t.save(ctx, tx, reply)
+	})
+}
+
+// save writes the turn in tx: the profile and summary changes, the user's
+// message and Aira's reply
+func (t *turn) save(ctx context.Context, tx repositories.Repositories, reply string) error {
+	if t.profileChanged {
+		if err := tx.Profiles.Save(ctx, t.profile); err != nil {
+			return fmt.Errorf("failed to save financial profile: %w", err)
+		}
+	}
+
+	if t.conversation.SummarizedMessageID != t.summarizedMessageID {
+		if err := tx.Conversations.SaveSummary(ctx, t.conversation.ID, t.conversation.Summary, t.conversation.SummarizedMessageID); err != nil {
+			return fmt.Errorf("failed to save conversation summary: %w", err)
+		}
+	}
+
+	if err := tx.Messages.Create(ctx, t.userMsg); err != nil {
+		return fmt.Errorf("failed to save user message: %w", err)
+	}
+
+	assistantMsg := &models.Message{
+		ConversationID: t.conversation.ID,
 		Role:           models.RoleAssistant,
-		Content:        aiResponse,
+		Content:        reply,
+	}
+	if err := tx.Messages.Create(ctx, assistantMsg); err != nil {
+		return fmt.Errorf("failed to save assistant message: %w", err)
 	}
-	if err := s.messageRepo.Create(assistantMsg); err != nil {
-		return "", false, nil, fmt.Errorf("failed to save assistant message: %w", err)
+	return nil
+}
+
+// completeWithBudget generates the budget, then saves it, marks the
+// conversation as done and stores the turn in one transaction. A retry after
+// a failure starts over, and a concurrent request for the same budget gets
+// ErrBudgetAlreadyCreated instead of a second set of budgets.
+func (s *conversationService) completeWithBudget(ctx context.Context, t *turn) ([]models.Budget, string, error) {
+	conversation := t.conversation
+
+	// Ask LLM to analyze conversation and generate budget
+	budgets, aiResponse, err := s.generateBudgetFromConversation(ctx, t)
+	if err != nil {
+		return nil, "", err
 	}
 
-	isCompleted := conversation.CompletedAt != nil
-	return aiResponse, isCompleted, budgets, nil
+	now := time.Now()
+	err = s.uow.Do(ctx, func(tx repositories.Repositories) error {
+		completed, err := tx.Conversations.MarkBudgetGenerated(ctx, conversation.ID, now)
+		if err != nil {
+			return fmt.Errorf("failed to update conversation: %w", err)
+		}
+		if !completed {
+			return ErrBudgetAlreadyCreated
+		}
+
+		if err := tx.Budgets.CreateBatch(ctx, budgets); err != nil {
+			return fmt.Errorf("failed to save budgets: %w", err)
+		}
+
+		return t.save(ctx, tx, aiResponse)
+	})
+	if err != nil {
+		return nil, "", err
+	}
+
+	conversation.BudgetGenerated = true
+	conversation.CompletedAt = &now
+
+	return budgets, aiResponse, nil
 }
 
-// detectBudgetGenerationIntent checks if user wants to generate budget
-func (s *conversationService) detectBudgetGenerationIntent(userMessage string, messages []models.Message) bool {
-	lower := strings.ToLower(userMessage)
+// adjustBudget handles a message sent after the budget was generated. Aira
+// proposes new amounts for what the user asks to change, keeping the total
+// equal to the income, and applies them once the user confirms. It returns
+// the budgets when they were changed.
+//
+// The LLM reads the requested changes first; the proposal or the applied
+// changes are then saved with the turn's messages in one transaction.
+func (s *conversationService) adjustBudget(ctx context.Context, conversation *models.Conversation, userMessage string) (string, []models.Budget, error) {
+	t, err := s.startTurn(ctx, conversation, userMessage)
+	if err != nil {
+		return "", nil, err
+	}
 
-	// Keywords that trigger budget generation
-	keywords := []string{
-		"buatin budget",
-		"bikinin budget",
-		"generate budget",
-		"buat budget",
-		"siap",
-		"oke buatin",
-		"lanjut",
-		"udah cukup",
+	budgets, err := adjustableBudgets(ctx, s.budgetRepo, conversation.UserID)
+	if err != nil {
+		return adjustmentErrorMessage, nil, err
 	}
 
-	for _, keyword := range keywords {
-		if strings.Contains(lower, keyword) {
-			return true
+	profile, err := s.loadProfile(ctx, conversation.UserID)
+	if err != nil {
+		return adjustmentErrorMessage, nil, err
+	}
+
+	var requests []BudgetChangeRequest
+	if len(budgets) > 0 {
+		requests = s.parseBudgetChanges(ctx, conversation, budgets, t.messages)
+	}
+
+	var aiResponse string
+	var adjusted []models.Budget
+	err = s.uow.Do(ctx, func(tx repositories.Repositories) error {
+		aiResponse, adjusted, err = planAdjustment(ctx, tx, conversation, profile, budgets, userMessage, requests)
+		if err != nil {
+			return err
 		}
+		return t.save(ctx, tx, aiResponse)
+	})
+	if err != nil {
+		return adjustmentErrorMessage, nil, err
 	}
 
-	// If conversation is long enough (>= 6 messages), assume ready for budget
-	if len(messages) >= 6 {
-		return true
+	return aiResponse, adjusted, nil
+}
+
+func planAdjustment(ctx context.Context, tx repositories.Repositories, conversation *models.Conversation, profile *models.FinancialProfile, budgets []models.Budget, userMessage string, requests []BudgetChangeRequest) (string, []models.Budget, error) {
+	pending, err := tx.BudgetAdjustments.FindPendingByConversationID(ctx, conversation.ID)
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return "", nil, fmt.Errorf("failed to load budget adjustment: %w", err)
 	}
 
-	return false
+	if len(budgets) == 0 {
+		return adjustmentNoBudgetMessage, nil, nil
+	}
+
+	if len(requests) == 0 {
+		if pending == nil {
+			return adjustmentHelpMessage, nil, nil
+		}
+
+		isConfirmation, isYes := utils.ExtractConfirmation(userMessage)
+		if !isConfirmation {
+			return formatAdjustmentProposal(pending.Changes), nil, nil
+		}
+		if isYes {
+			return applyAdjustment(ctx, tx, conversation.UserID, pending)
+		}
+		return adjustmentCancelledMessage, nil, rejectAdjustment(ctx, tx, pending)
+	}
+
+	// A new request replaces the proposal the user did not answer
+	if pending != nil {
+		if err := rejectAdjustment(ctx, tx, pending); err != nil {
+			return "", nil, err
+		}
+	}
+
+	income := profile.Salary
+	if income <= 0 {
+		for _, budget := range budgets {
+			income += budget.Amount - budget.RolloverAmount
+		}
+	}
+
+	changes, err := planBudgetAdjustment(budgets, income, requests)
+	if errors.Is(err, ErrAdjustmentExceedsIncome) {
+		return adjustmentTooLargeMessage, nil, nil
+	}
+	if err != nil {
+		return "", nil, err
+	}
+	if len(changes) == 0 {
+		return adjustmentUnchangedMessage, nil, nil
+	}
+
+	adjustment := &models.BudgetAdjustment{
+		UserID:         conversation.UserID,
+		ConversationID: conversation.ID,
+		Request:        userMessage,
+		Status:         models.BudgetAdjustmentPending,
+		Changes:        changes,
+	}
+	if err := tx.BudgetAdjustments.Create(ctx, adjustment); err != nil {
+		return "", nil, fmt.Errorf("failed to save budget adjustment: %w", err)
+	}
+
+	return formatAdjustmentProposal(changes), nil, nil
+}
+
+func applyAdjustment(ctx context.Context, tx repositories.Repositories, userID uint, adjustment *models.BudgetAdjustment) (string, []models.Budget, error) {
+	applied, err := tx.BudgetAdjustments.Apply(ctx, adjustment, time.Now())
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to apply budget adjustment: %w", err)
+	}
+	if !applied {
+		return adjustmentStaleMessage, nil, rejectAdjustment(ctx, tx, adjustment)
+	}
+
+	budgets, err := adjustableBudgets(ctx, tx.Budgets, userID)
+	if err != nil {
+		return "", nil, err
+	}
+
+	return formatAdjustedBudgets(budgets), budgets, nil
+}
+
+func rejectAdjustment(ctx context.Context, tx repositories.Repositories, adjustment *models.BudgetAdjustment) error {
+	adjustment.Status = models.BudgetAdjustmentRejected
+	if err := tx.BudgetAdjustments.Update(ctx, adjustment); err != nil {
+		return fmt.Errorf("failed to update budget adjustment: %w", err)
+	}
+	return nil
+}
+
+// adjustableBudgets returns the user's monthly budgets of the current period
+// in the categories Aira allocates
+func adjustableBudgets(ctx context.Context, budgetRepo repositories.BudgetRepository, userID uint) ([]models.Budget, error) {
+	active, err := budgetRepo.FindActiveByUserID(ctx, userID, time.Now())
+	if err != nil {
+		return nil, fmt.Errorf("failed to load budgets: %w", err)
+	}
+
+	var budgets []models.Budget
+	for _, budget := range active {
+		if budget.Period == models.BudgetPeriodMonthly && isBudgetCategory(budget.Category) {
+			budgets = append(budgets, budget)
+		}
+	}
+	return budgets, nil
 }
 
-// generateBudgetFromConversation uses LLM to analyze conversation and generate personalized budget
-func (s *conversationService) generateBudgetFromConversation(conversation *models.Conversation, messages []models.Message) ([]models.Budget, string, error) {
-	// Create prompt for LLM to analyze conversation and generate budget
-	analysisPrompt := getBudgetAnalysisPrompt(messages)
+// planTurn classifies the latest user message and notes what it says in the
+// user's financial profile, which is saved with the turn. It reports whether
+// the budget can be generated now, and otherwise returns the system prompt
+// for Aira's reply.
+func (s *conversationService) planTurn(ctx context.Context, t *turn) (bool, string, error) {
+	conversation := t.conversation
+
+	// General conversations only answer questions
+	if conversation.Topic == models.ConversationTopicGeneral {
+		return false, getAiraGeneralPrompt(), nil
+	}
+
+	profile, err := s.loadProfile(ctx, conversation.UserID)
+	if err != nil {
+		return false, "", err
+	}
+	t.profile = profile
+
+	classification := s.classifyMessage(ctx, conversation, profile, t.messages)
+	t.profileChanged = updateProfile(profile, t.messages[len(t.messages)-1].Content, classification)
+
+	missing := missingSlots(profile)
+	if classification.Intent == IntentRequestBudget && len(missing) == 0 && !conversation.BudgetGenerated {
+		return true, "", nil
+	}
+
+	return false, getAiraSystemPrompt() + getTurnGuidance(classification.Intent, missing), nil
+}
 
-	// Call LLM to get budget recommendation
-	llmResponse, err := s.openAIService.GenerateResponseWithRetry(analysisPrompt, []models.Message{}, 3)
+// loadProfile returns the user's financial profile, or an empty one if the
+// interview has not learned anything yet
+func (s *conversationService) loadProfile(ctx context.Context, userID uint) (*models.FinancialProfile, error) {
+	profile, err := s.profileRepo.FindByUserID(ctx, userID)
 	if err != nil {
-		return nil, "", fmt.Errorf("LLM analysis failed: %w", err)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return &models.FinancialProfile{UserID: userID}, nil
+		}
+		return nil, fmt.Errorf("failed to load financial profile: %w", err)
 	}
+	return profile, nil
+}
 
-	// Parse LLM response to extract budget data
-	budgetData, err := s.parseLLMBudgetResponse(llmResponse)
+// generateBudgetFromConversation uses LLM to analyze conversation and generate
+// personalized budget, from the profile as planTurn updated it
+func (s *conversationService) generateBudgetFromConversation(ctx context.Context, t *turn) ([]models.Budget, string, error) {
+	conversation, messages, profile := t.conversation, t.messages, t.profile
+
+	baseline, err := s.costOfLiving.Baseline(ctx, profile.City, profile.Lifestyle)
 	if err != nil {
-		return nil, "", fmt.Errorf("failed to parse budget response: %w", err)
+		return nil, "", fmt.Errorf("failed to load cost of living: %w", err)
 	}
 
-	// Create budget records
-	budgets := s.createBudgetRecords(conversation.UserID, budgetData)
+	// The transcript goes into the analysis prompt, so it shares its budget
+	summary, history := s.conversationContext(ctx, conversation, getBudgetAnalysisPrompt(profile, "", nil, baseline), messages)
 
-	// Save budgets to database
-	if err := s.budgetRepo.CreateBatch(budgets); err != nil {
-		return nil, "", fmt.Errorf("failed to save budgets: %w", err)
+	budgetData, err := s.requestBudget(ctx, conversation, profile, summary, history, baseline)
+	if err != nil && ctx.Err() != nil {
+		return nil, "", ctx.Err()
+	}
+	if err != nil {
+		// Don't leave the user without a budget when the LLM is down
+		log.Printf("LLM budget failed, using rule-based budget: %v", err)
+		budgetData, err = GenerateRuleBasedBudget(profile.Salary, baseline)
+		if err != nil {
+			return nil, "", fmt.Errorf("rule-based budget failed: %w", err)
+		}
 	}
 
+	// Create budget records for the user's current pay period
+	user, err := s.userRepo.FindByID(ctx, conversation.UserID)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to load user: %w", err)
+	}
+	budgets := monthlyBudgetRecords(s.calendar, user, budgetData, time.Now())
+
 	// Generate user-friendly response
 	response := formatBudgetResponse(budgets, budgetData)
 
 	return budgets, response, nil
 }
 
+// requestBudget asks the LLM for a budget and validates it. Invalid budgets
+// are sent back with the problems found; if the LLM cannot fix them the last
+// budget is rebalanced deterministically. Essentials far below the cost of
+// living are sent back too, but a valid budget is kept if they stay low.
+func (s *conversationService) requestBudget(ctx context.Context, conversation *models.Conversation, profile *models.FinancialProfile, summary string, messages []models.Message, baseline *CostBaseline) (*BudgetData, error) {
+	analysisPrompt := getBudgetAnalysisPrompt(profile, summary, messages, baseline)
+
+	var repair []models.Message
+	var lastData, validData *BudgetData
+	var lastErr error
+
+	for attempt := 0; attempt < budgetAnalysisAttempts; attempt++ {
+		llmResponse, err := s.llm(conversation, models.LLMPurposeBudget).GenerateStructured(ctx, analysisPrompt, repair, budgetSchema)
+		if err != nil {
+			lastErr = fmt.Errorf("LLM analysis failed: %w", err)
+			if attempt < budgetAnalysisAttempts-1 {
+				if err := sleep(ctx, time.Duration(1<<uint(attempt))*time.Second); err != nil {
+					return nil, err
+				}
+			}
+			continue
+		}
+
+		budgetData, err := parseBudgetData(llmResponse)
+		var problems []string
+		if err != nil {
+			problems = []string{err.Error()}
+		} else {
+			lastData = budgetData
+			problems = validateBudgetData(budgetData)
+			if len(problems) == 0 {
+				validData = budgetData
+				problems = checkBudgetAgainstBaseline(budgetData, baseline)
+				if len(problems) == 0 {
+					return budgetData, nil
+				}
+			}
+		}
+
+		lastErr = fmt.Errorf("invalid budget response: %s", strings.Join(problems, "; "))
+
+		// Show the LLM its answer and what is wrong with it
+		repair = append(repair,
+			models.Message{Role: models.RoleAssistant, Content: llmResponse},
+			models.Message{Role: models.RoleUser, Content: getBudgetRepairPrompt(problems)},
+		)
+	}
+
+	if validData != nil {
+		log.Printf("Keeping LLM budget below the cost of living: %v", lastErr)
+		return validData, nil
+	}
+
+	if lastData == nil {
+		return nil, lastErr
+	}
+
+	if err := rebalanceBudget(lastData); err != nil {
+		return nil, fmt.Errorf("%w (rebalance failed: %v)", lastErr, err)
+	}
+	log.Printf("Rebalanced LLM budget after %d attempts: %v", budgetAnalysisAttempts, lastErr)
+
+	return lastData, nil
+}
+
 // GetConversationHistory retrieves all messages in a conversation
-func (s *conversationService) GetConversationHistory(sessionID string) ([]models.Message, error) {
-	conversation, err := s.conversationRepo.FindBySessionID(sessionID)
+func (s *conversationService) GetConversationHistory(ctx context.Context, userID uint, sessionID string) ([]models.Message, error) {
+	conversation, err := s.findConversation(ctx, userID, sessionID)
 	if err != nil {
-		return nil, fmt.Errorf("conversation not found: %w", err)
+		return nil, err
 	}
 
-	messages, err := s.messageRepo.FindByConversationID(conversation.ID)
+	messages, err := s.messageRepo.FindByConversationID(ctx, conversation.ID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to retrieve messages: %w", err)
 	}
@@ -230,20 +915,97 @@ func (s *conversationService) GetConversationHistory(sessionID string) ([]models
 	return messages, nil
 }
 
-// ResetConversation resets an existing conversation
-func (s *conversationService) ResetConversation(sessionID string) (*models.Conversation, string, error) {
-	conversation, err := s.conversationRepo.FindBySessionID(sessionID)
+// ResetConversation replaces an existing conversation with a new one about
+// the same topic. The old one is only deleted once the new one can start, and
+// both happen in one transaction, so a failed reset keeps the old one.
+func (s *conversationService) ResetConversation(ctx context.Context, userID uint, sessionID string) (*models.Conversation, string, error) {
+	old, err := s.findConversation(ctx, userID, sessionID)
+	if err != nil {
+		return nil, "", err
+	}
+
+	conversation, quotaReply, err := s.newConversation(ctx, userID, old.Topic, old.ID)
+	if err != nil {
+		return nil, "", err
+	}
+
+	err = s.uow.Do(ctx, func(tx repositories.Repositories) error {
+		if err := tx.Conversations.Delete(ctx, old.ID); err != nil {
+			return fmt.Errorf("failed to delete conversation: %w", err)
+		}
+		if err := tx.Conversations.Create(ctx, conversation); err != nil {
+			return createConversationError(err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, "", err
+	}
+
+	return s.greet(ctx, conversation, quotaReply)
+}
+
+// findConversation looks up a session scoped to its owner
+func (s *conversationService) findConversation(ctx context.Context, userID uint, sessionID string) (*models.Conversation, error) {
+	conversation, err := s.conversationRepo.FindByUserAndSessionID(ctx, userID, sessionID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrConversationNotFound
+		}
+		return nil, fmt.Errorf("failed to find conversation: %w", err)
+	}
+	return conversation, nil
+}
+
+func summarizeConversation(conversation *models.Conversation) ConversationSummary {
+	return ConversationSummary{
+		SessionID:       conversation.SessionID,
+		Topic:           conversation.Topic,
+		Status:          conversation.Status(),
+		BudgetGenerated: conversation.BudgetGenerated,
+		CreatedAt:       conversation.CreatedAt,
+		CompletedAt:     conversation.CompletedAt,
+		ArchivedAt:      conversation.ArchivedAt,
+	}
+}
+
+// conversationCursor is the position of the last row of a page and the
+// filters it was listed with, so a cursor cannot continue another listing
+type conversationCursor struct {
+	repositories.ConversationCursor
+	Status string `json:"status,omitempty"`
+	Topic  string `json:"topic,omitempty"`
+}
+
+func encodeConversationCursor(conversation models.Conversation, filter repositories.ConversationFilter) string {
+	data, _ := json.Marshal(conversationCursor{
+		ConversationCursor: repositories.ConversationCursor{
+			CreatedAt: conversation.CreatedAt,
+			ID:        conversation.ID,
+		},
+		Status: filter.Status,
+		Topic:  filter.Topic,
+	})
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// decodeConversationCursor returns ErrInvalidCursor for a malformed cursor or
+// one issued for other filters
+func decodeConversationCursor(value string, filter repositories.ConversationFilter) (*repositories.ConversationCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(value)
 	if err != nil {
-		return nil, "", fmt.Errorf("conversation not found: %w", err)
+		return nil, ErrInvalidCursor
 	}
 
-	// Delete old conversation
-	if err := s.conversationRepo.Delete(conversation.ID); err != nil {
-		return nil, "", fmt.Errorf("failed to delete conversation: %w", err)
+	var cursor conversationCursor
+	if err := json.Unmarshal(data, &cursor); err != nil || cursor.ID == 0 {
+		return nil, ErrInvalidCursor
+	}
+	if cursor.Status != filter.Status || cursor.Topic != filter.Topic {
+		return nil, ErrInvalidCursor
 	}
 
-	// Start new conversation
-	return s.StartConversation(conversation.UserID)
+	return &cursor.ConversationCursor, nil
 }
 
 // Helper functions
@@ -279,25 +1041,50 @@ GREETING PERTAMA:
 Sambut user dengan ramah dan ajak mereka cerita tentang keuangan mereka secara casual.`
 }
 
-func getBudgetAnalysisPrompt(messages []models.Message) string {
+func getAiraGeneralPrompt() string {
+	return `Kamu adalah Aira, asisten keuangan virtual yang asik dan helpful banget!
+
+PERSONALITY:
+- Tone: Santai, Gen Z Indonesia, casual tapi tetap sopan
+- Style: Ramah, encouraging, tidak judgemental
+- Language: Bahasa Indonesia casual (gue/kamu, bukan saya/anda)
+- Max 2-3 kalimat per response, jangan bertele-tele
+- Gunakan emoji secukupnya (max 2 per message)
+
+TUGAS KAMU:
+Jawab pertanyaan user seputar keuangan pribadi: nabung, dana darurat, investasi, utang, cicilan, dan cara ngatur pengeluaran.
+
+ATURAN:
+- Kasih jawaban praktis yang bisa langsung dipraktekin
+- Jangan rekomendasiin produk investasi atau saham tertentu
+- Kalau user mau dibikinin budget, suruh mulai conversation budget baru
+- Kalau pertanyaannya di luar topik keuangan, jawab singkat lalu arahkan balik
+
+GREETING PERTAMA:
+Sambut user dengan ramah dan tanya mau ngobrolin soal keuangan apa.`
+}
+
+func getBudgetAnalysisPrompt(profile *models.FinancialProfile, summary string, messages []models.Message, baseline *CostBaseline) string {
 	// Convert messages to conversation transcript
-	transcript := ""
-	for _, msg := range messages {
-		role := "User"
-		if msg.Role == models.RoleAssistant {
-			role = "Aira"
-		}
-		transcript += fmt.Sprintf("%s: %s\n", role, msg.Content)
+	transcript := formatTranscript(messages)
+	if summary != "" {
+		transcript = "(ringkasan bagian awal: " + summary + ")\n" + transcript
 	}
 
 	return fmt.Sprintf(`Kamu adalah AI budget analyst. Analisa percakapan berikut dan generate personalized budget.
 
+PROFIL KEUANGAN USER:
+%s
+
+BIAYA HIDUP REFERENSI:
+%s
+
 PERCAKAPAN:
 %s
 
 TUGAS KAMU:
 1. Extract informasi penting: salary, location, lifestyle, spending habits, goals
-2. Pertimbangkan cost of living di lokasi mereka
+2. Pertimbangkan cost of living di lokasi mereka, pakai biaya hidup referensi sebagai patokan
 3. Pertimbangkan lifestyle dan kebiasaan mereka
 4. Generate budget allocation yang PERSONAL dan REALISTIC
 
@@ -317,63 +1104,52 @@ OUTPUT FORMAT (JSON):
 }
 
 PENTING:
+- salary = gaji bulanan di profil
+- Masukkan pengeluaran rutin dari profil ke kategori yang pas (sewa/cicilan ke Kewajiban, dll)
 - Total semua amount HARUS = salary
 - Round ke nearest 1000
 - Realistic dengan cost of living kota mereka
 - Personal based on habits & goals mereka
 
-Return ONLY valid JSON, no explanation.`, transcript)
-}
-
-type BudgetData struct {
-	Salary     float64 `json:"salary"`
-	Location   string  `json:"location"`
-	Analysis   string  `json:"analysis"`
-	Categories []struct {
-		Name        string  `json:"name"`
-		Amount      float64 `json:"amount"`
-		Description string  `json:"description"`
-	} `json:"categories"`
+Return ONLY valid JSON, no explanation.`, describeProfile(profile), describeBaseline(baseline), transcript)
 }
 
-func (s *conversationService) parseLLMBudgetResponse(llmResponse string) (*BudgetData, error) {
-	// Extract JSON from response (LLM might add extra text)
-	start := strings.Index(llmResponse, "{")
-	end := strings.LastIndex(llmResponse, "}") + 1
-
-	if start == -1 || end == 0 {
-		return nil, fmt.Errorf("no JSON found in response")
+// describeBaseline renders the cost of living for prompts
+func describeBaseline(baseline *CostBaseline) string {
+	if baseline == nil {
+		return "- belum ada data"
 	}
 
-	jsonStr := llmResponse[start:end]
-
-	var budgetData BudgetData
-	if err := json.Unmarshal([]byte(jsonStr), &budgetData); err != nil {
-		return nil, fmt.Errorf("failed to parse JSON: %w", err)
+	place := baseline.Source
+	if baseline.Location != "" && baseline.Location != baseline.Source {
+		place = fmt.Sprintf("%s (angka %s)", baseline.Location, baseline.Source)
 	}
 
-	return &budgetData, nil
+	return fmt.Sprintf(`- Lokasi: %s, lifestyle %s, per bulan untuk 1 orang
+- Sewa & utilities: Rp %.0f
+- Makan: Rp %.0f
+- Transport: Rp %.0f`,
+		place, baseline.Lifestyle, baseline.Rent, baseline.Food, baseline.Transport)
 }
 
-func (s *conversationService) createBudgetRecords(userID uint, data *BudgetData) []models.Budget {
-	now := time.Now()
-	startDate := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
-	endDate := startDate.AddDate(0, 1, 0).Add(-time.Second)
+func getBudgetRepairPrompt(problems []string) string {
+	return fmt.Sprintf(`Budget JSON kamu perlu diperbaiki:
+- %s
 
-	budgets := []models.Budget{}
-	for _, cat := range data.Categories {
-		budgets = append(budgets, models.Budget{
-			UserID:      userID,
-			Category:    cat.Name,
-			Amount:      cat.Amount,
-			Period:      "monthly",
-			StartDate:   startDate,
-			EndDate:     endDate,
-			Description: cat.Description,
-		})
-	}
+Perbaiki dan kirim ulang budget lengkapnya dalam format yang sama.`, strings.Join(problems, "\n- "))
+}
+
+type BudgetData struct {
+	Salary     float64          `json:"salary"`
+	Location   string           `json:"location"`
+	Analysis   string           `json:"analysis"`
+	Categories []BudgetCategory `json:"categories"`
+}
 
-	return budgets
+type BudgetCategory struct {
+	Name        string  `json:"name"`
+	Amount      float64 `json:"amount"`
+	Description string  `json:"description"`
 }
 
 func formatBudgetResponse(budgets []models.Budget, data *BudgetData) string {
@@ -385,7 +1161,7 @@ func formatBudgetResponse(budgets []models.Budget, data *BudgetData) string {
 	}
 
 	response += fmt.Sprintf("\n💡 %s\n\n", data.Analysis)
-	response += "kamu bisa adjust sendiri nanti kalau ada yang kurang pas!"
+	response += "kalau ada yang kurang pas, bilang aja mau diubah gimana!"
 
 	return response
 }
@@ -0,0 +1,911 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stewicca/angagrar-backend/internal/models"
+	"github.com/stewicca/angagrar-backend/internal/repositories"
+	"gorm.io/gorm"
+)
+
+type fakeConversationRepo struct {
+	conversations map[uint]*models.Conversation
+	nextID        uint
+	createError   error
+}
+
+func newFakeConversationRepo() *fakeConversationRepo {
+	return &fakeConversationRepo{conversations: map[uint]*models.Conversation{}}
+}
+
+func (r *fakeConversationRepo) Create(ctx context.Context, conversation *models.Conversation) error {
+	if r.createError != nil {
+		return r.createError
+	}
+	r.nextID++
+	conversation.ID = r.nextID
+	r.conversations[conversation.ID] = conversation
+	return nil
+}
+
+func (r *fakeConversationRepo) FindByID(ctx context.Context, id uint) (*models.Conversation, error) {
+	if conversation, ok := r.conversations[id]; ok {
+		return conversation, nil
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+func (r *fakeConversationRepo) FindByUserAndSessionID(ctx context.Context, userID uint, sessionID string) (*models.Conversation, error) {
+	for _, conversation := range r.conversations {
+		if conversation.SessionID == sessionID && conversation.UserID == userID {
+			return conversation, nil
+		}
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+func (r *fakeConversationRepo) FindByUserID(ctx context.Context, userID uint) ([]models.Conversation, error) {
+	var conversations []models.Conversation
+	for _, conversation := range r.conversations {
+		if conversation.UserID == userID {
+			conversations = append(conversations, *conversation)
+		}
+	}
+	return conversations, nil
+}
+
+func (r *fakeConversationRepo) FindActiveByUserID(ctx context.Context, userID uint, topic string) (*models.Conversation, error) {
+	for _, conversation := range r.conversations {
+		if conversation.UserID == userID && conversation.Topic == topic && conversation.Status() == models.ConversationStatusActive {
+			return conversation, nil
+		}
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+// List orders by ID only, the fake does not set CreatedAt
+func (r *fakeConversationRepo) List(ctx context.Context, userID uint, filter repositories.ConversationFilter) ([]models.Conversation, error) {
+	var conversations []models.Conversation
+	for id := r.nextID; id > 0 && len(conversations) < filter.Limit; id-- {
+		conversation, ok := r.conversations[id]
+		if !ok || conversation.UserID != userID {
+			continue
+		}
+		if filter.Status != "" && conversation.Status() != filter.Status {
+			continue
+		}
+		if filter.Topic != "" && conversation.Topic != filter.Topic {
+			continue
+		}
+		if filter.Cursor != nil && id >= filter.Cursor.ID {
+			continue
+		}
+		conversations = append(conversations, *conversation)
+	}
+	return conversations, nil
+}
+
+func (r *fakeConversationRepo) SetArchivedAt(ctx context.Context, id uint, archivedAt *time.Time) error {
+	if conversation, ok := r.conversations[id]; ok {
+		conversation.ArchivedAt = archivedAt
+	}
+	return nil
+}
+
+func (r *fakeConversationRepo) SaveSummary(ctx context.Context, id uint, summary string, summarizedMessageID uint) error {
+	if conversation, ok := r.conversations[id]; ok && conversation.SummarizedMessageID < summarizedMessageID {
+		conversation.Summary = summary
+		conversation.SummarizedMessageID = summarizedMessageID
+	}
+	return nil
+}
+
+func (r *fakeConversationRepo) MarkBudgetGenerated(ctx context.Context, id uint, at time.Time) (bool, error) {
+	conversation, ok := r.conversations[id]
+	if !ok || conversation.CompletedAt != nil || conversation.ArchivedAt != nil {
+		return false, nil
+	}
+	conversation.BudgetGenerated = true
+	conversation.CompletedAt = &at
+	return true, nil
+}
+
+func (r *fakeConversationRepo) Delete(ctx context.Context, id uint) error {
+	delete(r.conversations, id)
+	return nil
+}
+
+type fakeMessageRepo struct {
+	messages []models.Message
+}
+
+func (r *fakeMessageRepo) Create(ctx context.Context, message *models.Message) error {
+	message.ID = uint(len(r.messages) + 1)
+	r.messages = append(r.messages, *message)
+	return nil
+}
+
+func (r *fakeMessageRepo) FindByID(ctx context.Context, id uint) (*models.Message, error) {
+	for _, message := range r.messages {
+		if message.ID == id {
+			return &message, nil
+		}
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+func (r *fakeMessageRepo) FindByConversationID(ctx context.Context, conversationID uint) ([]models.Message, error) {
+	var messages []models.Message
+	for _, message := range r.messages {
+		if message.ConversationID == conversationID {
+			messages = append(messages, message)
+		}
+	}
+	return messages, nil
+}
+
+func (r *fakeMessageRepo) Delete(ctx context.Context, id uint) error {
+	return nil
+}
+
+type fakeBudgetRepo struct {
+	budgets     []models.Budget
+	createError error
+}
+
+func (r *fakeBudgetRepo) Create(ctx context.Context, budget *models.Budget) error {
+	budget.ID = uint(len(r.budgets) + 1)
+	r.budgets = append(r.budgets, *budget)
+	return nil
+}
+
+func (r *fakeBudgetRepo) CreateBatch(ctx context.Context, budgets []models.Budget) error {
+	if r.createError != nil {
+		return r.createError
+	}
+	for i := range budgets {
+		budgets[i].ID = uint(len(r.budgets) + 1)
+		r.budgets = append(r.budgets, budgets[i])
+	}
+	return nil
+}
+
+func (r *fakeBudgetRepo) FindByID(ctx context.Context, id uint) (*models.Budget, error) {
+	return nil, gorm.ErrRecordNotFound
+}
+
+func (r *fakeBudgetRepo) FindByUserID(ctx context.Context, userID uint) ([]models.Budget, error) {
+	return r.budgets, nil
+}
+
+func (r *fakeBudgetRepo) FindActiveByUserID(ctx context.Context, userID uint, at time.Time) ([]models.Budget, error) {
+	var budgets []models.Budget
+	for _, budget := range r.budgets {
+		if budget.UserID == userID && !at.Before(budget.StartDate) && !at.After(budget.EndDate) {
+			budgets = append(budgets, budget)
+		}
+	}
+	return budgets, nil
+}
+
+func (r *fakeBudgetRepo) FindRenewable(ctx context.Context, period string, endedFrom, endedBefore time.Time) ([]models.Budget, error) {
+	var budgets []models.Budget
+	for _, budget := range r.budgets {
+		if budget.Period == period && !budget.EndDate.Before(endedFrom) && budget.EndDate.Before(endedBefore) && !r.renewed(budget.ID) {
+			budgets = append(budgets, budget)
+		}
+	}
+	return budgets, nil
+}
+
+func (r *fakeBudgetRepo) renewed(id uint) bool {
+	for _, budget := range r.budgets {
+		if budget.PreviousBudgetID != nil && *budget.PreviousBudgetID == id {
+			return true
+		}
+	}
+	return false
+}
+
+// CreateRenewal mirrors the unique index on previous_budget_id
+func (r *fakeBudgetRepo) CreateRenewal(ctx context.Context, budget *models.Budget) (bool, error) {
+	if budget.PreviousBudgetID != nil && r.renewed(*budget.PreviousBudgetID) {
+		return false, nil
+	}
+	if err := r.Create(ctx, budget); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (r *fakeBudgetRepo) Update(ctx context.Context, budget *models.Budget) error {
+	return nil
+}
+
+func (r *fakeBudgetRepo) Delete(ctx context.Context, id uint) error {
+	return nil
+}
+
+type fakeBudgetAdjustmentRepo struct {
+	adjustments []*models.BudgetAdjustment
+	budgetRepo  *fakeBudgetRepo
+}
+
+func (r *fakeBudgetAdjustmentRepo) Create(ctx context.Context, adjustment *models.BudgetAdjustment) error {
+	adjustment.ID = uint(len(r.adjustments) + 1)
+	r.adjustments = append(r.adjustments, adjustment)
+	return nil
+}
+
+func (r *fakeBudgetAdjustmentRepo) FindPendingByConversationID(ctx context.Context, conversationID uint) (*models.BudgetAdjustment, error) {
+	for i := len(r.adjustments) - 1; i >= 0; i-- {
+		adjustment := r.adjustments[i]
+		if adjustment.ConversationID == conversationID && adjustment.Status == models.BudgetAdjustmentPending {
+			return adjustment, nil
+		}
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+func (r *fakeBudgetAdjustmentRepo) Update(ctx context.Context, adjustment *models.BudgetAdjustment) error {
+	return nil
+}
+
+func (r *fakeBudgetAdjustmentRepo) Apply(ctx context.Context, adjustment *models.BudgetAdjustment, at time.Time) (bool, error) {
+	for _, change := range adjustment.Changes {
+		budget := &r.budgetRepo.budgets[change.BudgetID-1]
+		if budget.Amount != change.Before {
+			return false, nil
+		}
+	}
+	for _, change := range adjustment.Changes {
+		r.budgetRepo.budgets[change.BudgetID-1].Amount = change.After
+	}
+	adjustment.Status = models.BudgetAdjustmentApplied
+	adjustment.AppliedAt = &at
+	return true, nil
+}
+
+// fakeUnitOfWork hands out the fake repositories and puts their state back
+// when fn fails, like a rolled back transaction
+type fakeUnitOfWork struct {
+	conversationRepo *fakeConversationRepo
+	messageRepo      *fakeMessageRepo
+	budgetRepo       *fakeBudgetRepo
+	adjustmentRepo   *fakeBudgetAdjustmentRepo
+	profileRepo      *fakeProfileRepo
+}
+
+func newFakeUnitOfWork(conversationRepo *fakeConversationRepo, messageRepo *fakeMessageRepo, budgetRepo *fakeBudgetRepo, profileRepo *fakeProfileRepo) *fakeUnitOfWork {
+	return &fakeUnitOfWork{
+		conversationRepo: conversationRepo,
+		messageRepo:      messageRepo,
+		budgetRepo:       budgetRepo,
+		adjustmentRepo:   &fakeBudgetAdjustmentRepo{budgetRepo: budgetRepo},
+		profileRepo:      profileRepo,
+	}
+}
+
+func (u *fakeUnitOfWork) Do(ctx context.Context, fn func(tx repositories.Repositories) error) error {
+	conversations := make(map[uint]*models.Conversation, len(u.conversationRepo.conversations))
+	conversationRows := make(map[uint]models.Conversation, len(u.conversationRepo.conversations))
+	for id, conversation := range u.conversationRepo.conversations {
+		conversations[id] = conversation
+		conversationRows[id] = *conversation
+	}
+	messages := append([]models.Message(nil), u.messageRepo.messages...)
+	budgets := append([]models.Budget(nil), u.budgetRepo.budgets...)
+	profiles := make(map[uint]*models.FinancialProfile, len(u.profileRepo.profiles))
+	for userID, profile := range u.profileRepo.profiles {
+		profiles[userID] = profile
+	}
+
+	err := fn(repositories.Repositories{
+		Conversations:     u.conversationRepo,
+		Messages:          u.messageRepo,
+		Budgets:           u.budgetRepo,
+		BudgetAdjustments: u.adjustmentRepo,
+		Profiles:          u.profileRepo,
+	})
+	if err != nil {
+		for id, conversation := range conversations {
+			*conversation = conversationRows[id]
+		}
+		u.conversationRepo.conversations = conversations
+		u.messageRepo.messages = messages
+		u.budgetRepo.budgets = budgets
+		u.profileRepo.profiles = profiles
+	}
+	return err
+}
+
+type fakeUserRepo struct{}
+
+func (r *fakeUserRepo) Create(ctx context.Context, user *models.User) error {
+	return nil
+}
+
+func (r *fakeUserRepo) FindByID(ctx context.Context, id uint) (*models.User, error) {
+	return &models.User{ID: id, PayDay: 1, PayDayAdjust: models.PayDayAdjustNone}, nil
+}
+
+func (r *fakeUserRepo) FindByEmail(ctx context.Context, email string) (*models.User, error) {
+	return nil, gorm.ErrRecordNotFound
+}
+
+func (r *fakeUserRepo) Update(ctx context.Context, user *models.User) error {
+	return nil
+}
+
+type fakeProfileRepo struct {
+	profiles map[uint]*models.FinancialProfile
+}
+
+func (r *fakeProfileRepo) FindByUserID(ctx context.Context, userID uint) (*models.FinancialProfile, error) {
+	profile, ok := r.profiles[userID]
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	copied := *profile
+	return &copied, nil
+}
+
+func (r *fakeProfileRepo) Save(ctx context.Context, profile *models.FinancialProfile) error {
+	if r.profiles == nil {
+		r.profiles = make(map[uint]*models.FinancialProfile)
+	}
+	copied := *profile
+	r.profiles[profile.UserID] = &copied
+	return nil
+}
+
+type fakeLLMUsageRepo struct {
+	usages []*models.LLMUsage
+}
+
+func (r *fakeLLMUsageRepo) Create(ctx context.Context, usage *models.LLMUsage) error {
+	if usage.CreatedAt.IsZero() {
+		usage.CreatedAt = time.Now()
+	}
+	r.usages = append(r.usages, usage)
+	return nil
+}
+
+func (r *fakeLLMUsageRepo) SumTokensSince(ctx context.Context, userID uint, since time.Time) (int, error) {
+	total := 0
+	for _, usage := range r.usages {
+		if usage.UserID == userID && !usage.CreatedAt.Before(since) {
+			total += usage.PromptTokens + usage.CompletionTokens
+		}
+	}
+	return total, nil
+}
+
+func (r *fakeLLMUsageRepo) DailySpend(ctx context.Context, from, to time.Time) ([]repositories.DailySpend, error) {
+	return nil, nil
+}
+
+const (
+	ownerID    uint = 1
+	intruderID uint = 2
+)
+
+func newTestConversationService(t *testing.T, llm LLMService) (ConversationService, *fakeConversationRepo, *fakeMessageRepo, *fakeBudgetRepo, string) {
+	t.Helper()
+
+	conversationRepo := newFakeConversationRepo()
+	messageRepo := &fakeMessageRepo{}
+	budgetRepo := &fakeBudgetRepo{}
+
+	calendar, err := NewBudgetCalendar(time.UTC, nil)
+	if err != nil {
+		t.Fatalf("NewBudgetCalendar: %v", err)
+	}
+
+	profileRepo := &fakeProfileRepo{}
+	service := NewConversationService(conversationRepo, messageRepo, budgetRepo, &fakeUserRepo{}, profileRepo, newFakeUnitOfWork(conversationRepo, messageRepo, budgetRepo, profileRepo), calendar, newTestCostOfLiving(t), NewContextWindow(NewTokenCounter(LLMProviderScripted), 0, 8), NewUsageService(&fakeLLMUsageRepo{}, &fakeUserRepo{}, nil, nil, LLMProviderScripted), llm)
+
+	conversation, _, err := service.StartConversation(context.Background(), ownerID, "")
+	if err != nil {
+		t.Fatalf("StartConversation: %v", err)
+	}
+
+	return service, conversationRepo, messageRepo, budgetRepo, conversation.SessionID
+}
+
+func TestProcessMessageRejectsForeignSession(t *testing.T) {
+	service, _, messageRepo, budgetRepo, sessionID := newTestConversationService(t, NewScriptedLLMService(nil))
+	messagesBefore := len(messageRepo.messages)
+
+	_, _, _, err := service.ProcessMessage(context.Background(), intruderID, sessionID, "buatin budget")
+	if !errors.Is(err, ErrConversationNotFound) {
+		t.Fatalf("expected ErrConversationNotFound, got %v", err)
+	}
+
+	if len(messageRepo.messages) != messagesBefore {
+		t.Errorf("foreign user message was saved")
+	}
+	if len(budgetRepo.budgets) != 0 {
+		t.Errorf("budgets were created for a foreign session")
+	}
+}
+
+func TestGetConversationHistoryRejectsForeignSession(t *testing.T) {
+	service, _, _, _, sessionID := newTestConversationService(t, NewScriptedLLMService(nil))
+
+	messages, err := service.GetConversationHistory(context.Background(), intruderID, sessionID)
+	if !errors.Is(err, ErrConversationNotFound) {
+		t.Fatalf("expected ErrConversationNotFound, got %v", err)
+	}
+	if messages != nil {
+		t.Errorf("expected no messages, got %d", len(messages))
+	}
+}
+
+func TestResetConversationRejectsForeignSession(t *testing.T) {
+	service, conversationRepo, _, _, sessionID := newTestConversationService(t, NewScriptedLLMService(nil))
+
+	_, _, err := service.ResetConversation(context.Background(), intruderID, sessionID)
+	if !errors.Is(err, ErrConversationNotFound) {
+		t.Fatalf("expected ErrConversationNotFound, got %v", err)
+	}
+
+	if _, err := conversationRepo.FindByUserAndSessionID(context.Background(), ownerID, sessionID); err != nil {
+		t.Errorf("owner conversation was deleted: %v", err)
+	}
+	if _, err := conversationRepo.FindActiveByUserID(context.Background(), intruderID, models.ConversationTopicBudget); err == nil {
+		t.Errorf("a conversation was started for the foreign user")
+	}
+}
+
+// greetingDownLLM fails every greeting
+type greetingDownLLM struct {
+	LLMService
+}
+
+func (l greetingDownLLM) GenerateResponseWithRetry(ctx context.Context, systemPrompt string, messages []models.Message, maxRetries int) (string, error) {
+	return "", errors.New("llm unavailable")
+}
+
+func TestResetConversationReplacesTheInterview(t *testing.T) {
+	ctx := context.Background()
+	service, conversationRepo, messageRepo, _, sessionID := newTestConversationService(t, greetingDownLLM{NewScriptedLLMService(nil)})
+	old, _ := conversationRepo.FindByUserAndSessionID(ctx, ownerID, sessionID)
+
+	conversation, greeting, err := service.ResetConversation(ctx, ownerID, sessionID)
+	if err != nil {
+		t.Fatalf("ResetConversation: %v", err)
+	}
+	if greeting == "" {
+		t.Error("expected the fallback greeting when the LLM is down")
+	}
+	if conversation.SessionID == sessionID || conversation.Topic != models.ConversationTopicBudget {
+		t.Errorf("expected a new budget interview, got %q about %q", conversation.SessionID, conversation.Topic)
+	}
+	if _, err := conversationRepo.FindByID(ctx, old.ID); err == nil {
+		t.Error("expected the old conversation to be deleted")
+	}
+
+	messages, _ := messageRepo.FindByConversationID(ctx, conversation.ID)
+	if len(messages) != 1 || messages[0].Content != greeting {
+		t.Errorf("expected the new conversation to start with the greeting, got %d messages", len(messages))
+	}
+}
+
+func TestResetConversationKeepsItWhenAnotherInterviewIsActive(t *testing.T) {
+	ctx := context.Background()
+	service, conversationRepo, _, _, sessionID := newTestConversationService(t, NewScriptedLLMService(nil))
+
+	if _, _, _, err := service.ProcessMessage(ctx, ownerID, sessionID, "buatin budget"); err != nil {
+		t.Fatalf("ProcessMessage: %v", err)
+	}
+	if _, _, err := service.StartConversation(ctx, ownerID, models.ConversationTopicBudget); err != nil {
+		t.Fatalf("StartConversation: %v", err)
+	}
+
+	if _, _, err := service.ResetConversation(ctx, ownerID, sessionID); !errors.Is(err, ErrBudgetInterviewActive) {
+		t.Fatalf("expected ErrBudgetInterviewActive, got %v", err)
+	}
+	if _, err := conversationRepo.FindByUserAndSessionID(ctx, ownerID, sessionID); err != nil {
+		t.Errorf("expected the completed conversation to be kept, got %v", err)
+	}
+}
+
+func TestFailedResetKeepsTheOldConversation(t *testing.T) {
+	ctx := context.Background()
+	service, conversationRepo, messageRepo, _, sessionID := newTestConversationService(t, NewScriptedLLMService(nil))
+	messagesBefore := len(messageRepo.messages)
+
+	conversationRepo.createError = errors.New("connection reset")
+	if _, _, err := service.ResetConversation(ctx, ownerID, sessionID); err == nil {
+		t.Fatal("expected the failed create to be reported")
+	}
+
+	if _, err := conversationRepo.FindByUserAndSessionID(ctx, ownerID, sessionID); err != nil {
+		t.Errorf("expected the old conversation to be restored, got %v", err)
+	}
+	if len(conversationRepo.conversations) != 1 || len(messageRepo.messages) != messagesBefore {
+		t.Errorf("expected nothing else to change, got %d conversations and %d new messages",
+			len(conversationRepo.conversations), len(messageRepo.messages)-messagesBefore)
+	}
+
+	// The old conversation is still the active interview
+	conversationRepo.createError = nil
+	if _, _, err := service.ResetConversation(ctx, ownerID, sessionID); err != nil {
+		t.Errorf("expected the retry to reset the conversation, got %v", err)
+	}
+}
+
+func TestOwnerCanUseOwnSession(t *testing.T) {
+	service, _, _, budgetRepo, sessionID := newTestConversationService(t, NewScriptedLLMService(nil))
+
+	if _, _, _, err := service.ProcessMessage(context.Background(), ownerID, sessionID, "buatin budget"); err != nil {
+		t.Fatalf("ProcessMessage: %v", err)
+	}
+	if len(budgetRepo.budgets) == 0 {
+		t.Errorf("expected budgets to be created for the owner")
+	}
+
+	messages, err := service.GetConversationHistory(context.Background(), ownerID, sessionID)
+	if err != nil {
+		t.Fatalf("GetConversationHistory: %v", err)
+	}
+	if len(messages) != 3 {
+		t.Errorf("expected 3 messages, got %d", len(messages))
+	}
+}
+
+func TestFailedBudgetSaveRollsBackTheTurn(t *testing.T) {
+	service, conversationRepo, messageRepo, budgetRepo, sessionID := newTestConversationService(t, NewScriptedLLMService(nil))
+	messagesBefore := len(messageRepo.messages)
+
+	budgetRepo.createError = errors.New("connection reset")
+	if _, _, _, err := service.ProcessMessage(context.Background(), ownerID, sessionID, "buatin budget"); err == nil {
+		t.Fatal("expected the failed budget save to be reported")
+	}
+
+	conversation, _ := conversationRepo.FindByUserAndSessionID(context.Background(), ownerID, sessionID)
+	if conversation.CompletedAt != nil || conversation.BudgetGenerated {
+		t.Errorf("conversation was completed without budgets")
+	}
+	if len(messageRepo.messages) != messagesBefore {
+		t.Errorf("expected the user message to be rolled back, got %d new messages", len(messageRepo.messages)-messagesBefore)
+	}
+	profileRepo := service.(*conversationService).profileRepo.(*fakeProfileRepo)
+	if _, err := profileRepo.FindByUserID(context.Background(), ownerID); err == nil {
+		t.Errorf("expected the profile extracted in the failed turn to be rolled back")
+	}
+
+	// Retrying creates the budget once
+	budgetRepo.createError = nil
+	_, completed, budgets, err := service.ProcessMessage(context.Background(), ownerID, sessionID, "buatin budget")
+	if err != nil {
+		t.Fatalf("ProcessMessage: %v", err)
+	}
+	if !completed || len(budgets) == 0 || len(budgetRepo.budgets) != len(budgets) {
+		t.Errorf("expected one set of %d budgets, got %d", len(budgets), len(budgetRepo.budgets))
+	}
+	if len(messageRepo.messages) != messagesBefore+2 {
+		t.Errorf("expected the turn to save 2 messages, got %d", len(messageRepo.messages)-messagesBefore)
+	}
+	if _, err := profileRepo.FindByUserID(context.Background(), ownerID); err != nil {
+		t.Errorf("expected the profile to be saved with the turn, got %v", err)
+	}
+}
+
+func TestProcessMessageStopsWhenClientDisconnects(t *testing.T) {
+	llm := NewScriptedLLMService([]ScriptRule{{Reply: "halo juga kak!"}})
+	service, _, messageRepo, _, sessionID := newTestConversationService(t, llm)
+	messagesBefore := len(messageRepo.messages)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	start := time.Now()
+	_, _, _, err := service.ProcessMessage(ctx, ownerID, sessionID, "halo")
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("expected no retry backoff, took %v", elapsed)
+	}
+	if len(messageRepo.messages) != messagesBefore {
+		t.Errorf("expected nothing saved for a cancelled turn")
+	}
+}
+
+func TestStreamMessageSavesPartialReplyOnCancel(t *testing.T) {
+	llm := NewScriptedLLMService([]ScriptRule{{Reply: "halo juga kak!"}})
+	service, _, messageRepo, _, sessionID := newTestConversationService(t, llm)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var deltas []string
+	_, _, _, err := service.StreamMessage(ctx, ownerID, sessionID, "halo", func(delta string) error {
+		deltas = append(deltas, delta)
+		cancel()
+		return nil
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+	if len(deltas) != 1 {
+		t.Fatalf("expected 1 delta before cancel, got %d", len(deltas))
+	}
+
+	last := messageRepo.messages[len(messageRepo.messages)-1]
+	if last.Role != models.RoleAssistant || last.Content != "halo " {
+		t.Errorf("expected partial assistant reply to be saved, got %s %q", last.Role, last.Content)
+	}
+}
+
+func TestStreamMessageRejectsForeignSession(t *testing.T) {
+	service, _, _, _, sessionID := newTestConversationService(t, NewScriptedLLMService(nil))
+
+	_, _, _, err := service.StreamMessage(context.Background(), intruderID, sessionID, "halo", func(string) error {
+		t.Fatal("no delta expected for a foreign session")
+		return nil
+	})
+	if !errors.Is(err, ErrConversationNotFound) {
+		t.Fatalf("expected ErrConversationNotFound, got %v", err)
+	}
+}
+
+func TestProcessMessageRebalancesInvalidBudget(t *testing.T) {
+	llm := NewScriptedLLMService([]ScriptRule{
+		{Match: "AI budget analyst", Reply: `{"salary": 6000000, "categories": [{"name": "Makan", "amount": 2000000}, {"name": "Tabungan", "amount": 1000000}]}`},
+		{Match: "intent classifier", Reply: `{"intent": "request_budget", "income": 6000000, "city": "bdg", "lifestyle": "hemat"}`},
+		{Reply: "hai!"},
+	})
+	service, _, _, budgetRepo, sessionID := newTestConversationService(t, llm)
+
+	if _, _, _, err := service.ProcessMessage(context.Background(), ownerID, sessionID, "buatin budget"); err != nil {
+		t.Fatalf("ProcessMessage: %v", err)
+	}
+
+	total := 0.0
+	for _, budget := range budgetRepo.budgets {
+		total += budget.Amount
+	}
+	if total != 6000000 {
+		t.Errorf("expected budgets to add up to the salary, got %.0f", total)
+	}
+}
+
+func TestProcessMessageWaitsForRequiredSlots(t *testing.T) {
+	llm := NewScriptedLLMService([]ScriptRule{
+		{Match: "AI budget analyst", Reply: defaultScript[0].Reply},
+		{Match: "gaji 8 juta", Reply: `{"intent": "provide_info", "income": 8000000, "city": "jkt", "lifestyle": null}`},
+		{Match: "santai aja", Reply: `{"intent": "provide_info", "income": null, "city": null, "lifestyle": "santai"}`},
+		{Match: "bikin sekarang", Reply: `{"intent": "request_budget", "income": null, "city": null, "lifestyle": null}`},
+		{Reply: "oke!"},
+	})
+	service, _, _, budgetRepo, sessionID := newTestConversationService(t, llm)
+
+	for _, message := range []string{"bikin sekarang dong", "gaji 8 juta, tinggal di jkt", "bikin sekarang dong"} {
+		_, completed, budgets, err := service.ProcessMessage(context.Background(), ownerID, sessionID, message)
+		if err != nil {
+			t.Fatalf("ProcessMessage(%q): %v", message, err)
+		}
+		if completed || len(budgets) > 0 || len(budgetRepo.budgets) > 0 {
+			t.Fatalf("budget generated after %q before lifestyle was known", message)
+		}
+	}
+
+	profile, err := service.(*conversationService).profileRepo.FindByUserID(context.Background(), ownerID)
+	if err != nil {
+		t.Fatalf("expected a financial profile: %v", err)
+	}
+	if profile.Salary != 8000000 || profile.City != "Jakarta" || profile.Lifestyle != "" {
+		t.Errorf("unexpected profile: salary %.0f, city %q, lifestyle %q", profile.Salary, profile.City, profile.Lifestyle)
+	}
+
+	if _, _, _, err := service.ProcessMessage(context.Background(), ownerID, sessionID, "santai aja orangnya"); err != nil {
+		t.Fatalf("ProcessMessage: %v", err)
+	}
+	_, completed, budgets, err := service.ProcessMessage(context.Background(), ownerID, sessionID, "bikin sekarang dong")
+	if err != nil {
+		t.Fatalf("ProcessMessage: %v", err)
+	}
+	if !completed || len(budgets) == 0 {
+		t.Errorf("expected budget once income, city and lifestyle are known")
+	}
+}
+
+func TestProcessMessageFallsBackToRuleBasedBudget(t *testing.T) {
+	llm := NewScriptedLLMService([]ScriptRule{
+		{Match: "AI budget analyst", Reply: "maaf, lagi nggak bisa"},
+		{Match: "intent classifier", Reply: `{"intent": "request_budget", "income": 7000000, "city": "jogja", "lifestyle": "santai"}`},
+		{Reply: "hai!"},
+	})
+	service, _, _, budgetRepo, sessionID := newTestConversationService(t, llm)
+
+	reply, _, budgets, err := service.ProcessMessage(context.Background(), ownerID, sessionID, "buatin budget")
+	if err != nil {
+		t.Fatalf("ProcessMessage: %v", err)
+	}
+	if reply == budgetErrorMessage || len(budgets) != len(budgetCategories) {
+		t.Fatalf("expected a rule-based budget, got %d budgets and reply %q", len(budgets), reply)
+	}
+
+	total := 0.0
+	for _, budget := range budgetRepo.budgets {
+		total += budget.Amount
+	}
+	if total != 7000000 {
+		t.Errorf("expected budgets to add up to the salary, got %.0f", total)
+	}
+}
+
+func TestProcessMessageAdjustsBudgetAfterConfirmation(t *testing.T) {
+	service, _, _, budgetRepo, sessionID := newTestConversationService(t, NewScriptedLLMService(nil))
+
+	if _, _, _, err := service.ProcessMessage(context.Background(), ownerID, sessionID, "buatin budget"); err != nil {
+		t.Fatalf("ProcessMessage: %v", err)
+	}
+
+	reply, completed, budgets, err := service.ProcessMessage(context.Background(), ownerID, sessionID, "naikin makan jadi 1.5 juta, kurangin healing")
+	if err != nil {
+		t.Fatalf("ProcessMessage: %v", err)
+	}
+	if !completed || len(budgets) != 0 || reply == conversationCompletedMessage {
+		t.Fatalf("expected a proposal before applying, got %d budgets and reply %q", len(budgets), reply)
+	}
+	if amount := budgetAmount(budgetRepo.budgets, "Makan"); amount != 1250000 {
+		t.Fatalf("budget changed before confirmation: Makan %.0f", amount)
+	}
+
+	for _, message := range []string{"caranya gimana?", "biaya makan berapa?", "saya masih mikir"} {
+		if _, _, budgets, err := service.ProcessMessage(context.Background(), ownerID, sessionID, message); err != nil || len(budgets) != 0 {
+			t.Fatalf("ProcessMessage(%q): expected no change, got %d budgets, %v", message, len(budgets), err)
+		}
+		if amount := budgetAmount(budgetRepo.budgets, "Makan"); amount != 1250000 {
+			t.Fatalf("%q applied the proposal: Makan %.0f", message, amount)
+		}
+	}
+
+	_, _, budgets, err = service.ProcessMessage(context.Background(), ownerID, sessionID, "iya")
+	if err != nil {
+		t.Fatalf("ProcessMessage: %v", err)
+	}
+	if len(budgets) != len(budgetCategories) {
+		t.Fatalf("expected the adjusted budgets, got %d", len(budgets))
+	}
+
+	total := 0.0
+	for _, budget := range budgetRepo.budgets {
+		total += budget.Amount
+	}
+	if total != 5000000 {
+		t.Errorf("expected budgets to add up to the salary, got %.0f", total)
+	}
+	if makan, healing := budgetAmount(budgetRepo.budgets, "Makan"), budgetAmount(budgetRepo.budgets, "Healing"); makan != 1500000 || healing != 250000 {
+		t.Errorf("expected Makan 1500000 and Healing 250000, got %.0f and %.0f", makan, healing)
+	}
+}
+
+func budgetAmount(budgets []models.Budget, category string) float64 {
+	for _, budget := range budgets {
+		if budget.Category == category {
+			return budget.Amount
+		}
+	}
+	return 0
+}
+
+func TestStartConversationAllowsOneBudgetInterview(t *testing.T) {
+	service, _, _, _, _ := newTestConversationService(t, NewScriptedLLMService(nil))
+
+	if _, _, err := service.StartConversation(context.Background(), ownerID, models.ConversationTopicBudget); !errors.Is(err, ErrBudgetInterviewActive) {
+		t.Fatalf("expected ErrBudgetInterviewActive, got %v", err)
+	}
+
+	for i := 0; i < 2; i++ {
+		conversation, _, err := service.StartConversation(context.Background(), ownerID, models.ConversationTopicGeneral)
+		if err != nil {
+			t.Fatalf("StartConversation(general): %v", err)
+		}
+		if conversation.Topic != models.ConversationTopicGeneral {
+			t.Errorf("expected topic general, got %q", conversation.Topic)
+		}
+	}
+
+	if _, _, err := service.StartConversation(context.Background(), ownerID, "gossip"); !errors.Is(err, ErrInvalidTopic) {
+		t.Errorf("expected ErrInvalidTopic, got %v", err)
+	}
+}
+
+func TestArchivedConversationRejectsMessagesUntilUnarchived(t *testing.T) {
+	service, _, _, _, sessionID := newTestConversationService(t, NewScriptedLLMService(nil))
+
+	summary, err := service.ArchiveConversation(context.Background(), ownerID, sessionID)
+	if err != nil {
+		t.Fatalf("ArchiveConversation: %v", err)
+	}
+	if summary.Status != models.ConversationStatusArchived {
+		t.Fatalf("expected archived status, got %q", summary.Status)
+	}
+
+	if _, _, _, err := service.ProcessMessage(context.Background(), ownerID, sessionID, "halo"); !errors.Is(err, ErrConversationArchived) {
+		t.Fatalf("expected ErrConversationArchived, got %v", err)
+	}
+
+	// An archived interview no longer blocks a new one
+	if _, _, err := service.StartConversation(context.Background(), ownerID, models.ConversationTopicBudget); err != nil {
+		t.Fatalf("StartConversation: %v", err)
+	}
+	if _, err := service.UnarchiveConversation(context.Background(), ownerID, sessionID); !errors.Is(err, ErrBudgetInterviewActive) {
+		t.Fatalf("expected ErrBudgetInterviewActive, got %v", err)
+	}
+
+	if _, err := service.ArchiveConversation(context.Background(), intruderID, sessionID); !errors.Is(err, ErrConversationNotFound) {
+		t.Errorf("expected ErrConversationNotFound for a foreign session, got %v", err)
+	}
+}
+
+func TestListConversationsPaginatesAndFilters(t *testing.T) {
+	service, _, _, _, sessionID := newTestConversationService(t, NewScriptedLLMService(nil))
+
+	for i := 0; i < 3; i++ {
+		if _, _, err := service.StartConversation(context.Background(), ownerID, models.ConversationTopicGeneral); err != nil {
+			t.Fatalf("StartConversation: %v", err)
+		}
+	}
+	if _, _, err := service.StartConversation(context.Background(), intruderID, models.ConversationTopicGeneral); err != nil {
+		t.Fatalf("StartConversation: %v", err)
+	}
+
+	var sessions []string
+	cursor := ""
+	for {
+		page, err := service.ListConversations(context.Background(), ownerID, ConversationQuery{Filter: repositories.ConversationFilter{Limit: 3}, Cursor: cursor})
+		if err != nil {
+			t.Fatalf("ListConversations: %v", err)
+		}
+		for _, conversation := range page.Conversations {
+			sessions = append(sessions, conversation.SessionID)
+		}
+		if !page.HasMore {
+			break
+		}
+		cursor = page.NextCursor
+	}
+	if len(sessions) != 4 || sessions[3] != sessionID {
+		t.Fatalf("expected the owner's 4 conversations, oldest last, got %v", sessions)
+	}
+
+	page, err := service.ListConversations(context.Background(), ownerID, ConversationQuery{Filter: repositories.ConversationFilter{Topic: models.ConversationTopicBudget}})
+	if err != nil {
+		t.Fatalf("ListConversations: %v", err)
+	}
+	if len(page.Conversations) != 1 || page.Conversations[0].SessionID != sessionID {
+		t.Errorf("expected only the budget interview, got %+v", page.Conversations)
+	}
+
+	if _, err := service.ListConversations(context.Background(), ownerID, ConversationQuery{Filter: repositories.ConversationFilter{Status: "open"}}); !errors.Is(err, ErrInvalidStatus) {
+		t.Errorf("expected ErrInvalidStatus, got %v", err)
+	}
+
+	// A cursor only continues the listing it came from
+	general := repositories.ConversationFilter{Topic: models.ConversationTopicGeneral, Limit: 1}
+	first, err := service.ListConversations(context.Background(), ownerID, ConversationQuery{Filter: general})
+	if err != nil || first.NextCursor == "" {
+		t.Fatalf("ListConversations: expected a next cursor, got %v", err)
+	}
+	if _, err := service.ListConversations(context.Background(), ownerID, ConversationQuery{Filter: general, Cursor: first.NextCursor}); err != nil {
+		t.Errorf("expected the cursor to continue its listing, got %v", err)
+	}
+	for name, filter := range map[string]repositories.ConversationFilter{
+		"without the topic": {Limit: 1},
+		"another topic":     {Topic: models.ConversationTopicBudget, Limit: 1},
+		"another status":    {Topic: models.ConversationTopicGeneral, Status: models.ConversationStatusActive, Limit: 1},
+	} {
+		if _, err := service.ListConversations(context.Background(), ownerID, ConversationQuery{Filter: filter, Cursor: first.NextCursor}); !errors.Is(err, ErrInvalidCursor) {
+			t.Errorf("%s: expected ErrInvalidCursor, got %v", name, err)
+		}
+	}
+}
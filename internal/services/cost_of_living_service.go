@@ -0,0 +1,264 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/stewicca/angagrar-backend/internal/models"
+	"github.com/stewicca/angagrar-backend/internal/repositories"
+	"github.com/stewicca/angagrar-backend/internal/seeds"
+	"github.com/stewicca/angagrar-backend/pkg/utils"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrCityCostNotFound = errors.New("cost of living not found")
+	ErrUnknownLocation  = errors.New("unknown location, use an Indonesian province, city or regency")
+	ErrInvalidCityCost  = errors.New("rent, food and transport must not be negative")
+)
+
+// CityCostAmounts are the monthly costs of one lifestyle in one place
+type CityCostAmounts struct {
+	Rent      float64 `json:"rent"`
+	Food      float64 `json:"food"`
+	Transport float64 `json:"transport"`
+}
+
+// CityCostSeed is the versioned cost-of-living seed file. Rows from an older
+// seed version are updated, rows changed through the admin API are kept.
+type CityCostSeed struct {
+	Version int `json:"version"`
+	Cities  []struct {
+		City       string                     `json:"city"`
+		Lifestyles map[string]CityCostAmounts `json:"lifestyles"`
+	} `json:"cities"`
+}
+
+// CostBaseline is the cost of living a budget is checked against
+type CostBaseline struct {
+	Location  string  `json:"location"` // Where the user lives
+	Source    string  `json:"source"`   // Whose numbers these are: the location, its province or Indonesia
+	Lifestyle string  `json:"lifestyle"`
+	Rent      float64 `json:"rent"`
+	Food      float64 `json:"food"`
+	Transport float64 `json:"transport"`
+}
+
+// Essentials is what the baseline costs per month in total
+func (b *CostBaseline) Essentials() float64 {
+	return b.Rent + b.Food + b.Transport
+}
+
+type CostOfLivingService interface {
+	ListCosts(ctx context.Context, city string) ([]models.CityCost, error)
+	SetCost(ctx context.Context, city, lifestyle string, amounts CityCostAmounts) (*models.CityCost, error)
+	DeleteCost(ctx context.Context, city, lifestyle string) error
+	Baseline(ctx context.Context, location, lifestyle string) (*CostBaseline, error)
+	SyncSeed(ctx context.Context, seed *CityCostSeed) (int, error)
+}
+
+type costOfLivingService struct {
+	cityCostRepo repositories.CityCostRepository
+}
+
+func NewCostOfLivingService(cityCostRepo repositories.CityCostRepository) CostOfLivingService {
+	return &costOfLivingService{cityCostRepo: cityCostRepo}
+}
+
+// LoadCityCostSeed reads a seed file, or the built-in seed when path is empty
+func LoadCityCostSeed(path string) (*CityCostSeed, error) {
+	raw := seeds.CityCosts
+	if path != "" {
+		var err error
+		if raw, err = os.ReadFile(path); err != nil {
+			return nil, fmt.Errorf("failed to read cost-of-living seed: %w", err)
+		}
+	}
+	return ParseCityCostSeed(raw)
+}
+
+// ParseCityCostSeed decodes a seed file
+func ParseCityCostSeed(raw []byte) (*CityCostSeed, error) {
+	var seed CityCostSeed
+	if err := json.Unmarshal(raw, &seed); err != nil {
+		return nil, fmt.Errorf("invalid cost-of-living seed: %w", err)
+	}
+	if seed.Version < 1 {
+		return nil, fmt.Errorf("invalid cost-of-living seed: version must be at least 1")
+	}
+	return &seed, nil
+}
+
+func (s *costOfLivingService) ListCosts(ctx context.Context, city string) ([]models.CityCost, error) {
+	if city != "" {
+		var err error
+		if city, err = normalizeCostCity(city); err != nil {
+			return nil, err
+		}
+	}
+	return s.cityCostRepo.FindAll(ctx, city)
+}
+
+// SetCost creates or replaces the numbers of one place and lifestyle. They
+// are marked as admin numbers so later seeds leave them alone.
+func (s *costOfLivingService) SetCost(ctx context.Context, city, lifestyle string, amounts CityCostAmounts) (*models.CityCost, error) {
+	cost, err := s.findOrNew(ctx, city, lifestyle)
+	if err != nil {
+		return nil, err
+	}
+	if amounts.Rent < 0 || amounts.Food < 0 || amounts.Transport < 0 {
+		return nil, ErrInvalidCityCost
+	}
+
+	cost.Rent, cost.Food, cost.Transport = amounts.Rent, amounts.Food, amounts.Transport
+	cost.Source = models.CityCostSourceAdmin
+
+	if err := s.cityCostRepo.Save(ctx, cost); err != nil {
+		return nil, err
+	}
+	return cost, nil
+}
+
+func (s *costOfLivingService) DeleteCost(ctx context.Context, city, lifestyle string) error {
+	cost, err := s.findOrNew(ctx, city, lifestyle)
+	if err != nil {
+		return err
+	}
+	if cost.ID == 0 {
+		return ErrCityCostNotFound
+	}
+	return s.cityCostRepo.Delete(ctx, cost.ID)
+}
+
+// Baseline returns the cost of living at location for lifestyle, using the
+// province's numbers and then the national average for places without their
+// own. An empty location gets the national average.
+func (s *costOfLivingService) Baseline(ctx context.Context, location, lifestyle string) (*CostBaseline, error) {
+	if location != "" {
+		location = utils.NormalizeLocation(location)
+	}
+	lifestyle = utils.NormalizeLifestyle(lifestyle)
+
+	candidates := []string{location, utils.RegionProvinceOf(location), models.CityCostNational}
+	for _, city := range candidates {
+		if city == "" {
+			continue
+		}
+
+		cost, err := s.cityCostRepo.Find(ctx, city, lifestyle)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		return &CostBaseline{
+			Location:  location,
+			Source:    cost.City,
+			Lifestyle: lifestyle,
+			Rent:      cost.Rent,
+			Food:      cost.Food,
+			Transport: cost.Transport,
+		}, nil
+	}
+
+	return nil, fmt.Errorf("%w for %s (%s)", ErrCityCostNotFound, models.CityCostNational, lifestyle)
+}
+
+// SyncSeed adds the seed's rows and updates rows seeded by an older version.
+// It returns how many rows changed.
+func (s *costOfLivingService) SyncSeed(ctx context.Context, seed *CityCostSeed) (int, error) {
+	changed := 0
+
+	for _, entry := range seed.Cities {
+		for lifestyle, amounts := range entry.Lifestyles {
+			cost, err := s.findOrNew(ctx, entry.City, lifestyle)
+			if err != nil {
+				return changed, fmt.Errorf("cost-of-living seed %s/%s: %w", entry.City, lifestyle, err)
+			}
+			if amounts.Rent < 0 || amounts.Food < 0 || amounts.Transport < 0 {
+				return changed, fmt.Errorf("cost-of-living seed %s/%s: %w", entry.City, lifestyle, ErrInvalidCityCost)
+			}
+
+			if cost.ID != 0 && (cost.Source != models.CityCostSourceSeed || cost.SeedVersion >= seed.Version) {
+				continue
+			}
+
+			cost.Rent, cost.Food, cost.Transport = amounts.Rent, amounts.Food, amounts.Transport
+			cost.Source = models.CityCostSourceSeed
+			cost.SeedVersion = seed.Version
+
+			if err := s.cityCostRepo.Save(ctx, cost); err != nil {
+				return changed, err
+			}
+			changed++
+		}
+	}
+
+	return changed, nil
+}
+
+// findOrNew loads the row of city and lifestyle, or an unsaved one
+func (s *costOfLivingService) findOrNew(ctx context.Context, city, lifestyle string) (*models.CityCost, error) {
+	city, err := normalizeCostCity(city)
+	if err != nil {
+		return nil, err
+	}
+
+	normalized, ok := utils.DetectLifestyle(lifestyle)
+	if !ok {
+		return nil, ErrInvalidLifestyle
+	}
+
+	cost, err := s.cityCostRepo.Find(ctx, city, normalized)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return &models.CityCost{City: city, Lifestyle: normalized}, nil
+	}
+	return cost, err
+}
+
+// normalizeCostCity accepts known regions and the national average
+func normalizeCostCity(city string) (string, error) {
+	if strings.EqualFold(strings.TrimSpace(city), models.CityCostNational) {
+		return models.CityCostNational, nil
+	}
+
+	region, ok := utils.LookupRegion(city)
+	if !ok {
+		return "", ErrUnknownLocation
+	}
+	return region.Name, nil
+}
+
+// checkBudgetAgainstBaseline flags essentials far below what living at the
+// user's location usually costs. It only applies when the salary covers the
+// baseline, otherwise cutting essentials is unavoidable.
+func checkBudgetAgainstBaseline(data *BudgetData, baseline *CostBaseline) []string {
+	if baseline == nil || data.Salary < baseline.Essentials() {
+		return nil
+	}
+
+	typical := map[string]float64{
+		"Kewajiban": baseline.Rent,
+		"Makan":     baseline.Food,
+		"Transport": baseline.Transport,
+	}
+
+	var problems []string
+	for _, cat := range data.Categories {
+		expected, ok := typical[cat.Name]
+		if !ok || cat.Amount >= expected/2 {
+			continue
+		}
+		problems = append(problems, fmt.Sprintf(
+			"%s is %.0f, less than half the typical %.0f for a %s lifestyle in %s; raise it unless the conversation explains why it is low",
+			cat.Name, cat.Amount, expected, baseline.Lifestyle, baseline.Source))
+	}
+
+	return problems
+}
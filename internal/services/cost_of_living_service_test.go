@@ -0,0 +1,182 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stewicca/angagrar-backend/internal/models"
+	"gorm.io/gorm"
+)
+
+type fakeCityCostRepo struct {
+	costs  []models.CityCost
+	nextID uint
+}
+
+func (r *fakeCityCostRepo) FindAll(ctx context.Context, city string) ([]models.CityCost, error) {
+	var costs []models.CityCost
+	for _, cost := range r.costs {
+		if city == "" || cost.City == city {
+			costs = append(costs, cost)
+		}
+	}
+	return costs, nil
+}
+
+func (r *fakeCityCostRepo) Find(ctx context.Context, city, lifestyle string) (*models.CityCost, error) {
+	for _, cost := range r.costs {
+		if cost.City == city && cost.Lifestyle == lifestyle {
+			copied := cost
+			return &copied, nil
+		}
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+func (r *fakeCityCostRepo) Save(ctx context.Context, cost *models.CityCost) error {
+	if cost.ID == 0 {
+		r.nextID++
+		cost.ID = r.nextID
+		r.costs = append(r.costs, *cost)
+		return nil
+	}
+	for i := range r.costs {
+		if r.costs[i].ID == cost.ID {
+			r.costs[i] = *cost
+		}
+	}
+	return nil
+}
+
+func (r *fakeCityCostRepo) Delete(ctx context.Context, id uint) error {
+	for i := range r.costs {
+		if r.costs[i].ID == id {
+			r.costs = append(r.costs[:i], r.costs[i+1:]...)
+			return nil
+		}
+	}
+	return nil
+}
+
+// newTestCostOfLiving returns a service loaded with the built-in seed
+func newTestCostOfLiving(t *testing.T) CostOfLivingService {
+	t.Helper()
+
+	seed, err := LoadCityCostSeed("")
+	if err != nil {
+		t.Fatalf("LoadCityCostSeed: %v", err)
+	}
+
+	service := NewCostOfLivingService(&fakeCityCostRepo{})
+	if _, err := service.SyncSeed(context.Background(), seed); err != nil {
+		t.Fatalf("SyncSeed: %v", err)
+	}
+
+	return service
+}
+
+func TestBaselineFallsBackToProvinceAndNation(t *testing.T) {
+	service := newTestCostOfLiving(t)
+
+	tests := []struct {
+		location string
+		source   string
+	}{
+		{"jaksel", "Jakarta Selatan"},
+		{"kab. bandung", "Jawa Barat"},
+		{"garut", "Jawa Barat"},
+		{"kota kupang", "Nusa Tenggara Timur"},
+		{"antah berantah", models.CityCostNational},
+		{"", models.CityCostNational},
+	}
+
+	for _, tt := range tests {
+		baseline, err := service.Baseline(context.Background(), tt.location, "moderate")
+		if err != nil {
+			t.Fatalf("Baseline(%q): %v", tt.location, err)
+		}
+		if baseline.Source != tt.source {
+			t.Errorf("Baseline(%q) used %s, expected %s", tt.location, baseline.Source, tt.source)
+		}
+	}
+}
+
+func TestSyncSeedKeepsAdminChanges(t *testing.T) {
+	repo := &fakeCityCostRepo{}
+	service := NewCostOfLivingService(repo)
+
+	seed, err := ParseCityCostSeed([]byte(`{"version": 1, "cities": [
+		{"city": "Bandung", "lifestyles": {"Moderate": {"rent": 1500000, "food": 1500000, "transport": 500000}}},
+		{"city": "Surabaya", "lifestyles": {"Moderate": {"rent": 1700000, "food": 1600000, "transport": 600000}}}
+	]}`))
+	if err != nil {
+		t.Fatalf("ParseCityCostSeed: %v", err)
+	}
+	if _, err := service.SyncSeed(context.Background(), seed); err != nil {
+		t.Fatalf("SyncSeed: %v", err)
+	}
+
+	if _, err := service.SetCost(context.Background(), "bdg", "moderate", CityCostAmounts{Rent: 2000000, Food: 1500000, Transport: 500000}); err != nil {
+		t.Fatalf("SetCost: %v", err)
+	}
+
+	seed.Version = 2
+	seed.Cities[0].Lifestyles["Moderate"] = CityCostAmounts{Rent: 1600000, Food: 1600000, Transport: 500000}
+	seed.Cities[1].Lifestyles["Moderate"] = CityCostAmounts{Rent: 1800000, Food: 1600000, Transport: 600000}
+
+	changed, err := service.SyncSeed(context.Background(), seed)
+	if err != nil {
+		t.Fatalf("SyncSeed: %v", err)
+	}
+	if changed != 1 {
+		t.Errorf("expected only the seeded row to change, %d changed", changed)
+	}
+
+	bandung, _ := repo.Find(context.Background(), "Bandung", "Moderate")
+	if bandung.Rent != 2000000 || bandung.Source != models.CityCostSourceAdmin {
+		t.Errorf("admin change was overwritten: %+v", bandung)
+	}
+	surabaya, _ := repo.Find(context.Background(), "Surabaya", "Moderate")
+	if surabaya.Rent != 1800000 || surabaya.SeedVersion != 2 {
+		t.Errorf("seeded row was not updated: %+v", surabaya)
+	}
+}
+
+func TestSetCostRejectsUnknownPlacesAndLifestyles(t *testing.T) {
+	service := NewCostOfLivingService(&fakeCityCostRepo{})
+	amounts := CityCostAmounts{Rent: 1000000, Food: 1000000, Transport: 300000}
+
+	if _, err := service.SetCost(context.Background(), "atlantis", "moderate", amounts); !errors.Is(err, ErrUnknownLocation) {
+		t.Errorf("expected ErrUnknownLocation, got %v", err)
+	}
+	if _, err := service.SetCost(context.Background(), "bandung", "mewah", amounts); !errors.Is(err, ErrInvalidLifestyle) {
+		t.Errorf("expected ErrInvalidLifestyle, got %v", err)
+	}
+	if err := service.DeleteCost(context.Background(), "bandung", "moderate"); !errors.Is(err, ErrCityCostNotFound) {
+		t.Errorf("expected ErrCityCostNotFound, got %v", err)
+	}
+}
+
+func TestCheckBudgetAgainstBaseline(t *testing.T) {
+	baseline := &CostBaseline{Source: "Jakarta", Lifestyle: "Moderate", Rent: 2500000, Food: 2000000, Transport: 800000}
+	data := &BudgetData{
+		Salary: 10000000,
+		Categories: []BudgetCategory{
+			{Name: "Kewajiban", Amount: 2500000},
+			{Name: "Makan", Amount: 500000},
+			{Name: "Transport", Amount: 800000},
+			{Name: "Tabungan", Amount: 6200000},
+		},
+	}
+
+	if problems := checkBudgetAgainstBaseline(data, baseline); len(problems) != 1 {
+		t.Errorf("expected one problem for Makan, got %v", problems)
+	}
+
+	// A salary below the cost of living has to cut essentials
+	data.Salary = 4000000
+	if problems := checkBudgetAgainstBaseline(data, baseline); len(problems) != 0 {
+		t.Errorf("expected no problems for a low salary, got %v", problems)
+	}
+}
@@ -0,0 +1,299 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/stewicca/angagrar-backend/internal/models"
+	"github.com/stewicca/angagrar-backend/pkg/utils"
+)
+
+// Intents a user message is classified into
+const (
+	IntentProvideInfo   = "provide_info"
+	IntentAskQuestion   = "ask_question"
+	IntentRequestBudget = "request_budget"
+	IntentCorrectInfo   = "correct_info"
+	IntentOffTopic      = "off_topic"
+)
+
+// classifierHistory is how many earlier messages the classifier sees, enough
+// to understand short answers like "iya" or "bandung"
+const classifierHistory = 6
+
+// MessageClassification is the intent of one user message and the slot values
+// it mentions. Nil slots were not mentioned.
+type MessageClassification struct {
+	Intent            string                    `json:"intent"`
+	Income            *float64                  `json:"income"`
+	City              *string                   `json:"city"`
+	Lifestyle         *string                   `json:"lifestyle"`
+	RecurringExpenses []models.RecurringExpense `json:"recurring_expenses"`
+	Goals             []string                  `json:"goals"`
+}
+
+var intentSchema = JSONSchema{
+	Name:        "message_classification",
+	Description: "Intent of the user's latest message and the budget info it contains",
+	Schema: json.RawMessage(`{
+  "type": "object",
+  "properties": {
+    "intent": {"type": "string", "enum": ["provide_info", "ask_question", "request_budget", "correct_info", "off_topic"]},
+    "income": {"type": ["number", "null"], "description": "monthly income in rupiah"},
+    "city": {"type": ["string", "null"]},
+    "lifestyle": {"type": ["string", "null"], "enum": ["minimalis", "moderate", "santai", null]},
+    "recurring_expenses": {
+      "type": ["array", "null"],
+      "items": {
+        "type": "object",
+        "properties": {
+          "name": {"type": "string"},
+          "amount": {"type": "number", "description": "monthly amount in rupiah, 0 if not mentioned"}
+        },
+        "required": ["name", "amount"],
+        "additionalProperties": false
+      }
+    },
+    "goals": {"type": ["array", "null"], "items": {"type": "string"}}
+  },
+  "required": ["intent", "income", "city", "lifestyle", "recurring_expenses", "goals"],
+  "additionalProperties": false
+}`),
+}
+
+// budgetRequestKeywords are used when the classifier is unavailable
+var budgetRequestKeywords = []string{
+	"buatin budget",
+	"bikinin budget",
+	"generate budget",
+	"buat budget",
+	"oke buatin",
+}
+
+// classifyMessage asks the LLM for the intent and slots of the latest user
+// message. If that fails it falls back to keyword matching without slots.
+func (s *conversationService) classifyMessage(ctx context.Context, conversation *models.Conversation, profile *models.FinancialProfile, messages []models.Message) MessageClassification {
+	if len(messages) > classifierHistory {
+		messages = messages[len(messages)-classifierHistory:]
+	}
+
+	raw, err := s.llm(conversation, models.LLMPurposeClassify).GenerateStructured(ctx, getIntentClassifierPrompt(profile), messages, intentSchema)
+	if err == nil {
+		var classification MessageClassification
+		if err = json.Unmarshal([]byte(extractJSONObject(raw)), &classification); err == nil && isIntent(classification.Intent) {
+			return classification
+		}
+		if err == nil {
+			err = fmt.Errorf("unknown intent %q", classification.Intent)
+		}
+	}
+
+	log.Printf("Intent classification failed, falling back to keywords: %v", err)
+
+	lower := strings.ToLower(messages[len(messages)-1].Content)
+	for _, keyword := range budgetRequestKeywords {
+		if strings.Contains(lower, keyword) {
+			return MessageClassification{Intent: IntentRequestBudget}
+		}
+	}
+	return MessageClassification{Intent: IntentProvideInfo}
+}
+
+// updateProfile stores what the latest user message says about the user's
+// finances, overwriting earlier values so corrections win. Salary, city and
+// lifestyle are parsed from the message first; the LLM's slots are the
+// fallback. It reports whether anything changed.
+func updateProfile(profile *models.FinancialProfile, message string, classification MessageClassification) bool {
+	changed := false
+
+	salary, ok := utils.ExtractSalary(message)
+	if !ok && classification.Income != nil && utils.ValidateSalary(*classification.Income) == nil {
+		salary, ok = *classification.Income, true
+	}
+	if ok && salary != profile.Salary {
+		profile.Salary = salary
+		changed = true
+	}
+
+	city, ok := utils.DetectLocation(message)
+	if !ok && classification.City != nil && strings.TrimSpace(*classification.City) != "" {
+		city, ok = utils.NormalizeLocation(*classification.City), true
+	}
+	if ok && city != profile.City {
+		profile.City = city
+		changed = true
+	}
+
+	lifestyle, ok := utils.DetectLifestyle(message)
+	if !ok && classification.Lifestyle != nil && *classification.Lifestyle != "" {
+		lifestyle, ok = utils.NormalizeLifestyle(*classification.Lifestyle), true
+	}
+	if ok && lifestyle != profile.Lifestyle {
+		profile.Lifestyle = lifestyle
+		changed = true
+	}
+
+	for _, expense := range classification.RecurringExpenses {
+		if mergeRecurringExpense(profile, expense) {
+			changed = true
+		}
+	}
+
+	for _, goal := range classification.Goals {
+		if addGoal(profile, goal) {
+			changed = true
+		}
+	}
+
+	return changed
+}
+
+// mergeRecurringExpense adds an expense or updates the amount of one with the
+// same name
+func mergeRecurringExpense(profile *models.FinancialProfile, expense models.RecurringExpense) bool {
+	expense.Name = strings.TrimSpace(expense.Name)
+	if expense.Name == "" || expense.Amount < 0 {
+		return false
+	}
+
+	for i, existing := range profile.RecurringExpenses {
+		if strings.EqualFold(existing.Name, expense.Name) {
+			if expense.Amount == 0 || expense.Amount == existing.Amount {
+				return false
+			}
+			profile.RecurringExpenses[i].Amount = expense.Amount
+			return true
+		}
+	}
+
+	profile.RecurringExpenses = append(profile.RecurringExpenses, expense)
+	return true
+}
+
+func addGoal(profile *models.FinancialProfile, goal string) bool {
+	goal = strings.TrimSpace(goal)
+	if goal == "" {
+		return false
+	}
+
+	for _, existing := range profile.Goals {
+		if strings.EqualFold(existing, goal) {
+			return false
+		}
+	}
+
+	profile.Goals = append(profile.Goals, goal)
+	return true
+}
+
+// missingSlots lists the info still needed before a budget can be generated
+func missingSlots(profile *models.FinancialProfile) []string {
+	var missing []string
+	if profile.Salary <= 0 {
+		missing = append(missing, "gaji/income bulanan")
+	}
+	if profile.City == "" {
+		missing = append(missing, "kota tempat tinggal")
+	}
+	if profile.Lifestyle == "" {
+		missing = append(missing, "lifestyle (hemat, moderate, atau santai)")
+	}
+	return missing
+}
+
+func isIntent(intent string) bool {
+	switch intent {
+	case IntentProvideInfo, IntentAskQuestion, IntentRequestBudget, IntentCorrectInfo, IntentOffTopic:
+		return true
+	}
+	return false
+}
+
+// extractJSONObject trims text some providers put around a JSON object
+func extractJSONObject(raw string) string {
+	start := strings.Index(raw, "{")
+	end := strings.LastIndex(raw, "}") + 1
+	if start == -1 || end <= start {
+		return raw
+	}
+	return raw[start:end]
+}
+
+func getIntentClassifierPrompt(profile *models.FinancialProfile) string {
+	return fmt.Sprintf(`Kamu adalah intent classifier untuk Aira, asisten budget. Klasifikasikan pesan TERAKHIR dari user.
+
+INTENT:
+- provide_info: user cerita info keuangan (gaji, kota, lifestyle, pengeluaran, goals)
+- ask_question: user nanya sesuatu ke Aira
+- request_budget: user minta dibikinin budget sekarang
+- correct_info: user meralat info yang sebelumnya dia kasih
+- off_topic: di luar topik keuangan
+
+INFO YANG SUDAH DIKETAHUI:
+%s
+
+SLOT (isi hanya dari pesan terakhir user, null kalau tidak disebut):
+- income: gaji/pemasukan bulanan dalam rupiah, angka penuh ("8 juta" = 8000000)
+- city: kota tempat tinggal
+- lifestyle: "minimalis" (hemat), "moderate", atau "santai" (suka healing, jarang nabung)
+- recurring_expenses: pengeluaran rutin bulanan, misal [{"name": "kos", "amount": 1500000}]
+- goals: tujuan keuangan, misal ["dana darurat", "DP rumah"]
+
+Return ONLY valid JSON: {"intent": ..., "income": ..., "city": ..., "lifestyle": ..., "recurring_expenses": ..., "goals": ...}`,
+		describeProfile(profile))
+}
+
+// getTurnGuidance steers Aira's next reply based on the classified message
+func getTurnGuidance(intent string, missing []string) string {
+	var guidance []string
+
+	if len(missing) > 0 {
+		guidance = append(guidance, "INFO YANG BELUM ADA: "+strings.Join(missing, ", "))
+		if intent == IntentRequestBudget {
+			guidance = append(guidance, "User minta dibikinin budget, tapi info di atas belum lengkap. Bilang singkat dan tanya info yang kurang.")
+		}
+	} else {
+		guidance = append(guidance, "Gaji, kota, dan lifestyle user udah lengkap. Tawarkan untuk bikinin budget.")
+	}
+
+	if intent == IntentOffTopic {
+		guidance = append(guidance, "Pesan terakhir user di luar topik keuangan. Jawab singkat lalu arahkan balik ke obrolan budget.")
+	}
+
+	return "\n\nCATATAN UNTUK BALASAN BERIKUTNYA:\n- " + strings.Join(guidance, "\n- ")
+}
+
+// describeProfile renders the profile for prompts
+func describeProfile(profile *models.FinancialProfile) string {
+	known := func(value string) string {
+		if value == "" {
+			return "belum diketahui"
+		}
+		return value
+	}
+
+	salary := ""
+	if profile.Salary > 0 {
+		salary = fmt.Sprintf("Rp %.0f", profile.Salary)
+	}
+
+	expenses := make([]string, 0, len(profile.RecurringExpenses))
+	for _, expense := range profile.RecurringExpenses {
+		if expense.Amount > 0 {
+			expenses = append(expenses, fmt.Sprintf("%s Rp %.0f", expense.Name, expense.Amount))
+		} else {
+			expenses = append(expenses, expense.Name)
+		}
+	}
+
+	return fmt.Sprintf(`- Gaji bulanan: %s
+- Kota: %s
+- Lifestyle: %s
+- Pengeluaran rutin: %s
+- Goals: %s`,
+		known(salary), known(profile.City), known(profile.Lifestyle),
+		known(strings.Join(expenses, ", ")), known(strings.Join(profile.Goals, ", ")))
+}
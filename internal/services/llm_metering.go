@@ -0,0 +1,114 @@
+package services
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/stewicca/angagrar-backend/internal/models"
+)
+
+// TokenUsage is what the provider reports one call used
+type TokenUsage struct {
+	Model            string
+	PromptTokens     int
+	CompletionTokens int
+}
+
+// usageReporter is implemented by providers that know the token usage of
+// their calls. The returned copy of the provider passes it to onUsage after
+// every call.
+type usageReporter interface {
+	reportingUsage(onUsage func(TokenUsage)) LLMService
+}
+
+// meteredLLM records every call it makes in the name of a user
+type meteredLLM struct {
+	llm            LLMService
+	usage          *usageService
+	userID         uint
+	conversationID *uint
+	purpose        string
+}
+
+func (m *meteredLLM) GenerateResponse(ctx context.Context, systemPrompt string, messages []models.Message) (string, error) {
+	var reply string
+	var err error
+	m.measure(ctx, systemPrompt, messages, func(llm LLMService) (string, error) {
+		reply, err = llm.GenerateResponse(ctx, systemPrompt, messages)
+		return reply, err
+	})
+	return reply, err
+}
+
+// GenerateResponseWithRetry records every attempt, since each one is paid for
+func (m *meteredLLM) GenerateResponseWithRetry(ctx context.Context, systemPrompt string, messages []models.Message, maxRetries int) (string, error) {
+	return generateWithRetry(ctx, m, systemPrompt, messages, maxRetries)
+}
+
+func (m *meteredLLM) GenerateStructured(ctx context.Context, systemPrompt string, messages []models.Message, schema JSONSchema) (string, error) {
+	var reply string
+	var err error
+	m.measure(ctx, systemPrompt, messages, func(llm LLMService) (string, error) {
+		reply, err = llm.GenerateStructured(ctx, systemPrompt, messages, schema)
+		return reply, err
+	})
+	return reply, err
+}
+
+func (m *meteredLLM) StreamResponse(ctx context.Context, systemPrompt string, messages []models.Message, onDelta func(delta string) error) (string, error) {
+	var reply string
+	var err error
+	m.measure(ctx, systemPrompt, messages, func(llm LLMService) (string, error) {
+		reply, err = llm.StreamResponse(ctx, systemPrompt, messages, onDelta)
+		return reply, err
+	})
+	return reply, err
+}
+
+// measure runs call and records its usage. A failed call is still recorded
+// when the provider reported tokens for it or part of a reply arrived, since
+// it is billed; only calls that failed with nothing reported and nothing
+// returned are skipped.
+func (m *meteredLLM) measure(ctx context.Context, systemPrompt string, messages []models.Message, call func(llm LLMService) (string, error)) {
+	var reported *TokenUsage
+	llm := m.llm
+	if reporter, ok := llm.(usageReporter); ok {
+		llm = reporter.reportingUsage(func(usage TokenUsage) {
+			reported = &usage
+		})
+	}
+
+	start := time.Now()
+	reply, err := call(llm)
+	latency := time.Since(start)
+
+	hasReport := reported != nil && reported.PromptTokens+reported.CompletionTokens > 0
+	if err != nil && reply == "" && !hasReport {
+		return
+	}
+
+	record := &models.LLMUsage{
+		UserID:         m.userID,
+		ConversationID: m.conversationID,
+		Purpose:        m.purpose,
+		Model:          m.usage.model,
+		LatencyMs:      latency.Milliseconds(),
+	}
+	if hasReport {
+		if reported.Model != "" {
+			record.Model = reported.Model
+		}
+		record.PromptTokens = reported.PromptTokens
+		record.CompletionTokens = reported.CompletionTokens
+	} else {
+		record.PromptTokens = m.usage.counter.CountPrompt(systemPrompt, messages)
+		record.CompletionTokens = m.usage.counter.Count(reply)
+		record.Estimated = true
+	}
+
+	// The call is paid for even when the client went away meanwhile
+	if err := m.usage.Record(context.WithoutCancel(ctx), record); err != nil {
+		log.Printf("Failed to record LLM usage: %v", err)
+	}
+}
@@ -0,0 +1,111 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/stewicca/angagrar-backend/config"
+	"github.com/stewicca/angagrar-backend/internal/models"
+)
+
+const (
+	LLMProviderOpenAI           = "openai"
+	LLMProviderOpenAICompatible = "openai_compatible"
+	LLMProviderAnthropic        = "anthropic"
+	LLMProviderScripted         = "scripted"
+)
+
+// LLMService is a chat model backend. Messages are the conversation so far,
+// without the system prompt. Calls and retries stop once ctx is done.
+type LLMService interface {
+	GenerateResponse(ctx context.Context, systemPrompt string, messages []models.Message) (string, error)
+	GenerateResponseWithRetry(ctx context.Context, systemPrompt string, messages []models.Message, maxRetries int) (string, error)
+	StreamResponse(ctx context.Context, systemPrompt string, messages []models.Message, onDelta func(delta string) error) (string, error)
+	// GenerateStructured asks for a JSON object matching schema, using the
+	// provider's structured output or tool calling, and returns it raw
+	GenerateStructured(ctx context.Context, systemPrompt string, messages []models.Message, schema JSONSchema) (string, error)
+}
+
+// JSONSchema describes the JSON object a structured response must match
+type JSONSchema struct {
+	Name        string
+	Description string
+	Schema      json.RawMessage
+}
+
+// streamTimeout bounds a whole streamed completion; tokens keep arriving, so
+// it is longer than the timeout for a single blocking call
+const streamTimeout = 2 * time.Minute
+
+// NewLLMService builds the provider selected by LLM_PROVIDER
+func NewLLMService(cfg *config.Config) (LLMService, error) {
+	switch cfg.LLMProvider {
+	case LLMProviderOpenAI:
+		return NewOpenAIService(cfg.OpenAIAPIKey, cfg.OpenAIBaseURL, cfg.OpenAIModel, cfg.LLMMaxTokens, cfg.LLMTemperature), nil
+
+	case LLMProviderOpenAICompatible:
+		if cfg.OpenAIBaseURL == "" {
+			return nil, fmt.Errorf("OPENAI_BASE_URL is required for the %s provider", LLMProviderOpenAICompatible)
+		}
+		return NewOpenAIService(cfg.OpenAIAPIKey, cfg.OpenAIBaseURL, cfg.OpenAIModel, cfg.LLMMaxTokens, cfg.LLMTemperature), nil
+
+	case LLMProviderAnthropic:
+		if cfg.AnthropicAPIKey == "" {
+			return nil, fmt.Errorf("ANTHROPIC_API_KEY is required for the %s provider", LLMProviderAnthropic)
+		}
+		return NewAnthropicService(cfg.AnthropicAPIKey, cfg.AnthropicBaseURL, cfg.AnthropicModel, cfg.LLMMaxTokens, cfg.LLMTemperature), nil
+
+	case LLMProviderScripted:
+		if cfg.LLMScriptFile == "" {
+			return NewScriptedLLMService(nil), nil
+		}
+		rules, err := LoadScriptRules(cfg.LLMScriptFile)
+		if err != nil {
+			return nil, err
+		}
+		return NewScriptedLLMService(rules), nil
+
+	default:
+		return nil, fmt.Errorf("unknown LLM_PROVIDER %q", cfg.LLMProvider)
+	}
+}
+
+// generateWithRetry attempts to generate response with exponential backoff retry,
+// and stops as soon as ctx is done
+func generateWithRetry(ctx context.Context, llm LLMService, systemPrompt string, messages []models.Message, maxRetries int) (string, error) {
+	var lastErr error
+
+	for attempt := 0; attempt < maxRetries; attempt++ {
+		response, err := llm.GenerateResponse(ctx, systemPrompt, messages)
+		if err == nil {
+			return response, nil
+		}
+
+		lastErr = err
+
+		// Exponential backoff: 1s, 2s, 4s
+		if attempt < maxRetries-1 {
+			backoff := time.Duration(1<<uint(attempt)) * time.Second
+			if err := sleep(ctx, backoff); err != nil {
+				return "", err
+			}
+		}
+	}
+
+	return "", fmt.Errorf("failed after %d retries: %w", maxRetries, lastErr)
+}
+
+// sleep waits for d, or returns ctx's error when ctx is done first
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
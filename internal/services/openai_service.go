@@ -2,102 +2,187 @@ package services
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
+	"strings"
 	"time"
 
 	"github.com/sashabaranov/go-openai"
-	"github.com/stewicca/angagrar-backend/config"
 	"github.com/stewicca/angagrar-backend/internal/models"
 )
 
-type OpenAIService interface {
-	GenerateResponse(systemPrompt string, messages []models.Message) (string, error)
-	GenerateResponseWithRetry(systemPrompt string, messages []models.Message, maxRetries int) (string, error)
-}
-
 type openAIService struct {
 	client      *openai.Client
 	model       string
 	maxTokens   int
 	temperature float32
+	onUsage     func(TokenUsage)
 }
 
-func NewOpenAIService(cfg *config.Config) OpenAIService {
-	client := openai.NewClient(cfg.OpenAIAPIKey)
+// NewOpenAIService talks to OpenAI, or to any server with an OpenAI-compatible
+// chat completion API when baseURL is set. Local servers usually take any key.
+func NewOpenAIService(apiKey, baseURL, model string, maxTokens int, temperature float32) LLMService {
+	clientConfig := openai.DefaultConfig(apiKey)
+	if baseURL != "" {
+		clientConfig.BaseURL = strings.TrimSuffix(baseURL, "/")
+	}
 
 	return &openAIService{
-		client:      client,
-		model:       cfg.OpenAIModel,
-		maxTokens:   cfg.OpenAIMaxTokens,
-		temperature: cfg.OpenAITemp,
+		client:      openai.NewClientWithConfig(clientConfig),
+		model:       model,
+		maxTokens:   maxTokens,
+		temperature: temperature,
 	}
 }
 
 // GenerateResponse calls OpenAI API to generate a response
-func (s *openAIService) GenerateResponse(systemPrompt string, messages []models.Message) (string, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+func (s *openAIService) GenerateResponse(ctx context.Context, systemPrompt string, messages []models.Message) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
 	defer cancel()
 
-	// Convert messages to OpenAI format
-	chatMessages := []openai.ChatCompletionMessage{
-		{
-			Role:    openai.ChatMessageRoleSystem,
-			Content: systemPrompt,
-		},
+	req := s.buildRequest(systemPrompt, messages)
+
+	// Call OpenAI API
+	resp, err := s.client.CreateChatCompletion(ctx, req)
+	if err != nil {
+		return "", fmt.Errorf("OpenAI API error: %w", err)
 	}
 
-	// Add conversation history
-	for _, msg := range messages {
-		role := openai.ChatMessageRoleUser
-		if msg.Role == models.RoleAssistant {
-			role = openai.ChatMessageRoleAssistant
-		}
+	s.reportUsage(resp.Model, resp.Usage)
 
-		chatMessages = append(chatMessages, openai.ChatCompletionMessage{
-			Role:    role,
-			Content: msg.Content,
-		})
+	if len(resp.Choices) == 0 {
+		return "", fmt.Errorf("no response from OpenAI")
 	}
 
-	// Create chat completion request
-	req := openai.ChatCompletionRequest{
-		Model:       s.model,
-		Messages:    chatMessages,
-		MaxTokens:   s.maxTokens,
-		Temperature: s.temperature,
+	return resp.Choices[0].Message.Content, nil
+}
+
+// GenerateStructured uses OpenAI structured outputs so the reply is a JSON
+// object matching schema
+func (s *openAIService) GenerateStructured(ctx context.Context, systemPrompt string, messages []models.Message, schema JSONSchema) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	req := s.buildRequest(systemPrompt, messages)
+	req.ResponseFormat = &openai.ChatCompletionResponseFormat{
+		Type: openai.ChatCompletionResponseFormatTypeJSONSchema,
+		JSONSchema: &openai.ChatCompletionResponseFormatJSONSchema{
+			Name:        schema.Name,
+			Description: schema.Description,
+			Schema:      schema.Schema,
+			Strict:      true,
+		},
 	}
 
-	// Call OpenAI API
 	resp, err := s.client.CreateChatCompletion(ctx, req)
 	if err != nil {
 		return "", fmt.Errorf("OpenAI API error: %w", err)
 	}
 
+	s.reportUsage(resp.Model, resp.Usage)
+
 	if len(resp.Choices) == 0 {
 		return "", fmt.Errorf("no response from OpenAI")
 	}
 
+	if refusal := resp.Choices[0].Message.Refusal; refusal != "" {
+		return "", fmt.Errorf("OpenAI refused: %s", refusal)
+	}
+
 	return resp.Choices[0].Message.Content, nil
 }
 
-// GenerateResponseWithRetry attempts to generate response with exponential backoff retry
-func (s *openAIService) GenerateResponseWithRetry(systemPrompt string, messages []models.Message, maxRetries int) (string, error) {
-	var lastErr error
+func (s *openAIService) GenerateResponseWithRetry(ctx context.Context, systemPrompt string, messages []models.Message, maxRetries int) (string, error) {
+	return generateWithRetry(ctx, s, systemPrompt, messages, maxRetries)
+}
+
+// StreamResponse streams a completion and passes every token delta to
+// onDelta. The text received so far is returned even when the stream breaks
+// off, the context is cancelled or onDelta fails.
+func (s *openAIService) StreamResponse(ctx context.Context, systemPrompt string, messages []models.Message, onDelta func(delta string) error) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, streamTimeout)
+	defer cancel()
+
+	// The last chunk carries the usage of the whole stream
+	req := s.buildRequest(systemPrompt, messages)
+	req.StreamOptions = &openai.StreamOptions{IncludeUsage: true}
+
+	stream, err := s.client.CreateChatCompletionStream(ctx, req)
+	if err != nil {
+		return "", fmt.Errorf("OpenAI API error: %w", err)
+	}
+	defer stream.Close()
 
-	for attempt := 0; attempt < maxRetries; attempt++ {
-		response, err := s.GenerateResponse(systemPrompt, messages)
-		if err == nil {
-			return response, nil
+	var content strings.Builder
+	for {
+		resp, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			return content.String(), nil
+		}
+		if err != nil {
+			return content.String(), fmt.Errorf("OpenAI stream error: %w", err)
 		}
 
-		lastErr = err
+		if resp.Usage != nil {
+			s.reportUsage(resp.Model, *resp.Usage)
+		}
 
-		// Exponential backoff: 1s, 2s, 4s
-		if attempt < maxRetries-1 {
-			backoff := time.Duration(1<<uint(attempt)) * time.Second
-			time.Sleep(backoff)
+		if len(resp.Choices) == 0 || resp.Choices[0].Delta.Content == "" {
+			continue
+		}
+
+		delta := resp.Choices[0].Delta.Content
+		content.WriteString(delta)
+		if err := onDelta(delta); err != nil {
+			return content.String(), err
 		}
 	}
+}
 
-	return "", fmt.Errorf("failed after %d retries: %w", maxRetries, lastErr)
+func (s *openAIService) reportingUsage(onUsage func(TokenUsage)) LLMService {
+	reporting := *s
+	reporting.onUsage = onUsage
+	return &reporting
+}
+
+func (s *openAIService) reportUsage(model string, usage openai.Usage) {
+	if s.onUsage == nil {
+		return
+	}
+	s.onUsage(TokenUsage{
+		Model:            model,
+		PromptTokens:     usage.PromptTokens,
+		CompletionTokens: usage.CompletionTokens,
+	})
+}
+
+// buildRequest converts the conversation to an OpenAI chat completion request
+func (s *openAIService) buildRequest(systemPrompt string, messages []models.Message) openai.ChatCompletionRequest {
+	chatMessages := []openai.ChatCompletionMessage{
+		{
+			Role:    openai.ChatMessageRoleSystem,
+			Content: systemPrompt,
+		},
+	}
+
+	// Add conversation history
+	for _, msg := range messages {
+		role := openai.ChatMessageRoleUser
+		if msg.Role == models.RoleAssistant {
+			role = openai.ChatMessageRoleAssistant
+		}
+
+		chatMessages = append(chatMessages, openai.ChatCompletionMessage{
+			Role:    role,
+			Content: msg.Content,
+		})
+	}
+
+	return openai.ChatCompletionRequest{
+		Model:       s.model,
+		Messages:    chatMessages,
+		MaxTokens:   s.maxTokens,
+		Temperature: s.temperature,
+	}
 }
@@ -0,0 +1,127 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/stewicca/angagrar-backend/internal/models"
+)
+
+// ScriptRule answers every prompt whose system prompt or latest message
+// contains Match (case-insensitive). An empty Match answers everything.
+type ScriptRule struct {
+	Match string `json:"match"`
+	Reply string `json:"reply"`
+}
+
+// defaultScript lets the app run without any LLM: Aira chats with a fixed
+// reply, every message counts as a budget request with all info known, and
+// the budget analysis returns a fixed 5 juta budget
+var defaultScript = []ScriptRule{
+	{
+		Match: "AI budget analyst",
+		Reply: `{
+  "salary": 5000000,
+  "location": "Jakarta",
+  "analysis": "budget contoh dari scripted LLM, bukan hasil analisa beneran",
+  "categories": [
+    {"name": "Kewajiban", "amount": 1500000, "description": "sewa, utilities, cicilan"},
+    {"name": "Makan", "amount": 1250000, "description": "makanan sehari-hari"},
+    {"name": "Transport", "amount": 500000, "description": "transportasi"},
+    {"name": "Healing", "amount": 500000, "description": "hiburan, self-care"},
+    {"name": "Tabungan", "amount": 1000000, "description": "tabungan & investasi"},
+    {"name": "Lain-lain", "amount": 250000, "description": "pengeluaran lain"}
+  ]
+}`,
+	},
+	{
+		Match: "intent classifier",
+		Reply: `{"intent": "request_budget", "income": 5000000, "city": "Jakarta", "lifestyle": "moderate"}`,
+	},
+	{
+		Reply: "oke noted! 👋 cerita lagi dong soal gaji, kota, sama kebiasaan belanja kamu, nanti bilang aja \"buatin budget\" kalau udah siap.",
+	},
+}
+
+type scriptedLLMService struct {
+	rules []ScriptRule
+}
+
+// NewScriptedLLMService returns a deterministic, offline LLM for development
+// and tests. Nil rules use the built-in script.
+func NewScriptedLLMService(rules []ScriptRule) LLMService {
+	if rules == nil {
+		rules = defaultScript
+	}
+	return &scriptedLLMService{rules: rules}
+}
+
+// LoadScriptRules reads a JSON array of rules
+func LoadScriptRules(path string) ([]ScriptRule, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read LLM script: %w", err)
+	}
+
+	var rules []ScriptRule
+	if err := json.Unmarshal(raw, &rules); err != nil {
+		return nil, fmt.Errorf("invalid LLM script %s: %w", path, err)
+	}
+
+	return rules, nil
+}
+
+func (s *scriptedLLMService) GenerateResponse(ctx context.Context, systemPrompt string, messages []models.Message) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+
+	prompt := strings.ToLower(systemPrompt)
+	if len(messages) > 0 {
+		prompt += "\n" + strings.ToLower(messages[len(messages)-1].Content)
+	}
+
+	for _, rule := range s.rules {
+		if strings.Contains(prompt, strings.ToLower(rule.Match)) {
+			return rule.Reply, nil
+		}
+	}
+
+	return "", fmt.Errorf("no scripted reply matches the prompt")
+}
+
+func (s *scriptedLLMService) GenerateResponseWithRetry(ctx context.Context, systemPrompt string, messages []models.Message, maxRetries int) (string, error) {
+	// Retrying gives the same answer
+	return s.GenerateResponse(ctx, systemPrompt, messages)
+}
+
+// GenerateStructured returns the scripted reply as is; scripts for structured
+// prompts should hold the JSON object
+func (s *scriptedLLMService) GenerateStructured(ctx context.Context, systemPrompt string, messages []models.Message, schema JSONSchema) (string, error) {
+	return s.GenerateResponse(ctx, systemPrompt, messages)
+}
+
+// StreamResponse sends the reply word by word
+func (s *scriptedLLMService) StreamResponse(ctx context.Context, systemPrompt string, messages []models.Message, onDelta func(delta string) error) (string, error) {
+	reply, err := s.GenerateResponse(ctx, systemPrompt, messages)
+	if err != nil {
+		return "", err
+	}
+
+	var content strings.Builder
+	for _, word := range strings.SplitAfter(reply, " ") {
+		if err := ctx.Err(); err != nil {
+			return content.String(), err
+		}
+
+		content.WriteString(word)
+		if err := onDelta(word); err != nil {
+			return content.String(), err
+		}
+	}
+
+	return content.String(), nil
+}
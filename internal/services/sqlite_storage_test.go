@@ -0,0 +1,166 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stewicca/angagrar-backend/config"
+	"github.com/stewicca/angagrar-backend/internal/database"
+	"github.com/stewicca/angagrar-backend/internal/models"
+	"github.com/stewicca/angagrar-backend/internal/repositories"
+	"gorm.io/gorm"
+)
+
+// newSQLiteRepositories migrates a fresh in-memory SQLite database
+func newSQLiteRepositories(t *testing.T) (repositories.Repositories, repositories.UnitOfWork) {
+	t.Helper()
+
+	db, err := database.Open(&config.Config{DBDriver: database.DriverSQLite, DBPath: database.SQLiteMemory})
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+
+	migrator, err := database.NewMigrator(db)
+	if err != nil {
+		t.Fatalf("NewMigrator: %v", err)
+	}
+	if _, err := migrator.Up(context.Background()); err != nil {
+		t.Fatalf("migrate up: %v", err)
+	}
+
+	return repositories.Repositories{
+		Users:             repositories.NewUserRepository(db),
+		RefreshTokens:     repositories.NewRefreshTokenRepository(db),
+		RevokedTokens:     repositories.NewRevokedTokenRepository(db),
+		Transactions:      repositories.NewTransactionRepository(db),
+		Budgets:           repositories.NewBudgetRepository(db),
+		BudgetAdjustments: repositories.NewBudgetAdjustmentRepository(db),
+		Conversations:     repositories.NewConversationRepository(db),
+		Messages:          repositories.NewMessageRepository(db),
+		Profiles:          repositories.NewFinancialProfileRepository(db),
+		CityCosts:         repositories.NewCityCostRepository(db),
+		LLMUsage:          repositories.NewLLMUsageRepository(db),
+	}, repositories.NewUnitOfWork(db)
+}
+
+func TestConversationFlowOnSQLite(t *testing.T) {
+	ctx := context.Background()
+	repos, uow := newSQLiteRepositories(t)
+
+	user := &models.User{GuestID: uuid.NewString()}
+	if err := repos.Users.Create(ctx, user); err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+
+	costOfLiving := NewCostOfLivingService(repos.CityCosts)
+	seed, err := LoadCityCostSeed("")
+	if err != nil {
+		t.Fatalf("LoadCityCostSeed: %v", err)
+	}
+	if _, err := costOfLiving.SyncSeed(ctx, seed); err != nil {
+		t.Fatalf("SyncSeed: %v", err)
+	}
+
+	calendar, err := NewBudgetCalendar(time.UTC, nil)
+	if err != nil {
+		t.Fatalf("NewBudgetCalendar: %v", err)
+	}
+	usage := NewUsageService(repos.LLMUsage, repos.Users, nil, nil, LLMProviderScripted)
+	service := NewConversationService(repos.Conversations, repos.Messages, repos.Budgets, repos.Users, repos.Profiles, uow, calendar, costOfLiving,
+		NewContextWindow(NewTokenCounter(LLMProviderScripted), 0, 8), usage, NewScriptedLLMService(nil))
+
+	conversation, _, err := service.StartConversation(ctx, user.ID, "")
+	if err != nil {
+		t.Fatalf("StartConversation: %v", err)
+	}
+
+	_, completed, budgets, err := service.ProcessMessage(ctx, user.ID, conversation.SessionID, "buatin budget")
+	if err != nil {
+		t.Fatalf("ProcessMessage: %v", err)
+	}
+	if !completed || len(budgets) == 0 {
+		t.Fatalf("expected the budget to be generated, got completed=%v and %d budgets", completed, len(budgets))
+	}
+
+	saved, err := repos.Budgets.FindActiveByUserID(ctx, user.ID, time.Now())
+	if err != nil {
+		t.Fatalf("FindActiveByUserID: %v", err)
+	}
+	if len(saved) != len(budgets) {
+		t.Errorf("expected %d active budgets, got %d", len(budgets), len(saved))
+	}
+
+	history, err := service.GetConversationHistory(ctx, user.ID, conversation.SessionID)
+	if err != nil {
+		t.Fatalf("GetConversationHistory: %v", err)
+	}
+	if len(history) != 3 {
+		t.Errorf("expected 3 messages, got %d", len(history))
+	}
+
+	// A second request cannot complete the conversation again
+	if ok, err := repos.Conversations.MarkBudgetGenerated(ctx, conversation.ID, time.Now()); err != nil || ok {
+		t.Errorf("expected the completed conversation to stay as is, got %v, %v", ok, err)
+	}
+
+	report, err := usage.DailySpend(ctx, time.Now().AddDate(0, 0, -1), time.Now())
+	if err != nil {
+		t.Fatalf("DailySpend: %v", err)
+	}
+	if report.Calls == 0 || len(report.Days) == 0 {
+		t.Errorf("expected the LLM calls to be metered, got %+v", report)
+	}
+}
+
+// racingConversationRepo never sees an active interview, like a request that
+// checked while a concurrent one was still creating its interview
+type racingConversationRepo struct {
+	repositories.ConversationRepository
+}
+
+func (r racingConversationRepo) FindActiveByUserID(ctx context.Context, userID uint, topic string) (*models.Conversation, error) {
+	return nil, gorm.ErrRecordNotFound
+}
+
+func TestConcurrentBudgetInterviewsOnSQLite(t *testing.T) {
+	ctx := context.Background()
+	repos, uow := newSQLiteRepositories(t)
+
+	user := &models.User{GuestID: uuid.NewString()}
+	if err := repos.Users.Create(ctx, user); err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	calendar, err := NewBudgetCalendar(time.UTC, nil)
+	if err != nil {
+		t.Fatalf("NewBudgetCalendar: %v", err)
+	}
+	usage := NewUsageService(repos.LLMUsage, repos.Users, nil, nil, LLMProviderScripted)
+	service := NewConversationService(racingConversationRepo{repos.Conversations}, repos.Messages, repos.Budgets, repos.Users, repos.Profiles, uow, calendar,
+		NewCostOfLivingService(repos.CityCosts), NewContextWindow(NewTokenCounter(LLMProviderScripted), 0, 8), usage, NewScriptedLLMService(nil))
+
+	first, _, err := service.StartConversation(ctx, user.ID, models.ConversationTopicBudget)
+	if err != nil {
+		t.Fatalf("StartConversation: %v", err)
+	}
+	if _, _, err := service.StartConversation(ctx, user.ID, models.ConversationTopicBudget); !errors.Is(err, ErrBudgetInterviewActive) {
+		t.Fatalf("expected ErrBudgetInterviewActive past the check, got %v", err)
+	}
+
+	if _, err := service.ArchiveConversation(ctx, user.ID, first.SessionID); err != nil {
+		t.Fatalf("ArchiveConversation: %v", err)
+	}
+	if _, _, err := service.StartConversation(ctx, user.ID, models.ConversationTopicBudget); err != nil {
+		t.Fatalf("StartConversation: %v", err)
+	}
+	if _, err := service.UnarchiveConversation(ctx, user.ID, first.SessionID); !errors.Is(err, ErrBudgetInterviewActive) {
+		t.Errorf("expected ErrBudgetInterviewActive unarchiving past the check, got %v", err)
+	}
+}
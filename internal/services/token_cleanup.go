@@ -0,0 +1,59 @@
+package services
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// revokedTokenCleanupInterval is how often expired access tokens are dropped
+// from the denylist
+const revokedTokenCleanupInterval = time.Hour
+
+// RevokedTokenCleanup keeps the revoked token denylist, which the auth
+// middleware queries on every request, down to tokens that are still valid
+type RevokedTokenCleanup struct {
+	authService AuthService
+	ctx         context.Context
+	cancel      context.CancelFunc
+	done        chan struct{}
+}
+
+func NewRevokedTokenCleanup(authService AuthService) *RevokedTokenCleanup {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &RevokedTokenCleanup{
+		authService: authService,
+		ctx:         ctx,
+		cancel:      cancel,
+		done:        make(chan struct{}),
+	}
+}
+
+func (c *RevokedTokenCleanup) Start() {
+	go c.run()
+}
+
+// Stop cancels a running cleanup and waits for it to return
+func (c *RevokedTokenCleanup) Stop() {
+	c.cancel()
+	<-c.done
+}
+
+func (c *RevokedTokenCleanup) run() {
+	defer close(c.done)
+
+	ticker := time.NewTicker(revokedTokenCleanupInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := c.authService.PurgeRevokedTokens(c.ctx, time.Now()); err != nil && c.ctx.Err() == nil {
+			log.Printf("Revoked token cleanup failed: %v", err)
+		}
+
+		select {
+		case <-c.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package services
+
+import (
+	"math"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/stewicca/angagrar-backend/config"
+	"github.com/stewicca/angagrar-backend/internal/models"
+)
+
+// tokenizerProfile is how densely a model family's tokenizer packs casual
+// Indonesian chat text
+type tokenizerProfile struct {
+	modelPrefix   string
+	charsPerToken float64
+	perMessage    int // role markers and separators around every message
+}
+
+// tokenizerProfiles are matched by model name prefix, first match wins. The
+// ratios are rounded down so estimates err on the high side.
+var tokenizerProfiles = []tokenizerProfile{
+	{modelPrefix: "gpt-4o", charsPerToken: 3.6, perMessage: 4},
+	{modelPrefix: "gpt-4.1", charsPerToken: 3.6, perMessage: 4},
+	{modelPrefix: "o1", charsPerToken: 3.6, perMessage: 4},
+	{modelPrefix: "o3", charsPerToken: 3.6, perMessage: 4},
+	{modelPrefix: "o4", charsPerToken: 3.6, perMessage: 4},
+	{modelPrefix: "gpt-4", charsPerToken: 3.2, perMessage: 4},
+	{modelPrefix: "gpt-3.5", charsPerToken: 3.2, perMessage: 4},
+	{modelPrefix: "claude", charsPerToken: 3.0, perMessage: 5},
+}
+
+// defaultTokenizerProfile covers local and unknown models, whose tokenizers
+// are often less efficient on Indonesian
+var defaultTokenizerProfile = tokenizerProfile{charsPerToken: 2.8, perMessage: 5}
+
+// TokenCounter estimates how many prompt tokens a model needs. Providers do
+// not ship their tokenizers for Go, so counts come from per-model character
+// ratios; characters outside ASCII, like emoji, count as a token each.
+type TokenCounter struct {
+	profile tokenizerProfile
+}
+
+func NewTokenCounter(model string) *TokenCounter {
+	model = strings.ToLower(model)
+	for _, profile := range tokenizerProfiles {
+		if strings.HasPrefix(model, profile.modelPrefix) {
+			return &TokenCounter{profile: profile}
+		}
+	}
+	return &TokenCounter{profile: defaultTokenizerProfile}
+}
+
+// LLMModel returns the model name of the configured LLM provider
+func LLMModel(cfg *config.Config) string {
+	switch cfg.LLMProvider {
+	case LLMProviderAnthropic:
+		return cfg.AnthropicModel
+	case LLMProviderScripted:
+		return LLMProviderScripted
+	default:
+		return cfg.OpenAIModel
+	}
+}
+
+// Count estimates the tokens of text
+func (c *TokenCounter) Count(text string) int {
+	ascii, other := 0, 0
+	for _, r := range text {
+		if r < utf8.RuneSelf {
+			ascii++
+		} else {
+			other++
+		}
+	}
+	return int(math.Ceil(float64(ascii)/c.profile.charsPerToken)) + other
+}
+
+// CountPrompt estimates the tokens of a request: the system prompt and
+// every message with its overhead
+func (c *TokenCounter) CountPrompt(systemPrompt string, messages []models.Message) int {
+	total := c.Count(systemPrompt) + c.profile.perMessage
+	for _, msg := range messages {
+		total += c.Count(msg.Content) + c.profile.perMessage
+	}
+	return total
+}
@@ -1,33 +1,102 @@
 package services
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
 	"errors"
+	"strings"
 	"time"
 
 	"github.com/stewicca/angagrar-backend/internal/models"
 	"github.com/stewicca/angagrar-backend/internal/repositories"
+	"gorm.io/gorm"
 )
 
+const (
+	DefaultTransactionPageSize = 50
+	MaxTransactionPageSize     = 200
+)
+
+var (
+	ErrTransactionNotFound      = errors.New("transaction not found")
+	ErrInvalidTransactionAmount = errors.New("amount must be greater than 0")
+	ErrInvalidTransactionType   = errors.New("type must be 'income' or 'expense'")
+	ErrInvalidCursor            = errors.New("invalid cursor")
+)
+
+// TransactionQuery is a listing request. Cursor is the opaque NextCursor of
+// the previous page.
+type TransactionQuery struct {
+	Filter repositories.TransactionFilter
+	Cursor string
+}
+
+// TransactionPage is one page of a listing
+type TransactionPage struct {
+	Transactions []models.Transaction `json:"transactions"`
+	NextCursor   string               `json:"next_cursor,omitempty"`
+	HasMore      bool                 `json:"has_more"`
+}
+
+// TransactionUpdate holds the fields to change; nil fields are left as is.
+// ClearBudget unlinks the transaction from its budget.
+type TransactionUpdate struct {
+	BudgetID    *uint
+	ClearBudget bool
+	Type        *string
+	Category    *string
+	Amount      *float64
+	Description *string
+	Date        *time.Time
+}
+
 type TransactionService interface {
-	CreateTransaction(userID uint, budgetID *uint, transactionType, category string, amount float64, description string, date time.Time) (*models.Transaction, error)
-	GetUserTransactions(userID uint) ([]models.Transaction, error)
+	CreateTransaction(ctx context.Context, userID uint, budgetID *uint, transactionType, category string, amount float64, description string, date time.Time) (*models.Transaction, error)
+	GetTransaction(ctx context.Context, userID, id uint) (*models.Transaction, error)
+	ListTransactions(ctx context.Context, userID uint, query TransactionQuery) (*TransactionPage, error)
+	UpdateTransaction(ctx context.Context, userID, id uint, update TransactionUpdate) (*models.Transaction, error)
+	DeleteTransaction(ctx context.Context, userID, id uint) error
 }
 
 type transactionService struct {
 	transactionRepo repositories.TransactionRepository
+	budgetRepo      repositories.BudgetRepository
+	categoryAliases map[string]string
 }
 
-func NewTransactionService(transactionRepo repositories.TransactionRepository) TransactionService {
-	return &transactionService{transactionRepo: transactionRepo}
+// NewTransactionService takes categoryAliases keyed by lowercase transaction
+// category, used to match transactions to budgets with a different name
+func NewTransactionService(
+	transactionRepo repositories.TransactionRepository,
+	budgetRepo repositories.BudgetRepository,
+	categoryAliases map[string]string,
+) TransactionService {
+	return &transactionService{
+		transactionRepo: transactionRepo,
+		budgetRepo:      budgetRepo,
+		categoryAliases: categoryAliases,
+	}
 }
 
-func (s *transactionService) CreateTransaction(userID uint, budgetID *uint, transactionType, category string, amount float64, description string, date time.Time) (*models.Transaction, error) {
-	if amount <= 0 {
-		return nil, errors.New("amount must be greater than 0")
+// CreateTransaction links an expense without budgetID to the user's budget for
+// the same category whose period covers date, if there is one
+func (s *transactionService) CreateTransaction(ctx context.Context, userID uint, budgetID *uint, transactionType, category string, amount float64, description string, date time.Time) (*models.Transaction, error) {
+	if err := validateTransaction(transactionType, amount); err != nil {
+		return nil, err
 	}
 
-	if transactionType != "income" && transactionType != "expense" {
-		return nil, errors.New("type must be 'income' or 'expense'")
+	if budgetID != nil {
+		if err := s.checkBudgetOwner(ctx, userID, *budgetID); err != nil {
+			return nil, err
+		}
+	} else if transactionType == "expense" {
+		matched, err := s.matchBudget(ctx, userID, category, date)
+		if err != nil {
+			return nil, err
+		}
+		budgetID = matched
 	}
 
 	transaction := &models.Transaction{
@@ -40,13 +109,214 @@ func (s *transactionService) CreateTransaction(userID uint, budgetID *uint, tran
 		Date:        date,
 	}
 
-	if err := s.transactionRepo.Create(transaction); err != nil {
+	if err := s.transactionRepo.Create(ctx, transaction); err != nil {
 		return nil, err
 	}
 
 	return transaction, nil
 }
 
-func (s *transactionService) GetUserTransactions(userID uint) ([]models.Transaction, error) {
-	return s.transactionRepo.FindByUserID(userID)
+func (s *transactionService) GetTransaction(ctx context.Context, userID, id uint) (*models.Transaction, error) {
+	transaction, err := s.transactionRepo.FindByUserAndID(ctx, userID, id)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrTransactionNotFound
+		}
+		return nil, err
+	}
+	return transaction, nil
+}
+
+// ListTransactions returns one page of the user's transactions. One extra row
+// is fetched to know whether another page follows.
+func (s *transactionService) ListTransactions(ctx context.Context, userID uint, query TransactionQuery) (*TransactionPage, error) {
+	filter := query.Filter
+
+	if filter.Limit <= 0 {
+		filter.Limit = DefaultTransactionPageSize
+	}
+	if filter.Limit > MaxTransactionPageSize {
+		filter.Limit = MaxTransactionPageSize
+	}
+	pageSize := filter.Limit
+	filter.Limit++
+
+	if query.Cursor != "" {
+		cursor, err := decodeTransactionCursor(query.Cursor, filter)
+		if err != nil {
+			return nil, err
+		}
+		filter.Cursor = cursor
+	}
+
+	transactions, err := s.transactionRepo.List(ctx, userID, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	page := &TransactionPage{Transactions: transactions}
+	if len(transactions) > pageSize {
+		page.Transactions = transactions[:pageSize]
+		page.HasMore = true
+		page.NextCursor = encodeTransactionCursor(page.Transactions[pageSize-1], filter)
+	}
+
+	return page, nil
+}
+
+func (s *transactionService) UpdateTransaction(ctx context.Context, userID, id uint, update TransactionUpdate) (*models.Transaction, error) {
+	transaction, err := s.GetTransaction(ctx, userID, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if update.ClearBudget {
+		transaction.BudgetID = nil
+	} else if update.BudgetID != nil {
+		if err := s.checkBudgetOwner(ctx, userID, *update.BudgetID); err != nil {
+			return nil, err
+		}
+		transaction.BudgetID = update.BudgetID
+	}
+	if update.Type != nil {
+		transaction.Type = *update.Type
+	}
+	if update.Category != nil {
+		transaction.Category = *update.Category
+	}
+	if update.Amount != nil {
+		transaction.Amount = *update.Amount
+	}
+	if update.Description != nil {
+		transaction.Description = *update.Description
+	}
+	if update.Date != nil {
+		transaction.Date = *update.Date
+	}
+
+	if err := validateTransaction(transaction.Type, transaction.Amount); err != nil {
+		return nil, err
+	}
+
+	if err := s.transactionRepo.Update(ctx, transaction); err != nil {
+		return nil, err
+	}
+
+	return transaction, nil
+}
+
+func (s *transactionService) DeleteTransaction(ctx context.Context, userID, id uint) error {
+	transaction, err := s.GetTransaction(ctx, userID, id)
+	if err != nil {
+		return err
+	}
+
+	return s.transactionRepo.Delete(ctx, transaction.ID)
+}
+
+// checkBudgetOwner rejects budgets of other users as if they did not exist
+func (s *transactionService) checkBudgetOwner(ctx context.Context, userID, budgetID uint) error {
+	budget, err := s.budgetRepo.FindByID(ctx, budgetID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrBudgetNotFound
+		}
+		return err
+	}
+
+	if budget.UserID != userID {
+		return ErrBudgetNotFound
+	}
+
+	return nil
+}
+
+// matchBudget finds the budget active on date whose category equals the
+// transaction category or its alias, ignoring case
+func (s *transactionService) matchBudget(ctx context.Context, userID uint, category string, date time.Time) (*uint, error) {
+	budgets, err := s.budgetRepo.FindActiveByUserID(ctx, userID, date)
+	if err != nil {
+		return nil, err
+	}
+
+	category = strings.TrimSpace(category)
+	if alias, ok := s.categoryAliases[strings.ToLower(category)]; ok {
+		category = alias
+	}
+
+	for _, budget := range budgets {
+		if strings.EqualFold(budget.Category, category) {
+			return &budget.ID, nil
+		}
+	}
+
+	return nil, nil
+}
+
+func validateTransaction(transactionType string, amount float64) error {
+	if amount <= 0 {
+		return ErrInvalidTransactionAmount
+	}
+
+	if transactionType != "income" && transactionType != "expense" {
+		return ErrInvalidTransactionType
+	}
+
+	return nil
+}
+
+// transactionCursor is the position of the last row of a page and a
+// fingerprint of the filters and sort it was listed with, so a cursor cannot
+// continue another listing
+type transactionCursor struct {
+	repositories.TransactionCursor
+	Filters string `json:"filters"`
+}
+
+// transactionFilterFingerprint hashes everything that decides which rows a
+// listing returns and in which order, but not the page size
+func transactionFilterFingerprint(filter repositories.TransactionFilter) string {
+	if filter.SortBy == "" {
+		filter.SortBy = repositories.TransactionSortDate
+	}
+	filter.Category = strings.ToLower(strings.TrimSpace(filter.Category))
+	filter.Search = strings.ToLower(filter.Search)
+	filter.Cursor = nil
+	filter.Limit = 0
+
+	data, _ := json.Marshal(filter)
+	sum := sha256.Sum256(data)
+	return base64.RawURLEncoding.EncodeToString(sum[:12])
+}
+
+func encodeTransactionCursor(t models.Transaction, filter repositories.TransactionFilter) string {
+	data, _ := json.Marshal(transactionCursor{
+		TransactionCursor: repositories.TransactionCursor{
+			Date:      t.Date,
+			Amount:    t.Amount,
+			CreatedAt: t.CreatedAt,
+			ID:        t.ID,
+		},
+		Filters: transactionFilterFingerprint(filter),
+	})
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// decodeTransactionCursor returns ErrInvalidCursor for a malformed cursor or
+// one issued for other filters or another sort
+func decodeTransactionCursor(value string, filter repositories.TransactionFilter) (*repositories.TransactionCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	var cursor transactionCursor
+	if err := json.Unmarshal(data, &cursor); err != nil || cursor.ID == 0 {
+		return nil, ErrInvalidCursor
+	}
+	if cursor.Filters != transactionFilterFingerprint(filter) {
+		return nil, ErrInvalidCursor
+	}
+
+	return &cursor.TransactionCursor, nil
 }
@@ -0,0 +1,331 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stewicca/angagrar-backend/internal/models"
+	"github.com/stewicca/angagrar-backend/internal/repositories"
+)
+
+// newTestTransactionService returns the service on SQLite with two users
+func newTestTransactionService(t *testing.T) (TransactionService, repositories.Repositories, *models.User, *models.User) {
+	t.Helper()
+
+	repos, _ := newSQLiteRepositories(t)
+	owner := &models.User{GuestID: uuid.NewString()}
+	intruder := &models.User{GuestID: uuid.NewString()}
+	for _, user := range []*models.User{owner, intruder} {
+		if err := repos.Users.Create(context.Background(), user); err != nil {
+			t.Fatalf("create user: %v", err)
+		}
+	}
+
+	aliases := map[string]string{"food": "Makan", "jajan": "Makan", "ojol": "Transport"}
+	return NewTransactionService(repos.Transactions, repos.Budgets, aliases), repos, owner, intruder
+}
+
+func createMonthlyBudget(t *testing.T, repos repositories.Repositories, userID uint, category string, start time.Time) *models.Budget {
+	t.Helper()
+
+	budget := &models.Budget{UserID: userID, Category: category, Amount: 1000000, Period: models.BudgetPeriodMonthly,
+		StartDate: start, EndDate: start.AddDate(0, 1, 0).Add(-time.Second)}
+	if err := repos.Budgets.Create(context.Background(), budget); err != nil {
+		t.Fatalf("create budget: %v", err)
+	}
+	return budget
+}
+
+func TestTransactionRejectsForeignBudget(t *testing.T) {
+	ctx := context.Background()
+	service, repos, owner, intruder := newTestTransactionService(t)
+
+	march := time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)
+	own := createMonthlyBudget(t, repos, owner.ID, "Makan", march)
+	foreign := createMonthlyBudget(t, repos, intruder.ID, "Makan", march)
+	missing := foreign.ID + 100
+	date := march.AddDate(0, 0, 10)
+
+	for name, budgetID := range map[string]uint{"foreign": foreign.ID, "missing": missing} {
+		id := budgetID
+		if _, err := service.CreateTransaction(ctx, owner.ID, &id, "expense", "Makan", 50000, "", date); !errors.Is(err, ErrBudgetNotFound) {
+			t.Errorf("create with a %s budget: expected ErrBudgetNotFound, got %v", name, err)
+		}
+	}
+
+	transaction, err := service.CreateTransaction(ctx, owner.ID, &own.ID, "expense", "Makan", 50000, "", date)
+	if err != nil {
+		t.Fatalf("CreateTransaction: %v", err)
+	}
+	if _, err := service.UpdateTransaction(ctx, owner.ID, transaction.ID, TransactionUpdate{BudgetID: &foreign.ID}); !errors.Is(err, ErrBudgetNotFound) {
+		t.Errorf("update with a foreign budget: expected ErrBudgetNotFound, got %v", err)
+	}
+
+	stored, err := service.GetTransaction(ctx, owner.ID, transaction.ID)
+	if err != nil {
+		t.Fatalf("GetTransaction: %v", err)
+	}
+	if stored.BudgetID == nil || *stored.BudgetID != own.ID {
+		t.Errorf("expected the transaction to stay on budget %d, got %v", own.ID, stored.BudgetID)
+	}
+
+	page, err := service.ListTransactions(ctx, owner.ID, TransactionQuery{})
+	if err != nil {
+		t.Fatalf("ListTransactions: %v", err)
+	}
+	if len(page.Transactions) != 1 {
+		t.Errorf("expected only the valid transaction to be saved, got %d", len(page.Transactions))
+	}
+}
+
+func TestTransactionMatchesBudget(t *testing.T) {
+	ctx := context.Background()
+	service, repos, owner, intruder := newTestTransactionService(t)
+
+	march := time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)
+	april := march.AddDate(0, 1, 0)
+	marchFood := createMonthlyBudget(t, repos, owner.ID, "Makan", march)
+	aprilFood := createMonthlyBudget(t, repos, owner.ID, "Makan", april)
+	aprilTransport := createMonthlyBudget(t, repos, owner.ID, "Transport", april)
+	createMonthlyBudget(t, repos, intruder.ID, "Hiburan", march)
+
+	tests := []struct {
+		name     string
+		txType   string
+		category string
+		date     time.Time
+		want     *models.Budget
+	}{
+		{"same category", "expense", "Makan", march.AddDate(0, 0, 10), marchFood},
+		{"category in other case", "expense", " makan ", march.AddDate(0, 0, 10), marchFood},
+		{"alias", "expense", "Food", march.AddDate(0, 0, 10), marchFood},
+		{"another alias", "expense", "ojol", april.AddDate(0, 0, 3), aprilTransport},
+		{"budget of the transaction's period", "expense", "jajan", april.AddDate(0, 0, 3), aprilFood},
+		{"last second of the period", "expense", "Makan", april.Add(-time.Second), marchFood},
+		{"no budget in the period", "expense", "Makan", april.AddDate(0, 1, 0), nil},
+		{"no budget for the category", "expense", "Kesehatan", march.AddDate(0, 0, 10), nil},
+		{"another user's budget", "expense", "Hiburan", march.AddDate(0, 0, 10), nil},
+		{"income", "income", "Makan", march.AddDate(0, 0, 10), nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			transaction, err := service.CreateTransaction(ctx, owner.ID, nil, tt.txType, tt.category, 25000, "", tt.date)
+			if err != nil {
+				t.Fatalf("CreateTransaction: %v", err)
+			}
+
+			switch {
+			case tt.want == nil && transaction.BudgetID != nil:
+				t.Errorf("expected no budget, got %d", *transaction.BudgetID)
+			case tt.want != nil && (transaction.BudgetID == nil || *transaction.BudgetID != tt.want.ID):
+				t.Errorf("expected budget %d (%s from %s), got %v", tt.want.ID, tt.want.Category, tt.want.StartDate.Format("2006-01-02"), transaction.BudgetID)
+			}
+		})
+	}
+}
+
+// seedTransactions creates transactions in March 2025 with ties on date and
+// amount, linking the Makan expenses to a March budget
+func seedTransactions(t *testing.T, service TransactionService, repos repositories.Repositories, userID uint) *models.Budget {
+	t.Helper()
+
+	budget := createMonthlyBudget(t, repos, userID, "Makan", time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC))
+	for _, row := range []struct {
+		txType, category, description string
+		amount                        float64
+		day                           int
+	}{
+		{"expense", "Makan", "Nasi Padang", 50000, 1},
+		{"expense", "makan", "kopi susu", 50000, 1},
+		{"income", "Gaji", "gaji maret", 8000000, 1},
+		{"expense", "Transport", "ojol ke kantor", 20000, 2},
+		{"expense", "Makan", "makan malam 100%", 75000, 3},
+		{"expense", "Hiburan", "bioskop", 150000, 3},
+		{"expense", "Makan", "warteg_", 50000, 5},
+	} {
+		date := time.Date(2025, 3, row.day, 12, 0, 0, 0, time.UTC)
+		if _, err := service.CreateTransaction(context.Background(), userID, nil, row.txType, row.category, row.amount, row.description, date); err != nil {
+			t.Fatalf("CreateTransaction: %v", err)
+		}
+	}
+	return budget
+}
+
+func transactionIDs(transactions []models.Transaction) []uint {
+	ids := make([]uint, 0, len(transactions))
+	for _, transaction := range transactions {
+		ids = append(ids, transaction.ID)
+	}
+	return ids
+}
+
+func TestListTransactionsPagesWithCursor(t *testing.T) {
+	ctx := context.Background()
+	service, repos, owner, intruder := newTestTransactionService(t)
+	seedTransactions(t, service, repos, owner.ID)
+	seedTransactions(t, service, repos, intruder.ID)
+
+	sorts := []repositories.TransactionFilter{
+		{},
+		{Ascending: true},
+		{SortBy: repositories.TransactionSortAmount},
+		{SortBy: repositories.TransactionSortAmount, Ascending: true},
+		{SortBy: repositories.TransactionSortCreatedAt},
+		{Type: "expense", SortBy: repositories.TransactionSortAmount},
+	}
+	for _, filter := range sorts {
+		name := fmt.Sprintf("%s asc=%v type=%q", filter.SortBy, filter.Ascending, filter.Type)
+		t.Run(name, func(t *testing.T) {
+			all := filter
+			all.Limit = MaxTransactionPageSize
+			want, err := service.ListTransactions(ctx, owner.ID, TransactionQuery{Filter: all})
+			if err != nil {
+				t.Fatalf("ListTransactions: %v", err)
+			}
+			if want.HasMore || want.NextCursor != "" {
+				t.Fatalf("expected a single page, got has_more=%v", want.HasMore)
+			}
+
+			var got []uint
+			query := TransactionQuery{Filter: filter}
+			query.Filter.Limit = 2
+			for pages := 0; ; pages++ {
+				if pages > len(want.Transactions) {
+					t.Fatal("the cursor did not advance")
+				}
+				page, err := service.ListTransactions(ctx, owner.ID, query)
+				if err != nil {
+					t.Fatalf("ListTransactions: %v", err)
+				}
+				got = append(got, transactionIDs(page.Transactions)...)
+				if !page.HasMore {
+					break
+				}
+				query.Cursor = page.NextCursor
+			}
+
+			if fmt.Sprint(got) != fmt.Sprint(transactionIDs(want.Transactions)) {
+				t.Errorf("expected the pages to list %v, got %v", transactionIDs(want.Transactions), got)
+			}
+		})
+	}
+
+	if _, err := service.ListTransactions(ctx, owner.ID, TransactionQuery{Cursor: "not-a-cursor"}); !errors.Is(err, ErrInvalidCursor) {
+		t.Errorf("expected ErrInvalidCursor, got %v", err)
+	}
+
+	// A cursor only continues the listing it came from
+	from := time.Date(2025, 3, 2, 0, 0, 0, 0, time.UTC)
+	issued := repositories.TransactionFilter{Category: "Makan", DateFrom: &from, Limit: 1}
+	first, err := service.ListTransactions(ctx, owner.ID, TransactionQuery{Filter: issued})
+	if err != nil || first.NextCursor == "" {
+		t.Fatalf("ListTransactions: expected a next cursor, got %v", err)
+	}
+	same := issued
+	same.Category, same.SortBy, same.Limit = " makan ", repositories.TransactionSortDate, 5
+	if _, err := service.ListTransactions(ctx, owner.ID, TransactionQuery{Filter: same, Cursor: first.NextCursor}); err != nil {
+		t.Errorf("expected the cursor to continue the same listing with another page size, got %v", err)
+	}
+
+	later := from.AddDate(0, 0, 1)
+	for name, filter := range map[string]repositories.TransactionFilter{
+		"another sort":     {Category: "Makan", DateFrom: &from, SortBy: repositories.TransactionSortAmount},
+		"another order":    {Category: "Makan", DateFrom: &from, Ascending: true},
+		"another category": {Category: "Transport", DateFrom: &from},
+		"another date":     {Category: "Makan", DateFrom: &later},
+		"without filters":  {},
+	} {
+		if _, err := service.ListTransactions(ctx, owner.ID, TransactionQuery{Filter: filter, Cursor: first.NextCursor}); !errors.Is(err, ErrInvalidCursor) {
+			t.Errorf("%s: expected ErrInvalidCursor, got %v", name, err)
+		}
+	}
+}
+
+func TestListTransactionsDefaultPageSize(t *testing.T) {
+	ctx := context.Background()
+	service, _, owner, _ := newTestTransactionService(t)
+
+	date := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	for i := 0; i <= DefaultTransactionPageSize; i++ {
+		if _, err := service.CreateTransaction(ctx, owner.ID, nil, "expense", "Makan", float64(1000+i), "", date.Add(time.Duration(i)*time.Minute)); err != nil {
+			t.Fatalf("CreateTransaction: %v", err)
+		}
+	}
+
+	first, err := service.ListTransactions(ctx, owner.ID, TransactionQuery{})
+	if err != nil {
+		t.Fatalf("ListTransactions: %v", err)
+	}
+	if len(first.Transactions) != DefaultTransactionPageSize || !first.HasMore {
+		t.Fatalf("expected a first page of %d with more to come, got %d, has_more=%v", DefaultTransactionPageSize, len(first.Transactions), first.HasMore)
+	}
+
+	rest, err := service.ListTransactions(ctx, owner.ID, TransactionQuery{Cursor: first.NextCursor})
+	if err != nil {
+		t.Fatalf("ListTransactions: %v", err)
+	}
+	if len(rest.Transactions) != 1 || rest.HasMore {
+		t.Errorf("expected the last transaction on the second page, got %d, has_more=%v", len(rest.Transactions), rest.HasMore)
+	}
+}
+
+func TestListTransactionsFilters(t *testing.T) {
+	ctx := context.Background()
+	service, repos, owner, intruder := newTestTransactionService(t)
+	budget := seedTransactions(t, service, repos, owner.ID)
+	seedTransactions(t, service, repos, intruder.ID)
+
+	from := time.Date(2025, 3, 2, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2025, 3, 3, 23, 59, 59, 0, time.UTC)
+	min, max := 50000.0, 75000.0
+	over := 60000.0
+
+	tests := []struct {
+		name   string
+		filter repositories.TransactionFilter
+		want   []string
+	}{
+		{"no filter", repositories.TransactionFilter{},
+			[]string{"Nasi Padang", "kopi susu", "gaji maret", "ojol ke kantor", "makan malam 100%", "bioskop", "warteg_"}},
+		{"type", repositories.TransactionFilter{Type: "income"}, []string{"gaji maret"}},
+		{"category ignoring case", repositories.TransactionFilter{Category: "MAKAN"},
+			[]string{"Nasi Padang", "kopi susu", "makan malam 100%", "warteg_"}},
+		{"budget", repositories.TransactionFilter{BudgetID: &budget.ID},
+			[]string{"Nasi Padang", "kopi susu", "makan malam 100%", "warteg_"}},
+		{"date range", repositories.TransactionFilter{DateFrom: &from, DateTo: &to},
+			[]string{"ojol ke kantor", "makan malam 100%", "bioskop"}},
+		{"amount range", repositories.TransactionFilter{MinAmount: &min, MaxAmount: &max},
+			[]string{"Nasi Padang", "kopi susu", "makan malam 100%", "warteg_"}},
+		{"text ignoring case", repositories.TransactionFilter{Search: "KOPI"}, []string{"kopi susu"}},
+		{"percent sign is literal", repositories.TransactionFilter{Search: "100%"}, []string{"makan malam 100%"}},
+		{"underscore is literal", repositories.TransactionFilter{Search: "_"}, []string{"warteg_"}},
+		{"combined", repositories.TransactionFilter{Type: "expense", Category: "makan", MinAmount: &over}, []string{"makan malam 100%"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			page, err := service.ListTransactions(ctx, owner.ID, TransactionQuery{Filter: tt.filter})
+			if err != nil {
+				t.Fatalf("ListTransactions: %v", err)
+			}
+
+			got := make(map[string]bool, len(page.Transactions))
+			for _, transaction := range page.Transactions {
+				got[transaction.Description] = true
+			}
+			if len(page.Transactions) != len(tt.want) {
+				t.Errorf("expected %v, got %d transactions", tt.want, len(page.Transactions))
+			}
+			for _, description := range tt.want {
+				if !got[description] {
+					t.Errorf("expected %q in %v", description, got)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,252 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/stewicca/angagrar-backend/internal/models"
+	"github.com/stewicca/angagrar-backend/internal/repositories"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrQuotaExceeded    = errors.New("LLM usage quota exceeded")
+	ErrDailyQuota       = fmt.Errorf("daily %w", ErrQuotaExceeded)
+	ErrMonthlyQuota     = fmt.Errorf("monthly %w", ErrQuotaExceeded)
+	ErrUserNotFound     = errors.New("user not found")
+	ErrInvalidTier      = errors.New("unknown tier, use one of the tiers in LLM_QUOTAS")
+	ErrInvalidDateRange = errors.New("from must be before to, at most 366 days apart")
+)
+
+// maxSpendReportDays bounds the days of one spend report
+const maxSpendReportDays = 366
+
+// UsageQuota is how many tokens, prompt and completion together, a user may
+// use per day and per calendar month. 0 means no limit.
+type UsageQuota struct {
+	DailyTokens   int `json:"daily_tokens"`
+	MonthlyTokens int `json:"monthly_tokens"`
+}
+
+// LLMPrice is what a model costs in USD per million tokens
+type LLMPrice struct {
+	Input  float64
+	Output float64
+}
+
+// ParseUsageQuotas reads "daily/monthly" token limits per tier
+func ParseUsageQuotas(values map[string]string) (map[string]UsageQuota, error) {
+	quotas := make(map[string]UsageQuota, len(values))
+	for tier, value := range values {
+		first, second := splitPair(value)
+		daily, err1 := strconv.Atoi(first)
+		monthly, err2 := strconv.Atoi(second)
+		if err1 != nil || err2 != nil || daily < 0 || monthly < 0 {
+			return nil, fmt.Errorf("invalid quota %q for tier %s, want daily/monthly tokens", value, tier)
+		}
+		quotas[tier] = UsageQuota{DailyTokens: daily, MonthlyTokens: monthly}
+	}
+	return quotas, nil
+}
+
+// ParseLLMPrices reads "input/output" USD per million tokens per model name
+// prefix
+func ParseLLMPrices(values map[string]string) (map[string]LLMPrice, error) {
+	prices := make(map[string]LLMPrice, len(values))
+	for model, value := range values {
+		first, second := splitPair(value)
+		input, err1 := strconv.ParseFloat(first, 64)
+		output, err2 := strconv.ParseFloat(second, 64)
+		if err1 != nil || err2 != nil || input < 0 || output < 0 {
+			return nil, fmt.Errorf("invalid price %q for model %s, want input/output USD per 1M tokens", value, model)
+		}
+		prices[model] = LLMPrice{Input: input, Output: output}
+	}
+	return prices, nil
+}
+
+// splitPair splits "a/b"; a value without a slash yields an empty second part
+func splitPair(value string) (string, string) {
+	first, second, _ := strings.Cut(value, "/")
+	return strings.TrimSpace(first), strings.TrimSpace(second)
+}
+
+// SpendReport is the LLM usage of every day in a date range
+type SpendReport struct {
+	Days         []repositories.DailySpend `json:"days"`
+	Calls        int                       `json:"calls"`
+	TotalTokens  int                       `json:"total_tokens"`
+	TotalCostUSD float64                   `json:"total_cost_usd"`
+}
+
+type UsageService interface {
+	// Meter wraps llm so every call is recorded for the user and, when not
+	// 0, the conversation
+	Meter(llm LLMService, userID uint, conversationID uint, purpose string) LLMService
+	Record(ctx context.Context, usage *models.LLMUsage) error
+	// CheckQuota returns ErrDailyQuota or ErrMonthlyQuota, both matching
+	// ErrQuotaExceeded, once the user used up a quota of their tier
+	CheckQuota(ctx context.Context, userID uint) error
+	DailySpend(ctx context.Context, from, to time.Time) (*SpendReport, error)
+	SetTier(ctx context.Context, userID uint, tier string) (*models.User, error)
+}
+
+type usageService struct {
+	usageRepo repositories.LLMUsageRepository
+	userRepo  repositories.UserRepository
+	quotas    map[string]UsageQuota
+	prices    map[string]LLMPrice
+	model     string // configured model, recorded when the provider names none
+	counter   *TokenCounter
+}
+
+// NewUsageService meters LLM calls against the per-tier quotas. Tiers
+// missing from quotas have no limit; models missing from prices cost nothing,
+// like local models.
+func NewUsageService(
+	usageRepo repositories.LLMUsageRepository,
+	userRepo repositories.UserRepository,
+	quotas map[string]UsageQuota,
+	prices map[string]LLMPrice,
+	model string,
+) UsageService {
+	return &usageService{
+		usageRepo: usageRepo,
+		userRepo:  userRepo,
+		quotas:    quotas,
+		prices:    prices,
+		model:     model,
+		counter:   NewTokenCounter(model),
+	}
+}
+
+func (s *usageService) Meter(llm LLMService, userID uint, conversationID uint, purpose string) LLMService {
+	metered := &meteredLLM{
+		llm:     llm,
+		usage:   s,
+		userID:  userID,
+		purpose: purpose,
+	}
+	if conversationID != 0 {
+		metered.conversationID = &conversationID
+	}
+	return metered
+}
+
+// Record stores the usage with its estimated cost
+func (s *usageService) Record(ctx context.Context, usage *models.LLMUsage) error {
+	if price, ok := s.price(usage.Model); ok {
+		usage.CostUSD = (float64(usage.PromptTokens)*price.Input + float64(usage.CompletionTokens)*price.Output) / 1e6
+	}
+	return s.usageRepo.Create(ctx, usage)
+}
+
+// price finds the price of the longest model prefix matching model
+func (s *usageService) price(model string) (LLMPrice, bool) {
+	model = strings.ToLower(model)
+
+	prefixes := make([]string, 0, len(s.prices))
+	for prefix := range s.prices {
+		if strings.HasPrefix(model, prefix) {
+			prefixes = append(prefixes, prefix)
+		}
+	}
+	if len(prefixes) == 0 {
+		return LLMPrice{}, false
+	}
+
+	sort.Slice(prefixes, func(i, j int) bool { return len(prefixes[i]) > len(prefixes[j]) })
+	return s.prices[prefixes[0]], true
+}
+
+func (s *usageService) CheckQuota(ctx context.Context, userID uint) error {
+	user, err := s.userRepo.FindByID(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("failed to load user: %w", err)
+	}
+
+	quota, ok := s.quotas[user.UsageTier()]
+	if !ok {
+		// A tier removed from the config falls back to the default tiers
+		quota, ok = s.quotas[(&models.User{Email: user.Email}).UsageTier()]
+		if !ok {
+			return nil
+		}
+	}
+
+	now := time.Now()
+	limits := []struct {
+		since  time.Time
+		tokens int
+		err    error
+	}{
+		{time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location()), quota.DailyTokens, ErrDailyQuota},
+		{time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location()), quota.MonthlyTokens, ErrMonthlyQuota},
+	}
+
+	for _, limit := range limits {
+		if limit.tokens <= 0 {
+			continue
+		}
+		used, err := s.usageRepo.SumTokensSince(ctx, userID, limit.since)
+		if err != nil {
+			return fmt.Errorf("failed to load LLM usage: %w", err)
+		}
+		if used >= limit.tokens {
+			return limit.err
+		}
+	}
+
+	return nil
+}
+
+// DailySpend reports the usage of every day in [from, to)
+func (s *usageService) DailySpend(ctx context.Context, from, to time.Time) (*SpendReport, error) {
+	if !from.Before(to) || to.Sub(from) > maxSpendReportDays*24*time.Hour {
+		return nil, ErrInvalidDateRange
+	}
+
+	days, err := s.usageRepo.DailySpend(ctx, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load LLM usage: %w", err)
+	}
+
+	report := &SpendReport{Days: days}
+	if report.Days == nil {
+		report.Days = []repositories.DailySpend{}
+	}
+	for _, day := range days {
+		report.Calls += day.Calls
+		report.TotalTokens += day.PromptTokens + day.CompletionTokens
+		report.TotalCostUSD += day.CostUSD
+	}
+	return report, nil
+}
+
+// SetTier assigns the user a quota tier, an empty tier restores the default
+func (s *usageService) SetTier(ctx context.Context, userID uint, tier string) (*models.User, error) {
+	tier = strings.ToLower(strings.TrimSpace(tier))
+	if _, ok := s.quotas[tier]; tier != "" && !ok {
+		return nil, ErrInvalidTier
+	}
+
+	user, err := s.userRepo.FindByID(ctx, userID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrUserNotFound
+		}
+		return nil, fmt.Errorf("failed to load user: %w", err)
+	}
+
+	user.Tier = tier
+	if err := s.userRepo.Update(ctx, user); err != nil {
+		return nil, fmt.Errorf("failed to update user: %w", err)
+	}
+
+	return user, nil
+}
@@ -0,0 +1,171 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stewicca/angagrar-backend/internal/models"
+)
+
+// reportingLLM answers every call with reply and err, and reports usage like
+// the OpenAI and Anthropic providers do
+type reportingLLM struct {
+	reply   string
+	err     error
+	usage   TokenUsage
+	onUsage func(TokenUsage)
+}
+
+func (l *reportingLLM) reportingUsage(onUsage func(TokenUsage)) LLMService {
+	reporting := *l
+	reporting.onUsage = onUsage
+	return &reporting
+}
+
+func (l *reportingLLM) GenerateResponse(ctx context.Context, systemPrompt string, messages []models.Message) (string, error) {
+	if l.onUsage != nil {
+		l.onUsage(l.usage)
+	}
+	return l.reply, l.err
+}
+
+func (l *reportingLLM) GenerateResponseWithRetry(ctx context.Context, systemPrompt string, messages []models.Message, maxRetries int) (string, error) {
+	return l.GenerateResponse(ctx, systemPrompt, messages)
+}
+
+func (l *reportingLLM) GenerateStructured(ctx context.Context, systemPrompt string, messages []models.Message, schema JSONSchema) (string, error) {
+	return l.GenerateResponse(ctx, systemPrompt, messages)
+}
+
+func (l *reportingLLM) StreamResponse(ctx context.Context, systemPrompt string, messages []models.Message, onDelta func(delta string) error) (string, error) {
+	reply, err := l.GenerateResponse(ctx, systemPrompt, messages)
+	if err != nil {
+		return reply, err
+	}
+	return reply, onDelta(reply)
+}
+
+func TestMeteredLLMRecordsUsageAndCost(t *testing.T) {
+	prices, err := ParseLLMPrices(map[string]string{"gpt-4o": "2.5/10", "gpt-4o-mini": "0.15/0.6"})
+	if err != nil {
+		t.Fatalf("ParseLLMPrices: %v", err)
+	}
+	usageRepo := &fakeLLMUsageRepo{}
+	usage := NewUsageService(usageRepo, &fakeUserRepo{}, nil, prices, "gpt-4o-mini")
+
+	llm := &reportingLLM{reply: "halo", usage: TokenUsage{Model: "gpt-4o-mini-2024-07-18", PromptTokens: 1000, CompletionTokens: 500}}
+	if _, err := usage.Meter(llm, ownerID, 7, models.LLMPurposeChat).GenerateResponse(context.Background(), "prompt", nil); err != nil {
+		t.Fatalf("GenerateResponse: %v", err)
+	}
+
+	// Providers without usage reports are estimated
+	if _, err := usage.Meter(NewScriptedLLMService(nil), ownerID, 0, models.LLMPurposeGreeting).GenerateResponse(context.Background(), "prompt", nil); err != nil {
+		t.Fatalf("GenerateResponse: %v", err)
+	}
+
+	if len(usageRepo.usages) != 2 {
+		t.Fatalf("expected 2 recorded calls, got %d", len(usageRepo.usages))
+	}
+
+	reported := usageRepo.usages[0]
+	if reported.Estimated || reported.PromptTokens != 1000 || reported.CompletionTokens != 500 {
+		t.Errorf("reported usage not recorded as is: %+v", reported)
+	}
+	if reported.ConversationID == nil || *reported.ConversationID != 7 || reported.Purpose != models.LLMPurposeChat {
+		t.Errorf("call not attributed to the conversation: %+v", reported)
+	}
+	// The longest matching price prefix wins
+	if want := (1000*0.15 + 500*0.6) / 1e6; math.Abs(reported.CostUSD-want) > 1e-12 {
+		t.Errorf("expected cost %v, got %v", want, reported.CostUSD)
+	}
+
+	estimated := usageRepo.usages[1]
+	if !estimated.Estimated || estimated.PromptTokens == 0 || estimated.ConversationID != nil {
+		t.Errorf("unexpected estimated usage: %+v", estimated)
+	}
+}
+
+func TestMeteredLLMRecordsFailedCallsThatWereBilled(t *testing.T) {
+	ctx := context.Background()
+	usageRepo := &fakeLLMUsageRepo{}
+	usage := NewUsageService(usageRepo, &fakeUserRepo{}, nil, nil, "gpt-4o-mini")
+	failure := errors.New("no tool_use block in the response")
+
+	// The provider billed the call but the reply could not be used
+	billed := &reportingLLM{err: failure, usage: TokenUsage{PromptTokens: 800, CompletionTokens: 40}}
+	metered := usage.Meter(billed, ownerID, 7, models.LLMPurposeBudget)
+	if _, err := metered.GenerateStructured(ctx, "prompt", nil, JSONSchema{}); !errors.Is(err, failure) {
+		t.Fatalf("expected the provider error, got %v", err)
+	}
+	if _, err := metered.StreamResponse(ctx, "prompt", nil, func(string) error { return nil }); !errors.Is(err, failure) {
+		t.Fatalf("expected the provider error, got %v", err)
+	}
+
+	// Nothing reported and nothing returned, e.g. the request never left
+	unbilled := &reportingLLM{err: failure}
+	if _, err := usage.Meter(unbilled, ownerID, 7, models.LLMPurposeChat).GenerateResponse(ctx, "prompt", nil); !errors.Is(err, failure) {
+		t.Fatalf("expected the provider error, got %v", err)
+	}
+
+	if len(usageRepo.usages) != 2 {
+		t.Fatalf("expected the 2 billed calls to be recorded, got %d", len(usageRepo.usages))
+	}
+	for _, recorded := range usageRepo.usages {
+		if recorded.Estimated || recorded.PromptTokens != 800 || recorded.CompletionTokens != 40 {
+			t.Errorf("reported usage not recorded as is: %+v", recorded)
+		}
+	}
+}
+
+func TestOverQuotaUserGetsAiraReplyWithoutLLM(t *testing.T) {
+	quotas, err := ParseUsageQuotas(map[string]string{models.TierGuest: "100/0"})
+	if err != nil {
+		t.Fatalf("ParseUsageQuotas: %v", err)
+	}
+	usageRepo := &fakeLLMUsageRepo{}
+	usageRepo.Create(context.Background(), &models.LLMUsage{UserID: ownerID, PromptTokens: 80, CompletionTokens: 40})
+
+	calendar, err := NewBudgetCalendar(time.UTC, nil)
+	if err != nil {
+		t.Fatalf("NewBudgetCalendar: %v", err)
+	}
+	budgetRepo := &fakeBudgetRepo{}
+	messageRepo := &fakeMessageRepo{}
+	conversationRepo := newFakeConversationRepo()
+	profileRepo := &fakeProfileRepo{}
+	service := NewConversationService(conversationRepo, messageRepo, budgetRepo, &fakeUserRepo{}, profileRepo, newFakeUnitOfWork(conversationRepo, messageRepo, budgetRepo, profileRepo), calendar, newTestCostOfLiving(t),
+		NewContextWindow(NewTokenCounter(LLMProviderScripted), 0, 8), NewUsageService(usageRepo, &fakeUserRepo{}, quotas, nil, LLMProviderScripted), NewScriptedLLMService(nil))
+
+	conversation, greeting, err := service.StartConversation(context.Background(), ownerID, "")
+	if err != nil {
+		t.Fatalf("StartConversation: %v", err)
+	}
+	if greeting == "" {
+		t.Errorf("expected a fallback greeting")
+	}
+
+	messagesBefore := len(messageRepo.messages)
+	reply, _, _, err := service.ProcessMessage(context.Background(), ownerID, conversation.SessionID, "gaji gue 5 juta")
+	if err != nil {
+		t.Fatalf("ProcessMessage: %v", err)
+	}
+	if reply != dailyQuotaMessage {
+		t.Errorf("expected the daily quota message, got %q", reply)
+	}
+
+	if len(usageRepo.usages) != 1 {
+		t.Errorf("LLM was called over quota: %d calls recorded", len(usageRepo.usages)-1)
+	}
+	if len(messageRepo.messages) != messagesBefore {
+		t.Errorf("over-quota message was saved")
+	}
+
+	// A new day starts with a fresh daily quota
+	usageRepo.usages[0].CreatedAt = time.Now().AddDate(0, 0, -1)
+	if err := NewUsageService(usageRepo, &fakeUserRepo{}, quotas, nil, LLMProviderScripted).CheckQuota(context.Background(), ownerID); err != nil {
+		t.Errorf("expected quota left on a new day, got %v", err)
+	}
+}
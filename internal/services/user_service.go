@@ -1,22 +1,195 @@
 package services
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
 	"github.com/stewicca/angagrar-backend/internal/models"
 	"github.com/stewicca/angagrar-backend/internal/repositories"
+	"github.com/stewicca/angagrar-backend/pkg/utils"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrInvalidPayDay       = errors.New("pay_day must be between 1 and 31")
+	ErrInvalidPayDayAdjust = errors.New("pay_day_adjustment must be 'none', 'previous_business_day' or 'next_business_day'")
+	ErrInvalidSalary       = errors.New("invalid salary")
+	ErrInvalidLifestyle    = errors.New("lifestyle must be 'Minimalis', 'Moderate' or 'Santai'")
+	ErrInvalidExpense      = errors.New("recurring expenses need a name and a non-negative amount")
 )
 
+// FinancialProfileUpdate holds the fields to change; nil fields are left as
+// is. Lists replace the stored ones.
+type FinancialProfileUpdate struct {
+	Salary            *float64
+	City              *string
+	Lifestyle         *string
+	RecurringExpenses *[]models.RecurringExpense
+	Goals             *[]string
+}
+
+// PayCycle is a user's pay cycle setting and the budget period it gives today
+type PayCycle struct {
+	PayDay            int       `json:"pay_day"`
+	PayDayAdjustment  string    `json:"pay_day_adjustment"`
+	CurrentPeriodFrom time.Time `json:"current_period_start"`
+	CurrentPeriodTo   time.Time `json:"current_period_end"`
+}
+
 type UserService interface {
-	GetProfile(userID uint) (*models.User, error)
+	GetProfile(ctx context.Context, userID uint) (*models.User, error)
+	GetPayCycle(ctx context.Context, userID uint) (*PayCycle, error)
+	UpdatePayCycle(ctx context.Context, userID uint, payDay *int, adjustment *string) (*PayCycle, error)
+	GetFinancialProfile(ctx context.Context, userID uint) (*models.FinancialProfile, error)
+	UpdateFinancialProfile(ctx context.Context, userID uint, update FinancialProfileUpdate) (*models.FinancialProfile, error)
 }
 
 type userService struct {
-	userRepo repositories.UserRepository
+	userRepo    repositories.UserRepository
+	profileRepo repositories.FinancialProfileRepository
+	calendar    *BudgetCalendar
+}
+
+func NewUserService(
+	userRepo repositories.UserRepository,
+	profileRepo repositories.FinancialProfileRepository,
+	calendar *BudgetCalendar,
+) UserService {
+	return &userService{
+		userRepo:    userRepo,
+		profileRepo: profileRepo,
+		calendar:    calendar,
+	}
+}
+
+func (s *userService) GetProfile(ctx context.Context, userID uint) (*models.User, error) {
+	return s.userRepo.FindByID(ctx, userID)
+}
+
+func (s *userService) GetPayCycle(ctx context.Context, userID uint) (*PayCycle, error) {
+	user, err := s.userRepo.FindByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.payCycleOf(user), nil
+}
+
+// UpdatePayCycle changes when the user's monthly budget periods start. The
+// running budgets keep their dates; renewal follows the new cycle.
+func (s *userService) UpdatePayCycle(ctx context.Context, userID uint, payDay *int, adjustment *string) (*PayCycle, error) {
+	user, err := s.userRepo.FindByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if payDay != nil {
+		if *payDay < 1 || *payDay > 31 {
+			return nil, ErrInvalidPayDay
+		}
+		user.PayDay = *payDay
+	}
+
+	if adjustment != nil {
+		switch *adjustment {
+		case models.PayDayAdjustNone, models.PayDayAdjustPreviousDay, models.PayDayAdjustNextDay:
+			user.PayDayAdjust = *adjustment
+		default:
+			return nil, ErrInvalidPayDayAdjust
+		}
+	}
+
+	if err := s.userRepo.Update(ctx, user); err != nil {
+		return nil, err
+	}
+
+	return s.payCycleOf(user), nil
+}
+
+func (s *userService) payCycleOf(user *models.User) *PayCycle {
+	start, end := s.calendar.PeriodBounds(user, models.BudgetPeriodMonthly, time.Now())
+
+	return &PayCycle{
+		PayDay:            user.PayDay,
+		PayDayAdjustment:  user.PayDayAdjust,
+		CurrentPeriodFrom: start,
+		CurrentPeriodTo:   end,
+	}
 }
 
-func NewUserService(userRepo repositories.UserRepository) UserService {
-	return &userService{userRepo: userRepo}
+// GetFinancialProfile returns an empty profile until the interview or the
+// user fills it
+func (s *userService) GetFinancialProfile(ctx context.Context, userID uint) (*models.FinancialProfile, error) {
+	profile, err := s.profileRepo.FindByUserID(ctx, userID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return &models.FinancialProfile{
+				UserID:            userID,
+				RecurringExpenses: []models.RecurringExpense{},
+				Goals:             []string{},
+			}, nil
+		}
+		return nil, err
+	}
+	return profile, nil
 }
 
-func (s *userService) GetProfile(userID uint) (*models.User, error) {
-	return s.userRepo.FindByID(userID)
+func (s *userService) UpdateFinancialProfile(ctx context.Context, userID uint, update FinancialProfileUpdate) (*models.FinancialProfile, error) {
+	profile, err := s.GetFinancialProfile(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if update.Salary != nil {
+		if err := utils.ValidateSalary(*update.Salary); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidSalary, err)
+		}
+		profile.Salary = *update.Salary
+	}
+
+	if update.City != nil {
+		profile.City = ""
+		if city := strings.TrimSpace(*update.City); city != "" {
+			profile.City = utils.NormalizeLocation(city)
+		}
+	}
+
+	if update.Lifestyle != nil {
+		lifestyle, ok := utils.DetectLifestyle(*update.Lifestyle)
+		if !ok {
+			return nil, ErrInvalidLifestyle
+		}
+		profile.Lifestyle = lifestyle
+	}
+
+	if update.RecurringExpenses != nil {
+		expenses := make([]models.RecurringExpense, 0, len(*update.RecurringExpenses))
+		for _, expense := range *update.RecurringExpenses {
+			expense.Name = strings.TrimSpace(expense.Name)
+			if expense.Name == "" || expense.Amount < 0 {
+				return nil, ErrInvalidExpense
+			}
+			expenses = append(expenses, expense)
+		}
+		profile.RecurringExpenses = expenses
+	}
+
+	if update.Goals != nil {
+		goals := make([]string, 0, len(*update.Goals))
+		for _, goal := range *update.Goals {
+			if goal = strings.TrimSpace(goal); goal != "" {
+				goals = append(goals, goal)
+			}
+		}
+		profile.Goals = goals
+	}
+
+	if err := s.profileRepo.Save(ctx, profile); err != nil {
+		return nil, err
+	}
+
+	return profile, nil
 }
@@ -6,6 +6,19 @@ import (
 	"regexp"
 	"strconv"
 	"strings"
+	"unicode"
+)
+
+var (
+	decimalWithUnitPattern = regexp.MustCompile(`^\d+\.\d{1,2}\s*(juta|jt|ribu|rb|miliar)`)
+
+	// salaryPattern finds the amount following a salary keyword in free text,
+	// e.g. "gaji gue 8 juta" or "penghasilan Rp 8.500.000"
+	salaryPattern = regexp.MustCompile(`(?:gaji|gajian|salary|penghasilan|pendapatan|income|pemasukan|thp)\D{0,30}?((?:rp\.?\s*)?\d+(?:[.,]\d+)*\s*(?:juta|jt|ribu|rb)?)`)
+
+	// freeTextLifestyles are lifestyle words specific enough to trust in a
+	// chat message
+	freeTextLifestyles = []string{"minimalis", "hemat", "irit", "moderate", "seimbang", "balanced", "santai", "yolo", "boros", "flexing"}
 )
 
 // ParseSalary parses various salary formats to float64
@@ -16,6 +29,12 @@ func ParseSalary(input string) (float64, error) {
 	// Remove "rp", "rupiah", and spaces
 	input = strings.ReplaceAll(input, "rp", "")
 	input = strings.ReplaceAll(input, "rupiah", "")
+	input = strings.TrimSpace(input)
+
+	// In "5.5 juta" the dot is a decimal separator, in "5.000.000" it groups thousands
+	if decimalWithUnitPattern.MatchString(input) {
+		input = strings.Replace(input, ".", ",", 1)
+	}
 	input = strings.ReplaceAll(input, ".", "")
 	input = strings.ReplaceAll(input, ",", ".")
 	input = strings.TrimSpace(input)
@@ -72,34 +91,16 @@ func ParseSalary(input string) (float64, error) {
 	return num, nil
 }
 
-// NormalizeLocation normalizes city name input to standard format
-// Supports variations like: "jakarta", "Jakarta", "jkt", "sby", etc.
+// NormalizeLocation normalizes a place name to its canonical form
+// Supports Indonesian provinces, cities and regencies with variations like:
+// "jakarta", "jkt", "jaksel", "kab. bogor", "jabar", etc.
 func NormalizeLocation(input string) string {
-	input = strings.TrimSpace(strings.ToLower(input))
+	if region, ok := LookupRegion(input); ok {
+		return region.Name
+	}
 
-	// Map of abbreviations to full names
-	cityMap := map[string]string{
-		"jkt":        "Jakarta",
-		"jakarta":    "Jakarta",
-		"sby":        "Surabaya",
-		"surabaya":   "Surabaya",
-		"bdg":        "Bandung",
-		"bandung":    "Bandung",
-		"jogja":      "Yogyakarta",
-		"yogya":      "Yogyakarta",
-		"yogyakarta": "Yogyakarta",
-		"mdn":        "Medan",
-		"medan":      "Medan",
-		"bali":       "Bali",
-		"denpasar":   "Bali",
-	}
-
-	if normalized, ok := cityMap[input]; ok {
-		return normalized
-	}
-
-	// Return capitalized version if not in map
-	return strings.Title(input)
+	// Return capitalized version if not a known region
+	return strings.Title(strings.TrimSpace(strings.ToLower(input)))
 }
 
 // NormalizeLifestyle normalizes lifestyle input to standard options
@@ -161,18 +162,10 @@ func ValidateSalary(salary float64) error {
 	return nil
 }
 
-// IsValidLocation checks if location is in the supported list
+// IsValidLocation checks if location is a known Indonesian region
 func IsValidLocation(location string) bool {
-	validLocations := []string{"Jakarta", "Surabaya", "Bandung", "Yogyakarta", "Medan", "Bali"}
-
-	normalized := NormalizeLocation(location)
-	for _, valid := range validLocations {
-		if normalized == valid {
-			return true
-		}
-	}
-
-	return false
+	_, ok := LookupRegion(location)
+	return ok
 }
 
 // IsValidLifestyle checks if lifestyle is valid
@@ -194,23 +187,58 @@ func RoundToNearest(amount float64, interval float64) float64 {
 	return math.Round(amount/interval) * interval
 }
 
-// ExtractConfirmation checks if user input is a confirmation (yes/no)
-func ExtractConfirmation(input string) (bool, bool) {
-	input = strings.TrimSpace(strings.ToLower(input))
+// maxConfirmationWords is the longest message still read as a plain yes or
+// no. Longer messages usually ask or explain something.
+const maxConfirmationWords = 5
 
-	// Yes keywords
-	yesKeywords := []string{"ya", "yes", "iya", "ok", "oke", "siap", "betul", "benar", "lanjut"}
-	for _, keyword := range yesKeywords {
-		if strings.Contains(input, keyword) {
-			return true, true // isConfirmation=true, isYes=true
-		}
+var (
+	// Negations are checked first so "nggak jadi ya" is a no
+	confirmationNoWords = map[string]bool{
+		"tidak": true, "tdk": true, "nggak": true, "ngga": true, "gak": true, "ga": true, "gk": true,
+		"enggak": true, "engga": true, "batal": true, "jangan": true, "no": true, "nope": true,
+		"salah": true, "ulang": true, "cancel": true,
+	}
+	confirmationYesWords = map[string]bool{
+		"ya": true, "yes": true, "iya": true, "iyaa": true, "y": true, "ok": true, "oke": true, "okay": true,
+		"okey": true, "siap": true, "sip": true, "betul": true, "benar": true, "bener": true, "lanjut": true,
+		"setuju": true, "boleh": true, "gas": true, "yup": true,
+	}
+	// A yes next to one of these is not an answer yet, e.g. "ya saya masih mikir"
+	confirmationHesitationWords = map[string]bool{
+		"mikir": true, "pikir": true, "dipikir": true, "nanti": true, "entar": true, "bentar": true,
+		"dulu": true, "ragu": true,
 	}
+)
 
-	// No keywords
-	noKeywords := []string{"tidak", "no", "nope", "enggak", "gak", "salah", "ulang"}
-	for _, keyword := range noKeywords {
-		if strings.Contains(input, keyword) {
-			return true, false // isConfirmation=true, isYes=false
+// ExtractConfirmation checks if user input is a short, clear yes or no. It
+// matches whole words only and returns isConfirmation=false for questions
+// and anything ambiguous.
+func ExtractConfirmation(input string) (isConfirmation bool, isYes bool) {
+	input = strings.ToLower(input)
+	if strings.Contains(input, "?") {
+		return false, false
+	}
+
+	words := strings.FieldsFunc(input, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	if len(words) == 0 || len(words) > maxConfirmationWords {
+		return false, false
+	}
+
+	for _, word := range words {
+		if confirmationNoWords[word] {
+			return true, false
+		}
+	}
+	for _, word := range words {
+		if confirmationHesitationWords[word] {
+			return false, false
+		}
+	}
+	for _, word := range words {
+		if confirmationYesWords[word] {
+			return true, true
 		}
 	}
 
@@ -239,3 +267,44 @@ func ContainsSalaryInfo(input string) bool {
 
 	return false
 }
+
+// ExtractSalary finds a salary mentioned in a chat message, such as
+// "gaji gue 8 juta". The amount must pass ValidateSalary.
+func ExtractSalary(input string) (float64, bool) {
+	for _, match := range salaryPattern.FindAllStringSubmatch(strings.ToLower(input), -1) {
+		salary, err := ParseSalary(match[1])
+		if err != nil || ValidateSalary(salary) != nil {
+			continue
+		}
+		return salary, true
+	}
+
+	return 0, false
+}
+
+// DetectLocation finds a known region in a chat message. The last one
+// mentioned wins, so "dulu di bandung, sekarang jakarta" gives Jakarta.
+func DetectLocation(input string) (string, bool) {
+	region, ok := detectRegion(input)
+	return region.Name, ok
+}
+
+// DetectLifestyle finds a lifestyle in a chat message. Unlike
+// NormalizeLifestyle it does not fall back to Moderate.
+func DetectLifestyle(input string) (string, bool) {
+	for _, word := range words(input) {
+		for _, keyword := range freeTextLifestyles {
+			if word == keyword {
+				return NormalizeLifestyle(word), true
+			}
+		}
+	}
+
+	return "", false
+}
+
+func words(input string) []string {
+	return strings.FieldsFunc(strings.ToLower(input), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
@@ -0,0 +1,43 @@
+package utils
+
+import "testing"
+
+func TestExtractConfirmation(t *testing.T) {
+	tests := []struct {
+		input            string
+		wantConfirmation bool
+		wantYes          bool
+	}{
+		{"iya", true, true},
+		{"Ya!", true, true},
+		{"oke lanjut aja", true, true},
+		{"sip, setuju", true, true},
+		{"boleh deh", true, true},
+		{"nggak jadi ya", true, false},
+		{"gak usah", true, false},
+		{"tidak", true, false},
+		{"batal aja", true, false},
+		{"jangan dulu ya", true, false},
+		{"enggak, ok makasih", true, false},
+		{"no", true, false},
+		{"caranya gimana?", false, false},
+		{"caranya gimana", false, false},
+		{"biaya makan berapa?", false, false},
+		{"saya masih mikir", false, false},
+		{"ya saya pikir dulu", false, false},
+		{"ya?", false, false},
+		{"token", false, false},
+		{"nominalnya kurang", false, false},
+		{"ya tapi makan jadi 3 juta aja kayaknya", false, false},
+		{"", false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			isConfirmation, isYes := ExtractConfirmation(tt.input)
+			if isConfirmation != tt.wantConfirmation || isYes != tt.wantYes {
+				t.Errorf("ExtractConfirmation(%q) = %v, %v, expected %v, %v", tt.input, isConfirmation, isYes, tt.wantConfirmation, tt.wantYes)
+			}
+		})
+	}
+}
@@ -1,10 +1,15 @@
 package utils
 
 import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
 	"errors"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
 )
 
 type Claims struct {
@@ -13,27 +18,32 @@ type Claims struct {
 	jwt.RegisteredClaims
 }
 
-func GenerateToken(userID uint, guestID, secret string) (string, error) {
-	claims := Claims{
+// GenerateToken issues an access token signed by the keyring's current key,
+// with a unique jti so it can be revoked
+func GenerateToken(userID uint, guestID string, keyring *Keyring, ttl time.Duration) (string, *Claims, error) {
+	now := time.Now()
+	claims := &Claims{
 		UserID:  userID,
 		GuestID: guestID,
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(24 * 30 * time.Hour)),
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			ID:        uuid.New().String(),
+			ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
+			IssuedAt:  jwt.NewNumericDate(now),
 		},
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString([]byte(secret))
+	signed, err := keyring.Sign(claims)
+	if err != nil {
+		return "", nil, err
+	}
+
+	return signed, claims, nil
 }
 
-func ValidateToken(tokenString, secret string) (*Claims, error) {
-	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (any, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, errors.New("invalid signing method")
-		}
-		return []byte(secret), nil
-	})
+// ValidateToken verifies a token against any key in the keyring, so tokens
+// signed before a key rotation stay valid until they expire
+func ValidateToken(tokenString string, keyring *Keyring) (*Claims, error) {
+	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, keyring.keyFunc)
 
 	if err != nil {
 		return nil, err
@@ -45,3 +55,18 @@ func ValidateToken(tokenString, secret string) (*Claims, error) {
 
 	return nil, errors.New("invalid token")
 }
+
+// GenerateRefreshToken returns an opaque random token; only its hash is stored
+func GenerateRefreshToken() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// HashToken returns the hex encoded SHA-256 digest of a token
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
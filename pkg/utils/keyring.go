@@ -0,0 +1,277 @@
+package utils
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// LegacyKeyID identifies the HS256 JWT_SECRET key. Tokens issued before kid
+// headers existed carry no kid and are verified with this key.
+const LegacyKeyID = "legacy"
+
+// insecureHMACSecret is the JWT_SECRET that used to ship as the built-in
+// default. It is public, so no HS256 key may use it.
+const insecureHMACSecret = "3RBN1skwbkcF3jp31mVJOuQ0AW38Ut"
+
+// IsInsecureHMACSecret reports whether secret is the public former default
+func IsInsecureHMACSecret(secret []byte) bool {
+	return string(secret) == insecureHMACSecret
+}
+
+// SigningKey is one entry of the keyring. Keys loaded from a public key file
+// can only verify tokens, which is how retired keys are kept around.
+type SigningKey struct {
+	ID        string
+	Method    jwt.SigningMethod
+	signKey   any
+	verifyKey any
+}
+
+// CanSign reports whether the private half of the key is available
+func (k *SigningKey) CanSign() bool {
+	return k.signKey != nil
+}
+
+// Keyring holds every key that may verify an access token and the single key
+// new tokens are signed with
+type Keyring struct {
+	signing *SigningKey
+	keys    map[string]*SigningKey
+}
+
+// NewKeyring builds a keyring that signs with signingKeyID. If signingKeyID is
+// empty and only one key can sign, that key is used.
+func NewKeyring(signingKeyID string, keys ...*SigningKey) (*Keyring, error) {
+	k := &Keyring{keys: make(map[string]*SigningKey, len(keys))}
+
+	for _, key := range keys {
+		if _, exists := k.keys[key.ID]; exists {
+			return nil, fmt.Errorf("duplicate JWT key id %q", key.ID)
+		}
+		k.keys[key.ID] = key
+	}
+
+	if signingKeyID == "" {
+		for _, key := range keys {
+			if !key.CanSign() {
+				continue
+			}
+			if signingKeyID != "" {
+				return nil, errors.New("several JWT keys can sign, set the signing key id")
+			}
+			signingKeyID = key.ID
+		}
+	}
+
+	signing, ok := k.keys[signingKeyID]
+	if !ok {
+		return nil, fmt.Errorf("JWT signing key %q is not configured", signingKeyID)
+	}
+	if !signing.CanSign() {
+		return nil, fmt.Errorf("JWT signing key %q has no private key", signingKeyID)
+	}
+	k.signing = signing
+
+	return k, nil
+}
+
+// LoadKeyring builds the keyring from config. Each key spec has the form
+// "kid:alg:path" where path points to a PEM file (or a raw secret for HS256).
+// A non-empty legacySecret is added as the HS256 key LegacyKeyID.
+func LoadKeyring(signingKeyID string, specs []string, legacySecret string) (*Keyring, error) {
+	var keys []*SigningKey
+
+	if legacySecret != "" {
+		keys = append(keys, NewHMACKey(LegacyKeyID, []byte(legacySecret)))
+	}
+
+	for _, spec := range specs {
+		key, err := loadKeySpec(spec)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+
+	if len(keys) == 0 {
+		return nil, errors.New("no JWT keys configured")
+	}
+
+	for _, key := range keys {
+		if secret, ok := key.verifyKey.([]byte); ok && IsInsecureHMACSecret(secret) {
+			return nil, fmt.Errorf("JWT key %q is the public built-in default secret, generate a new secret", key.ID)
+		}
+	}
+
+	return NewKeyring(signingKeyID, keys...)
+}
+
+// NewHMACKey returns an HS256 key that can both sign and verify
+func NewHMACKey(id string, secret []byte) *SigningKey {
+	return &SigningKey{
+		ID:        id,
+		Method:    jwt.SigningMethodHS256,
+		signKey:   secret,
+		verifyKey: secret,
+	}
+}
+
+// ParseKeyPEM parses an RS256 or EdDSA key. A private key can sign and
+// verify, a public key can only verify.
+func ParseKeyPEM(id, alg string, data []byte) (*SigningKey, error) {
+	isPrivate := strings.Contains(string(data), "PRIVATE KEY")
+
+	switch alg {
+	case jwt.SigningMethodRS256.Alg():
+		if isPrivate {
+			privateKey, err := jwt.ParseRSAPrivateKeyFromPEM(data)
+			if err != nil {
+				return nil, err
+			}
+			return &SigningKey{ID: id, Method: jwt.SigningMethodRS256, signKey: privateKey, verifyKey: &privateKey.PublicKey}, nil
+		}
+		publicKey, err := jwt.ParseRSAPublicKeyFromPEM(data)
+		if err != nil {
+			return nil, err
+		}
+		return &SigningKey{ID: id, Method: jwt.SigningMethodRS256, verifyKey: publicKey}, nil
+
+	case jwt.SigningMethodEdDSA.Alg():
+		if isPrivate {
+			privateKey, err := jwt.ParseEdPrivateKeyFromPEM(data)
+			if err != nil {
+				return nil, err
+			}
+			signer := privateKey.(crypto.Signer)
+			return &SigningKey{ID: id, Method: jwt.SigningMethodEdDSA, signKey: privateKey, verifyKey: signer.Public()}, nil
+		}
+		publicKey, err := jwt.ParseEdPublicKeyFromPEM(data)
+		if err != nil {
+			return nil, err
+		}
+		return &SigningKey{ID: id, Method: jwt.SigningMethodEdDSA, verifyKey: publicKey}, nil
+
+	default:
+		return nil, fmt.Errorf("unsupported JWT algorithm %q", alg)
+	}
+}
+
+func loadKeySpec(spec string) (*SigningKey, error) {
+	parts := strings.SplitN(strings.TrimSpace(spec), ":", 3)
+	if len(parts) != 3 || parts[0] == "" || parts[2] == "" {
+		return nil, fmt.Errorf("invalid JWT key spec %q, expected kid:alg:path", spec)
+	}
+	id, alg, path := parts[0], strings.ToUpper(parts[1]), parts[2]
+	if alg == "EDDSA" {
+		alg = jwt.SigningMethodEdDSA.Alg()
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read JWT key %q: %w", id, err)
+	}
+
+	if alg == jwt.SigningMethodHS256.Alg() {
+		return NewHMACKey(id, []byte(strings.TrimSpace(string(data)))), nil
+	}
+
+	key, err := ParseKeyPEM(id, alg, data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse JWT key %q: %w", id, err)
+	}
+
+	return key, nil
+}
+
+// Sign signs the claims with the current signing key and sets its kid header
+func (k *Keyring) Sign(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(k.signing.Method, claims)
+	token.Header["kid"] = k.signing.ID
+	return token.SignedString(k.signing.signKey)
+}
+
+// keyFunc resolves the verification key from the kid header and refuses
+// tokens whose alg does not match the key, so an RSA public key can never be
+// used as an HMAC secret
+func (k *Keyring) keyFunc(token *jwt.Token) (any, error) {
+	kid, _ := token.Header["kid"].(string)
+	if kid == "" {
+		kid = LegacyKeyID
+	}
+
+	key, ok := k.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown key id %q", kid)
+	}
+
+	if token.Method.Alg() != key.Method.Alg() {
+		return nil, errors.New("invalid signing method")
+	}
+
+	return key.verifyKey, nil
+}
+
+// JWK is a public key in RFC 7517 format
+type JWK struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+	N         string `json:"n,omitempty"`
+	E         string `json:"e,omitempty"`
+	Curve     string `json:"crv,omitempty"`
+	X         string `json:"x,omitempty"`
+}
+
+// JWKSet is the document served at /.well-known/jwks.json
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKS returns the public half of every asymmetric key. HMAC keys are shared
+// secrets and are never published.
+func (k *Keyring) JWKS() JWKSet {
+	set := JWKSet{Keys: []JWK{}}
+
+	ids := make([]string, 0, len(k.keys))
+	for id := range k.keys {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	for _, id := range ids {
+		key := k.keys[id]
+		switch publicKey := key.verifyKey.(type) {
+		case *rsa.PublicKey:
+			set.Keys = append(set.Keys, JWK{
+				KeyType:   "RSA",
+				KeyID:     key.ID,
+				Use:       "sig",
+				Algorithm: key.Method.Alg(),
+				N:         base64.RawURLEncoding.EncodeToString(publicKey.N.Bytes()),
+				E:         base64.RawURLEncoding.EncodeToString(big.NewInt(int64(publicKey.E)).Bytes()),
+			})
+		case ed25519.PublicKey:
+			set.Keys = append(set.Keys, JWK{
+				KeyType:   "OKP",
+				KeyID:     key.ID,
+				Use:       "sig",
+				Algorithm: key.Method.Alg(),
+				Curve:     "Ed25519",
+				X:         base64.RawURLEncoding.EncodeToString(publicKey),
+			})
+		}
+	}
+
+	return set
+}
@@ -0,0 +1,262 @@
+package utils
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func pemBlock(t *testing.T, blockType string, der []byte, err error) []byte {
+	t.Helper()
+
+	if err != nil {
+		t.Fatalf("marshal %s: %v", blockType, err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der})
+}
+
+// newEdDSAKeyPEM returns the private and public PEM of a new Ed25519 key
+func newEdDSAKeyPEM(t *testing.T) (private, public []byte) {
+	t.Helper()
+
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("generate Ed25519 key: %v", err)
+	}
+	privateDER, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	private = pemBlock(t, "PRIVATE KEY", privateDER, err)
+	publicDER, err := x509.MarshalPKIXPublicKey(publicKey)
+	public = pemBlock(t, "PUBLIC KEY", publicDER, err)
+	return private, public
+}
+
+// newRSAKeyPEM returns the private and public PEM of a new RSA key
+func newRSAKeyPEM(t *testing.T) (private, public []byte) {
+	t.Helper()
+
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generate RSA key: %v", err)
+	}
+	privateDER, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	private = pemBlock(t, "PRIVATE KEY", privateDER, err)
+	publicDER, err := x509.MarshalPKIXPublicKey(&privateKey.PublicKey)
+	public = pemBlock(t, "PUBLIC KEY", publicDER, err)
+	return private, public
+}
+
+func parseKey(t *testing.T, id, alg string, data []byte) *SigningKey {
+	t.Helper()
+
+	key, err := ParseKeyPEM(id, alg, data)
+	if err != nil {
+		t.Fatalf("ParseKeyPEM %s: %v", id, err)
+	}
+	return key
+}
+
+func newKeyring(t *testing.T, signingKeyID string, keys ...*SigningKey) *Keyring {
+	t.Helper()
+
+	keyring, err := NewKeyring(signingKeyID, keys...)
+	if err != nil {
+		t.Fatalf("NewKeyring: %v", err)
+	}
+	return keyring
+}
+
+func issue(t *testing.T, keyring *Keyring) string {
+	t.Helper()
+
+	token, _, err := GenerateToken(7, "guest", keyring, time.Minute)
+	if err != nil {
+		t.Fatalf("GenerateToken: %v", err)
+	}
+	return token
+}
+
+// forge signs claims with any method, key and kid, the way an attacker would
+func forge(t *testing.T, method jwt.SigningMethod, kid string, key any) string {
+	t.Helper()
+
+	token := jwt.NewWithClaims(method, &Claims{
+		UserID:           7,
+		RegisteredClaims: jwt.RegisteredClaims{ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute))},
+	})
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatalf("sign forged token: %v", err)
+	}
+	return signed
+}
+
+func writeKeyFile(t *testing.T, name string, data []byte) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatalf("write %s: %v", name, err)
+	}
+	return path
+}
+
+func TestKeyringVerifiesByKid(t *testing.T) {
+	edPrivate, _ := newEdDSAKeyPEM(t)
+	hmacKey := NewHMACKey("2026-09", []byte("september-secret"))
+	edKey := parseKey(t, "2026-10", "EdDSA", edPrivate)
+
+	before := newKeyring(t, "2026-09", hmacKey)
+	after := newKeyring(t, "2026-10", hmacKey, edKey)
+
+	for name, token := range map[string]string{
+		"before rotation": issue(t, before),
+		"after rotation":  issue(t, after),
+	} {
+		claims, err := ValidateToken(token, after)
+		if err != nil {
+			t.Errorf("%s: expected the token to verify, got %v", name, err)
+			continue
+		}
+		if claims.UserID != 7 {
+			t.Errorf("%s: expected user 7, got %d", name, claims.UserID)
+		}
+	}
+
+	// The kid picks the key, a token claiming another kid fails
+	if _, err := ValidateToken(forge(t, jwt.SigningMethodHS256, "2026-10", []byte("september-secret")), after); err == nil {
+		t.Error("expected a token signed with another key than its kid to be rejected")
+	}
+	if _, err := ValidateToken(forge(t, jwt.SigningMethodHS256, "2026-08", []byte("september-secret")), after); err == nil {
+		t.Error("expected a token with an unknown kid to be rejected")
+	}
+}
+
+func TestKeyringRejectsAlgNotMatchingTheKey(t *testing.T) {
+	rsaPrivate, rsaPublic := newRSAKeyPEM(t)
+	edPrivate, edPublic := newEdDSAKeyPEM(t)
+
+	keyring := newKeyring(t, "rsa",
+		parseKey(t, "rsa", "RS256", rsaPrivate),
+		parseKey(t, "ed", "EdDSA", edPrivate),
+	)
+
+	// The public keys are published, so they must never verify an HS256
+	// token as if they were the HMAC secret
+	forged := map[string]string{
+		"RS256 key as HS256 secret":  forge(t, jwt.SigningMethodHS256, "rsa", rsaPublic),
+		"EdDSA key as HS256 secret":  forge(t, jwt.SigningMethodHS256, "ed", edPublic),
+		"raw EdDSA key as HS256":     forge(t, jwt.SigningMethodHS256, "ed", []byte(keyring.keys["ed"].verifyKey.(ed25519.PublicKey))),
+		"RS256 token with EdDSA kid": forge(t, jwt.SigningMethodRS256, "ed", keyring.keys["rsa"].signKey),
+		"unsigned":                   forge(t, jwt.SigningMethodNone, "rsa", jwt.UnsafeAllowNoneSignatureType),
+	}
+	for name, token := range forged {
+		if _, err := ValidateToken(token, keyring); err == nil {
+			t.Errorf("%s: expected the token to be rejected", name)
+		}
+	}
+}
+
+func TestKeyringVerifiesWithRetiredPublicKey(t *testing.T) {
+	oldPrivate, oldPublic := newEdDSAKeyPEM(t)
+	newPrivate, _ := newEdDSAKeyPEM(t)
+
+	token := issue(t, newKeyring(t, "old", parseKey(t, "old", "EdDSA", oldPrivate)))
+
+	retired := parseKey(t, "old", "EdDSA", oldPublic)
+	if retired.CanSign() {
+		t.Fatal("expected a key parsed from a public key not to sign")
+	}
+	keyring := newKeyring(t, "", retired, parseKey(t, "new", "EdDSA", newPrivate))
+
+	if _, err := ValidateToken(token, keyring); err != nil {
+		t.Errorf("expected the token of the retired key to verify, got %v", err)
+	}
+	if _, err := NewKeyring("old", retired); err == nil {
+		t.Error("expected a public key to be refused as the signing key")
+	}
+}
+
+func TestLegacyTokenWithoutKidUsesLegacyKey(t *testing.T) {
+	edPrivate, _ := newEdDSAKeyPEM(t)
+	path := writeKeyFile(t, "ed.pem", edPrivate)
+
+	keyring, err := LoadKeyring("2026-10", []string{"2026-10:EdDSA:" + path}, "legacy-secret")
+	if err != nil {
+		t.Fatalf("LoadKeyring: %v", err)
+	}
+
+	legacy := forge(t, jwt.SigningMethodHS256, "", []byte("legacy-secret"))
+	if _, err := ValidateToken(legacy, keyring); err != nil {
+		t.Errorf("expected a token without kid to verify with the %s key, got %v", LegacyKeyID, err)
+	}
+
+	wrongSecret := forge(t, jwt.SigningMethodHS256, "", []byte("other-secret"))
+	if _, err := ValidateToken(wrongSecret, keyring); err == nil {
+		t.Error("expected a token without kid signed with another secret to be rejected")
+	}
+
+	withoutLegacy, err := LoadKeyring("", []string{"2026-10:EdDSA:" + path}, "")
+	if err != nil {
+		t.Fatalf("LoadKeyring: %v", err)
+	}
+	if _, err := ValidateToken(legacy, withoutLegacy); err == nil {
+		t.Error("expected a token without kid to be rejected when JWT_SECRET is not set")
+	}
+}
+
+func TestJWKSNeverPublishesHMACKeys(t *testing.T) {
+	rsaPrivate, _ := newRSAKeyPEM(t)
+	_, edPublic := newEdDSAKeyPEM(t)
+
+	keyring, err := LoadKeyring("rsa", []string{
+		"hmac:HS256:" + writeKeyFile(t, "hmac.key", []byte("shared-secret\n")),
+		"rsa:RS256:" + writeKeyFile(t, "rsa.pem", rsaPrivate),
+		"ed:EdDSA:" + writeKeyFile(t, "ed.pub.pem", edPublic),
+	}, "legacy-secret")
+	if err != nil {
+		t.Fatalf("LoadKeyring: %v", err)
+	}
+
+	set := keyring.JWKS()
+	var ids []string
+	for _, key := range set.Keys {
+		ids = append(ids, key.KeyID)
+	}
+	if got := strings.Join(ids, ","); got != "ed,rsa" {
+		t.Errorf("expected only the ed and rsa keys, got %q", got)
+	}
+
+	document, err := json.Marshal(set)
+	if err != nil {
+		t.Fatalf("marshal JWKS: %v", err)
+	}
+	for _, leak := range []string{"shared-secret", "legacy-secret", `"oct"`, `"d"`} {
+		if strings.Contains(string(document), leak) {
+			t.Errorf("JWKS contains %s: %s", leak, document)
+		}
+	}
+}
+
+func TestLoadKeyringRejectsInsecureSecret(t *testing.T) {
+	if _, err := LoadKeyring("", nil, insecureHMACSecret); err == nil {
+		t.Error("expected the public default JWT_SECRET to be rejected")
+	}
+
+	path := writeKeyFile(t, "hmac.key", []byte(insecureHMACSecret+"\n"))
+	if _, err := LoadKeyring("", []string{"2026-10:HS256:" + path}, ""); err == nil {
+		t.Error("expected an HS256 key file holding the public default secret to be rejected")
+	}
+}
@@ -0,0 +1,252 @@
+package utils
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/csv"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// Region types in the regions dataset
+const (
+	RegionProvince = "provinsi"
+	RegionCity     = "kota"
+	RegionRegency  = "kabupaten"
+)
+
+// Region is an Indonesian province, city (kota) or regency (kabupaten)
+type Region struct {
+	Name     string // Canonical name, "Kabupaten X" when a city or province is also called X
+	Type     string // See Region* constants
+	Province string // Empty for provinces
+}
+
+//go:embed data/regions.csv
+var regionsCSV []byte
+
+// regionPrefixes narrow a lookup to one region type, e.g. "kab. bogor"
+var regionPrefixes = []struct {
+	prefix     string
+	regionType string
+}{
+	{"kabupaten", RegionRegency},
+	{"kab", RegionRegency},
+	{"kota", RegionCity},
+	{"provinsi", RegionProvince},
+	{"prov", RegionProvince},
+}
+
+// locationCues are words that make the next word in a chat message a place,
+// as in "tinggal di batu" (batu also means stone)
+var locationCues = map[string]bool{
+	"di": true, "dari": true, "ke": true, "tinggal": true, "domisili": true, "pindah": true,
+	"daerah": true, "area": true, "wilayah": true, "asal": true, "kota": true,
+	"kab": true, "kabupaten": true, "provinsi": true, "prov": true,
+}
+
+// wellKnownLocations are detected in chat messages without a cue word;
+// they are rarely used as ordinary words
+var wellKnownLocations = map[string]bool{
+	"jakarta": true, "jkt": true, "jaksel": true, "jakbar": true, "jakpus": true, "jaktim": true, "jakut": true,
+	"jakarta selatan": true, "jakarta barat": true, "jakarta pusat": true, "jakarta timur": true, "jakarta utara": true,
+	"surabaya": true, "sby": true, "bandung": true, "bdg": true, "yogyakarta": true, "jogja": true, "yogya": true,
+	"medan": true, "mdn": true, "bali": true, "denpasar": true, "semarang": true, "makassar": true, "palembang": true,
+	"tangerang": true, "tangsel": true, "tangerang selatan": true, "bekasi": true, "depok": true, "bogor": true,
+	"balikpapan": true, "pekanbaru": true, "batam": true, "samarinda": true, "pontianak": true, "banjarmasin": true,
+	"manado": true,
+}
+
+type regionIndex struct {
+	byKey      map[string]Region            // plain names and aliases
+	byTypeKey  map[string]map[string]Region // names and aliases per region type
+	maxKeyWord int
+}
+
+var (
+	regionsOnce sync.Once
+	regions     *regionIndex
+)
+
+func loadRegions() *regionIndex {
+	regionsOnce.Do(func() {
+		index, err := parseRegions(regionsCSV)
+		if err != nil {
+			panic(fmt.Sprintf("invalid embedded regions dataset: %v", err))
+		}
+		regions = index
+	})
+	return regions
+}
+
+func parseRegions(raw []byte) (*regionIndex, error) {
+	records, err := csv.NewReader(bytes.NewReader(raw)).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) < 2 {
+		return nil, fmt.Errorf("no regions")
+	}
+
+	type row struct {
+		region  Region
+		aliases []string
+	}
+
+	rows := make([]row, 0, len(records)-1)
+	cityOrProvince := make(map[string]bool)
+	for i, record := range records[1:] {
+		if len(record) != 4 {
+			return nil, fmt.Errorf("line %d: expected 4 fields, got %d", i+2, len(record))
+		}
+
+		regionType, name, province := record[0], strings.TrimSpace(record[1]), strings.TrimSpace(record[2])
+		switch regionType {
+		case RegionProvince, RegionCity, RegionRegency:
+		default:
+			return nil, fmt.Errorf("line %d: unknown region type %q", i+2, regionType)
+		}
+
+		var aliases []string
+		if record[3] != "" {
+			aliases = strings.Split(record[3], "|")
+		}
+
+		rows = append(rows, row{region: Region{Name: name, Type: regionType, Province: province}, aliases: aliases})
+		if regionType != RegionRegency {
+			cityOrProvince[locationKey(name)] = true
+		}
+	}
+
+	index := &regionIndex{
+		byKey:     make(map[string]Region),
+		byTypeKey: map[string]map[string]Region{RegionProvince: {}, RegionCity: {}, RegionRegency: {}},
+	}
+
+	// Plain names resolve to cities before provinces before regencies, so
+	// "bandung" is Kota Bandung and "gorontalo" is Kota Gorontalo
+	for _, regionType := range []string{RegionCity, RegionProvince, RegionRegency} {
+		for _, r := range rows {
+			if r.region.Type != regionType {
+				continue
+			}
+
+			region := r.region
+			base := locationKey(region.Name)
+			if regionType == RegionRegency && cityOrProvince[base] {
+				region.Name = "Kabupaten " + region.Name
+			}
+
+			for _, key := range append([]string{base}, r.aliases...) {
+				key = locationKey(key)
+				if _, taken := index.byKey[key]; !taken {
+					index.byKey[key] = region
+				}
+				if _, taken := index.byTypeKey[regionType][key]; !taken {
+					index.byTypeKey[regionType][key] = region
+				}
+				if words := len(strings.Fields(key)); words > index.maxKeyWord {
+					index.maxKeyWord = words
+				}
+			}
+		}
+	}
+
+	return index, nil
+}
+
+// LookupRegion finds a province, city or regency by name or common alias,
+// e.g. "jaksel", "kab. bogor", "Kota Malang" or "jabar"
+func LookupRegion(input string) (Region, bool) {
+	index := loadRegions()
+	key := locationKey(input)
+
+	for _, p := range regionPrefixes {
+		name, ok := strings.CutPrefix(key, p.prefix+" ")
+		if !ok {
+			continue
+		}
+		if region, found := index.byTypeKey[p.regionType][name]; found {
+			return region, true
+		}
+		// "kota baru" is an alias, "kota jakarta" means the province
+		if region, found := index.byKey[key]; found {
+			return region, true
+		}
+		region, found := index.byKey[name]
+		return region, found
+	}
+
+	region, ok := index.byKey[key]
+	return region, ok
+}
+
+// RegionProvinceOf returns the province a normalized location belongs to,
+// or "" if it is unknown or a province itself
+func RegionProvinceOf(location string) string {
+	region, ok := LookupRegion(location)
+	if !ok {
+		return ""
+	}
+	return region.Province
+}
+
+// detectRegion finds the last place mentioned in a chat message. Places that
+// double as ordinary words only count after a cue word like "di" or when the
+// message is nothing but the place.
+func detectRegion(input string) (Region, bool) {
+	index := loadRegions()
+	tokens := words(input)
+
+	var found Region
+	ok := false
+	for i := 0; i < len(tokens); {
+		// "di yogyakarta" is the city, not the province DI Yogyakarta
+		if locationCues[tokens[i]] && !isRegionPrefix(tokens[i]) {
+			i++
+			continue
+		}
+
+		matched := 0
+		// One extra word for prefixes like "kab"
+		for n := min(index.maxKeyWord+1, len(tokens)-i); n > 0; n-- {
+			phrase := strings.Join(tokens[i:i+n], " ")
+			region, hit := LookupRegion(phrase)
+			if !hit {
+				continue
+			}
+
+			cued := (i > 0 && locationCues[tokens[i-1]]) || isRegionPrefix(tokens[i])
+			if cued || wellKnownLocations[phrase] || n == len(tokens) {
+				found, ok = region, true
+			}
+			matched = n
+			break
+		}
+
+		if matched == 0 {
+			matched = 1
+		}
+		i += matched
+	}
+
+	return found, ok
+}
+
+func isRegionPrefix(word string) bool {
+	for _, p := range regionPrefixes {
+		if word == p.prefix {
+			return true
+		}
+	}
+	return false
+}
+
+// locationKey is the lookup form of a place name: lower case, single spaces,
+// no dots or hyphens
+func locationKey(name string) string {
+	name = strings.ToLower(name)
+	name = strings.NewReplacer(".", " ", "-", " ").Replace(name)
+	return strings.Join(strings.Fields(name), " ")
+}